@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// takeoutArchives returns the Takeout archives -dir names: one archive, a
+// comma-separated list of them or a glob pattern such as "takeout-*", whose matches
+// other than archives (the extraction folder, say) are left out. It returns nil when
+// -dir names no archives, so it is checked as a folder.
+func takeoutArchives(dir string) ([]string, error) {
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return nil, nil
+	}
+	var archives []string
+	for _, entry := range splitList(dir) {
+		if !strings.ContainsAny(entry, "*?[") {
+			if !processor.IsTakeoutArchive(entry) {
+				return nil, nil
+			}
+			archives = append(archives, entry)
+			continue
+		}
+		matches, _ := filepath.Glob(entry)
+		found := false
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() && processor.IsTakeoutArchive(match) {
+				archives = append(archives, match)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no .zip, .tgz or .tar.gz archives match %s", entry)
+		}
+	}
+	for _, archive := range archives {
+		if _, err := os.Stat(archive); err != nil {
+			return nil, err
+		}
+	}
+	return archives, nil
+}
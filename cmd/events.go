@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// eventLine is one line of the -events stream
+type eventLine struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Path       string    `json:"path,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	SkipReason string    `json:"skipReason,omitempty"`
+	Output     string    `json:"output,omitempty"`
+	Message    string    `json:"message,omitempty"`
+}
+
+// streamEvents writes the events of the run to path as JSON lines, for front-ends and
+// bots that follow the progress instead of parsing stdout. It must be called before
+// the run starts; the returned function waits until the last event is written.
+func streamEvents(p *processor.Processor, path string) (func(), error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create events file: %w", err)
+	}
+	events := p.Events()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		failed := false
+		// The channel is drained to the end even when writing fails, so the run never waits on it
+		for event := range events {
+			if failed {
+				continue
+			}
+			line := eventLine{Type: event.Type, Time: event.Time.UTC(), Path: event.Path, Message: event.Message}
+			if event.Result != nil {
+				line.Status, line.SkipReason, line.Output = event.Result.Status, event.Result.SkipReason, event.Result.Output
+			}
+			if err := enc.Encode(line); err != nil {
+				fmt.Printf("[ERROR] Failed to write events to %s: %v\n", path, err)
+				failed = true
+			}
+		}
+	}()
+	return func() { <-done }, nil
+}
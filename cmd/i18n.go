@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// translations holds the summary, plan and prompt texts in each supported language,
+// keyed by the English text without surrounding whitespace. Log lines tagged like
+// [ERROR] and file details stay in English so they can be searched and shared.
+var translations = map[string]map[string]string{
+	"de": {
+		"Starting Google Takeout EXIF metadata processor": "Google Takeout EXIF-Metadatenverarbeitung wird gestartet",
+		"Directory: %s":                                             "Verzeichnis: %s",
+		"Merged export: %s":                                         "Zusammengeführter Export: %s",
+		"Output: %s":                                                "Ausgabe: %s",
+		"Relocated library: %s":                                     "Verschobene Bibliothek: %s",
+		"Manifest: %s":                                              "Manifest: %s",
+		"Dry Run: %v":                                               "Testlauf: %v",
+		"Verbose: %v":                                               "Ausführlich: %v",
+		"Retrying %d failed files from %s":                          "%d fehlgeschlagene Dateien aus %s werden erneut versucht",
+		"=== Planned Changes ===":                                   "=== Geplante Änderungen ===",
+		"Files found: %d":                                           "Gefundene Dateien: %d",
+		"Media files: %d (%d images, %d videos)":                    "Mediendateien: %d (%d Bilder, %d Videos)",
+		"Media files with JSON metadata: %d":                        "Mediendateien mit JSON-Metadaten: %d",
+		"No files will be modified.":                                "Es werden keine Dateien geändert.",
+		"This run will:":                                            "Dieser Lauf wird:",
+		"Proceed? [y/N]:":                                           "Fortfahren? [j/N]:",
+		"Aborted, no files were modified.":                          "Abgebrochen, es wurden keine Dateien geändert.",
+		"Report written to: %s":                                     "Bericht geschrieben nach: %s",
+		"Batch report written to: %s":                               "Stapelbericht geschrieben nach: %s",
+		"Checksums of %d files written to: %s":                      "Prüfsummen von %d Dateien geschrieben nach: %s",
+		"%d oversized videos listed in: %s":                         "%d zu große Videos aufgelistet in: %s",
+		"Extracted %d files from %d archives into %s":               "%d Dateien aus %d Archiven entpackt nach %s",
+		"Would extract %d files from %d archives into %s":           "Würde %d Dateien aus %d Archiven nach %s entpacken",
+		"Run without -dry-run to extract them.":                     "Ohne -dry-run ausführen, um sie zu entpacken.",
+		"%d files repacked into: %s":                                "%d Dateien neu gepackt in: %s",
+		"=== Processing Complete ===":                               "=== Verarbeitung abgeschlossen ===",
+		"Total files scanned: %d":                                   "Durchsuchte Dateien insgesamt: %d",
+		"- Media files: %d":                                         "- Mediendateien: %d",
+		"- JSON sidecars: %d":                                       "- JSON-Dateien: %d",
+		"- Other files: %d":                                         "- Andere Dateien: %d",
+		"JSON metadata files found: %d":                             "Gefundene JSON-Metadatendateien: %d",
+		"Media files processed: %d":                                 "Verarbeitete Mediendateien: %d",
+		"- Modified: %d":                                            "- Geändert: %d",
+		"- Already up-to-date: %d":                                  "- Bereits aktuell: %d",
+		"Files skipped: %d":                                         "Übersprungene Dateien: %d",
+		"- No JSON sidecar: %d":                                     "- Ohne JSON-Sidecar: %d",
+		"- Unsupported file type: %d":                               "- Nicht unterstützter Dateityp: %d",
+		"- Not a media file: %d":                                    "- Keine Mediendatei: %d",
+		"- Not in the selected albums: %d":                          "- Nicht in den gewählten Alben: %d",
+		"- Already processed: %d":                                   "- Bereits verarbeitet: %d",
+		"- In the trash: %d":                                        "- Im Papierkorb: %d",
+		"- Duplicate copies: %d":                                    "- Doppelte Kopien: %d",
+		"- Outside the export: %d":                                  "- Außerhalb des Exports: %d",
+		"- Suspected wrong match: %d":                               "- Vermutlich falsch zugeordnet: %d",
+		"- Unreadable sidecar: %d":                                  "- Unlesbarer Sidecar: %d",
+		"- Not found in the library: %d":                            "- Nicht in der Bibliothek gefunden: %d",
+		"- Nested zip archives: %d":                                 "- Verschachtelte ZIP-Archive: %d",
+		"- Parts of split videos: %d":                               "- Teile geteilter Videos: %d",
+		"- Corrupt or truncated: %d":                                "- Beschädigt oder abgeschnitten: %d",
+		"- Videos over the size limit: %d":                          "- Videos über der Größengrenze: %d",
+		"Non-media files ignored (HTML, CSV, ...): %d":              "Ignorierte Nicht-Mediendateien (HTML, CSV, ...): %d",
+		"Bytes added by native EXIF insertion: %d":                  "Durch natives EXIF-Einfügen hinzugefügte Bytes: %d",
+		"File times synced from EXIF: %d":                           "Aus EXIF übernommene Dateizeiten: %d",
+		"Sidecars in older formats: %d":                             "Sidecars in älteren Formaten: %d",
+		"Picasa entries merged: %d":                                 "Übernommene Picasa-Einträge: %d",
+		"Partner-shared items: %d":                                  "Vom Partner geteilte Elemente: %d",
+		"Google Photos creations: %d":                               "Von Google Fotos erstellt: %d",
+		"Corrupt or truncated files: %d":                            "Beschädigte oder abgeschnittene Dateien: %d",
+		"MPEG transport streams (.ts, .mts, .m2ts): %d":             "MPEG-Transportströme (.ts, .mts, .m2ts): %d",
+		"Videos over -max-video-size (skipped): %d":                 "Videos über -max-video-size (übersprungen): %d",
+		"Copies cloned (copy-on-write): %d":                         "Geklonte Kopien (Copy-on-Write): %d",
+		"Files hardlinked to the export: %d":                        "Per Hardlink mit dem Export verknüpfte Dateien: %d",
+		"Writes that did not read back (-verify-writes): %d":        "Schreibvorgänge, die nicht zurückgelesen werden konnten (-verify-writes): %d",
+		"Taken/creation time conflicts: %d":                         "Konflikte zwischen Aufnahme- und Erstellungszeit: %d",
+		"Suspected wrong matches (not applied): %d":                 "Vermutlich falsche Zuordnungen (nicht angewendet): %d",
+		"Incomplete albums: %d":                                     "Unvollständige Alben: %d",
+		"Merge conflicts between exports: %d":                       "Konflikte zwischen Exporten: %d",
+		"Duplicates (not reorganized): %d":                          "Duplikate (nicht einsortiert): %d",
+		"Files reorganized: %d":                                     "Einsortierte Dateien: %d",
+		"Verification failures: %d":                                 "Fehlgeschlagene Prüfungen: %d",
+		"Errors encountered: %d":                                    "Aufgetretene Fehler: %d",
+		"Elapsed: %s":                                               "Dauer: %s",
+		"=== Time and IO per Stage ===":                             "=== Zeit und Datenmenge pro Phase ===",
+		"=== Estimated Run Time ===":                                "=== Geschätzte Laufzeit ===",
+		"This run will take about %s with %d workers":               "Dieser Lauf dauert etwa %s mit %d Workern",
+		"=== Folders ===":                                           "=== Ordner ===",
+		"=== Modified Files ===":                                    "=== Geänderte Dateien ===",
+		"=== Unchanged Files (Already Had Matching EXIF) ===":       "=== Unveränderte Dateien (EXIF bereits passend) ===",
+		"=== Sidecar Matches ===":                                   "=== Zuordnung der JSON-Dateien ===",
+		"=== Taken/Creation Time Conflicts ===":                     "=== Konflikte zwischen Aufnahme- und Erstellungszeit ===",
+		"=== Suspected Wrong Matches (use -force to apply) ===":     "=== Vermutlich falsche Zuordnungen (mit -force anwenden) ===",
+		"=== Incomplete Albums ===":                                 "=== Unvollständige Alben ===",
+		"=== Merge Conflicts ===":                                   "=== Konflikte zwischen Exporten ===",
+		"=== Slowest Files ===":                                     "=== Langsamste Dateien ===",
+		"=== Videos Over -max-video-size (not processed) ===":       "=== Videos über -max-video-size (nicht verarbeitet) ===",
+		"=== Errors ===":                                            "=== Fehler ===",
+		"=== Duplicates ===":                                        "=== Duplikate ===",
+		"=== Verification Failures ===":                             "=== Fehlgeschlagene Prüfungen ===",
+		"=== Archive Index ===":                                     "=== Archivindex ===",
+		"=== Skipped: Outside Takeout Root ===":                     "=== Übersprungen: außerhalb des Takeout-Ordners ===",
+		"=== UTC Offset Audit ===":                                  "=== Prüfung der UTC-Abweichung ===",
+		"=== Albums ===":                                            "=== Alben ===",
+		"The sample and its results are in %s; delete it when done": "Die Stichprobe und ihre Ergebnisse liegen in %s; danach bitte löschen",
+	},
+	"es": {
+		"Starting Google Takeout EXIF metadata processor": "Iniciando el procesador de metadatos EXIF de Google Takeout",
+		"Directory: %s":                                             "Directorio: %s",
+		"Merged export: %s":                                         "Exportación combinada: %s",
+		"Output: %s":                                                "Salida: %s",
+		"Relocated library: %s":                                     "Biblioteca reubicada: %s",
+		"Manifest: %s":                                              "Manifiesto: %s",
+		"Dry Run: %v":                                               "Simulación: %v",
+		"Verbose: %v":                                               "Detallado: %v",
+		"Retrying %d failed files from %s":                          "Reintentando %d archivos fallidos de %s",
+		"=== Planned Changes ===":                                   "=== Cambios previstos ===",
+		"Files found: %d":                                           "Archivos encontrados: %d",
+		"Media files: %d (%d images, %d videos)":                    "Archivos multimedia: %d (%d imágenes, %d vídeos)",
+		"Media files with JSON metadata: %d":                        "Archivos multimedia con metadatos JSON: %d",
+		"No files will be modified.":                                "No se modificará ningún archivo.",
+		"This run will:":                                            "Esta ejecución va a:",
+		"Proceed? [y/N]:":                                           "¿Continuar? [s/N]:",
+		"Aborted, no files were modified.":                          "Cancelado, no se modificó ningún archivo.",
+		"Report written to: %s":                                     "Informe guardado en: %s",
+		"Batch report written to: %s":                               "Informe del lote guardado en: %s",
+		"Checksums of %d files written to: %s":                      "Sumas de comprobación de %d archivos guardadas en: %s",
+		"%d oversized videos listed in: %s":                         "%d vídeos demasiado grandes listados en: %s",
+		"Extracted %d files from %d archives into %s":               "%d archivos extraídos de %d archivos comprimidos en %s",
+		"Would extract %d files from %d archives into %s":           "Se extraerían %d archivos de %d archivos comprimidos en %s",
+		"Run without -dry-run to extract them.":                     "Ejecute sin -dry-run para extraerlos.",
+		"%d files repacked into: %s":                                "%d archivos empaquetados de nuevo en: %s",
+		"=== Processing Complete ===":                               "=== Procesamiento completado ===",
+		"Total files scanned: %d":                                   "Archivos analizados en total: %d",
+		"- Media files: %d":                                         "- Archivos multimedia: %d",
+		"- JSON sidecars: %d":                                       "- Archivos JSON: %d",
+		"- Other files: %d":                                         "- Otros archivos: %d",
+		"JSON metadata files found: %d":                             "Archivos de metadatos JSON encontrados: %d",
+		"Media files processed: %d":                                 "Archivos multimedia procesados: %d",
+		"- Modified: %d":                                            "- Modificados: %d",
+		"- Already up-to-date: %d":                                  "- Ya actualizados: %d",
+		"Files skipped: %d":                                         "Archivos omitidos: %d",
+		"- No JSON sidecar: %d":                                     "- Sin archivo JSON: %d",
+		"- Unsupported file type: %d":                               "- Tipo de archivo no compatible: %d",
+		"- Not a media file: %d":                                    "- No es un archivo multimedia: %d",
+		"- Not in the selected albums: %d":                          "- Fuera de los álbumes elegidos: %d",
+		"- Already processed: %d":                                   "- Ya procesados: %d",
+		"- In the trash: %d":                                        "- En la papelera: %d",
+		"- Duplicate copies: %d":                                    "- Copias duplicadas: %d",
+		"- Outside the export: %d":                                  "- Fuera de la exportación: %d",
+		"- Suspected wrong match: %d":                               "- Posible asignación errónea: %d",
+		"- Unreadable sidecar: %d":                                  "- Archivo JSON ilegible: %d",
+		"- Not found in the library: %d":                            "- No encontrados en la biblioteca: %d",
+		"- Nested zip archives: %d":                                 "- Archivos zip anidados: %d",
+		"- Parts of split videos: %d":                               "- Partes de vídeos divididos: %d",
+		"- Corrupt or truncated: %d":                                "- Dañados o truncados: %d",
+		"- Videos over the size limit: %d":                          "- Vídeos por encima del límite: %d",
+		"Non-media files ignored (HTML, CSV, ...): %d":              "Archivos no multimedia ignorados (HTML, CSV, ...): %d",
+		"Bytes added by native EXIF insertion: %d":                  "Bytes añadidos por la inserción EXIF nativa: %d",
+		"File times synced from EXIF: %d":                           "Fechas de archivo tomadas de EXIF: %d",
+		"Sidecars in older formats: %d":                             "Sidecars en formatos antiguos: %d",
+		"Picasa entries merged: %d":                                 "Entradas de Picasa combinadas: %d",
+		"Partner-shared items: %d":                                  "Elementos compartidos por la pareja: %d",
+		"Google Photos creations: %d":                               "Creaciones de Google Fotos: %d",
+		"Corrupt or truncated files: %d":                            "Archivos dañados o truncados: %d",
+		"MPEG transport streams (.ts, .mts, .m2ts): %d":             "Flujos de transporte MPEG (.ts, .mts, .m2ts): %d",
+		"Videos over -max-video-size (skipped): %d":                 "Vídeos por encima de -max-video-size (omitidos): %d",
+		"Copies cloned (copy-on-write): %d":                         "Copias clonadas (copy-on-write): %d",
+		"Files hardlinked to the export: %d":                        "Archivos enlazados (hardlink) a la exportación: %d",
+		"Writes that did not read back (-verify-writes): %d":        "Escrituras que no se pudieron releer (-verify-writes): %d",
+		"Taken/creation time conflicts: %d":                         "Conflictos entre fecha de captura y de creación: %d",
+		"Suspected wrong matches (not applied): %d":                 "Posibles asociaciones erróneas (no aplicadas): %d",
+		"Incomplete albums: %d":                                     "Álbumes incompletos: %d",
+		"Merge conflicts between exports: %d":                       "Conflictos entre exportaciones: %d",
+		"Duplicates (not reorganized): %d":                          "Duplicados (no reorganizados): %d",
+		"Files reorganized: %d":                                     "Archivos reorganizados: %d",
+		"Verification failures: %d":                                 "Verificaciones fallidas: %d",
+		"Errors encountered: %d":                                    "Errores encontrados: %d",
+		"Elapsed: %s":                                               "Tiempo total: %s",
+		"=== Time and IO per Stage ===":                             "=== Tiempo y datos por fase ===",
+		"=== Estimated Run Time ===":                                "=== Tiempo estimado ===",
+		"This run will take about %s with %d workers":               "Esta ejecución tardará unos %s con %d procesos",
+		"=== Folders ===":                                           "=== Carpetas ===",
+		"=== Modified Files ===":                                    "=== Archivos modificados ===",
+		"=== Unchanged Files (Already Had Matching EXIF) ===":       "=== Archivos sin cambios (EXIF ya coincidía) ===",
+		"=== Sidecar Matches ===":                                   "=== Asociación de archivos JSON ===",
+		"=== Taken/Creation Time Conflicts ===":                     "=== Conflictos entre fecha de captura y de creación ===",
+		"=== Suspected Wrong Matches (use -force to apply) ===":     "=== Posibles asociaciones erróneas (use -force para aplicarlas) ===",
+		"=== Incomplete Albums ===":                                 "=== Álbumes incompletos ===",
+		"=== Merge Conflicts ===":                                   "=== Conflictos entre exportaciones ===",
+		"=== Slowest Files ===":                                     "=== Archivos más lentos ===",
+		"=== Videos Over -max-video-size (not processed) ===":       "=== Vídeos por encima de -max-video-size (no procesados) ===",
+		"=== Errors ===":                                            "=== Errores ===",
+		"=== Duplicates ===":                                        "=== Duplicados ===",
+		"=== Verification Failures ===":                             "=== Verificaciones fallidas ===",
+		"=== Archive Index ===":                                     "=== Índice del archivo ===",
+		"=== Skipped: Outside Takeout Root ===":                     "=== Omitidos: fuera de la carpeta de Takeout ===",
+		"=== UTC Offset Audit ===":                                  "=== Revisión del desfase UTC ===",
+		"=== Albums ===":                                            "=== Álbumes ===",
+		"The sample and its results are in %s; delete it when done": "La muestra y sus resultados están en %s; bórrela al terminar",
+	},
+	"fr": {
+		"Starting Google Takeout EXIF metadata processor": "Démarrage du traitement des métadonnées EXIF Google Takeout",
+		"Directory: %s":                                             "Dossier : %s",
+		"Merged export: %s":                                         "Export fusionné : %s",
+		"Output: %s":                                                "Sortie : %s",
+		"Relocated library: %s":                                     "Bibliothèque déplacée : %s",
+		"Manifest: %s":                                              "Manifeste : %s",
+		"Dry Run: %v":                                               "Simulation : %v",
+		"Verbose: %v":                                               "Détaillé : %v",
+		"Retrying %d failed files from %s":                          "Nouvel essai de %d fichiers en échec depuis %s",
+		"=== Planned Changes ===":                                   "=== Modifications prévues ===",
+		"Files found: %d":                                           "Fichiers trouvés : %d",
+		"Media files: %d (%d images, %d videos)":                    "Fichiers multimédias : %d (%d images, %d vidéos)",
+		"Media files with JSON metadata: %d":                        "Fichiers multimédias avec métadonnées JSON : %d",
+		"No files will be modified.":                                "Aucun fichier ne sera modifié.",
+		"This run will:":                                            "Cette exécution va :",
+		"Proceed? [y/N]:":                                           "Continuer ? [o/N] :",
+		"Aborted, no files were modified.":                          "Annulé, aucun fichier n'a été modifié.",
+		"Report written to: %s":                                     "Rapport enregistré dans : %s",
+		"Batch report written to: %s":                               "Rapport du lot enregistré dans : %s",
+		"Checksums of %d files written to: %s":                      "Sommes de contrôle de %d fichiers enregistrées dans : %s",
+		"%d oversized videos listed in: %s":                         "%d vidéos trop volumineuses listées dans : %s",
+		"Extracted %d files from %d archives into %s":               "%d fichiers extraits de %d archives dans %s",
+		"Would extract %d files from %d archives into %s":           "%d fichiers seraient extraits de %d archives dans %s",
+		"Run without -dry-run to extract them.":                     "Relancez sans -dry-run pour les extraire.",
+		"%d files repacked into: %s":                                "%d fichiers réempaquetés dans : %s",
+		"=== Processing Complete ===":                               "=== Traitement terminé ===",
+		"Total files scanned: %d":                                   "Fichiers analysés au total : %d",
+		"- Media files: %d":                                         "- Fichiers multimédias : %d",
+		"- JSON sidecars: %d":                                       "- Fichiers JSON : %d",
+		"- Other files: %d":                                         "- Autres fichiers : %d",
+		"JSON metadata files found: %d":                             "Fichiers de métadonnées JSON trouvés : %d",
+		"Media files processed: %d":                                 "Fichiers multimédias traités : %d",
+		"- Modified: %d":                                            "- Modifiés : %d",
+		"- Already up-to-date: %d":                                  "- Déjà à jour : %d",
+		"Files skipped: %d":                                         "Fichiers ignorés : %d",
+		"- No JSON sidecar: %d":                                     "- Sans fichier JSON : %d",
+		"- Unsupported file type: %d":                               "- Type de fichier non pris en charge : %d",
+		"- Not a media file: %d":                                    "- Pas un fichier multimédia : %d",
+		"- Not in the selected albums: %d":                          "- Hors des albums choisis : %d",
+		"- Already processed: %d":                                   "- Déjà traités : %d",
+		"- In the trash: %d":                                        "- Dans la corbeille : %d",
+		"- Duplicate copies: %d":                                    "- Copies en double : %d",
+		"- Outside the export: %d":                                  "- Hors de l'export : %d",
+		"- Suspected wrong match: %d":                               "- Correspondance douteuse : %d",
+		"- Unreadable sidecar: %d":                                  "- Fichier JSON illisible : %d",
+		"- Not found in the library: %d":                            "- Introuvables dans la bibliothèque : %d",
+		"- Nested zip archives: %d":                                 "- Archives zip imbriquées : %d",
+		"- Parts of split videos: %d":                               "- Parties de vidéos scindées : %d",
+		"- Corrupt or truncated: %d":                                "- Corrompus ou tronqués : %d",
+		"- Videos over the size limit: %d":                          "- Vidéos au-delà de la limite : %d",
+		"Non-media files ignored (HTML, CSV, ...): %d":              "Fichiers non multimédias ignorés (HTML, CSV, ...) : %d",
+		"Bytes added by native EXIF insertion: %d":                  "Octets ajoutés par l'insertion EXIF native : %d",
+		"File times synced from EXIF: %d":                           "Dates de fichier reprises de l'EXIF : %d",
+		"Sidecars in older formats: %d":                             "Sidecars dans des formats anciens : %d",
+		"Picasa entries merged: %d":                                 "Entrées Picasa fusionnées : %d",
+		"Partner-shared items: %d":                                  "Éléments partagés par le partenaire : %d",
+		"Google Photos creations: %d":                               "Créations de Google Photos : %d",
+		"Corrupt or truncated files: %d":                            "Fichiers corrompus ou tronqués : %d",
+		"MPEG transport streams (.ts, .mts, .m2ts): %d":             "Flux de transport MPEG (.ts, .mts, .m2ts) : %d",
+		"Videos over -max-video-size (skipped): %d":                 "Vidéos au-delà de -max-video-size (ignorées) : %d",
+		"Copies cloned (copy-on-write): %d":                         "Copies clonées (copy-on-write) : %d",
+		"Files hardlinked to the export: %d":                        "Fichiers liés (hardlink) à l'export : %d",
+		"Writes that did not read back (-verify-writes): %d":        "Écritures non confirmées à la relecture (-verify-writes) : %d",
+		"Taken/creation time conflicts: %d":                         "Conflits entre date de prise de vue et de création : %d",
+		"Suspected wrong matches (not applied): %d":                 "Associations probablement erronées (non appliquées) : %d",
+		"Incomplete albums: %d":                                     "Albums incomplets : %d",
+		"Merge conflicts between exports: %d":                       "Conflits entre exports : %d",
+		"Duplicates (not reorganized): %d":                          "Doublons (non réorganisés) : %d",
+		"Files reorganized: %d":                                     "Fichiers réorganisés : %d",
+		"Verification failures: %d":                                 "Échecs de vérification : %d",
+		"Errors encountered: %d":                                    "Erreurs rencontrées : %d",
+		"Elapsed: %s":                                               "Durée : %s",
+		"=== Time and IO per Stage ===":                             "=== Temps et volume par étape ===",
+		"=== Estimated Run Time ===":                                "=== Durée estimée ===",
+		"This run will take about %s with %d workers":               "Cette exécution prendra environ %s avec %d processus",
+		"=== Folders ===":                                           "=== Dossiers ===",
+		"=== Modified Files ===":                                    "=== Fichiers modifiés ===",
+		"=== Unchanged Files (Already Had Matching EXIF) ===":       "=== Fichiers inchangés (EXIF déjà correct) ===",
+		"=== Sidecar Matches ===":                                   "=== Association des fichiers JSON ===",
+		"=== Taken/Creation Time Conflicts ===":                     "=== Conflits entre date de prise de vue et de création ===",
+		"=== Suspected Wrong Matches (use -force to apply) ===":     "=== Associations probablement erronées (-force pour les appliquer) ===",
+		"=== Incomplete Albums ===":                                 "=== Albums incomplets ===",
+		"=== Merge Conflicts ===":                                   "=== Conflits entre exports ===",
+		"=== Slowest Files ===":                                     "=== Fichiers les plus lents ===",
+		"=== Videos Over -max-video-size (not processed) ===":       "=== Vidéos au-delà de -max-video-size (non traitées) ===",
+		"=== Errors ===":                                            "=== Erreurs ===",
+		"=== Duplicates ===":                                        "=== Doublons ===",
+		"=== Verification Failures ===":                             "=== Échecs de vérification ===",
+		"=== Archive Index ===":                                     "=== Index de l'archive ===",
+		"=== Skipped: Outside Takeout Root ===":                     "=== Ignorés : hors du dossier Takeout ===",
+		"=== UTC Offset Audit ===":                                  "=== Contrôle du décalage UTC ===",
+		"=== Albums ===":                                            "=== Albums ===",
+		"The sample and its results are in %s; delete it when done": "L'échantillon et ses résultats sont dans %s ; supprimez-le ensuite",
+	},
+}
+
+// yesAnswers are the answers accepted by confirm in each language besides "y" and "yes"
+var yesAnswers = map[string][]string{
+	"de": {"j", "ja"},
+	"es": {"s", "si", "sí"},
+	"fr": {"o", "oui"},
+}
+
+// language is the language of the summary and prompts; "en" or a key of translations
+var language = "en"
+
+// setLanguage selects the output language. An empty lang is detected from the
+// LC_ALL, LC_MESSAGES and LANG environment variables, falling back to English for
+// locales without a translation; an explicit but unsupported lang is an error.
+func setLanguage(lang string) error {
+	if lang == "" {
+		if detected := detectLanguage(); translations[detected] != nil {
+			language = detected
+		}
+		return nil
+	}
+	lang = strings.ToLower(lang)
+	if lang != "en" && translations[lang] == nil {
+		return fmt.Errorf("unsupported language %q (expected %s)", lang, strings.Join(supportedLanguages(), ", "))
+	}
+	language = lang
+	return nil
+}
+
+// detectLanguage returns the language code of the first locale variable that is set,
+// e.g. "de" for "de_DE.UTF-8"
+func detectLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" {
+			continue
+		}
+		if i := strings.IndexAny(locale, "_.@-"); i >= 0 {
+			locale = locale[:i]
+		}
+		return strings.ToLower(locale)
+	}
+	return "en"
+}
+
+// supportedLanguages lists the accepted -lang values
+func supportedLanguages() []string {
+	langs := []string{"en"}
+	for lang := range translations {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs[1:])
+	return langs
+}
+
+// tr translates a summary or prompt text, keeping its leading and trailing whitespace.
+// Texts without a translation are returned unchanged.
+func tr(text string) string {
+	key := strings.TrimSpace(text)
+	translated, ok := translations[language][key]
+	if !ok {
+		return text
+	}
+	start := strings.Index(text, key)
+	return text[:start] + translated + text[start+len(key):]
+}
+
+// isYes reports whether a lower-cased answer to confirm means yes
+func isYes(answer string) bool {
+	if answer == "y" || answer == "yes" {
+		return true
+	}
+	for _, yes := range yesAnswers[language] {
+		if answer == yes {
+			return true
+		}
+	}
+	return false
+}
@@ -1,30 +1,475 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"google-takeout-exif-applier/internal/config"
+	"google-takeout-exif-applier/internal/manifest"
+	"google-takeout-exif-applier/internal/metadata"
 	"google-takeout-exif-applier/internal/processor"
+	"google-takeout-exif-applier/internal/report"
 )
 
+// lowMemoryLimit is the Go heap limit for -low-memory, leaving room for exiftool and
+// ffmpeg on a 512MB device; GOMEMLIMIT overrides it
+const lowMemoryLimit = 256 << 20
+
+// lowMatchExitCode is the exit status with -fail-on-low-match when too few media
+// files had a sidecar; 1 stays for errors
+const lowMatchExitCode = 3
+
+// minMatchRateFiles is how many media files a run needs before its match rate is
+// checked, since a few files without sidecars say nothing about the export
+const minMatchRateFiles = 20
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		os.Exit(runReportCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "scan" {
+		os.Exit(runScanCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "undo-renames" {
+		os.Exit(runUndoRenamesCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export-manifest" {
+		os.Exit(runExportManifestCommand(os.Args[2:]))
+	}
+	// apply-manifest is a normal run taking its metadata from a manifest, so it
+	// shares all of the run's flags
+	args, manifestPath := os.Args[1:], ""
+	if len(args) > 0 && args[0] == "apply-manifest" {
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			fmt.Println("Usage: google-takeout-exif-applier apply-manifest <manifest.jsonl.gz> -dir <library> [options]")
+			os.Exit(1)
+		}
+		args, manifestPath = args[2:], args[1]
+	}
+
 	rootDir := flag.String("dir", "", "Root directory of Google Takeout folder")
+	configPath := flag.String("config", "", "Path to a JSON configuration file")
 	dryRun := flag.Bool("dry-run", false, "Perform a dry run without modifying files")
 	verbose := flag.Bool("verbose", false, "Enable verbose logging")
-	flag.Parse()
+	outputDir := flag.String("output", "", "Write processed copies under this directory and leave the export untouched")
+	quarantineDir := flag.String("quarantine", "", "Move empty or truncated media files under this directory (copy them with -output)")
+	relocatedDir := flag.String("relocated", "", "Write the metadata to the copies of the media files in this library instead of to the export")
+	relocatedMatch := flag.String("relocated-match", "name-size", "How -relocated finds the copies: name-size or hash (SHA-256)")
+	outputMode := flag.String("output-mode", processor.OutputCopy, "How -output creates its files: copy, or hardlink to link the files that need no changes")
+	normalizeNames := flag.Bool("normalize-names", false, "With -output, clean up file names (drop \"(1)\", replace look-alike Unicode characters)")
+	nameTemplate := flag.String("name-template", "", "With -output, name copies from their metadata, e.g. {yyyy}{mm}{dd}_{hhmmss}_{original}")
+	renameToTitle := flag.Bool("rename-to-title", false, "Rename media with generated names (UUIDs, hashes) to the title in their JSON")
+	renameJournal := flag.String("rename-journal", "takeout-renames.jsonl", "Journal of the renames made by -rename-to-title, for \"undo-renames\"")
+	videoXMP := flag.Bool("video-xmp", false, "Write .xmp sidecars for videos instead of remuxing them")
+	stripGoogleXMP := flag.Bool("strip-google-xmp", false, "Remove Google's edit history and editing breadcrumbs from the XMP of images, keeping motion photo, panorama and depth data")
+	inPlace := flag.Bool("in-place", false, "Overwrite files in place instead of replacing them, keeping hardlinks and snapshot sharing intact")
+	fastStart := flag.Bool("faststart", false, "Move the moov index of remuxed MP4/MOV files to the front for streaming")
+	writeOrigin := flag.Bool("write-origin", false, "Record the Takeout device/app origin in UserComment (images) or xmp:CreatorTool (XMP sidecars)")
+	partnerDir := flag.String("partner-dir", "", "Move items shared by your Google Photos partner under this directory")
+	partnerTag := flag.Bool("partner-tag", false, "Tag partner-shared items with a \"Partner: <name>\" keyword")
+	partnerName := flag.String("partner-name", "", "Partner name to use when it cannot be parsed from the folder structure")
+	yes := flag.Bool("yes", false, "Skip the confirmation prompt (unattended mode)")
+	flag.BoolVar(yes, "no-confirm", false, "Alias for -yes")
+	fileTimeout := flag.Duration("file-timeout", 0, "Give up on a file whose metadata write takes longer than this (e.g. 5m; 0 = no limit)")
+	maxErrors := flag.Int("max-errors", 0, "Abort the run after this many errors (0 = no limit)")
+	minMatchRate := flag.Int("min-match-rate", 80, "Warn when fewer than this percent of the media files had a JSON sidecar (0 = off)")
+	failOnLowMatch := flag.Bool("fail-on-low-match", false, "Exit with status 3 when the -min-match-rate check fails")
+	order := flag.String("order", "path", "Processing order: path, size or oldest-first")
+	priority := flag.String("priority", "", "Comma-separated album folder names to process first")
+	mergeDirs := flag.String("merge", "", "Comma-separated other Takeout exports of the same library to process together with -dir")
+	matchMode := flag.String("match", "normal", "Sidecar matching: strict (documented names only), normal or aggressive (adds title and fuzzy matching)")
+	jsonRoot := flag.String("json-root", "", "Also look for sidecars in this directory tree mirroring the export's folders")
+	force := flag.Bool("force", false, "Apply sidecars even when their JSON title does not match the media file name")
+	conflictRule := flag.String("conflict", "newest", "Which copy wins when a photo is in several exports: newest or gps")
+	albums := flag.String("album", "", "Comma-separated album names or globs to process (default: all)")
+	albumAsKeyword := flag.Bool("album-as-keyword", false, "Add the album title (or album folder name) as a keyword on member photos")
+	sharedComments := flag.String("shared-comments", "", "Keep shared album likes and comments: xmp, or text for a .comments.txt file next to each photo")
+	tagCreations := flag.Bool("tag-creations", false, "Add a \"Google Photos creation\" keyword to collages, animations and effects made by Google Photos")
+	labelKeywords := flag.Bool("label-keywords", false, "Add the names from the JSON people, tags and labels fields as keywords")
+	picasa := flag.Bool("picasa", false, "Merge the captions, keywords, stars and face names of .picasa.ini files with the JSON")
+	descriptionTemplate := flag.String("description-template", "", "Template of the written description, e.g. \"{description} — imported from Google Photos {album}\"")
+	faceRegions := flag.Bool("face-regions", false, "Write the face rectangles from .picasa.ini files or the JSON as MWG regions")
+	albumKeywords := flag.Bool("album-location-keywords", false, "Add album location enrichments as keywords on member photos")
+	timePolicy := flag.String("time-policy", "taken", "Timestamp to write when taken and creation times conflict: taken, creation or earliest")
+	timeThreshold := flag.Duration("time-conflict", 0, "Flag files whose taken and creation times differ by more than this (e.g. 720h; 0 = off)")
+	timeShift := flag.String("time-shift", "", "Shift all written timestamps, e.g. +2h37m or -1d")
+	tzAudit := flag.Bool("tz-audit", false, "Report files whose time looks off by whole hours compared to GPS local time")
+	tzCorrect := flag.Bool("tz-correct", false, "Write the GPS-derived local time instead of UTC for flagged files (implies -tz-audit)")
+	marker := flag.Bool("marker", false, "Tag written files with an XMP marker and skip files already tagged, without reading their JSON")
+	auditXMP := flag.Bool("audit-xmp", false, "Embed an XMP audit trail naming the source JSON, export date and tags written")
+	gpsTime := flag.Bool("gps-time", false, "Also write GPSDateStamp/GPSTimeStamp (UTC) for files with GPS data")
+	timeTolerance := flag.Duration("time-tolerance", 0, "Treat existing EXIF times within this window as up-to-date (e.g. 2s, 1m)")
+	reportPath := flag.String("report", "", "Write a JSON report of every file's outcome to this path")
+	eventsPath := flag.String("events", "", "Write the progress of the run (file started, file done, warning, error) to this path as JSON lines")
+	batchBy := flag.String("batch-by", "", "Process in batches by year or album, writing a report and checkpoint after each (requires -report)")
+	checksums := flag.Bool("checksums", false, "Record the SHA-256 of every written file in the -report, for \"report verify\"")
+	sha256Sums := flag.String("sha256sums", "", "After the run, write a SHA256SUMS manifest of every media file in the processed tree to this path")
+	pipeline := flag.String("pipeline", "", "Chain steps after applying the metadata: apply,dedupe,reorganize,verify (any in this order, starting with apply)")
+	reorganizeDir := flag.String("reorganize-dir", "", "Library the pipeline's reorganize step copies the processed files into")
+	reorganizeTemplate := flag.String("reorganize-template", processor.DefaultReorganizeTemplate, "Folders and names of the reorganized copies, with the -name-template fields")
+	filesFrom := flag.String("files-from", "", "Process only the media paths listed in this file (one per line, \"-\" for stdin)")
+	retryFrom := flag.String("retry-from", "", "Re-process only the files that failed in this previous -report file")
+	resume := flag.Bool("resume", false, "Continue the run interrupted in -dir (or -output), skipping the files it completed")
+	watch := flag.Bool("watch", false, "Keep watching the export while it is still being extracted and process folders as they settle")
+	watchInterval := flag.Duration("watch-interval", 10*time.Second, "With -watch, how often to look for new files")
+	watchSettle := flag.Duration("watch-settle", time.Minute, "With -watch, how long a folder must be unchanged before its files are processed")
+	watchIdle := flag.Duration("watch-idle", 0, "With -watch, stop once nothing changed for this long (0 = until interrupted)")
+	syncMTime := flag.Bool("sync-mtime", false, "For media without JSON, set the file time from the embedded EXIF time")
+	extractZips := flag.Bool("extract-zips", false, "Extract zip archives found inside the export next to themselves and process their contents")
+	extractTo := flag.String("extract-to", "", "When -dir names Takeout archives, extract them into this folder (default: next to them, named after them)")
+	repack := flag.String("repack", "", "After the run, write the processed files into this zip archive (the -output folder with -output)")
+	mergeSplit := flag.Bool("merge-split-videos", false, "Join the parts of split videos (VID_part1.mp4, VID_part2.mp4) with ffmpeg before applying metadata")
+	estimateSamples := flag.Int("estimate-samples", 3, "In dry-run, time this many sample writes per file type to estimate the run time (0 = off)")
+	lowMemory := flag.Bool("low-memory", false, "Keep memory use low for small devices (no sidecar cache or detail lists, at most 2 workers)")
+	maxVideoSize := flag.String("max-video-size", "", "Skip videos larger than this, e.g. 4GB, instead of remuxing them (empty = no limit)")
+	oversizedList := flag.String("oversized-list", "", "Write the videos skipped by -max-video-size to this file, for -files-from on another machine")
+	niceIO := flag.Bool("nice-io", false, "Run at idle IO and lowest CPU priority so the machine stays responsive (Linux)")
+	quietHours := flag.String("quiet-hours", "", "Pause or throttle during these local time windows, e.g. \"mon-fri 08:00-18:00,sat 10:00-14:00\"")
+	quietMode := flag.String("quiet-mode", processor.QuietPause, "What to do during -quiet-hours: pause, or throttle to one file at a time with idle gaps")
+	pauseFile := flag.String("pause-file", "", "Pause while this file exists: create it to pause after the files in progress, delete it to resume")
+	writer := flag.String("writer", metadata.WriterAuto, "Metadata writers: auto (exiftool/ffmpeg when installed) or native (built-in JPEG/MP4 writers only)")
+	verifyWrites := flag.Bool("verify-writes", false, "Read the tags back after each write and count the files whose tags don't match as errors")
+	summaryFormat := flag.String("summary-format", summaryText, "Format of the summary after the run: text, or markdown for tables to paste into an issue or forum post")
+	slowest := flag.Int("slowest", 10, "List this many of the files that took longest to process in the summary (0 = none)")
+	minWorkers := flag.Int("min-workers", 1, "Lower bound for worker autoscaling")
+	workers := flag.Int("workers", 0, "Number of files processed at once, the starting size with -max-workers (0 = one per CPU, at least 2)")
+	maxIOPS := flag.Int("max-iops", 0, "Throttle the workers to this many file reads and writes per second (0 = no limit)")
+	bandwidth := flag.String("bandwidth", "", "Throttle the workers to this many bytes read and written per second, e.g. 20MB (empty = no limit)")
+	maxWorkers := flag.Int("max-workers", 0, "Scale workers automatically up to this many (0 = fixed pool sized to the CPU count)")
+	sample := flag.Int("sample", 0, "Copy this many random media files with their sidecars to a temporary directory and process only the copies")
+	legacySupplemental := flag.Bool("legacy-global-supplemental", false, "Merge every field of a folder's supplemental-metadata.json into each file (old behavior)")
+	lang := flag.String("lang", "", "Language of the summary and prompts: en, de, es or fr (default: from the locale)")
+	flag.CommandLine.Parse(args)
+
+	if err := setLanguage(*lang); err != nil {
+		log.Fatalf("Invalid -lang: %v", err)
+	}
 
 	if *rootDir == "" {
 		fmt.Println("Usage: google-takeout-exif-applier -dir <path-to-takeout-folder> [options]")
 		fmt.Println("\nOptions:")
-		fmt.Println("  -dir string      Root directory of Google Takeout folder (required)")
+		fmt.Println("  -dir string      Root directory of Google Takeout folder, or Takeout archives: takeout-001.zip,takeout-002.zip or 'takeout-*.tgz' (required)")
+		fmt.Println("  -config string   Path to a JSON configuration file")
 		fmt.Println("  -dry-run         Perform a dry run without modifying files")
 		fmt.Println("  -verbose         Enable verbose logging")
+		fmt.Println("  -lang string     Language of the summary and prompts: en, de, es or fr (default: from the locale)")
+		fmt.Println("  -report string   Write a JSON report of every file's outcome to this path")
+		fmt.Println("  -events string   Write the progress of the run (file started, file done, warning, error) to this path as JSON lines")
+		fmt.Println("  -batch-by string")
+		fmt.Println("                   Process in batches by year or album, writing a report and checkpoint after each (requires -report)")
+		fmt.Println("  -checksums       Record the SHA-256 of every written file in the -report, for \"report verify\"")
+		fmt.Println("  -sha256sums string")
+		fmt.Println("                   After the run, write a SHA256SUMS manifest of every media file in the processed tree to this path")
+		fmt.Println("  -output string   Write processed copies under this directory and leave the export untouched")
+		fmt.Println("  -output-mode string")
+		fmt.Println("                   How -output creates its files: copy, or hardlink to link the files that need no changes (default \"copy\")")
+		fmt.Println("  -quarantine string")
+		fmt.Println("                   Move empty or truncated media files under this directory (copy them with -output)")
+		fmt.Println("  -relocated string")
+		fmt.Println("                   Write the metadata to the copies of the media files in this library instead of to the export")
+		fmt.Println("  -relocated-match string")
+		fmt.Println("                   How -relocated finds the copies: name-size or hash (SHA-256) (default \"name-size\")")
+		fmt.Println("  -normalize-names With -output, clean up file names (drop \"(1)\", replace look-alike Unicode characters)")
+		fmt.Println("  -sample int      Copy this many random media files with their sidecars to a temporary directory and process only the copies")
+		fmt.Println("  -name-template string")
+		fmt.Println("                   With -output, name copies from their metadata, e.g. {yyyy}{mm}{dd}_{hhmmss}_{original}")
+		fmt.Println("  -rename-to-title Rename media with generated names (UUIDs, hashes) to the title in their JSON")
+		fmt.Println("  -rename-journal string")
+		fmt.Println("                   Journal of the renames made by -rename-to-title, for \"undo-renames\" (default \"takeout-renames.jsonl\")")
+		fmt.Println("  -video-xmp       Write .xmp sidecars for videos instead of remuxing them")
+		fmt.Println("  -faststart       Move the moov index of remuxed MP4/MOV files to the front for streaming")
+		fmt.Println("  -strip-google-xmp")
+		fmt.Println("                   Remove Google's edit history and editing breadcrumbs from the XMP of images, keeping motion photo, panorama and depth data")
+		fmt.Println("  -in-place        Overwrite files in place instead of replacing them (keeps hardlinks; slower, not atomic)")
+		fmt.Println("  -write-origin    Record the Takeout device/app origin in UserComment or xmp:CreatorTool")
+		fmt.Println("  -partner-dir string")
+		fmt.Println("                   Move items shared by your Google Photos partner under this directory")
+		fmt.Println("  -partner-tag     Tag partner-shared items with a \"Partner: <name>\" keyword")
+		fmt.Println("  -partner-name string")
+		fmt.Println("                   Partner name to use when it cannot be parsed from the folder structure")
+		fmt.Println("  -yes, -no-confirm")
+		fmt.Println("                   Skip the confirmation prompt (unattended mode)")
+		fmt.Println("  -time-conflict duration")
+		fmt.Println("                   Flag files whose taken and creation times differ by more than this (e.g. 720h)")
+		fmt.Println("  -time-policy string")
+		fmt.Println("                   Timestamp to write for flagged files: taken, creation or earliest (default \"taken\")")
+		fmt.Println("  -time-shift string")
+		fmt.Println("                   Shift all written timestamps, e.g. +2h37m or -1d")
+		fmt.Println("  -tz-audit        Report files whose time looks off by whole hours compared to GPS local time")
+		fmt.Println("  -tz-correct      Write the GPS-derived local time for flagged files (implies -tz-audit)")
+		fmt.Println("  -marker          Tag written files with an XMP marker and skip files already tagged, without reading their JSON")
+		fmt.Println("  -audit-xmp       Embed an XMP audit trail naming the source JSON, export date and tags written")
+		fmt.Println("  -gps-time        Also write GPSDateStamp/GPSTimeStamp (UTC) for files with GPS data")
+		fmt.Println("  -time-tolerance duration")
+		fmt.Println("                   Treat existing EXIF times within this window as up-to-date (e.g. 2s, 1m)")
+		fmt.Println("  -sync-mtime      For media without JSON, set the file time from the embedded EXIF time")
+		fmt.Println("  -extract-zips    Extract zip archives found inside the export next to themselves and process their contents")
+		fmt.Println("  -extract-to string")
+		fmt.Println("                   When -dir names Takeout archives, extract them into this folder (default: next to them, named after them)")
+		fmt.Println("  -repack string   After the run, write the processed files into this zip archive (the -output folder with -output)")
+		fmt.Println("  -merge-split-videos")
+		fmt.Println("                   Join the parts of split videos (VID_part1.mp4, VID_part2.mp4) with ffmpeg before applying metadata")
+		fmt.Println("  -legacy-global-supplemental")
+		fmt.Println("                   Merge every field of a folder's supplemental-metadata.json into each file")
+		fmt.Println("  -estimate-samples int")
+		fmt.Println("                   In dry-run, time this many sample writes per file type to estimate the run time (default 3)")
+		fmt.Println("  -max-workers int Scale workers automatically up to this many (0 = fixed pool)")
+		fmt.Println("  -min-workers int Lower bound for worker autoscaling (default 1)")
+		fmt.Println("  -workers int     Number of files processed at once, the starting size with -max-workers (0 = one per CPU, at least 2)")
+		fmt.Println("  -max-iops int    Throttle the workers to this many file reads and writes per second (0 = no limit)")
+		fmt.Println("  -bandwidth string")
+		fmt.Println("                   Throttle the workers to this many bytes read and written per second, e.g. 20MB (empty = no limit)")
+		fmt.Println("  -low-memory      Keep memory use low for small devices (no sidecar cache or detail lists, at most 2 workers)")
+		fmt.Println("  -max-video-size string")
+		fmt.Println("                   Skip videos larger than this, e.g. 4GB, instead of remuxing them (empty = no limit)")
+		fmt.Println("  -oversized-list string")
+		fmt.Println("                   Write the videos skipped by -max-video-size to this file, for -files-from on another machine")
+		fmt.Println("  -nice-io         Run at idle IO and lowest CPU priority so the machine stays responsive (Linux)")
+		fmt.Println("  -quiet-hours string")
+		fmt.Println("                   Pause or throttle during these local time windows, e.g. \"mon-fri 08:00-18:00,sat 10:00-14:00\"")
+		fmt.Println("  -quiet-mode string")
+		fmt.Println("                   What to do during -quiet-hours: pause, or throttle to one file at a time with idle gaps (default \"pause\")")
+		fmt.Println("  -pause-file string")
+		fmt.Println("                   Pause while this file exists: create it to pause after the files in progress, delete it to resume")
+		fmt.Println("  -writer string   Metadata writers: auto (exiftool/ffmpeg when installed) or native (built-in JPEG/MP4 writers only) (default \"auto\")")
+		fmt.Println("  -verify-writes   Read the tags back after each write and count the files whose tags don't match as errors")
+		fmt.Println("  -max-errors int  Abort the run after this many errors (0 = no limit)")
+		fmt.Println("  -min-match-rate int")
+		fmt.Println("                   Warn when fewer than this percent of the media files had a JSON sidecar (0 = off) (default 80)")
+		fmt.Println("  -fail-on-low-match")
+		fmt.Println("                   Exit with status 3 when the -min-match-rate check fails")
+		fmt.Println("  -summary-format string")
+		fmt.Println("                   Format of the summary after the run: text, or markdown for tables to paste into an issue or forum post (default \"text\")")
+		fmt.Println("  -slowest int     List this many of the files that took longest to process in the summary (default 10, 0 = none)")
+		fmt.Println("  -file-timeout duration")
+		fmt.Println("                   Give up on a file whose metadata write takes longer than this (e.g. 5m)")
+		fmt.Println("  -order string    Processing order: path, size or oldest-first (default \"path\")")
+		fmt.Println("  -pipeline string")
+		fmt.Println("                   Chain steps after applying the metadata: apply,dedupe,reorganize,verify (any in this order, starting with apply)")
+		fmt.Println("  -reorganize-dir string")
+		fmt.Println("                   Library the pipeline's reorganize step copies the processed files into")
+		fmt.Println("  -reorganize-template string")
+		fmt.Println("                   Folders and names of the reorganized copies, with the -name-template fields (default \"{yyyy}/{mm}/{original}\")")
+		fmt.Println("  -files-from string")
+		fmt.Println("                   Process only the media paths listed in this file (one per line, \"-\" for stdin)")
+		fmt.Println("  -retry-from string")
+		fmt.Println("                   Re-process only the files that failed in this previous -report file")
+		fmt.Println("  -resume          Continue the run interrupted in -dir (or -output), skipping the files it completed")
+		fmt.Println("  -watch           Keep watching the export while it is still being extracted and process folders as they settle")
+		fmt.Println("  -watch-interval duration")
+		fmt.Println("                   With -watch, how often to look for new files (default 10s)")
+		fmt.Println("  -watch-settle duration")
+		fmt.Println("                   With -watch, how long a folder must be unchanged before its files are processed (default 1m0s)")
+		fmt.Println("  -watch-idle duration")
+		fmt.Println("                   With -watch, stop once nothing changed for this long (0 = until interrupted)")
+		fmt.Println("  -match string    Sidecar matching: strict (documented names only), normal or aggressive")
+		fmt.Println("                   (adds title and fuzzy matching) (default \"normal\")")
+		fmt.Println("  -json-root string")
+		fmt.Println("                   Also look for sidecars in this directory tree mirroring the export's folders")
+		fmt.Println("  -force           Apply sidecars even when their JSON title does not match the media file name")
+		fmt.Println("  -merge string    Comma-separated other Takeout exports of the same library to process together with -dir")
+		fmt.Println("  -conflict string")
+		fmt.Println("                   Which copy wins when a photo is in several exports: newest or gps (default \"newest\")")
+		fmt.Println("  -album string    Comma-separated album names or globs to process (default: all)")
+		fmt.Println("  -album-as-keyword")
+		fmt.Println("                   Add the album title (or album folder name) as a keyword on member photos")
+		fmt.Println("  -label-keywords  Add the names from the JSON people, tags and labels fields as keywords")
+		fmt.Println("  -picasa          Merge the captions, keywords, stars and face names of .picasa.ini files with the JSON")
+		fmt.Println("  -face-regions    Write the face rectangles from .picasa.ini files or the JSON as MWG regions")
+		fmt.Println("  -description-template string")
+		fmt.Println("                   Template of the written description: {description}, {title}, {album}, {filename}, {people}, {date}, {yyyy}, {mm}, {dd}")
+		fmt.Println("  -shared-comments string")
+		fmt.Println("                   Keep shared album likes and comments: xmp, or text for a .comments.txt file next to each photo")
+		fmt.Println("  -tag-creations   Add a \"Google Photos creation\" keyword to collages, animations and effects made by Google Photos")
+		fmt.Println("  -album-location-keywords")
+		fmt.Println("                   Add album location enrichments as keywords on member photos")
+		fmt.Println("  -priority string")
+		fmt.Println("                   Comma-separated album folder names to process first")
+		fmt.Println("\nSubcommands:")
+		fmt.Println("  scan [-json] <dir>")
+		fmt.Println("                   Inventory files by extension and folder, without matching or changing anything")
+		fmt.Println("  export-manifest -dir <dir> [-o manifest.jsonl.gz]")
+		fmt.Println("                   Write the metadata of every media file, keyed by content hash, without changing anything")
+		fmt.Println("  apply-manifest <manifest.jsonl.gz> -dir <library> [options]")
+		fmt.Println("                   Apply a manifest's metadata to the files of a library with the same content")
+		fmt.Println("  report diff <runA.json> <runB.json>")
+		fmt.Println("                   Show files whose status changed between two reports")
+		fmt.Println("  report verify <run.json>")
+		fmt.Println("                   List files modified or removed since a -checksums run")
 		os.Exit(1)
 	}
 
+	if *filesFrom != "" && *retryFrom != "" {
+		log.Fatalf("-files-from and -retry-from cannot be combined")
+	}
+
+	if *sample > 0 && (*filesFrom != "" || *retryFrom != "") {
+		log.Fatalf("-sample picks its own files and cannot be combined with -files-from or -retry-from")
+	}
+
+	if *relocatedDir != "" && (*outputDir != "" || *sample > 0) {
+		log.Fatalf("-relocated writes to an existing library and cannot be combined with -output or -sample")
+	}
+
+	if manifestPath != "" && (*relocatedDir != "" || *jsonRoot != "" || *retryFrom != "" || *sample > 0) {
+		log.Fatalf("apply-manifest takes the metadata from the manifest and cannot be combined with -relocated, -json-root, -retry-from or -sample")
+	}
+
+	if *summaryFormat != summaryText && *summaryFormat != summaryMarkdown {
+		log.Fatalf("Invalid -summary-format: unknown format %q (expected %s or %s)", *summaryFormat, summaryText, summaryMarkdown)
+	}
+
+	if err := processor.ValidateRelocatedMatch(*relocatedMatch); err != nil {
+		log.Fatalf("Invalid -relocated-match: %v", err)
+	}
+
+	if *extractZips && (*outputDir != "" || *relocatedDir != "" || manifestPath != "") {
+		log.Fatalf("-extract-zips extracts the archives into the export and cannot be combined with -output, -relocated or apply-manifest")
+	}
+	if *mergeSplit && (*outputDir != "" || *relocatedDir != "" || manifestPath != "") {
+		log.Fatalf("-merge-split-videos writes the joined videos into the export and cannot be combined with -output, -relocated or apply-manifest")
+	}
+
+	if *outputMode != processor.OutputCopy && *outputDir == "" && *sample == 0 {
+		log.Fatalf("-output-mode chooses how -output creates its files; add -output")
+	}
+
+	if *normalizeNames && *outputDir == "" {
+		log.Fatalf("-normalize-names renames the copies written by -output; add -output")
+	}
+
+	if *nameTemplate != "" && *outputDir == "" {
+		log.Fatalf("-name-template names the copies written by -output; add -output")
+	}
+
+	if *checksums && *reportPath == "" {
+		log.Fatalf("-checksums records the checksums in the report; add -report")
+	}
+
+	if *pipeline != "" && *dryRun {
+		log.Fatalf("-pipeline deduplicates, copies and verifies the files a run writes; drop -dry-run")
+	}
+	if *pipeline != "" && *watch {
+		log.Fatalf("-pipeline works on a finished run and cannot be combined with -watch")
+	}
+
+	if *sha256Sums != "" && *dryRun {
+		log.Fatalf("-sha256sums lists the files as a run leaves them; drop -dry-run")
+	}
+	if *repack != "" && *dryRun {
+		log.Fatalf("-repack packs the files as a run leaves them; drop -dry-run")
+	}
+	videoSizeLimit, err := parseSize(*maxVideoSize)
+	if err != nil {
+		log.Fatalf("Invalid -max-video-size: %v", err)
+	}
+	bandwidthLimit, err := parseSize(*bandwidth)
+	if err != nil {
+		log.Fatalf("Invalid -bandwidth: %v", err)
+	}
+	if *oversizedList != "" && videoSizeLimit == 0 {
+		log.Fatalf("-oversized-list lists the videos skipped by -max-video-size; set a limit")
+	}
+
+	if err := metadata.ValidateWriter(*writer); err != nil {
+		log.Fatalf("Invalid -writer: %v", err)
+	}
+
+	if err := processor.ValidateBatchBy(*batchBy); err != nil {
+		log.Fatalf("Invalid -batch-by: %v", err)
+	}
+	if *batchBy != "" && *reportPath == "" {
+		log.Fatalf("-batch-by writes a report for every batch next to the -report; add -report")
+	}
+
+	if *watch && (*filesFrom != "" || *retryFrom != "" || *resume || *sample > 0 || *batchBy != "") {
+		log.Fatalf("-watch finds its own files and cannot be combined with -files-from, -retry-from, -resume, -sample or -batch-by")
+	}
+	if *watch && (*renameToTitle || *extractZips || *mergeSplit) {
+		log.Fatalf("-watch would see the files it creates as new ones and cannot be combined with -rename-to-title, -extract-zips or -merge-split-videos")
+	}
+	if *watch && !*yes && !*dryRun {
+		log.Fatalf("-watch processes files as they arrive, with no plan to confirm; add -yes")
+	}
+
+	if *filesFrom == "-" && !*yes && !*dryRun {
+		log.Fatalf("-files-from - reads the list from stdin; add -yes to skip the confirmation prompt")
+	}
+
+	if err := processor.ValidateOrder(*order); err != nil {
+		log.Fatalf("Invalid -order: %v", err)
+	}
+
+	if err := processor.ValidateTimePolicy(*timePolicy); err != nil {
+		log.Fatalf("Invalid -time-policy: %v", err)
+	}
+
+	if err := processor.ValidateMatchMode(*matchMode); err != nil {
+		log.Fatalf("Invalid -match: %v", err)
+	}
+
+	if err := processor.ValidateConflictRule(*conflictRule); err != nil {
+		log.Fatalf("Invalid -conflict: %v", err)
+	}
+
+	// The first Ctrl-C stops handing out files and kills the tool calls still running,
+	// then the summary and report are written as usual; a second one quits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+		fmt.Println("\n[INTERRUPT] Stopping: no new files are started and the tool calls in progress are cancelled (press Ctrl-C again to quit now)")
+	}()
+	quitOnSignal(ctx)
+	defer metadata.RemoveTempFilesOnPanic()
+
+	// Takeout archives given as -dir are extracted first, and the run works on the
+	// extracted files. A dry run only counts them, and works on the extraction
+	// directory once a previous run has extracted them all.
+	archives, err := takeoutArchives(*rootDir)
+	if err != nil {
+		log.Fatalf("Invalid -dir: %v", err)
+	}
+	if *extractTo != "" && len(archives) == 0 {
+		log.Fatalf("-extract-to sets where the Takeout archives given as -dir are extracted; -dir is not an archive")
+	}
+	if len(archives) > 0 {
+		target := *extractTo
+		if target == "" {
+			target = processor.ArchiveDir(archives)
+		}
+		if *dryRun {
+			files, err := processor.CountArchives(ctx, archives, target)
+			if err != nil {
+				log.Fatalf("Error reading archives: %v", err)
+			}
+			if files > 0 {
+				fmt.Printf(tr("Would extract %d files from %d archives into %s\n"), files, len(archives), target)
+				fmt.Println(tr("Run without -dry-run to extract them."))
+				return
+			}
+		} else {
+			files, err := processor.ExtractArchives(ctx, archives, target)
+			if err != nil {
+				log.Fatalf("Error extracting archives: %v", err)
+			}
+			fmt.Printf(tr("Extracted %d files from %d archives into %s\n\n"), files, len(archives), target)
+		}
+		*rootDir = target
+	}
+
 	// Verify directory exists
 	info, err := os.Stat(*rootDir)
 	if err != nil {
@@ -39,41 +484,650 @@ func main() {
 		log.Fatalf("Error getting absolute path: %v", err)
 	}
 
-	fmt.Printf("Starting Google Takeout EXIF metadata processor\n")
-	fmt.Printf("Directory: %s\n", absDir)
-	fmt.Printf("Dry Run: %v\n", *dryRun)
-	fmt.Printf("Verbose: %v\n\n", *verbose)
+	var mergeRoots []string
+	for _, dir := range splitList(*mergeDirs) {
+		info, err := os.Stat(dir)
+		if err != nil {
+			log.Fatalf("Error accessing merged directory: %v", err)
+		}
+		if !info.IsDir() {
+			log.Fatalf("Path is not a directory: %s", dir)
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatalf("Error getting absolute path: %v", err)
+		}
+		mergeRoots = append(mergeRoots, abs)
+	}
+
+	cfg := &config.Config{}
+	if *configPath != "" {
+		cfg, err = config.Load(*configPath)
+		if err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+	}
+
+	// In sample mode the whole run works on copies: the export, the output directory
+	// and the partner directory are all replaced by folders in a temporary directory
+	var sampleDir string
+	if *sample > 0 {
+		sampleDir, err = os.MkdirTemp("", "takeout-sample-")
+		if err != nil {
+			log.Fatalf("Error creating sample directory: %v", err)
+		}
+		sampler, err := processor.New(absDir,
+			processor.WithDryRun(true),
+			processor.WithSidecarMatching(cfg.SidecarStrategies, cfg.SidecarRules),
+			processor.WithMatchMode(*matchMode),
+			processor.WithMergeRoots(mergeRoots, *conflictRule),
+			processor.WithJSONRoot(*jsonRoot),
+			processor.WithAlbumFilter(splitList(*albums)),
+		)
+		if err != nil {
+			log.Fatalf("Invalid options: %v", err)
+		}
+		copied, err := sampler.CopySample(ctx, filepath.Join(sampleDir, "export"), *sample)
+		if err != nil {
+			log.Fatalf("Error copying sample: %v", err)
+		}
+		fmt.Printf("[SAMPLE] Copied %d random media files from %s to %s\n\n", copied, absDir, sampleDir)
+		// Sidecars from -json-root were copied next to their media files
+		absDir, mergeRoots, *jsonRoot = filepath.Join(sampleDir, "export"), nil, ""
+		if *outputDir != "" {
+			*outputDir = filepath.Join(sampleDir, "output")
+		}
+		if *partnerDir != "" {
+			*partnerDir = filepath.Join(sampleDir, "partner")
+		}
+		if *quarantineDir != "" {
+			*quarantineDir = filepath.Join(sampleDir, "quarantine")
+		}
+	}
+
+	fmt.Printf(tr("Starting Google Takeout EXIF metadata processor\n"))
+	fmt.Printf(tr("Directory: %s\n"), absDir)
+	for _, dir := range mergeRoots {
+		fmt.Printf(tr("Merged export: %s\n"), dir)
+	}
+	if *outputDir != "" {
+		fmt.Printf(tr("Output: %s\n"), *outputDir)
+	}
+	if *relocatedDir != "" {
+		fmt.Printf(tr("Relocated library: %s\n"), *relocatedDir)
+	}
+	if manifestPath != "" {
+		fmt.Printf(tr("Manifest: %s\n"), manifestPath)
+	}
+	fmt.Printf(tr("Dry Run: %v\n"), *dryRun)
+	fmt.Printf(tr("Verbose: %v\n\n"), *verbose)
+
+	var shift processor.TimeShift
+	if *timeShift != "" {
+		shift, err = processor.ParseTimeShift(*timeShift)
+		if err != nil {
+			log.Fatalf("Invalid -time-shift: %v", err)
+		}
+	}
+	options := []processor.Option{
+		processor.WithDryRun(*dryRun),
+		processor.WithVerbose(*verbose),
+		processor.WithApplyOptions(metadata.ApplyOptions{
+			VideoXMPSidecar: *videoXMP,
+			WriteProvenance: *writeOrigin,
+			TimeTolerance:   *timeTolerance,
+			GPSTimestamps:   *gpsTime,
+			WriteMarker:     *marker,
+			FastStart:       *fastStart,
+			Writer:          *writer,
+			InPlace:         *inPlace,
+			StripGoogleXMP:  *stripGoogleXMP,
+			FaceRegions:     *faceRegions,
+		}),
+		processor.WithMaxErrors(*maxErrors),
+		processor.WithWorkerCount(*workers),
+		processor.WithWorkers(*minWorkers, *maxWorkers),
+		processor.WithIOLimits(*maxIOPS, bandwidthLimit),
+		processor.WithLowMemory(*lowMemory),
+		processor.WithNiceIO(*niceIO),
+		processor.WithQuietHours(splitList(*quietHours), *quietMode),
+		processor.WithPauseFile(*pauseFile),
+		processor.WithFileTimeout(*fileTimeout),
+		processor.WithSidecarMatching(cfg.SidecarStrategies, cfg.SidecarRules),
+		processor.WithMatchMode(*matchMode),
+		processor.WithMergeRoots(mergeRoots, *conflictRule),
+		processor.WithJSONRoot(*jsonRoot),
+		processor.WithAlbumFilter(splitList(*albums)),
+		processor.WithOutputDir(*outputDir),
+		processor.WithOutputMode(*outputMode),
+		processor.WithQuarantineDir(*quarantineDir),
+		processor.WithRelocatedDir(*relocatedDir, *relocatedMatch),
+		processor.WithSlowestFiles(*slowest),
+		processor.WithPipeline(processor.PipelineOptions{Steps: splitList(*pipeline), Dir: *reorganizeDir, Template: *reorganizeTemplate}),
+		processor.WithMaxVideoSize(videoSizeLimit),
+		processor.WithVerifyWrites(*verifyWrites),
+		processor.WithSyncMTime(*syncMTime),
+		processor.WithExtractZips(*extractZips),
+		processor.WithMergeSplitVideos(*mergeSplit),
+		// The manifest reuses the checksums taken right after each file is written
+		processor.WithChecksums(*checksums || *sha256Sums != ""),
+		processor.WithAuditXMP(*auditXMP),
+		processor.WithLegacyGlobalSupplemental(*legacySupplemental),
+		processor.WithTimePolicy(*timePolicy, *timeThreshold),
+		processor.WithFolderRules(cfg.FolderRules),
+		processor.WithFilenameDateRules(cfg.FilenameDateRules),
+		processor.WithExcludeTransportStreams(cfg.ExcludeTransport),
+		processor.WithPicasa(*picasa, cfg.PicasaSources),
+		processor.WithForce(*force),
+		processor.WithTimeShift(shift, cfg.CameraShifts),
+		processor.WithTimezoneAudit(*tzAudit, *tzCorrect),
+		processor.WithOrder(*order, splitList(*priority)),
+		processor.WithNormalizeNames(*normalizeNames),
+		processor.WithNameTemplate(*nameTemplate),
+		processor.WithRenameToTitle(*renameToTitle, *renameJournal),
+		processor.WithResume(*resume),
+		processor.WithAlbumKeywords(*albumKeywords),
+		processor.WithAlbumNameKeyword(*albumAsKeyword),
+		processor.WithLabelKeywords(*labelKeywords),
+		processor.WithTagCreations(*tagCreations),
+		processor.WithDescriptionTemplate(*descriptionTemplate),
+		processor.WithSharedComments(*sharedComments),
+		processor.WithPartnerOptions(processor.PartnerOptions{
+			OutputDir:   *partnerDir,
+			Tag:         *partnerTag,
+			DefaultName: *partnerName,
+		}),
+	}
+	if manifestPath != "" {
+		entries, err := manifest.Load(manifestPath)
+		if err != nil {
+			log.Fatalf("Error loading manifest: %v", err)
+		}
+		options = append(options, processor.WithManifest(manifestPath, entries))
+	}
+	if *filesFrom != "" {
+		paths, err := readFileList(*filesFrom)
+		if err != nil {
+			log.Fatalf("Error reading file list: %v", err)
+		}
+		options = append(options, processor.WithFileList(paths))
+	}
+	if *retryFrom != "" {
+		previous, err := report.Load(*retryFrom)
+		if err != nil {
+			log.Fatalf("Error loading report: %v", err)
+		}
+		items := retryItems(previous)
+		fmt.Printf(tr("Retrying %d failed files from %s\n\n"), len(items), *retryFrom)
+		options = append(options, processor.WithRetryItems(items))
+	}
+	if *batchBy != "" {
+		options = append(options, processor.WithBatches(*batchBy, batchPath(*reportPath, "checkpoint"), func(batch processor.Batch, stats processor.Statistics) {
+			path := batchPath(*reportPath, batch.Name)
+			if err := report.New(absDir, *dryRun, &stats).Write(path); err != nil {
+				fmt.Printf("[ERROR] %v\n", err)
+			} else {
+				fmt.Printf(tr("Batch report written to: %s\n"), path)
+			}
+		}))
+	}
+	// A soft limit makes the garbage collector work harder before the OOM killer steps in
+	if *lowMemory && os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(lowMemoryLimit)
+	}
 
-	p := processor.New(absDir, *dryRun, *verbose)
-	stats, err := p.Process()
+	p, err := processor.New(absDir, options...)
 	if err != nil {
+		log.Fatalf("Invalid options: %v", err)
+	}
+	// Subscribed before the scan, so no event of the run is missed
+	waitEvents := func() {}
+	if *eventsPath != "" {
+		if waitEvents, err = streamEvents(p, *eventsPath); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	if pauseOnSignal(p) && *verbose {
+		fmt.Printf("[INFO] Send SIGUSR1 to pause or resume: kill -USR1 %d\n", os.Getpid())
+	}
+
+	// Only one run at a time may write to the folder; dry runs write nothing to it
+	unlock := func() {}
+	if !*dryRun {
+		if unlock, err = p.Lock(); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	if !*dryRun && !*yes && sampleDir == "" {
+		plan, err := p.Scan(ctx)
+		if err != nil {
+			log.Fatalf("Error scanning folder: %v", err)
+		}
+		printPlan(plan)
+		if !confirm(tr("Proceed? [y/N]: ")) {
+			unlock()
+			fmt.Println(tr("Aborted, no files were modified."))
+			os.Exit(0)
+		}
+		fmt.Println()
+	}
+
+	var stats processor.Statistics
+	if *watch {
+		stats, err = p.Watch(ctx, processor.WatchOptions{Interval: *watchInterval, Settle: *watchSettle, Idle: *watchIdle})
+	} else {
+		stats, err = p.Process(ctx)
+	}
+	unlock()
+	waitEvents()
+	if errors.Is(err, processor.ErrTooManyErrors) || errors.Is(err, context.Canceled) {
+		fmt.Printf("\n[ERROR] Processing stopped: %v\n", err)
+	} else if err != nil {
 		log.Fatalf("Error processing folder: %v", err)
 	}
 
-	fmt.Println("\n=== Processing Complete ===")
-	fmt.Printf("Total files scanned: %d\n", stats.TotalFiles)
-	fmt.Printf("JSON metadata files found: %d\n", stats.JSONFiles)
-	fmt.Printf("Media files processed: %d\n", stats.ProcessedFiles)
-	fmt.Printf("  - Modified: %d\n", stats.ModifiedFiles)
-	fmt.Printf("  - Already up-to-date: %d\n", stats.UnmodifiedFiles)
-	fmt.Printf("Files skipped: %d\n", stats.SkippedFiles)
-	fmt.Printf("Errors encountered: %d\n", stats.ErrorCount)
+	if *reportPath != "" {
+		if err := report.New(absDir, *dryRun, &stats).Write(*reportPath); err != nil {
+			fmt.Printf("[ERROR] %v\n", err)
+		} else {
+			fmt.Printf(tr("\nReport written to: %s\n"), *reportPath)
+		}
+	}
+
+	if *sha256Sums != "" {
+		root := absDir
+		if *outputDir != "" {
+			root = *outputDir
+		} else if *relocatedDir != "" {
+			root = *relocatedDir
+		}
+		if root, err = filepath.Abs(root); err == nil {
+			var listed int
+			if listed, err = report.WriteSHA256Sums(*sha256Sums, root, stats.Files); err == nil {
+				fmt.Printf(tr("Checksums of %d files written to: %s\n"), listed, *sha256Sums)
+			}
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] %v\n", err)
+		}
+	}
+
+	if *repack != "" {
+		root := absDir
+		if *outputDir != "" {
+			root = *outputDir
+		} else if *relocatedDir != "" {
+			root = *relocatedDir
+		}
+		if files, err := processor.RepackArchive(ctx, root, *repack); err != nil {
+			fmt.Printf("[ERROR] %v\n", err)
+		} else {
+			fmt.Printf(tr("%d files repacked into: %s\n"), files, *repack)
+		}
+	}
+
+	if *oversizedList != "" {
+		if err := writeFileList(*oversizedList, stats.OversizedVideos); err != nil {
+			fmt.Printf("[ERROR] %v\n", err)
+		} else {
+			fmt.Printf(tr("%d oversized videos listed in: %s\n"), len(stats.OversizedVideos), *oversizedList)
+		}
+	}
+
+	if *summaryFormat == summaryMarkdown {
+		printMarkdownSummary(absDir, &stats, *verbose)
+		if sampleDir != "" {
+			fmt.Printf(tr("\nThe sample and its results are in %s; delete it when done\n"), sampleDir)
+		}
+		lowMatch := warnLowMatchRate(&stats, *minMatchRate)
+		if stats.ErrorCount > 0 {
+			os.Exit(1)
+		}
+		if lowMatch && *failOnLowMatch {
+			os.Exit(lowMatchExitCode)
+		}
+		return
+	}
+
+	fmt.Println(tr("\n=== Processing Complete ==="))
+	for _, line := range summaryLines(&stats) {
+		fmt.Printf(tr(line.format+"\n"), line.value)
+	}
+	printStages(stats.Stages)
+	printSlowestFiles(stats.SlowestFiles)
+
+	if *dryRun && *estimateSamples > 0 {
+		if est, err := p.EstimateCost(ctx, *estimateSamples); err != nil {
+			fmt.Printf("[WARN] Could not estimate the run time: %v\n", err)
+		} else {
+			printEstimate(est)
+		}
+	}
+
+	if *dryRun && len(stats.Files) > 0 {
+		printFolderRollup(processor.SummarizeFolders(absDir, stats.Files))
+	}
 
 	if *verbose && len(stats.ModifiedDetails) > 0 {
-		fmt.Println("\n=== Modified Files ===")
+		fmt.Println(tr("\n=== Modified Files ==="))
 		for _, detail := range stats.ModifiedDetails {
 			fmt.Printf("%s\n", detail)
 		}
 	}
 
 	if *verbose && len(stats.UnmodifiedDetails) > 0 {
-		fmt.Println("\n=== Unchanged Files (Already Had Matching EXIF) ===")
+		fmt.Println(tr("\n=== Unchanged Files (Already Had Matching EXIF) ==="))
 		for _, detail := range stats.UnmodifiedDetails {
 			fmt.Printf("%s\n", detail)
 		}
 	}
 
+	if len(stats.MatchStrategies) > 0 {
+		fmt.Println(tr("\n=== Sidecar Matches ==="))
+		names := make([]string, 0, len(stats.MatchStrategies))
+		for name := range stats.MatchStrategies {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			ci, cj := stats.MatchStrategies[names[i]], stats.MatchStrategies[names[j]]
+			if ci != cj {
+				return ci > cj
+			}
+			return names[i] < names[j]
+		})
+		for _, name := range names {
+			fmt.Printf("  %-20s %d\n", name, stats.MatchStrategies[name])
+		}
+	}
+
+	if len(stats.TimestampConflicts) > 0 {
+		fmt.Println(tr("\n=== Taken/Creation Time Conflicts ==="))
+		for _, detail := range stats.TimestampConflicts {
+			fmt.Printf("%s\n", detail)
+		}
+	}
+
+	if len(stats.SuspectedMatches) > 0 {
+		fmt.Println(tr("\n=== Suspected Wrong Matches (use -force to apply) ==="))
+		for _, detail := range stats.SuspectedMatches {
+			fmt.Printf("%s\n", detail)
+		}
+	}
+
+	if albums := stats.IncompleteAlbums(); len(albums) > 0 {
+		fmt.Println(tr("\n=== Incomplete Albums ==="))
+		for _, album := range albums {
+			name := album.Folder
+			if album.Title != "" && album.Title != filepath.Base(album.Folder) {
+				name += " (" + album.Title + ")"
+			}
+			fmt.Printf("  %s: %d of %d items\n", name, album.Found, album.Expected)
+			if len(album.Missing) > 0 {
+				fmt.Printf("    Missing: %s\n", strings.Join(album.Missing, ", "))
+			}
+		}
+	}
+
+	if len(stats.OversizedVideos) > 0 {
+		fmt.Println(tr("\n=== Videos Over -max-video-size (not processed) ==="))
+		for _, video := range stats.OversizedVideos {
+			fmt.Printf("  %10s  %s\n", sizeString(video.Size), video.Path)
+		}
+	}
+
+	if len(stats.MergeConflicts) > 0 {
+		fmt.Println(tr("\n=== Merge Conflicts ==="))
+		for _, conflict := range stats.MergeConflicts {
+			fmt.Printf("  %s: using %s (%s; differs in %s)\n", conflict.Path, conflict.Winner, conflict.Reason, strings.Join(conflict.Fields, ", "))
+		}
+	}
+
+	if *verbose && len(stats.Duplicates) > 0 {
+		fmt.Println(tr("\n=== Duplicates ==="))
+		for _, dup := range stats.Duplicates {
+			fmt.Printf("  %s: same as %s\n", dup.Path, dup.Original)
+		}
+	}
+
+	if len(stats.VerifyFailures) > 0 {
+		fmt.Println(tr("\n=== Verification Failures ==="))
+		for _, failure := range stats.VerifyFailures {
+			fmt.Printf("  %s\n", failure)
+		}
+	}
+
+	if check := stats.IndexCheck; check != nil {
+		fmt.Println(tr("\n=== Archive Index ==="))
+		fmt.Printf("Media files listed in %s: %d, found on disk: %d\n", check.IndexPath, check.Listed, check.Found)
+		for i, name := range check.Missing {
+			if i == 20 && !*verbose {
+				fmt.Printf("  ... and %d more (use -verbose to list all)\n", len(check.Missing)-i)
+				break
+			}
+			fmt.Printf("  Missing: %s\n", name)
+		}
+	}
+
+	if len(stats.Escapes) > 0 {
+		fmt.Println(tr("\n=== Skipped: Outside Takeout Root ==="))
+		for _, detail := range stats.Escapes {
+			fmt.Printf("%s\n", detail)
+		}
+	}
+
+	if len(stats.TimezoneAudit) > 0 {
+		fmt.Println(tr("\n=== UTC Offset Audit ==="))
+		for _, detail := range stats.TimezoneAudit {
+			fmt.Printf("%s\n", detail)
+		}
+	}
+
+	if *verbose && len(stats.Albums) > 0 {
+		fmt.Println(tr("\n=== Albums ==="))
+		for _, album := range stats.Albums {
+			fmt.Printf("%s (%s): %d media files\n", album.Title, album.Folder, album.MediaFiles)
+			if len(album.Locations) > 0 {
+				fmt.Printf("    Locations: %s\n", strings.Join(album.Locations, ", "))
+			}
+			for _, narrative := range album.Narratives {
+				fmt.Printf("    Narrative: %s\n", narrative)
+			}
+		}
+	}
+
+	if sampleDir != "" {
+		fmt.Printf(tr("\nThe sample and its results are in %s; delete it when done\n"), sampleDir)
+	}
+
+	lowMatch := warnLowMatchRate(&stats, *minMatchRate)
 	if stats.ErrorCount > 0 {
 		os.Exit(1)
 	}
+	if lowMatch && *failOnLowMatch {
+		os.Exit(lowMatchExitCode)
+	}
+}
+
+// warnLowMatchRate warns at the end of a run when fewer than minRate percent of the
+// media files had a sidecar, which is how half-extracted exports show, and reports
+// whether it did
+func warnLowMatchRate(stats *processor.Statistics, minRate int) bool {
+	rate, media := stats.MatchRate()
+	if minRate <= 0 || media < minMatchRateFiles || rate*100 >= float64(minRate) {
+		return false
+	}
+	matched := media - stats.MatchStrategies[processor.MatchNone]
+	fmt.Printf("\n[WARN] Only %.0f%% of the media files had a JSON sidecar (%d of %d), below -min-match-rate %d%%\n",
+		rate*100, matched, media, minRate)
+	fmt.Println("[WARN] Check that every part of the Takeout export was downloaded and extracted into the same folder")
+	return true
+}
+
+// printPlan prints the pre-run summary shown before asking for confirmation
+func printPlan(plan *processor.Plan) {
+	fmt.Println(tr("=== Planned Changes ==="))
+	fmt.Printf(tr("Files found: %d\n"), plan.TotalFiles)
+	fmt.Printf(tr("Media files: %d (%d images, %d videos)\n"), plan.MediaFiles, plan.ImageFiles, plan.VideoFiles)
+	fmt.Printf(tr("Media files with JSON metadata: %d\n"), plan.MatchedFiles)
+	if len(plan.Actions) == 0 {
+		fmt.Println(tr("No files will be modified."))
+		return
+	}
+	fmt.Println(tr("This run will:"))
+	for _, action := range plan.Actions {
+		fmt.Printf("  - %s\n", action)
+	}
+	for _, hint := range plan.Hints {
+		fmt.Printf("[HINT] %s\n", hint)
+	}
+}
+
+// printStages prints the time and IO volume of each run stage
+func printStages(stages map[string]processor.StageStats) {
+	if len(stages) == 0 {
+		return
+	}
+	fmt.Println(tr("\n=== Time and IO per Stage ==="))
+	fmt.Printf("  %-12s %7s %10s %10s %10s\n", "Stage", "Files", "Time", "Read", "Written")
+	for _, name := range processor.StageNames() {
+		stage, ok := stages[name]
+		if !ok {
+			continue
+		}
+		fmt.Printf("  %-12s %7d %10s %10s %10s\n", name, stage.Files, roughDuration(stage.Duration),
+			sizeString(stage.BytesRead), sizeString(stage.BytesWritten))
+	}
+}
+
+// printSlowestFiles lists the files that took longest, slowest first
+func printSlowestFiles(files []processor.FileTiming) {
+	if len(files) == 0 {
+		return
+	}
+	fmt.Println(tr("\n=== Slowest Files ==="))
+	for _, f := range files {
+		fmt.Printf("  %8s %10s  %s\n", roughDuration(f.Duration), sizeString(f.Size), f.Path)
+	}
+}
+
+// printFolderRollup prints the dry-run outcome per folder as a table
+func printFolderRollup(folders []processor.FolderSummary) {
+	width := len("Folder")
+	for _, f := range folders {
+		if n := utf8.RuneCountInString(f.Folder); n > width {
+			width = n
+		}
+	}
+	fmt.Println(tr("\n=== Folders ==="))
+	fmt.Printf("  %-*s %7s %8s %10s %13s\n", width, "Folder", "Files", "Matched", "Unmatched", "Would modify")
+	for _, f := range folders {
+		fmt.Printf("  %-*s %7d %8d %10d %13d\n", width, f.Folder, f.Files, f.Matched, f.Unmatched, f.WouldModify)
+	}
+}
+
+// printEstimate prints the dry-run cost model
+func printEstimate(est *processor.CostEstimate) {
+	if est.ImageSamples == 0 && est.VideoSamples == 0 {
+		return
+	}
+	fmt.Println(tr("\n=== Estimated Run Time ==="))
+	if est.ImageSamples > 0 {
+		fmt.Printf("Images: %d x %v (timed on %d samples)\n", est.ImageFiles, est.ImageCost.Round(100*time.Microsecond), est.ImageSamples)
+	}
+	if est.VideoSamples > 0 {
+		fmt.Printf("Videos: %d, %.1f MB at %.1f MB/s (timed on %d samples)\n",
+			est.VideoFiles, float64(est.VideoBytes)/(1<<20), est.VideoThroughput/(1<<20), est.VideoSamples)
+	}
+	fmt.Printf(tr("This run will take about %s with %d workers\n"), roughDuration(est.Total), est.Workers)
+}
+
+// roughDuration formats an estimate at a sensible precision, e.g. "14h05m" or "3m20s"
+func roughDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		d = d.Round(time.Minute)
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		d = d.Round(time.Second)
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return d.Round(100 * time.Millisecond).String()
+	}
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return false
+	}
+	return isYes(strings.ToLower(strings.TrimSpace(answer)))
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readFileList reads the -files-from list from a file or, for "-", from stdin
+func readFileList(path string) ([]string, error) {
+	if path == "-" {
+		return processor.ReadFileList(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return processor.ReadFileList(f)
+}
+
+// writeFileList writes the paths of the oversized videos one per line, the format
+// -files-from reads
+func writeFileList(path string, videos []processor.OversizedVideo) error {
+	var b strings.Builder
+	for _, video := range videos {
+		b.WriteString(video.Path + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// batchPath names a file written next to the -report for batched runs: the report of
+// one batch or the checkpoint, e.g. run.2019.json for run.json
+func batchPath(reportPath, name string) string {
+	ext := filepath.Ext(reportPath)
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.TrimSuffix(reportPath, ext) + "." + name + ext
+}
+
+// retryItems lists the files that errored in a previous report, with their sidecar match
+func retryItems(r *report.Report) []processor.RetryItem {
+	var items []processor.RetryItem
+	for _, f := range r.Files {
+		if f.Status != processor.StatusError {
+			continue
+		}
+		items = append(items, processor.RetryItem{
+			MediaPath: r.AbsPath(f.Path),
+			JSONPath:  r.AbsPath(f.JSONPath),
+		})
+	}
+	return items
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"google-takeout-exif-applier/internal/config"
+	"google-takeout-exif-applier/internal/manifest"
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// runExportManifestCommand implements the "export-manifest" subcommand: the prepared
+// metadata of every media file, keyed by content hash, for applying it later
+func runExportManifestCommand(args []string) int {
+	fs := flag.NewFlagSet("export-manifest", flag.ContinueOnError)
+	rootDir := fs.String("dir", "", "Root directory of Google Takeout folder")
+	outPath := fs.String("o", "takeout-manifest.jsonl.gz", "Manifest file to write")
+	configPath := fs.String("config", "", "Path to a JSON configuration file")
+	matchMode := fs.String("match", "normal", "Sidecar matching: strict, normal or aggressive")
+	jsonRoot := fs.String("json-root", "", "Also look for sidecars in this directory tree mirroring the export's folders")
+	timePolicy := fs.String("time-policy", "taken", "Timestamp to use when taken and creation times conflict: taken, creation or earliest")
+	timeThreshold := fs.Duration("time-conflict", 0, "Taken and creation times differing by more than this conflict (0 = off)")
+	timeShift := fs.String("time-shift", "", "Shift all timestamps, e.g. +2h37m or -1d")
+	force := fs.Bool("force", false, "Include sidecars whose JSON title does not match the media file name")
+	verbose := fs.Bool("verbose", false, "List every file added to the manifest")
+	if err := fs.Parse(args); err != nil || *rootDir == "" || fs.NArg() != 0 {
+		fmt.Println("Usage: google-takeout-exif-applier export-manifest -dir <path-to-takeout-folder> [-o manifest.jsonl.gz] [options]")
+		return 1
+	}
+
+	absDir, err := filepath.Abs(*rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if info, err := os.Stat(absDir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", absDir)
+		return 1
+	}
+	if err := processor.ValidateTimePolicy(*timePolicy); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -time-policy: %v\n", err)
+		return 1
+	}
+	cfg := &config.Config{}
+	if *configPath != "" {
+		if cfg, err = config.Load(*configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			return 1
+		}
+	}
+
+	var shift processor.TimeShift
+	if *timeShift != "" {
+		if shift, err = processor.ParseTimeShift(*timeShift); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -time-shift: %v\n", err)
+			return 1
+		}
+	}
+
+	p, err := processor.New(absDir,
+		processor.WithDryRun(true),
+		processor.WithVerbose(*verbose),
+		processor.WithSidecarMatching(cfg.SidecarStrategies, cfg.SidecarRules),
+		processor.WithMatchMode(*matchMode),
+		processor.WithJSONRoot(*jsonRoot),
+		processor.WithFolderRules(cfg.FolderRules),
+		processor.WithFilenameDateRules(cfg.FilenameDateRules),
+		processor.WithTimePolicy(*timePolicy, *timeThreshold),
+		processor.WithTimeShift(shift, cfg.CameraShifts),
+		processor.WithForce(*force),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid options: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	w, err := manifest.Create(*outPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	written, err := p.ExportManifest(ctx, w)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote the metadata of %d media files to %s\n", written, *outPath)
+	return 0
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "google-takeout-exif-applier/internal/processor"
+
+// pauseOnSignal is not supported here, where there is no SIGUSR1; use -pause-file
+func pauseOnSignal(p *processor.Processor) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// pauseOnSignal pauses and resumes the run each time the process receives SIGUSR1
+// (kill -USR1 <pid>)
+func pauseOnSignal(p *processor.Processor) bool {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			p.TogglePause()
+		}
+	}()
+	return true
+}
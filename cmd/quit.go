@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// quitOnSignal quits right away on SIGTERM, or on a second Ctrl-C once interrupted
+// has been cancelled by the first one. The temporary files of the writes in progress
+// (video _tmp_ copies, .exif-tmp files, partial output copies) are removed first, so
+// the export is left without partial files.
+func quitOnSignal(interrupted context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	go func() {
+		var sig os.Signal
+		select {
+		case sig = <-signals:
+		case <-interrupted.Done():
+			signal.Notify(signals, os.Interrupt)
+			sig = <-signals
+		}
+		removed := metadata.RemoveTempFiles()
+		fmt.Printf("\n[INTERRUPT] Quitting now, %d temporary files removed\n", removed)
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		os.Exit(code)
+	}()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"google-takeout-exif-applier/internal/report"
+)
+
+// runReportCommand implements the "report" subcommand
+func runReportCommand(args []string) int {
+	if len(args) == 2 && args[0] == "verify" {
+		return runReportVerify(args[1])
+	}
+	if len(args) != 3 || args[0] != "diff" {
+		fmt.Println("Usage: google-takeout-exif-applier report diff <runA.json> <runB.json>")
+		fmt.Println("       google-takeout-exif-applier report verify <run.json>")
+		return 1
+	}
+
+	before, err := report.Load(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	after, err := report.Load(args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	changes := report.Diff(before, after)
+	fmt.Printf("Comparing %s (%s) with %s (%s)\n",
+		args[1], before.GeneratedAt.Format("2006-01-02 15:04:05"),
+		args[2], after.GeneratedAt.Format("2006-01-02 15:04:05"))
+	if len(changes) == 0 {
+		fmt.Println("No files changed status.")
+		return 0
+	}
+
+	fmt.Printf("%d files changed status:\n", len(changes))
+	group := ""
+	for _, change := range changes {
+		if title := change.Before + " -> " + change.After; title != group {
+			group = title
+			fmt.Printf("\n%s:\n", group)
+		}
+		fmt.Printf("  %s\n", change.Path)
+	}
+	return 0
+}
+
+// runReportVerify checks the files of a -checksums report against their recorded
+// checksums, listing those modified or removed since the run
+func runReportVerify(path string) int {
+	r, err := report.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	mismatches, checked := report.Verify(r)
+	if checked == 0 {
+		fmt.Println("The report has no checksums; re-run with -checksums to record them.")
+		return 1
+	}
+	if len(mismatches) == 0 {
+		fmt.Printf("All %d files match the checksums recorded on %s.\n", checked, r.GeneratedAt.Format("2006-01-02 15:04:05"))
+		return 0
+	}
+
+	fmt.Printf("%d of %d files changed since the run:\n", len(mismatches), checked)
+	for _, m := range mismatches {
+		if m.Err != nil {
+			fmt.Printf("  %s: %s (%v)\n", m.Path, m.Result, m.Err)
+		} else {
+			fmt.Printf("  %s: %s\n", m.Path, m.Result)
+		}
+	}
+	return 2
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// runScanCommand implements the "scan" subcommand: a quick inventory of the tree
+// without matching sidecars or reading any metadata
+func runScanCommand(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the inventory as JSON")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fmt.Println("Usage: google-takeout-exif-applier scan [-json] <path-to-takeout-folder>")
+		return 1
+	}
+
+	inv, err := processor.TakeInventory(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(inv, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(data))
+		return 0
+	}
+
+	fmt.Printf("=== Inventory of %s ===\n", inv.Root)
+	fmt.Printf("Files: %d (%s)\n", inv.Files, sizeString(inv.Bytes))
+	fmt.Printf("  - Media: %d (%d images, %d videos)\n", inv.MediaFiles, inv.ImageFiles, inv.VideoFiles)
+	fmt.Printf("  - JSON sidecars: %d\n", inv.Sidecars)
+	fmt.Printf("  - Album metadata: %d\n", inv.AlbumFiles)
+	fmt.Printf("  - Other: %d\n", inv.OtherFiles)
+
+	fmt.Println("\n=== Extensions ===")
+	exts := make([]string, 0, len(inv.Extensions))
+	for ext := range inv.Extensions {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		ci, cj := inv.Extensions[exts[i]].Files, inv.Extensions[exts[j]].Files
+		if ci != cj {
+			return ci > cj
+		}
+		return exts[i] < exts[j]
+	})
+	for _, ext := range exts {
+		name := ext
+		if name == "" {
+			name = "(none)"
+		}
+		count := inv.Extensions[ext]
+		fmt.Printf("  %-10s %7d  %s\n", name, count.Files, sizeString(count.Bytes))
+	}
+
+	fmt.Println("\n=== Folders ===")
+	for _, folder := range inv.Folders {
+		kind := ""
+		if folder.Kind != "" {
+			kind = " [" + folder.Kind + "]"
+		}
+		fmt.Printf("  %s%s: %d media, %d sidecars, %d other, %s\n",
+			folder.Path, kind, folder.Media, folder.Sidecars, folder.Other, sizeString(folder.Bytes))
+	}
+
+	if len(inv.Localized) > 0 {
+		fmt.Println("\n=== Localized Names ===")
+		names := make([]string, 0, len(inv.Localized))
+		for name := range inv.Localized {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %s: %d\n", name, inv.Localized[name])
+		}
+	}
+	return 0
+}
+
+// sizeString formats a byte count with a binary unit
+func sizeString(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// parseSize parses a byte count with an optional binary unit, e.g. 4GB, 500M or 2GiB,
+// as 0 for an empty value
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	if value == "" {
+		return 0, nil
+	}
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	shift := 0
+	if i := strings.IndexAny(value, "KMGT"); i >= 0 && i == len(value)-1 {
+		shift = 10 * (strings.IndexByte("KMGT", value[i]) + 1)
+		value = strings.TrimSpace(value[:i])
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 4GB or 500MB)", s)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
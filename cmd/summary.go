@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// Summary formats for -summary-format
+const (
+	summaryText     = "text"
+	summaryMarkdown = "markdown"
+)
+
+// markdownErrorLimit is how many errors the markdown summary lists without -verbose
+const markdownErrorLimit = 50
+
+// summaryLine is one count of the run summary: an English format with one verb,
+// translated with tr, and its value
+type summaryLine struct {
+	format string
+	value  any
+}
+
+// skipReasonLabels names the skip reasons in the summary, each listed in the
+// translations like the other summary lines
+var skipReasonLabels = map[string]string{
+	processor.SkipNoSidecar:        "No JSON sidecar",
+	processor.SkipUnsupportedType:  "Unsupported file type",
+	processor.SkipNotMedia:         "Not a media file",
+	processor.SkipFilteredOut:      "Not in the selected albums",
+	processor.SkipAlreadyProcessed: "Already processed",
+	processor.SkipTrashed:          "In the trash",
+	processor.SkipDuplicate:        "Duplicate copies",
+	processor.SkipOutsideRoot:      "Outside the export",
+	processor.SkipSuspectedMatch:   "Suspected wrong match",
+	processor.SkipBadSidecar:       "Unreadable sidecar",
+	processor.SkipNotInLibrary:     "Not found in the library",
+	processor.SkipNestedArchive:    "Nested zip archives",
+	processor.SkipSplitPart:        "Parts of split videos",
+	processor.SkipCorrupt:          "Corrupt or truncated",
+	processor.SkipTooLarge:         "Videos over the size limit",
+}
+
+// skipReasonLabel returns the summary label of a skip reason, the reason itself
+// when it has none
+func skipReasonLabel(reason string) string {
+	if label, ok := skipReasonLabels[reason]; ok {
+		return label
+	}
+	return reason
+}
+
+// summaryLines returns the counts of the run summary, leaving out the optional ones
+// that are zero
+func summaryLines(stats *processor.Statistics) []summaryLine {
+	lines := []summaryLine{
+		{"Total files scanned: %d", stats.TotalFiles},
+		{"  - Media files: %d", stats.MediaFiles},
+		{"  - JSON sidecars: %d", stats.SidecarFiles},
+		{"  - Other files: %d", stats.OtherFiles},
+		{"JSON metadata files found: %d", stats.JSONFiles},
+		{"Media files processed: %d", stats.ProcessedFiles},
+		{"  - Modified: %d", stats.ModifiedFiles},
+		{"  - Already up-to-date: %d", stats.UnmodifiedFiles},
+		{"Files skipped: %d", stats.SkippedFiles},
+	}
+	for _, reason := range processor.SkipReasonNames() {
+		if n := stats.SkipReasons[reason]; n > 0 {
+			lines = append(lines, summaryLine{"  - " + skipReasonLabel(reason) + ": %d", n})
+		}
+	}
+	optional := []summaryLine{
+		{"Non-media files ignored (HTML, CSV, ...): %d", stats.NonMediaFiles},
+		{"Bytes added by native EXIF insertion: %d", stats.BytesChanged},
+		{"File times synced from EXIF: %d", stats.SyncedFiles},
+		{"Sidecars in older formats: %d", stats.LegacyFiles},
+		{"Picasa entries merged: %d", stats.PicasaFiles},
+		{"Partner-shared items: %d", stats.PartnerFiles},
+		{"Google Photos creations: %d", stats.CreationFiles},
+		{"Corrupt or truncated files: %d", stats.CorruptFiles},
+		{"MPEG transport streams (.ts, .mts, .m2ts): %d", stats.TransportStreams},
+		{"Videos over -max-video-size (skipped): %d", len(stats.OversizedVideos)},
+		{"Copies cloned (copy-on-write): %d", stats.ClonedFiles},
+		{"Files hardlinked to the export: %d", stats.LinkedFiles},
+		{"Writes that did not read back (-verify-writes): %d", stats.WriteMismatches},
+		{"Taken/creation time conflicts: %d", len(stats.TimestampConflicts)},
+		{"Suspected wrong matches (not applied): %d", len(stats.SuspectedMatches)},
+		{"Incomplete albums: %d", len(stats.IncompleteAlbums())},
+		{"Merge conflicts between exports: %d", len(stats.MergeConflicts)},
+		{"Duplicates (not reorganized): %d", len(stats.Duplicates)},
+		{"Files reorganized: %d", stats.Reorganized},
+		{"Verification failures: %d", len(stats.VerifyFailures)},
+	}
+	for _, line := range optional {
+		if line.value != 0 && line.value != int64(0) {
+			lines = append(lines, line)
+		}
+	}
+	return append(lines,
+		summaryLine{"Errors encountered: %d", stats.ErrorCount},
+		summaryLine{"Elapsed: %s", roughDuration(stats.Elapsed)})
+}
+
+// printMarkdownSummary prints the run summary as Markdown tables, ready to paste into
+// an issue, a forum post or migration notes. Paths are relative to the export root.
+func printMarkdownSummary(root string, stats *processor.Statistics, verbose bool) {
+	fmt.Println(markdownHeading("## ", "=== Processing Complete ==="))
+	fmt.Println("| | |")
+	fmt.Println("|---|---:|")
+	for _, line := range summaryLines(stats) {
+		label := tr(line.format)
+		label = strings.TrimSuffix(strings.TrimSpace(label[:strings.LastIndex(label, "%")]), ":")
+		fmt.Printf("| %s | %v |\n", markdownCell(strings.TrimSpace(label)), line.value)
+	}
+
+	if len(stats.Stages) > 0 {
+		fmt.Println(markdownHeading("### ", "=== Time and IO per Stage ==="))
+		fmt.Println("| Stage | Files | Time | Read | Written |")
+		fmt.Println("|---|---:|---:|---:|---:|")
+		for _, name := range processor.StageNames() {
+			if stage, ok := stats.Stages[name]; ok {
+				fmt.Printf("| %s | %d | %s | %s | %s |\n", name, stage.Files, roughDuration(stage.Duration),
+					sizeString(stage.BytesRead), sizeString(stage.BytesWritten))
+			}
+		}
+	}
+
+	if len(stats.SlowestFiles) > 0 {
+		fmt.Println(markdownHeading("### ", "=== Slowest Files ==="))
+		fmt.Println("| Time | Size | File |")
+		fmt.Println("|---:|---:|---|")
+		for _, f := range stats.SlowestFiles {
+			fmt.Printf("| %s | %s | %s |\n", roughDuration(f.Duration), sizeString(f.Size), markdownCell(relativeTo(root, f.Path)))
+		}
+	}
+
+	var errs []string
+	for _, f := range stats.Files {
+		if f.Status == processor.StatusError {
+			errs = append(errs, fmt.Sprintf("`%s`: %s", relativeTo(root, f.Path), f.Message))
+		}
+	}
+	errs = append(errs, stats.VerifyFailures...)
+	if len(errs) > 0 {
+		fmt.Println(markdownHeading("### ", "=== Errors ==="))
+		for i, e := range errs {
+			if i == markdownErrorLimit && !verbose {
+				fmt.Printf("- ... and %d more (use -verbose to list all)\n", len(errs)-i)
+				break
+			}
+			fmt.Printf("- %s\n", e)
+		}
+	}
+}
+
+// markdownHeading turns a translated "=== Title ===" section title into a heading
+func markdownHeading(level, title string) string {
+	return "\n" + level + strings.Trim(tr(title), "= ")
+}
+
+// markdownCell escapes the characters that would end a table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// relativeTo returns path relative to root when it is inside it
+func relativeTo(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
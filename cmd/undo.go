@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// runUndoRenamesCommand implements the "undo-renames" subcommand, renaming the files
+// renamed by -rename-to-title back, newest first
+func runUndoRenamesCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Usage: google-takeout-exif-applier undo-renames <takeout-renames.jsonl>")
+		return 1
+	}
+	entries, err := processor.LoadRenameJournal(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var undone, failed int
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if err := processor.UndoRename(entry); err != nil {
+			failed++
+			fmt.Printf("[ERROR] %s: %v\n", entry.To, err)
+			continue
+		}
+		undone++
+		fmt.Printf("[UNDO] %s -> %s\n", entry.To, entry.From)
+	}
+	fmt.Printf("%d renames undone, %d failed.\n", undone, failed)
+	if failed > 0 {
+		return 2
+	}
+	return 0
+}
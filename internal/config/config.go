@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config represents the optional JSON configuration file passed with -config
+type Config struct {
+	FolderRules       []FolderRule       `json:"folderRules"`
+	CameraShifts      map[string]string  `json:"cameraShifts"`      // Camera model -> time shift, e.g. "+2h37m"
+	SidecarStrategies []string           `json:"sidecarStrategies"` // Order of sidecar matching strategies (empty = default)
+	SidecarRules      []SidecarRule      `json:"sidecarRules"`
+	FilenameDateRules []FilenameDateRule `json:"filenameDateRules"` // nil = the built-in WhatsApp/Telegram rules
+	PicasaSources     []string           `json:"picasaSources"`     // Priority of "json" and "picasa" with -picasa (empty = json first)
+	ExcludeTransport  bool               `json:"excludeTransport"`  // Skip .ts, .mts and .m2ts files instead of sniffing them
+}
+
+// FolderRule overrides or shifts the written date for media in matching folders.
+// Folder is a slash-separated path relative to the Takeout root; each segment may be a glob.
+type FolderRule struct {
+	Folder string `json:"folder"`
+	Date   string `json:"date,omitempty"`  // Fixed date, e.g. "1985-01-01" or "1985-01-01T12:00:00"
+	Shift  string `json:"shift,omitempty"` // Offset, e.g. "-5y", "+3mo10d" or "-2h30m"
+}
+
+// SidecarRule is a custom sidecar naming scheme. Pattern is a regular expression
+// matched against the media file name; JSON is the sidecar name, where $1, ${name}, ...
+// refer to the pattern's groups.
+type SidecarRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	JSON    string `json:"json"`
+}
+
+// FilenameDateRule takes the date of media whose file name matches Pattern from the
+// name, for apps such as WhatsApp whose files carry no EXIF date, so Google only
+// recorded the upload time. Pattern is a regular expression with the named groups
+// year, month and day, and optionally hour, minute and second. Sources lists where
+// the date comes from, in order of priority: "exif", "filename" and "json".
+type FilenameDateRule struct {
+	Name    string   `json:"name"`
+	Pattern string   `json:"pattern"`
+	Sources []string `json:"sources,omitempty"` // Default: exif, filename, json
+}
+
+// Load reads and parses a configuration file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Remove UTF-8 BOM if present
+	if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
+		data = data[3:]
+	}
+
+	var cfg Config
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config file: %w", err)
+	}
+
+	for i, rule := range cfg.FolderRules {
+		if rule.Folder == "" {
+			return nil, fmt.Errorf("folder rule %d: folder is required", i+1)
+		}
+		if (rule.Date == "") == (rule.Shift == "") {
+			return nil, fmt.Errorf("folder rule %q: exactly one of date or shift is required", rule.Folder)
+		}
+	}
+	for i, rule := range cfg.SidecarRules {
+		if rule.Name == "" || rule.Pattern == "" || rule.JSON == "" {
+			return nil, fmt.Errorf("sidecar rule %d: name, pattern and json are required", i+1)
+		}
+	}
+	for i, rule := range cfg.FilenameDateRules {
+		if rule.Name == "" || rule.Pattern == "" {
+			return nil, fmt.Errorf("filename date rule %d: name and pattern are required", i+1)
+		}
+	}
+	return &cfg, nil
+}
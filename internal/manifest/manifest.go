@@ -0,0 +1,121 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Entry is the parsed sidecar data of one media file, keyed by the file's content hash
+// so it can be found again after the file was renamed or moved
+type Entry struct {
+	SHA256    string             `json:"sha256"`
+	Size      int64              `json:"size"`
+	Path      string             `json:"path"`                // Slash-separated, relative to the export root
+	PhotoTime time.Time          `json:"photoTime"`           // Time to write, after time policy, folder rules and shifts
+	UTCOffset int                `json:"utcOffset,omitempty"` // Seconds PhotoTime is ahead of UTC, for -tz-correct local times
+	Metadata  *metadata.Metadata `json:"metadata"`            // Sidecar merged with its supplemental files
+}
+
+// NewEntry describes a media file with the metadata prepared for it
+func NewEntry(sha256 string, size int64, path string, meta *metadata.Metadata) (Entry, error) {
+	photoTime, err := meta.GetPhotoTime()
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{
+		SHA256:    sha256,
+		Size:      size,
+		Path:      path,
+		PhotoTime: photoTime,
+		UTCOffset: int(meta.GetUTCOffset() / time.Second),
+		Metadata:  meta,
+	}, nil
+}
+
+// Meta returns the entry's metadata with its prepared photo time, ready to be applied
+func (e Entry) Meta() *metadata.Metadata {
+	meta := *e.Metadata
+	meta.SetPhotoTime(e.PhotoTime)
+	meta.SetUTCOffset(time.Duration(e.UTCOffset) * time.Second)
+	return &meta
+}
+
+// Writer writes a gzip-compressed JSON Lines manifest, one Entry per line
+type Writer struct {
+	f   *os.File
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+// Create creates or truncates a manifest file
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest: %w", err)
+	}
+	gz := gzip.NewWriter(f)
+	return &Writer{f: f, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// Add appends an entry to the manifest
+func (w *Writer) Add(e Entry) error {
+	if err := w.enc.Encode(e); err != nil {
+		return fmt.Errorf("failed to write manifest entry for %s: %w", e.Path, err)
+	}
+	return nil
+}
+
+// Close flushes the compressed stream and closes the file
+func (w *Writer) Close() error {
+	if err := w.gz.Close(); err != nil {
+		w.f.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Load reads a manifest, compressed or not
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress manifest %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var entries []Entry
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var e Entry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %s, entry %d: %w", path, line, err)
+		}
+		if e.SHA256 == "" || e.Metadata == nil {
+			return nil, fmt.Errorf("manifest %s, entry %d: sha256 and metadata are required", path, line)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
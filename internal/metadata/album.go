@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// albumMetadataNames lists the (localized) names Google uses for album metadata files
+var albumMetadataNames = []string{
+	"metadata.json",
+	"Metadaten.json",
+	"métadonnées.json",
+	"metadatos.json",
+	"metadati.json",
+	"metadados.json",
+	"metadane.json",
+	"メタデータ.json",
+}
+
+// AlbumMetadata represents the album-level metadata.json found in album folders
+type AlbumMetadata struct {
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Access      string       `json:"access"`
+	Date        CreationTime `json:"date"`
+	Enrichments []Enrichment `json:"enrichments"`
+	ItemCount   int          `json:"-"` // Items in the album, when the file says
+	Members     []string     `json:"-"` // File names of the items, when the file lists them
+}
+
+// Enrichment is an album enrichment added in Google Photos (location or narrative text)
+type Enrichment struct {
+	Narrative *NarrativeEnrichment `json:"narrativeEnrichment,omitempty"`
+	Location  *LocationEnrichment  `json:"locationEnrichment,omitempty"`
+}
+
+// NarrativeEnrichment is a free-text caption inside an album
+type NarrativeEnrichment struct {
+	Text string `json:"text"`
+}
+
+// LocationEnrichment is a map/location card inside an album
+type LocationEnrichment struct {
+	Location []EnrichmentLocation `json:"location"`
+}
+
+// EnrichmentLocation is a single named place from a location enrichment
+type EnrichmentLocation struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	LatitudeE7  int64  `json:"latitudeE7"`
+	LongitudeE7 int64  `json:"longitudeE7"`
+}
+
+// LocationNames returns the unique place names from the album's location enrichments
+func (a *AlbumMetadata) LocationNames() []string {
+	var names []string
+	for _, enrichment := range a.Enrichments {
+		if enrichment.Location == nil {
+			continue
+		}
+		for _, location := range enrichment.Location.Location {
+			if location.Name != "" && !containsString(names, location.Name) {
+				names = append(names, location.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Narratives returns the text of the album's narrative enrichments
+func (a *AlbumMetadata) Narratives() []string {
+	var texts []string
+	for _, enrichment := range a.Enrichments {
+		if enrichment.Narrative != nil && enrichment.Narrative.Text != "" {
+			texts = append(texts, enrichment.Narrative.Text)
+		}
+	}
+	return texts
+}
+
+// IsAlbumMetadataFile reports whether the file name is one of the album metadata names
+func IsAlbumMetadataFile(path string) bool {
+	name := filepath.Base(path)
+	for _, candidate := range albumMetadataNames {
+		if name == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// FindAlbumMetadata looks for an album metadata file in dir, returning its path or ""
+func FindAlbumMetadata(dir string) string {
+	for _, name := range albumMetadataNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// ParseAlbumJSON parses an album metadata file
+func ParseAlbumJSON(jsonPath string) (*AlbumMetadata, error) {
+	var album AlbumMetadata
+	err := readJSONFile(jsonPath, func(data []byte, _ os.FileInfo) error {
+		// Remove UTF-8 BOM if present
+		if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
+			data = data[3:]
+		}
+		if err := json.Unmarshal(data, &album); err != nil {
+			return fmt.Errorf("failed to unmarshal album JSON: %w", err)
+		}
+		album.parseAlbumMembers(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
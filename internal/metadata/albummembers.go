@@ -0,0 +1,85 @@
+package metadata
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Keys under which the album metadata of some exports gives the number of items in
+// the album and the items themselves
+var (
+	albumCountKeys  = []string{"mediaItemsCount", "itemCount", "photosCount", "totalMediaItems"}
+	albumMemberKeys = []string{"mediaItems", "items", "photos"}
+	memberNameKeys  = []string{"title", "filename", "fileName", "name"}
+)
+
+// ExpectedItems returns how many items the album metadata says the album holds: the
+// number of members it lists, or else its item count, 0 when it says neither
+func (a *AlbumMetadata) ExpectedItems() int {
+	if len(a.Members) > 0 {
+		return len(a.Members)
+	}
+	return a.ItemCount
+}
+
+// parseAlbumMembers reads the item count and the file names of the members from an
+// album metadata file, into a.ItemCount and a.Members
+func (a *AlbumMetadata) parseAlbumMembers(data []byte) {
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(data, &doc) != nil {
+		return
+	}
+	for _, key := range albumCountKeys {
+		if n := jsonCount(doc[key]); n > 0 {
+			a.ItemCount = n
+			break
+		}
+	}
+	for _, key := range albumMemberKeys {
+		var items []json.RawMessage
+		if json.Unmarshal(doc[key], &items) != nil {
+			continue
+		}
+		for _, item := range items {
+			if name := memberName(item); name != "" {
+				a.Members = append(a.Members, name)
+			}
+		}
+		if len(a.Members) > 0 {
+			return
+		}
+	}
+}
+
+// jsonCount reads a count given as a JSON number or a string, 0 when it is neither
+func jsonCount(raw json.RawMessage) int {
+	var n int
+	if json.Unmarshal(raw, &n) == nil {
+		return n
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		n, _ = strconv.Atoi(strings.TrimSpace(s))
+	}
+	return n
+}
+
+// memberName returns the file name of an album member, given as a plain string or as
+// an object with its title or file name
+func memberName(raw json.RawMessage) string {
+	var name string
+	if json.Unmarshal(raw, &name) == nil {
+		return strings.TrimSpace(name)
+	}
+	var item map[string]json.RawMessage
+	if json.Unmarshal(raw, &item) != nil {
+		return ""
+	}
+	for _, key := range memberNameKeys {
+		if json.Unmarshal(item[key], &name) == nil && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
@@ -1,10 +1,14 @@
 package metadata
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,20 +17,47 @@ import (
 type ApplyResult struct {
 	Modified     bool
 	Details      string
-	ExistingData string
-	NewData      string
+	Changes      []FieldChange // Tags written, or checked when the file was up to date
+	BytesChanged int64         // Bytes added to the file by the native EXIF writer
 }
 
-// ApplyToFile applies the metadata to a media file
-func ApplyToFile(mediaPath string, meta *Metadata) (*ApplyResult, error) {
+// ApplyOptions controls how metadata is written to media files
+type ApplyOptions struct {
+	VideoXMPSidecar bool          // Write .xmp sidecars for videos instead of remuxing them
+	WriteProvenance bool          // Record the Takeout device/app origin in UserComment / xmp:CreatorTool
+	Keywords        []string      // Keywords added to XMP dc:Subject
+	TimeTolerance   time.Duration // Existing times within this window count as up-to-date
+	GPSTimestamps   bool          // Also write GPSDateStamp/GPSTimeStamp (UTC) when GPS is present
+	WriteMarker     bool          // Record AppliedMarker in XMP dc:source
+	OriginalName    string        // Record this name in XMP xmpMM:PreservedFileName (renamed copies)
+	FastStart       bool          // Move the moov box of remuxed MP4/MOV files to the front
+	Writer          string        // WriterAuto or WriterNative; empty means WriterAuto
+	Audit           *AuditTrail   // Record where the metadata came from in XMP, nil to omit
+	SharedComments  bool          // Write shared album likes and comments to XMP
+	InPlace         bool          // Overwrite files in place, keeping their inode, instead of replacing them
+	LinkedTo        string        // The file is a hardlink of this one; give it its own copy before changing it in place
+	StripGoogleXMP  bool          // Remove the edit history and editing breadcrumbs from the XMP of images
+	FaceRegions     bool          // Write the known face rectangles to images as MWG regions
+}
+
+// ApplyToFile applies the metadata to a media file. Cancelling ctx stops any
+// exiftool, ffmpeg or mkvpropedit process still running for the file.
+func ApplyToFile(ctx context.Context, mediaPath string, meta *Metadata, opts ApplyOptions) (*ApplyResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Check if it's an image
 	if isImageFile(mediaPath) {
-		return applyToImage(mediaPath, meta)
+		return applyToImage(ctx, mediaPath, meta, opts)
 	}
 
 	// Check if it's a video
 	if isVideoFile(mediaPath) {
-		return applyToVideo(mediaPath, meta)
+		if opts.VideoXMPSidecar {
+			return applyVideoSidecar(mediaPath, meta, opts)
+		}
+		return applyToVideo(ctx, mediaPath, meta, opts)
 	}
 
 	return nil, fmt.Errorf("unsupported media file type: %s", filepath.Ext(mediaPath))
@@ -70,8 +101,9 @@ func isVideoFile(path string) bool {
 	return videoExts[ext]
 }
 
-// applyToImage applies metadata to image files using exiftool if available, otherwise just timestamps
-func applyToImage(imagePath string, meta *Metadata) (*ApplyResult, error) {
+// applyToImage applies metadata to image files: JPEGs, TIFFs and DNGs natively unless
+// exiftool is needed, other formats using exiftool if available, otherwise just timestamps
+func applyToImage(ctx context.Context, imagePath string, meta *Metadata, opts ApplyOptions) (*ApplyResult, error) {
 	photoTime, err := meta.GetPhotoTime()
 	if err != nil {
 		return nil, fmt.Errorf("no valid timestamp in metadata: %w", err)
@@ -82,44 +114,140 @@ func applyToImage(imagePath string, meta *Metadata) (*ApplyResult, error) {
 		Modified: false,
 	}
 
-	// Try using exiftool first if available
-	_, err = exec.LookPath("exiftool")
-	if err == nil {
-		return applyImageMetadataWithExiftool(imagePath, meta, photoTime, result)
+	// Compare against the embedded EXIF natively, so the skip decision is reliable
+	// and works without exiftool
+	existing, err := readEXIF(imagePath)
+	nativeRead := err == nil
+	exiftool := useExiftool(opts)
+	var old map[string]string
+	if nativeRead {
+		old = existing.values()
+		// The XMP checks read the tags back through exiftool when it is used, and the XMP
+		// of JPEGs natively otherwise; other formats can't have them written without
+		// exiftool, so there they never force a rewrite
+		if exifMatches(existing, photoTime, meta, opts.TimeTolerance) && gpsStampPresent(existing, opts) && xmpUpToDate(ctx, imagePath, meta, opts, nil) {
+			result.Changes = unchangedFields(old, "DateTimeOriginal", "DateTime", "GPSLatitude", "GPSLongitude", "GPSDateStamp")
+			return result, nil
+		}
+	}
+
+	// JPEGs are written natively, leaving the image data untouched: always when they
+	// have no EXIF segment yet, and without exiftool (or with -writer native) when the
+	// native reader understands the existing one
+	if isJPEGFile(imagePath) && (errors.Is(err, errNoEXIF) || (nativeRead && !exiftool)) {
+		return applyNativeEXIF(imagePath, meta, photoTime, opts, old, result)
+	}
+
+	// TIFF and DNG files are their own EXIF block, written natively without exiftool
+	// (or with -writer native); XMP and IPTC are left to exiftool
+	if isTIFFFile(imagePath) && nativeRead && !exiftool {
+		return applyNativeTIFF(imagePath, meta, photoTime, opts, old, result)
+	}
+
+	// Other formats go through exiftool if available
+	if exiftool {
+		return applyImageMetadataWithExiftool(ctx, imagePath, meta, photoTime, opts, old, result)
 	}
 
-	// Fallback to just updating timestamps if exiftool not available
-	fmt.Printf("[INFO] exiftool not found, updating timestamps only for: %s\n", imagePath)
+	// Fallback to just updating timestamps if exiftool is not available or not selected
+	if opts.Writer == WriterNative {
+		fmt.Printf("[INFO] no native writer for this format, updating timestamps only for: %s\n", imagePath)
+	} else {
+		fmt.Printf("[INFO] exiftool not found, updating timestamps only for: %s\n", imagePath)
+	}
+	result.Changes = []FieldChange{fileTimeChange(imagePath, photoTime)}
+	if err := detach(imagePath, opts); err != nil {
+		return result, writeFailed(imagePath, err)
+	}
 	err = os.Chtimes(imagePath, photoTime, photoTime)
 	if err != nil {
-		return result, fmt.Errorf("failed to update file times: %w", err)
+		return result, writeFailed(imagePath, fmt.Errorf("failed to update file times: %w", err))
 	}
 
 	result.Modified = true
-	result.NewData = fmt.Sprintf("DateTime=%s", photoTime.Format("2006-01-02 15:04:05"))
 	return result, nil
 }
 
-// applyImageMetadataWithExiftool uses exiftool to embed metadata and check existing data
-func applyImageMetadataWithExiftool(imagePath string, meta *Metadata, photoTime time.Time, result *ApplyResult) (*ApplyResult, error) {
-	// First, check existing EXIF data
-	existingData := getExistingImageEXIF(imagePath)
-	result.ExistingData = existingData
+// applyNativeEXIF writes the EXIF, XMP and IPTC metadata of a JPEG without exiftool,
+// merging it into the existing segments or inserting new ones. old holds the values
+// read natively, nil when the file had no EXIF segment.
+func applyNativeEXIF(imagePath string, meta *Metadata, photoTime time.Time, opts ApplyOptions, old map[string]string, result *ApplyResult) (*ApplyResult, error) {
+	fields := newEXIFFields(meta, photoTime, opts)
+	added, err := rewriteJPEG(imagePath, opts.InPlace, func(segments []jpegSegment) ([]jpegSegment, error) {
+		return setJPEGMetadata(segments, fields, opts)
+	})
+	if err != nil {
+		return result, writeFailed(imagePath, fmt.Errorf("failed to write EXIF segment: %w", err))
+	}
+
+	// Update file modification time
+	err = os.Chtimes(imagePath, photoTime, photoTime)
+	if err != nil {
+		return result, writeFailed(imagePath, fmt.Errorf("failed to update file times: %w", err))
+	}
 
+	result.Modified = true
+	result.BytesChanged = added
+	result.Changes = fields.changes(opts, old)
+	return result, nil
+}
+
+// applyNativeTIFF writes the EXIF metadata of a TIFF or DNG file without exiftool,
+// appending the changed IFDs. old holds the values read natively.
+func applyNativeTIFF(imagePath string, meta *Metadata, photoTime time.Time, opts ApplyOptions, old map[string]string, result *ApplyResult) (*ApplyResult, error) {
+	fields := newEXIFFields(meta, photoTime, opts)
+	added, err := rewriteTIFFFile(imagePath, opts.InPlace, fields)
+	if err != nil {
+		return result, writeFailed(imagePath, fmt.Errorf("failed to write EXIF data: %w", err))
+	}
+
+	// Update file modification time
+	err = os.Chtimes(imagePath, photoTime, photoTime)
+	if err != nil {
+		return result, writeFailed(imagePath, fmt.Errorf("failed to update file times: %w", err))
+	}
+
+	result.Modified = true
+	result.BytesChanged = added
+	result.Changes = exifChanges(fields.changes(opts, old))
+	return result, nil
+}
+
+// applyImageMetadataWithExiftool uses exiftool to embed metadata and check existing data
+// existing holds the values read natively, nil when the native reader could not read the file.
+func applyImageMetadataWithExiftool(ctx context.Context, imagePath string, meta *Metadata, photoTime time.Time, opts ApplyOptions, existing map[string]string, result *ApplyResult) (*ApplyResult, error) {
 	// Prepare new metadata to check against existing
 	newDateTime := photoTime.Format("2006:01:02 15:04:05")
 
-	// Check if EXIF already matches what we want to write
-	if existingData != "" && shouldSkipImageModification(existingData, newDateTime, meta) {
-		result.Modified = false
-		result.NewData = fmt.Sprintf("DateTime=%s", photoTime.Format("2006-01-02 15:04:05"))
-		return result, nil
+	// Formats the native reader doesn't handle (PNG, HEIC, ...) are checked through exiftool's output
+	if existing == nil {
+		existing = getExistingImageEXIF(ctx, imagePath, meta, opts)
+		current := exiftoolEXIF(existing)
+
+		// Check if EXIF already matches what we want to write
+		if exifMatches(current, photoTime, meta, opts.TimeTolerance) && gpsStampPresent(current, opts) && xmpUpToDate(ctx, imagePath, meta, opts, existing) {
+			result.Modified = false
+			result.Changes = unchangedFields(existing, "DateTimeOriginal", "DateTime", "GPSLatitude", "GPSLongitude", "Subject")
+			return result, nil
+		}
 	}
 
 	// EXIF data needs updating, proceed with exiftool
 	args := []string{
-		"-overwrite_original",
+		overwriteArg(opts),
 		fmt.Sprintf("-DateTime=%s", newDateTime),
+		fmt.Sprintf("-DateTimeOriginal=%s", newDateTime),
+		fmt.Sprintf("-CreateDate=%s", newDateTime),
+	}
+
+	// Legacy DAMs read the IPTC dates only; keep them consistent with EXIF
+	if supportsIPTC(imagePath) {
+		var offset time.Duration
+		if utc, err := meta.GetUTCTime(); err == nil {
+			offset = photoTime.Sub(utc)
+		}
+		args = append(args, fmt.Sprintf("-IPTC:DateCreated=%s", photoTime.Format("2006:01:02")))
+		args = append(args, fmt.Sprintf("-IPTC:TimeCreated=%s%s", photoTime.Format("15:04:05"), formatUTCOffset(offset, ":")))
 	}
 
 	// Add description if available
@@ -128,6 +256,46 @@ func applyImageMetadataWithExiftool(imagePath string, meta *Metadata, photoTime
 		args = append(args, fmt.Sprintf("-Comment=%s", meta.Description))
 	}
 
+	// Add device/app provenance if requested
+	if provenance := meta.GetProvenance(); opts.WriteProvenance && provenance != "" {
+		args = append(args, fmt.Sprintf("-UserComment=%s", provenance))
+	}
+
+	if opts.WriteMarker {
+		args = append(args, fmt.Sprintf("-XMP-dc:Source=%s", AppliedMarker))
+	}
+	if opts.OriginalName != "" {
+		args = append(args, fmt.Sprintf("-XMP-xmpMM:PreservedFileName=%s", opts.OriginalName))
+	}
+
+	if rating := meta.GetRating(); rating > 0 {
+		args = append(args, fmt.Sprintf("-XMP-xmp:Rating=%d", rating))
+	}
+
+	if opts.StripGoogleXMP {
+		args = append(args, googleXMPArgs("=")...)
+	}
+
+	// Add keywords, removing first so repeated runs don't duplicate them
+	for _, keyword := range opts.Keywords {
+		args = append(args, fmt.Sprintf("-XMP-dc:Subject-=%s", keyword))
+		args = append(args, fmt.Sprintf("-XMP-dc:Subject+=%s", keyword))
+	}
+
+	// The tool's own namespaces must be declared to exiftool before any other argument
+	fields := newEXIFFields(meta, photoTime, opts)
+	if len(fields.Faces) > 0 {
+		fields.Width, fields.Height = imageDimensions(ctx, imagePath)
+		args = append(args, regionArgs(fields)...)
+	}
+	if own := append(auditArgs(fields, opts), socialArgs(fields)...); len(own) > 0 {
+		config, err := exiftoolConfig()
+		if err != nil {
+			return result, err
+		}
+		args = append(append([]string{"-config", config}, args...), own...)
+	}
+
 	// Add GPS data if available
 	if lat, latOk := meta.GetLatitude(); latOk {
 		if lon, lonOk := meta.GetLongitude(); lonOk {
@@ -137,89 +305,257 @@ func applyImageMetadataWithExiftool(imagePath string, meta *Metadata, photoTime
 			if alt, altOk := meta.GetAltitude(); altOk {
 				args = append(args, fmt.Sprintf("-GPSAltitude=%f", alt))
 			}
+
+			// GPS time is always UTC, even when the local time is written to DateTimeOriginal
+			if utc, err := meta.GetUTCTime(); err == nil && opts.GPSTimestamps {
+				args = append(args, fmt.Sprintf("-GPSDateStamp=%s", utc.Format("2006:01:02")))
+				args = append(args, fmt.Sprintf("-GPSTimeStamp=%s", utc.Format("15:04:05")))
+			}
 		}
 	}
 
 	args = append(args, imagePath)
 
-	cmd := exec.Command("exiftool", args...)
+	cmd := exiftoolCommand(ctx, args...)
 	err := cmd.Run()
+	if err != nil && ctx.Err() != nil {
+		return result, writeFailed(imagePath, fmt.Errorf("exiftool interrupted: %w", ctx.Err()))
+	}
 	if err != nil {
 		fmt.Printf("[WARN] exiftool failed, updating timestamps only: %v\n", err)
 		// Fall back to timestamps
+		result.Changes = []FieldChange{fileTimeChange(imagePath, photoTime)}
+		if err := detach(imagePath, opts); err != nil {
+			return result, writeFailed(imagePath, err)
+		}
 		err = os.Chtimes(imagePath, photoTime, photoTime)
 		if err != nil {
-			return result, fmt.Errorf("failed to update file times: %w", err)
+			return result, writeFailed(imagePath, fmt.Errorf("failed to update file times: %w", err))
 		}
 		result.Modified = true
-		result.NewData = fmt.Sprintf("DateTime=%s", photoTime.Format("2006-01-02 15:04:05"))
 		return result, nil
 	}
 
-	// Update file modification time
+	// Update file modification time; exiftool may have rewritten a linked file in place
+	if err := detach(imagePath, opts); err != nil {
+		return result, writeFailed(imagePath, err)
+	}
 	err = os.Chtimes(imagePath, photoTime, photoTime)
 	if err != nil {
-		return result, fmt.Errorf("failed to update file times: %w", err)
+		return result, writeFailed(imagePath, fmt.Errorf("failed to update file times: %w", err))
 	}
 
 	result.Modified = true
-	gpsStr := fmt.Sprintf("DateTime=%s", photoTime.Format("2006-01-02 15:04:05"))
-	if lat, latOk := meta.GetLatitude(); latOk {
-		if lon, lonOk := meta.GetLongitude(); lonOk {
-			gpsStr = fmt.Sprintf("%s, GPS: %.6f, %.6f", gpsStr, lat, lon)
+	result.Changes = changesFromArgs(args[:len(args)-1], existing)
+	return result, nil
+}
+
+// gpsStampPresent reports whether the GPS date stamp is already there when it is requested.
+// Only files whose JSON has coordinates get one.
+func gpsStampPresent(existing *exifData, opts ApplyOptions) bool {
+	return !opts.GPSTimestamps || !existing.HasGPS || existing.GPSDateStamp != ""
+}
+
+// hasKeywords checks that every requested keyword is already present in the existing data
+func hasKeywords(existingData string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if !strings.Contains(existingData, keyword) {
+			return false
 		}
 	}
-	result.NewData = gpsStr
-	return result, nil
+	return true
 }
 
-// shouldSkipImageModification checks if the existing EXIF data matches what we want
-func shouldSkipImageModification(existingData string, newDateTime string, meta *Metadata) bool {
-	// If no existing data, we need to modify
-	if strings.TrimSpace(existingData) == "" {
-		return false
+// xmpUpToDate reports whether the file already has the XMP data the options add.
+// values holds the tags read by getExistingImageEXIF; when nil, they are read only if
+// exiftool is used and one of the checks needs them, so each file costs at most one
+// exiftool call.
+func xmpUpToDate(ctx context.Context, imagePath string, meta *Metadata, opts ApplyOptions, values map[string]string) bool {
+	if values == nil && useExiftool(opts) && (len(opts.Keywords) > 0 || len(xmpCheckArgs(imagePath, meta, opts)) > 0) {
+		values = getExistingImageEXIF(ctx, imagePath, meta, opts)
 	}
+	return keywordsPresent(values, imagePath, opts) && originalNamePresent(values, imagePath, opts) &&
+		auditPresent(values, imagePath, opts) && socialPresent(values, imagePath, meta, opts) &&
+		ratingPresent(values, imagePath, meta, opts) && regionsPresent(values, imagePath, meta, opts) &&
+		googleXMPStripped(values, imagePath, opts)
+}
 
-	// Check if DateTime matches (allow some flexibility in format)
-	existingLower := strings.ToLower(existingData)
+// xmpCheckArgs returns the exiftool arguments reading the XMP tags xmpUpToDate
+// compares besides the keywords, which getExistingImageEXIF always reads
+func xmpCheckArgs(imagePath string, meta *Metadata, opts ApplyOptions) []string {
+	var args []string
+	if opts.OriginalName != "" {
+		args = append(args, "-XMP-xmpMM:PreservedFileName")
+	}
+	if opts.Audit != nil {
+		args = append(args, "-XMP-"+AuditPrefix+":SourceSidecar")
+	}
+	if opts.SharedComments && (len(meta.GetComments()) > 0 || len(meta.GetLikes()) > 0) {
+		args = append(args, "-XMP-"+SocialPrefix+":Comments", "-XMP-"+SocialPrefix+":Likes")
+	}
+	if meta.GetRating() > 0 {
+		args = append(args, "-XMP-xmp:Rating")
+	}
+	if opts.FaceRegions && len(meta.GetFaces()) > 0 {
+		args = append(args, "-XMP-mwg-rs:RegionAreaX")
+	}
+	// The XMP of JPEGs is searched for Google edit data natively
+	if opts.StripGoogleXMP && !isJPEGFile(imagePath) {
+		args = append(args, googleXMPArgs("")...)
+	}
+	return args
+}
+
+// keywordsPresent checks that the file already has every keyword
+func keywordsPresent(values map[string]string, imagePath string, opts ApplyOptions) bool {
+	if len(opts.Keywords) == 0 {
+		return true
+	}
+	if useExiftool(opts) {
+		return hasKeywords(values["Subject"], opts.Keywords)
+	}
+	if !isJPEGFile(imagePath) {
+		return true
+	}
+	xmp := readJPEGXMP(imagePath)
+	for _, keyword := range opts.Keywords {
+		if !bytes.Contains(xmp, []byte("<rdf:li>"+xmlEscape(keyword)+"</rdf:li>")) {
+			return false
+		}
+	}
+	return true
+}
 
-	// Simple check: if the new datetime appears in existing data, likely already set
-	if strings.Contains(existingLower, strings.ToLower(strings.Split(newDateTime, " ")[0])) {
+// originalNamePresent checks that the file already records its original name
+func originalNamePresent(values map[string]string, imagePath string, opts ApplyOptions) bool {
+	if opts.OriginalName == "" {
 		return true
 	}
+	if useExiftool(opts) {
+		return values["PreservedFileName"] == opts.OriginalName
+	}
+	return !isJPEGFile(imagePath) || bytes.Contains(readJPEGXMP(imagePath), []byte(xmlEscape(opts.OriginalName)))
+}
 
-	return false
+// readJPEGXMP returns the XMP packet of a JPEG, nil when it has none or can't be read
+func readJPEGXMP(imagePath string) []byte {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	segment, err := findJPEGSegment(f, 0xE1, xmpHeader)
+	if err != nil {
+		return nil
+	}
+	return segment
 }
 
-// getExistingImageEXIF retrieves existing EXIF data from an image
-func getExistingImageEXIF(imagePath string) string {
-	cmd := exec.Command("exiftool", "-DateTime", "-GPSLatitude", "-GPSLongitude", imagePath)
-	output, err := cmd.Output()
+// getExistingImageEXIF retrieves the existing EXIF data of an image through exiftool,
+// with the GPS values signed by their references, along with the XMP tags the
+// up-to-date check compares (see xmpCheckArgs). Lists are joined with listSeparator.
+// It is empty when exiftool fails.
+func getExistingImageEXIF(ctx context.Context, imagePath string, meta *Metadata, opts ApplyOptions) map[string]string {
+	args := []string{"-s", "-G1", "-n", "-sep", listSeparator, "-DateTime", "-DateTimeOriginal", "-GPSLatitude", "-GPSLatitudeRef",
+		"-GPSLongitude", "-GPSLongitudeRef", "-GPSDateStamp", "-XMP-dc:Subject"}
+	args = append(args, xmpCheckArgs(imagePath, meta, opts)...)
+	output, err := exiftoolCommand(ctx, append(args, imagePath)...).Output()
 	if err != nil {
-		return ""
+		return map[string]string{}
 	}
-	return strings.TrimSpace(string(output))
+	return existingImageValues(string(output))
+}
+
+// existingImageValues parses the output of getExistingImageEXIF ("[Group] TagName : value"
+// lines), naming the tags without their group and signing the GPS values. The tags
+// of the Google edit data are only noted under googleEditTag.
+func existingImageValues(output string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		var group string
+		if rest, ok := strings.CutPrefix(line, "["); ok {
+			if group, rest, ok = strings.Cut(rest, "]"); !ok {
+				continue
+			}
+			line = rest
+		}
+		tag, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		tag = strings.TrimSpace(tag)
+		if isGoogleEditTag(group, tag) {
+			values[googleEditTag] = group + ":" + tag
+			continue
+		}
+		values[tag] = strings.TrimSpace(value)
+	}
+	for name, ref := range gpsRefTags {
+		// XMP coordinates are printed signed and have no reference tag
+		if value, ok := values[name]; ok && values[ref] != "" {
+			values[name] = signedGPSValue(value, values[ref])
+		}
+	}
+	return values
+}
+
+// exiftoolEXIF turns the values read by getExistingImageEXIF into the fields the
+// native reader returns, for the "already up-to-date" check
+func exiftoolEXIF(values map[string]string) *exifData {
+	data := &exifData{
+		DateTime:         values["DateTime"],
+		DateTimeOriginal: values["DateTimeOriginal"],
+		GPSDateStamp:     values["GPSDateStamp"],
+	}
+	lat, latErr := strconv.ParseFloat(values["GPSLatitude"], 64)
+	lon, lonErr := strconv.ParseFloat(values["GPSLongitude"], 64)
+	if latErr == nil && lonErr == nil {
+		data.HasGPS = true
+		data.Latitude = lat
+		data.Longitude = lon
+	}
+	return data
 }
 
 // applyToVideo applies metadata to video files using ffmpeg
-func applyToVideo(videoPath string, meta *Metadata) (*ApplyResult, error) {
+func applyToVideo(ctx context.Context, videoPath string, meta *Metadata, opts ApplyOptions) (*ApplyResult, error) {
 	result := &ApplyResult{
 		Details:  filepath.Base(videoPath),
 		Modified: false,
 	}
 
-	// Check if ffmpeg is available
-	_, err := exec.LookPath("ffmpeg")
-	if err != nil {
+	// Matroska files can be edited in place with mkvpropedit, avoiding a full remux
+	if strings.ToLower(filepath.Ext(videoPath)) == ".mkv" && useTool(opts, "mkvpropedit") {
+		if err := detach(videoPath, opts); err != nil {
+			return result, writeFailed(videoPath, err)
+		}
+		return applyToMKV(ctx, videoPath, meta, result)
+	}
+
+	// Without ffmpeg, MP4/MOV files get their moov box edited natively
+	if !useTool(opts, "ffmpeg") {
+		if isoBMFFExts[strings.ToLower(filepath.Ext(videoPath))] {
+			return applyNativeMP4(videoPath, meta, opts, result)
+		}
 		// Fallback to just updating timestamps if ffmpeg is not available
-		fmt.Printf("[WARN] ffmpeg not found, updating timestamps only for: %s\n", videoPath)
+		if opts.Writer == WriterNative {
+			fmt.Printf("[WARN] no native writer for this format, updating timestamps only for: %s\n", videoPath)
+		} else {
+			fmt.Printf("[WARN] ffmpeg not found, updating timestamps only for: %s\n", videoPath)
+		}
 		photoTime, err := meta.GetPhotoTime()
 		if err == nil {
 			result.Modified = true
-			result.NewData = fmt.Sprintf("DateTime=%s", photoTime.Format("2006-01-02 15:04:05"))
-			return result, os.Chtimes(videoPath, photoTime, photoTime)
+			result.Changes = []FieldChange{fileTimeChange(videoPath, photoTime)}
+			if err := detach(videoPath, opts); err != nil {
+				return result, writeFailed(videoPath, err)
+			}
+			if err := os.Chtimes(videoPath, photoTime, photoTime); err != nil {
+				return result, writeFailed(videoPath, fmt.Errorf("failed to update file times: %w", err))
+			}
+			return result, nil
 		}
-		return result, fmt.Errorf("ffmpeg not available and no valid timestamp in metadata")
+		return result, fmt.Errorf("%w (ffmpeg), and %w", ErrToolMissing, err)
 	}
 
 	photoTime, err := meta.GetPhotoTime()
@@ -237,10 +573,10 @@ func applyToVideo(videoPath string, meta *Metadata) (*ApplyResult, error) {
 	base := filepath.Base(videoPath)
 
 	// Join them together with the prefix using filepath.Join()
-	tempOutput := filepath.Join(dir, prefix+base)
+	tempOutput := TrackTempFile(filepath.Join(dir, prefix+base))
 
 	defer func() {
-		os.Remove(tempOutput)
+		RemoveTempFile(tempOutput)
 	}()
 
 	// Build ffmpeg command to add metadata
@@ -266,30 +602,134 @@ func applyToVideo(videoPath string, meta *Metadata) (*ApplyResult, error) {
 		}
 	}
 
+	// ffmpeg writes the moov box after the media data; keep it in front for files that
+	// had it there, so streaming setups relying on faststart keep working
+	if isoBMFFExts[strings.ToLower(filepath.Ext(videoPath))] && (opts.FastStart || moovFirst(videoPath)) {
+		args = append(args, "-movflags", "+faststart")
+	}
+
 	// Add codec and output file
 	args = append(args, "-c", "copy", "-y", tempOutput)
 
-	cmd := exec.Command("ffmpeg", args...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 
 	// Run ffmpeg
 	err = cmd.Run()
+	if err != nil && ctx.Err() != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("ffmpeg interrupted: %w", ctx.Err()))
+	}
 	if err != nil {
-		return result, fmt.Errorf("ffmpeg failed: %w", err)
+		return result, writeFailed(videoPath, fmt.Errorf("ffmpeg failed: %w", err))
+	}
+
+	// Some players only honor the rotation in the track header, which a remux may drop
+	// or rewrite; put the original one back and verify it before replacing the video
+	if err := preserveRotation(videoPath, tempOutput); err != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("failed to keep the video rotation: %w", err))
 	}
 
 	// Replace original with temp file
-	err = os.Rename(tempOutput, videoPath)
+	err = replaceFile(tempOutput, videoPath, opts.InPlace)
+	if err != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("failed to replace original video: %w", err))
+	}
+
+	// Update file modification time
+	err = os.Chtimes(videoPath, photoTime, photoTime)
 	if err != nil {
-		return result, fmt.Errorf("failed to replace original video: %w", err)
+		return result, writeFailed(videoPath, fmt.Errorf("failed to update file times: %w", err))
+	}
+
+	result.Modified = true
+	result.Changes = ffmpegChanges(args)
+	return result, nil
+}
+
+// applyToMKV edits the Matroska segment info (date and title) in place using mkvpropedit
+func applyToMKV(ctx context.Context, videoPath string, meta *Metadata, result *ApplyResult) (*ApplyResult, error) {
+	photoTime, err := meta.GetPhotoTime()
+	if err != nil {
+		return result, fmt.Errorf("no valid timestamp in metadata: %w", err)
+	}
+
+	args := []string{
+		videoPath,
+		"--edit", "info",
+		"--set", fmt.Sprintf("date=%s", photoTime.Format(time.RFC3339)),
+	}
+	if meta.Title != "" {
+		args = append(args, "--set", fmt.Sprintf("title=%s", meta.Title))
+	}
+
+	cmd := exec.CommandContext(ctx, "mkvpropedit", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("mkvpropedit failed: %w: %s", err, strings.TrimSpace(string(output))))
 	}
 
 	// Update file modification time
 	err = os.Chtimes(videoPath, photoTime, photoTime)
 	if err != nil {
-		return result, fmt.Errorf("failed to update file times: %w", err)
+		return result, writeFailed(videoPath, fmt.Errorf("failed to update file times: %w", err))
 	}
 
 	result.Modified = true
-	result.NewData = fmt.Sprintf("creation_time=%s", photoTime.Format("2006-01-02T15:04:05"))
+	result.Changes = []FieldChange{{Tag: "date", New: photoTime.Format(time.RFC3339)}}
+	if meta.Title != "" {
+		result.Changes = append(result.Changes, FieldChange{Tag: "title", New: meta.Title})
+	}
+	return result, nil
+}
+
+// applyVideoSidecar writes an XMP sidecar next to the video instead of rewriting it
+func applyVideoSidecar(videoPath string, meta *Metadata, opts ApplyOptions) (*ApplyResult, error) {
+	result := &ApplyResult{
+		Details:  filepath.Base(videoPath),
+		Modified: false,
+	}
+
+	photoTime, err := meta.GetPhotoTime()
+	if err != nil {
+		return result, fmt.Errorf("no valid timestamp in metadata: %w", err)
+	}
+
+	sidecarPath := videoPath + ".xmp"
+	packet := buildXMPPacket(meta, photoTime)
+	if utc, err := meta.GetUTCTime(); err == nil && opts.GPSTimestamps && packet.simple["exif:GPSLatitude"] != "" {
+		packet.Set("exif:GPSTimeStamp", utc.Format("2006-01-02T15:04:05Z"))
+	}
+	if opts.WriteProvenance {
+		packet.Set("xmp:CreatorTool", meta.GetProvenance())
+	}
+	packet.AddToBag("dc:subject", opts.Keywords...)
+	if opts.WriteMarker {
+		packet.Set("dc:source", AppliedMarker)
+	}
+	packet.Set("xmpMM:PreservedFileName", opts.OriginalName)
+	fields := newEXIFFields(meta, photoTime, opts)
+	packet.setAudit(fields, opts)
+	packet.setSocial(fields)
+	packet.setRating(fields)
+	previous, _ := os.ReadFile(sidecarPath)
+	changed, err := writeXMPSidecar(sidecarPath, packet)
+	if err != nil {
+		return result, err
+	}
+
+	// Update file modification time
+	if err := detach(videoPath, opts); err != nil {
+		return result, writeFailed(videoPath, err)
+	}
+	err = os.Chtimes(videoPath, photoTime, photoTime)
+	if err != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("failed to update file times: %w", err))
+	}
+
+	result.Modified = changed
+	result.Changes = packet.changes(previous)
+	if !changed {
+		for i := range result.Changes {
+			result.Changes[i].Old = result.Changes[i].New
+		}
+	}
 	return result, nil
 }
@@ -0,0 +1,173 @@
+package metadata
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExiftoolEXIFTolerance(t *testing.T) {
+	// A HEIC as exiftool prints it with -s -n: unsigned coordinates and their references
+	output := func(dateTime string) string {
+		return "DateTimeOriginal                : " + dateTime + "\n" +
+			"GPSLatitudeRef                  : S\n" +
+			"GPSLatitude                     : 33.8688\n" +
+			"GPSLongitudeRef                 : E\n" +
+			"GPSLongitude                    : 151.2093\n"
+	}
+	meta := &Metadata{GeoData: GeoData{Latitude: -33.8688, Longitude: 151.2093}}
+	photoTime := time.Date(2019, 7, 14, 16, 20, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		dateTime string
+		want     bool
+	}{
+		{"same time", "2019:07:14 16:20:00", true},
+		{"1s drift", "2019:07:14 16:20:01", true},
+		{"1h drift", "2019:07:14 17:20:00", false},
+		{"same date, other time", "2019:07:14 08:00:00", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := exiftoolEXIF(existingImageValues(output(tc.dateTime)))
+			if got := exifMatches(existing, photoTime, meta, 2*time.Second); got != tc.want {
+				t.Errorf("exifMatches = %v, want %v (skip only when up to date)", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExiftoolEXIFGPSSign(t *testing.T) {
+	meta := &Metadata{GeoData: GeoData{Latitude: -33.8688, Longitude: 151.2093}}
+	photoTime := time.Date(2019, 7, 14, 16, 20, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{"signed by references", "DateTimeOriginal : 2019:07:14 16:20:00\nGPSLatitudeRef : S\nGPSLatitude : 33.8688\nGPSLongitudeRef : E\nGPSLongitude : 151.2093\n", true},
+		{"XMP, signed values", "DateTimeOriginal : 2019:07:14 16:20:00\nGPSLatitude : -33.8688\nGPSLongitude : 151.2093\n", true},
+		{"other hemisphere", "DateTimeOriginal : 2019:07:14 16:20:00\nGPSLatitudeRef : N\nGPSLatitude : 33.8688\nGPSLongitudeRef : E\nGPSLongitude : 151.2093\n", false},
+		{"no GPS", "DateTimeOriginal : 2019:07:14 16:20:00\n", false},
+		{"nothing read", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := exiftoolEXIF(existingImageValues(tc.output))
+			if got := exifMatches(existing, photoTime, meta, 0); got != tc.want {
+				t.Errorf("exifMatches = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// fakeExiftool makes exiftool calls run a script printing output, and returns a
+// function counting the calls made so far
+func fakeExiftool(t *testing.T, output string) func() int {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake exiftool is a shell script")
+	}
+	dir := t.TempDir()
+	log, printed := filepath.Join(dir, "calls"), filepath.Join(dir, "output")
+	if err := os.WriteFile(printed, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho >> '" + log + "'\ncat '" + printed + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "exiftool"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	findExiftool()
+	bin, pauses := exiftoolBin, exiftoolPauses
+	exiftoolBin, exiftoolPauses = filepath.Join(dir, "exiftool"), false
+	t.Cleanup(func() { exiftoolBin, exiftoolPauses = bin, pauses })
+	return func() int {
+		data, _ := os.ReadFile(log)
+		return len(data)
+	}
+}
+
+func TestXMPUpToDateOneExiftoolCall(t *testing.T) {
+	// A PNG as exiftool prints it with -s -G1 -sep listSeparator, holding everything
+	// the options below add
+	output := strings.Join([]string{
+		"[IFD0]          DateTime                        : 2019:07:14 16:20:00",
+		"[ExifIFD]       DateTimeOriginal                : 2019:07:14 16:20:00",
+		"[XMP-dc]        Subject                         : Holiday" + listSeparator + "Takeout",
+		"[XMP-xmpMM]     PreservedFileName               : IMG_1234.png",
+		"[XMP-" + AuditPrefix + "]      SourceSidecar                   : IMG_1234.png.json",
+		"[XMP-" + SocialPrefix + "]      Comments                        : Ann: sun, sea" + listSeparator + "Bob: nice",
+		"[XMP-" + SocialPrefix + "]      Likes                           : 1",
+		"[XMP-xmp]       Rating                          : 4",
+		"[XMP-mwg-rs]    RegionAreaX                     : 0.2500",
+		"",
+	}, "\n")
+	meta := &Metadata{
+		PhotoTakenTime: PhotoTakenTime{Timestamp: "1563121200"},
+		SharedComments: []SharedComment{
+			{Text: "sun, sea", ContentOwnerName: "Ann"},
+			{Text: "nice", Liked: true, ContentOwnerName: "Bob"},
+		},
+		rating: 4,
+		faces:  []FaceRegion{{X: 0.25, Y: 0.5, W: 0.1, H: 0.1}},
+	}
+	opts := ApplyOptions{
+		Keywords:       []string{"Takeout"},
+		OriginalName:   "IMG_1234.png",
+		Audit:          &AuditTrail{Sidecar: "IMG_1234.png.json"},
+		SharedComments: true,
+		StripGoogleXMP: true,
+		FaceRegions:    true,
+	}
+	imagePath := filepath.Join(t.TempDir(), "IMG_1234.png")
+	if err := os.WriteFile(imagePath, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := fakeExiftool(t, output)
+	result, err := applyToImage(context.Background(), imagePath, meta, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Modified {
+		t.Error("up-to-date file rewritten")
+	}
+	if n := calls(); n != 1 {
+		t.Errorf("%d exiftool calls for the up-to-date check, want 1", n)
+	}
+
+	// Without the values of the exiftool path, they are read in a single call too
+	if !xmpUpToDate(context.Background(), imagePath, meta, opts, nil) {
+		t.Error("xmpUpToDate = false for an up-to-date file")
+	}
+	if n := calls(); n != 2 {
+		t.Errorf("%d more exiftool calls for the XMP check, want 1", n-1)
+	}
+
+	for _, tc := range []struct {
+		name, from, to string
+	}{
+		{"keyword missing", "Holiday" + listSeparator + "Takeout", "Holiday"},
+		{"other original name", "IMG_1234.png\n", "IMG_9999.png\n"},
+		{"other sidecar", ": IMG_1234.png.json", ": other.json"},
+		{"comment split in two", "Ann: sun, sea", "Ann: sun" + listSeparator + "sea"},
+		{"like missing", "Likes                           : 1", "Likes                           : 0"},
+		{"other rating", "Rating                          : 4", "Rating                          : 3"},
+		{"other region", "0.2500", "0.7500"},
+		{"Camera Raw settings left", "[XMP-xmp] ", "[XMP-crs]       Exposure2012                    : +0.50\n[XMP-xmp] "},
+		{"edit history left", "[XMP-xmp] ", "[XMP-xmpMM]     HistoryAction                   : saved\n[XMP-xmp] "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if !strings.Contains(output, tc.from) {
+				t.Fatalf("%q not in the output", tc.from)
+			}
+			values := existingImageValues(strings.Replace(output, tc.from, tc.to, 1))
+			if xmpUpToDate(context.Background(), imagePath, meta, opts, values) {
+				t.Error("xmpUpToDate = true, want a rewrite")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package metadata
+
+import (
+	"bytes"
+	"time"
+)
+
+// Audit trail XMP namespace, written with ApplyOptions.Audit
+const (
+	AuditPrefix    = "gtea"
+	AuditNamespace = "https://github.com/lvmj06/google-takeout-exif-applier/ns/audit/1.0/"
+)
+
+// AuditTrail describes where the metadata written to a file came from, for
+// troubleshooting it long after the export is gone
+type AuditTrail struct {
+	Sidecar    string    // File name of the JSON sidecar (or manifest) the metadata came from
+	ExportDate time.Time // When Google created the export, zero when unknown
+}
+
+// auditedTags lists the tags written for a file, recorded in the audit trail's
+// AppliedFields under exiftool's names
+func auditedTags(fields exifFields, opts ApplyOptions) []string {
+	tags := []string{"DateTimeOriginal"}
+	if fields.HasGPS {
+		tags = append(tags, "GPSLatitude", "GPSLongitude")
+		if fields.HasAltitude {
+			tags = append(tags, "GPSAltitude")
+		}
+	}
+	if fields.Description != "" {
+		tags = append(tags, "ImageDescription")
+	}
+	if fields.UserComment != "" {
+		tags = append(tags, "UserComment")
+	}
+	if len(opts.Keywords) > 0 {
+		tags = append(tags, "Subject")
+	}
+	if opts.OriginalName != "" {
+		tags = append(tags, "PreservedFileName")
+	}
+	if len(fields.Likes) > 0 {
+		tags = append(tags, "Likes")
+	}
+	if len(fields.Comments) > 0 {
+		tags = append(tags, "Comments")
+	}
+	if fields.Rating > 0 {
+		tags = append(tags, "Rating")
+	}
+	if len(fields.Faces) > 0 {
+		tags = append(tags, "RegionInfo")
+	}
+	return tags
+}
+
+// setAudit adds the audit trail properties to a packet
+func (x *xmpPacket) setAudit(fields exifFields, opts ApplyOptions) {
+	if opts.Audit == nil {
+		return
+	}
+	x.Set(AuditPrefix+":SourceSidecar", opts.Audit.Sidecar)
+	if !opts.Audit.ExportDate.IsZero() {
+		x.Set(AuditPrefix+":ExportDate", opts.Audit.ExportDate.UTC().Format(time.RFC3339))
+	}
+	x.SetBag(AuditPrefix+":AppliedFields", auditedTags(fields, opts)...)
+}
+
+// auditArgs returns the exiftool arguments writing the audit trail, which need the
+// namespace definitions from exiftoolConfig
+func auditArgs(fields exifFields, opts ApplyOptions) []string {
+	if opts.Audit == nil {
+		return nil
+	}
+	group := "-XMP-" + AuditPrefix + ":"
+	args := []string{group + "SourceSidecar=" + opts.Audit.Sidecar}
+	if !opts.Audit.ExportDate.IsZero() {
+		args = append(args, group+"ExportDate="+opts.Audit.ExportDate.UTC().Format("2006:01:02 15:04:05Z"))
+	}
+	args = append(args, group+"AppliedFields=")
+	for _, tag := range auditedTags(fields, opts) {
+		args = append(args, group+"AppliedFields+="+tag)
+	}
+	return args
+}
+
+// auditPresent reports whether the file already records the audit trail's sidecar
+func auditPresent(values map[string]string, imagePath string, opts ApplyOptions) bool {
+	if opts.Audit == nil {
+		return true
+	}
+	if useExiftool(opts) {
+		return values["SourceSidecar"] == opts.Audit.Sidecar
+	}
+	return !isJPEGFile(imagePath) || bytes.Contains(readJPEGXMP(imagePath), []byte(">"+xmlEscape(opts.Audit.Sidecar)+"<"))
+}
@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Cache keeps parsed JSON metadata for the duration of a run. Documents are keyed by
+// content hash, so identical sidecars copied across album and year folders are parsed
+// once, and each sidecar path is read and merged with its supplementals only once.
+type Cache struct {
+	mu     sync.Mutex
+	files  map[string]cachedFile  // Sidecar path -> content hash at the time it was read
+	docs   map[[32]byte]*Metadata // Content hash -> parsed document (no supplementals merged)
+	merged map[string]*Metadata   // Sidecar path -> document with supplementals merged
+
+	legacyGlobal bool // Merge every field of folder-wide supplemental-metadata.json
+	disabled     bool // Parse every time without keeping anything
+}
+
+// cachedFile identifies the version of a file whose content hash was recorded
+type cachedFile struct {
+	size    int64
+	modTime time.Time
+	hash    [32]byte
+}
+
+// NewCache creates an empty metadata cache
+func NewCache() *Cache {
+	return &Cache{
+		files:  make(map[string]cachedFile),
+		docs:   make(map[[32]byte]*Metadata),
+		merged: make(map[string]*Metadata),
+	}
+}
+
+// SetLegacyGlobalSupplemental restores merging every field of a folder-wide
+// supplemental-metadata.json into each file's metadata
+func (c *Cache) SetLegacyGlobalSupplemental(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.legacyGlobal = enabled
+	c.merged = make(map[string]*Metadata)
+}
+
+// SetDisabled stops the cache from keeping parsed documents, trading repeated parsing
+// for memory that no longer grows with the number of sidecars
+func (c *Cache) SetDisabled(disabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disabled = disabled
+	c.files = make(map[string]cachedFile)
+	c.docs = make(map[[32]byte]*Metadata)
+	c.merged = make(map[string]*Metadata)
+}
+
+// ParseJSON behaves like the package-level ParseJSON, serving repeated and
+// duplicate sidecars from the cache. The returned Metadata is a private copy.
+func (c *Cache) ParseJSON(jsonPath string) (*Metadata, error) {
+	info, err := os.Stat(jsonPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON file: %w", err)
+	}
+
+	c.mu.Lock()
+	if f, ok := c.files[jsonPath]; ok && f.size == info.Size() && f.modTime.Equal(info.ModTime()) {
+		if meta, ok := c.merged[jsonPath]; ok {
+			c.mu.Unlock()
+			copied := *meta
+			return &copied, nil
+		}
+	}
+	legacyGlobal, disabled := c.legacyGlobal, c.disabled
+	c.mu.Unlock()
+	if disabled {
+		return parseJSONWith(jsonPath, parseSupplementalJSON, legacyGlobal)
+	}
+
+	meta, err := parseJSONWith(jsonPath, c.parseDocument, legacyGlobal)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.merged[jsonPath] = meta
+	c.mu.Unlock()
+	copied := *meta
+	return &copied, nil
+}
+
+// parseDocument parses one JSON file, reusing the parse of any identical content seen before
+func (c *Cache) parseDocument(jsonPath string) (*Metadata, error) {
+	var doc *Metadata
+	err := readJSONFile(jsonPath, func(data []byte, info os.FileInfo) error {
+		hash := sha256.Sum256(data)
+
+		c.mu.Lock()
+		c.files[jsonPath] = cachedFile{size: info.Size(), modTime: info.ModTime(), hash: hash}
+		cached, ok := c.docs[hash]
+		c.mu.Unlock()
+		if ok {
+			doc = cached
+			return nil
+		}
+
+		parsed, err := decodeJSON(data)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.docs[hash] = parsed
+		c.mu.Unlock()
+		doc = parsed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	copied := *doc
+	return &copied, nil
+}
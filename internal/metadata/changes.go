@@ -0,0 +1,127 @@
+package metadata
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// FieldChange is one tag written to a file, with the value it had before the write.
+// Old is empty when the tag was absent or its previous value could not be read.
+// Files found up to date report the checked tags with Old equal to New.
+type FieldChange struct {
+	Tag string
+	Old string
+	New string
+}
+
+// Changed reports whether the write altered the tag's value
+func (c FieldChange) Changed() bool {
+	return c.Old != c.New
+}
+
+// String renders the change as "Tag: old -> new", or "Tag: value (unchanged)"
+func (c FieldChange) String() string {
+	if !c.Changed() {
+		return fmt.Sprintf("%s: %s (unchanged)", c.Tag, c.New)
+	}
+	old := c.Old
+	if old == "" {
+		old = "-"
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Tag, old, c.New)
+}
+
+// Summary renders the new values of the changes as "Tag=value, ..."
+func (r *ApplyResult) Summary() string {
+	parts := make([]string, 0, len(r.Changes))
+	for _, change := range r.Changes {
+		parts = append(parts, change.Tag+"="+change.New)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// changesFromArgs turns exiftool "-Tag=value" arguments into the change set, looking
+// up the previous values in old. Values added with "-Tag+=" are collected into one
+// change; removals and options are ignored.
+func changesFromArgs(args []string, old map[string]string) []FieldChange {
+	var changes []FieldChange
+	index := make(map[string]int)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		tag, value, ok := strings.Cut(arg[1:], "=")
+		if !ok || strings.HasSuffix(tag, "-") {
+			continue
+		}
+		add := strings.HasSuffix(tag, "+")
+		tag = strings.TrimSuffix(tag, "+")
+		if i, seen := index[tag]; seen && add {
+			changes[i].New += ", " + value
+			continue
+		}
+		previous, ok := old[tag]
+		if !ok {
+			// exiftool's -s output names tags without their group ("XMP-dc:Subject" is "Subject")
+			previous = old[tag[strings.LastIndex(tag, ":")+1:]]
+		}
+		index[tag] = len(changes)
+		changes = append(changes, FieldChange{Tag: tag, Old: previous, New: value})
+	}
+	return changes
+}
+
+// ffmpegChanges turns ffmpeg "-metadata key=value" arguments into the change set.
+// The previous container tags are not read, so no change has an old value.
+func ffmpegChanges(args []string) []FieldChange {
+	var changes []FieldChange
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] != "-metadata" {
+			continue
+		}
+		if key, value, ok := strings.Cut(args[i+1], "="); ok {
+			changes = append(changes, FieldChange{Tag: key, New: value})
+		}
+		i++
+	}
+	return changes
+}
+
+// unchangedFields reports the given tags as verified, taking their values from values,
+// with lists comma-separated
+func unchangedFields(values map[string]string, tags ...string) []FieldChange {
+	var changes []FieldChange
+	for _, tag := range tags {
+		if value, ok := values[tag]; ok && value != "" {
+			value = strings.ReplaceAll(value, listSeparator, ", ")
+			changes = append(changes, FieldChange{Tag: tag, Old: value, New: value})
+		}
+	}
+	return changes
+}
+
+// fileTimeChange records setting a file's modification time to t, in UTC
+func fileTimeChange(path string, t time.Time) FieldChange {
+	change := FieldChange{Tag: "FileModifyDate", New: t.UTC().Format("2006:01:02 15:04:05")}
+	if info, err := os.Stat(path); err == nil {
+		change.Old = info.ModTime().UTC().Format("2006:01:02 15:04:05")
+	}
+	return change
+}
+
+// parseExiftoolValues parses exiftool's "-s" output ("TagName : value" lines)
+func parseExiftoolValues(output string) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		tag, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(tag)] = strings.TrimSpace(value)
+	}
+	return values
+}
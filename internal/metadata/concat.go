@@ -0,0 +1,61 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// JoinVideos concatenates the parts of a split video into dst with ffmpeg's concat
+// demuxer, copying the streams without re-encoding them. dst is written through a
+// temporary file next to it and must not exist; the parts are left untouched.
+func JoinVideos(ctx context.Context, parts []string, dst string) error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("%w (ffmpeg is needed to join split videos)", ErrToolMissing)
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+
+	list, err := os.CreateTemp("", "takeout-parts-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to create part list: %w", err)
+	}
+	defer RemoveTempFile(TrackTempFile(list.Name()))
+	for _, part := range parts {
+		abs, err := filepath.Abs(part)
+		if err != nil {
+			list.Close()
+			return err
+		}
+		// The concat demuxer quotes with single quotes; an embedded one is closed,
+		// escaped and reopened
+		fmt.Fprintf(list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	if err := list.Close(); err != nil {
+		return fmt.Errorf("failed to write part list: %w", err)
+	}
+
+	tempOutput := TrackTempFile(filepath.Join(filepath.Dir(dst), "_tmp_"+filepath.Base(dst)))
+	defer RemoveTempFile(tempOutput)
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-f", "concat", "-safe", "0", "-i", list.Name(), "-c", "copy", "-y", tempOutput)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return writeFailed(dst, fmt.Errorf("ffmpeg interrupted: %w", ctx.Err()))
+		}
+		return writeFailed(dst, fmt.Errorf("ffmpeg failed to join the parts: %w: %s", err, lastLine(output)))
+	}
+	if err := os.Rename(tempOutput, dst); err != nil {
+		return writeFailed(dst, fmt.Errorf("failed to move the joined video into place: %w", err))
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of a tool's output, usually its error
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
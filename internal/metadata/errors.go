@@ -0,0 +1,31 @@
+package metadata
+
+import "errors"
+
+// Failure categories that callers can test for with errors.Is
+var (
+	ErrBadTimestamp = errors.New("no valid timestamp") // The JSON has no usable photo time
+	ErrToolMissing  = errors.New("required tool not found")
+	ErrWriteFailed  = errors.New("failed to write metadata")
+	ErrCorruptFile  = errors.New("corrupt or truncated media file") // Empty or cut off, see CheckIntegrity
+)
+
+// WriteError is returned when writing a media file or its sidecar failed. It matches
+// ErrWriteFailed as well as the underlying error.
+type WriteError struct {
+	Path string
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() []error {
+	return []error{ErrWriteFailed, e.Err}
+}
+
+// writeFailed wraps err as a WriteError for path
+func writeFailed(path string, err error) error {
+	return &WriteError{Path: path, Err: err}
+}
@@ -0,0 +1,395 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF/TIFF tag IDs we read
+const (
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+	tagGPSAltitudeRef   = 0x0005
+	tagGPSAltitude      = 0x0006
+	tagGPSTimeStamp     = 0x0007
+	tagGPSDateStamp     = 0x001D
+	tagXMLPacket        = 0x02BC
+)
+
+// TIFF field types
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+	typeSLong     = 9
+	typeSRational = 10
+)
+
+var typeSizes = map[uint16]uint32{
+	typeByte:      1,
+	typeASCII:     1,
+	typeShort:     2,
+	typeLong:      4,
+	typeRational:  8,
+	typeUndefined: 1,
+	typeSLong:     4,
+	typeSRational: 8,
+}
+
+// errNoEXIF is returned when a file has no EXIF data we can parse
+var errNoEXIF = errors.New("no EXIF data")
+
+// errMalformed is returned when a file's structure cannot be followed
+var errMalformed = errors.New("malformed image structure")
+
+// errTIFFTooLarge is returned when the IFDs written would end past the 4 GiB a TIFF
+// offset can address
+var errTIFFTooLarge = errors.New("TIFF file too large for its offsets")
+
+// exifData holds the EXIF fields used for the "already up-to-date" check
+type exifData struct {
+	DateTime         string
+	DateTimeOriginal string
+	HasGPS           bool
+	Latitude         float64
+	Longitude        float64
+	HasAltitude      bool
+	Altitude         float64
+	GPSDateStamp     string
+	XMP              []byte // XMLPacket of TIFF-based files
+}
+
+// values returns the fields under the tag names exiftool writes, for the change set
+func (e *exifData) values() map[string]string {
+	values := map[string]string{
+		"DateTime":         e.DateTime,
+		"DateTimeOriginal": e.DateTimeOriginal,
+		"GPSDateStamp":     e.GPSDateStamp,
+	}
+	if e.HasGPS {
+		values["GPSLatitude"] = fmt.Sprintf("%f", e.Latitude)
+		values["GPSLongitude"] = fmt.Sprintf("%f", e.Longitude)
+	}
+	if e.HasAltitude {
+		values["GPSAltitude"] = fmt.Sprintf("%f", e.Altitude)
+	}
+	return values
+}
+
+// OriginalTime returns DateTimeOriginal, falling back to DateTime
+func (e *exifData) OriginalTime() (time.Time, bool) {
+	for _, value := range []string{e.DateTimeOriginal, e.DateTime} {
+		if len(value) < 19 {
+			continue
+		}
+		if t, err := time.Parse("2006:01:02 15:04:05", value[:19]); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// readEXIF parses EXIF data natively from JPEG and TIFF-based (TIFF, DNG) files
+func readEXIF(path string) (*exifData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, errNoEXIF
+	}
+
+	switch {
+	case header[0] == 0xFF && header[1] == 0xD8:
+		tiff, err := findJPEGExif(f)
+		if err != nil {
+			return nil, err
+		}
+		return parseTIFF(bytes.NewReader(tiff))
+	case bytes.Equal(header, []byte("II*\x00")) || bytes.Equal(header, []byte("MM\x00*")):
+		return parseTIFF(f)
+	}
+	return nil, errNoEXIF
+}
+
+// findJPEGExif returns the TIFF payload of the JPEG's Exif APP1 segment
+func findJPEGExif(r io.ReadSeeker) ([]byte, error) {
+	segment, err := findJPEGSegment(r, 0xE1, exifHeader)
+	if err != nil {
+		return nil, err
+	}
+	return segment[len(exifHeader):], nil
+}
+
+// exifHeader starts the APP1 segment holding EXIF data
+var exifHeader = []byte("Exif\x00\x00")
+
+// findJPEGSegment returns the first segment before the image data with the given
+// marker whose content starts with prefix
+func findJPEGSegment(r io.ReadSeeker, segmentMarker byte, prefix []byte) ([]byte, error) {
+	if _, err := r.Seek(2, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var marker [4]byte
+	for {
+		if _, err := io.ReadFull(r, marker[:2]); err != nil {
+			return nil, errMalformed
+		}
+		if marker[0] != 0xFF {
+			return nil, errMalformed
+		}
+		// Image data starts at SOS; no EXIF after that point
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, errNoEXIF
+		}
+		if _, err := io.ReadFull(r, marker[2:]); err != nil {
+			return nil, errMalformed
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:]))
+		if length < 2 {
+			return nil, errMalformed
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, errMalformed
+		}
+		if marker[1] == segmentMarker && bytes.HasPrefix(segment, prefix) {
+			return segment, nil
+		}
+	}
+}
+
+// tiffReader reads IFD entries from TIFF-structured data
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+}
+
+// ifdEntry is a raw IFD entry; value holds the inline 4 bytes or the offset
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// parseTIFF reads the tags we care about from IFD0, the Exif IFD and the GPS IFD
+func parseTIFF(r io.ReaderAt) (*exifData, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, errNoEXIF
+	}
+	t, err := newTIFFReader(r, header)
+	if err != nil {
+		return nil, errNoEXIF
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(header[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	data := &exifData{}
+	data.DateTime = t.asciiValue(ifd0[tagDateTime])
+	data.XMP = t.bytesValue(ifd0[tagXMLPacket])
+
+	if entry, ok := ifd0[tagExifIFD]; ok {
+		if exifIFD, err := t.readIFD(t.longValue(entry)); err == nil {
+			data.DateTimeOriginal = t.asciiValue(exifIFD[tagDateTimeOriginal])
+		}
+	}
+
+	if entry, ok := ifd0[tagGPSIFD]; ok {
+		if gps, err := t.readIFD(t.longValue(entry)); err == nil {
+			lat, latOk := t.coordinate(gps[tagGPSLatitude], gps[tagGPSLatitudeRef], "S")
+			lon, lonOk := t.coordinate(gps[tagGPSLongitude], gps[tagGPSLongitudeRef], "W")
+			if latOk && lonOk {
+				data.HasGPS = true
+				data.Latitude = lat
+				data.Longitude = lon
+			}
+			data.GPSDateStamp = t.asciiValue(gps[tagGPSDateStamp])
+			if alt := t.rationals(gps[tagGPSAltitude]); len(alt) == 1 {
+				data.HasAltitude = true
+				data.Altitude = alt[0]
+				if ref := t.bytesValue(gps[tagGPSAltitudeRef]); len(ref) > 0 && ref[0] == 1 {
+					data.Altitude = -data.Altitude
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// readIFD reads all entries of the IFD at offset
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]ifdEntry, error) {
+	countBuf := make([]byte, 2)
+	if _, err := t.r.ReadAt(countBuf, int64(offset)); err != nil {
+		return nil, errNoEXIF
+	}
+	count := int(t.order.Uint16(countBuf))
+	buf := make([]byte, count*12)
+	if _, err := t.r.ReadAt(buf, int64(offset)+2); err != nil {
+		return nil, errNoEXIF
+	}
+
+	entries := make(map[uint16]ifdEntry, count)
+	for i := 0; i < count; i++ {
+		raw := buf[i*12 : i*12+12]
+		entry := ifdEntry{
+			tag:   t.order.Uint16(raw[0:]),
+			typ:   t.order.Uint16(raw[2:]),
+			count: t.order.Uint32(raw[4:]),
+			value: raw[8:12],
+		}
+		entries[entry.tag] = entry
+	}
+	return entries, nil
+}
+
+// data returns the entry's value bytes, following the offset when they don't fit inline
+func (t *tiffReader) data(entry ifdEntry) []byte {
+	size, ok := typeSizes[entry.typ]
+	if !ok || entry.count == 0 || entry.count > 1<<20 {
+		return nil
+	}
+	total := size * entry.count
+	if total <= 4 {
+		return entry.value[:total]
+	}
+	buf := make([]byte, total)
+	if _, err := t.r.ReadAt(buf, int64(t.order.Uint32(entry.value))); err != nil {
+		return nil
+	}
+	return buf
+}
+
+func (t *tiffReader) asciiValue(entry ifdEntry) string {
+	if entry.typ != typeASCII {
+		return ""
+	}
+	return strings.TrimRight(string(t.data(entry)), "\x00 ")
+}
+
+func (t *tiffReader) bytesValue(entry ifdEntry) []byte {
+	if entry.typ != typeByte && entry.typ != typeUndefined {
+		return nil
+	}
+	return t.data(entry)
+}
+
+func (t *tiffReader) longValue(entry ifdEntry) uint32 {
+	switch entry.typ {
+	case typeLong:
+		return t.order.Uint32(entry.value)
+	case typeShort:
+		return uint32(t.order.Uint16(entry.value))
+	}
+	return 0
+}
+
+func (t *tiffReader) rationals(entry ifdEntry) []float64 {
+	if entry.typ != typeRational && entry.typ != typeSRational {
+		return nil
+	}
+	raw := t.data(entry)
+	values := make([]float64, 0, len(raw)/8)
+	for i := 0; i+8 <= len(raw); i += 8 {
+		num, den := t.order.Uint32(raw[i:]), t.order.Uint32(raw[i+4:])
+		if den == 0 {
+			return nil
+		}
+		if entry.typ == typeSRational {
+			values = append(values, float64(int32(num))/float64(int32(den)))
+		} else {
+			values = append(values, float64(num)/float64(den))
+		}
+	}
+	return values
+}
+
+// coordinate converts a degrees/minutes/seconds GPS value and its reference to decimal degrees
+func (t *tiffReader) coordinate(value, ref ifdEntry, negativeRef string) (float64, bool) {
+	dms := t.rationals(value)
+	if len(dms) != 3 {
+		return 0, false
+	}
+	decimal := dms[0] + dms[1]/60 + dms[2]/3600
+	if strings.EqualFold(t.asciiValue(ref), negativeRef) {
+		decimal = -decimal
+	}
+	return decimal, true
+}
+
+// ReadEXIFTime returns the file's embedded DateTimeOriginal (or DateTime), using the
+// native reader first and exiftool for other formats
+func ReadEXIFTime(ctx context.Context, mediaPath string) (time.Time, bool) {
+	if existing, err := readEXIF(mediaPath); err == nil {
+		if t, ok := existing.OriginalTime(); ok {
+			return t, true
+		}
+	}
+	return ReadDateTimeOriginal(ctx, mediaPath)
+}
+
+// SyncFileTime sets the file's modification time from its embedded EXIF time,
+// returning the time used and false when the file has no EXIF time
+func SyncFileTime(ctx context.Context, mediaPath string) (time.Time, bool, error) {
+	t, ok := ReadEXIFTime(ctx, mediaPath)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	if err := os.Chtimes(mediaPath, t, t); err != nil {
+		return t, true, writeFailed(mediaPath, fmt.Errorf("failed to update file times: %w", err))
+	}
+	return t, true, nil
+}
+
+// exifMatches reports whether the existing EXIF data already holds the target time
+// (within tolerance) and, when the metadata has coordinates, the same GPS position (within ~1m)
+func exifMatches(existing *exifData, photoTime time.Time, meta *Metadata, tolerance time.Duration) bool {
+	existingTime, ok := existing.OriginalTime()
+	if !ok {
+		return false
+	}
+	drift := existingTime.Sub(photoTime.Truncate(time.Second))
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > tolerance {
+		return false
+	}
+
+	if lat, latOk := meta.GetLatitude(); latOk {
+		if lon, lonOk := meta.GetLongitude(); lonOk {
+			if !existing.HasGPS {
+				return false
+			}
+			const epsilon = 0.00001
+			if math.Abs(existing.Latitude-lat) > epsilon || math.Abs(existing.Longitude-lon) > epsilon {
+				return false
+			}
+		}
+	}
+	return true
+}
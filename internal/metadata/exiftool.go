@@ -0,0 +1,132 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exiftoolNames lists the executable names we look for, in order of preference.
+// "exiftool(-k)" is the stock Windows download, which pauses for a key press on exit.
+var exiftoolNames = []string{"exiftool", "exiftool(-k)"}
+
+var (
+	exiftoolOnce   sync.Once
+	exiftoolBin    string
+	exiftoolPauses bool
+)
+
+// findExiftool locates the exiftool executable, returning its path and whether
+// it is the pause-on-exit "(-k)" build. An empty path means exiftool is not available.
+func findExiftool() (string, bool) {
+	exiftoolOnce.Do(func() {
+		exiftoolBin = lookupExiftool()
+		if exiftoolBin == "" {
+			return
+		}
+		exiftoolPauses = strings.Contains(strings.ToLower(filepath.Base(exiftoolBin)), "(-k)")
+		if exiftoolPauses {
+			fmt.Printf("[WARN] Using pause-on-exit exiftool build: %s\n", exiftoolBin)
+			fmt.Printf("       Rename it to exiftool.exe to avoid the key press workaround.\n")
+		}
+	})
+	return exiftoolBin, exiftoolPauses
+}
+
+// lookupExiftool searches PATH and then the application directory for exiftool
+func lookupExiftool() string {
+	for _, name := range exiftoolNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	exeDir := filepath.Dir(exe)
+	for _, name := range exiftoolNames {
+		for _, candidate := range []string{name, name + ".exe"} {
+			path := filepath.Join(exeDir, candidate)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// exiftoolAvailable reports whether an exiftool executable was found
+func exiftoolAvailable() bool {
+	path, _ := findExiftool()
+	return path != ""
+}
+
+// exiftoolCommand builds an exiftool command, working around the "(-k)" build's
+// pause on exit by passing -q and answering the key press prompt on stdin. The
+// process is killed when ctx is done.
+func exiftoolCommand(ctx context.Context, args ...string) *exec.Cmd {
+	path, pauses := findExiftool()
+	if !pauses {
+		return exec.CommandContext(ctx, path, args...)
+	}
+
+	// -config is only accepted as the first argument
+	var config []string
+	if len(args) >= 2 && args[0] == "-config" {
+		config, args = args[:2], args[2:]
+	}
+	cmd := exec.CommandContext(ctx, path, append(append(append([]string{}, config...), "-q"), args...)...)
+	cmd.Stdin = strings.NewReader("\n")
+	return cmd
+}
+
+// readTag returns the value of a single tag as printed by exiftool, or "" when the
+// tag is missing or exiftool is not available
+func readTag(ctx context.Context, mediaPath, tag string) string {
+	if !exiftoolAvailable() {
+		return ""
+	}
+	output, err := exiftoolCommand(ctx, "-s3", "-"+tag, mediaPath).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// listSeparator joins the items of list tags in the values read by
+// getExistingImageEXIF, so an item containing ", " is not taken for two
+const listSeparator = "\x1f"
+
+// listItems splits a list tag read with listSeparator, nil when it is empty
+func listItems(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, listSeparator)
+}
+
+// ReadCameraModel returns the camera model recorded in the file's EXIF data, or ""
+func ReadCameraModel(ctx context.Context, mediaPath string) string {
+	return readTag(ctx, mediaPath, "Model")
+}
+
+// ReadDateTimeOriginal returns the file's existing EXIF DateTimeOriginal as a wall-clock
+// time in UTC, and false when it is missing or unreadable
+func ReadDateTimeOriginal(ctx context.Context, mediaPath string) (time.Time, bool) {
+	value := readTag(ctx, mediaPath, "DateTimeOriginal")
+	if len(value) < 19 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006:01:02 15:04:05", value[:19])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
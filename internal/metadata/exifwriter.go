@@ -0,0 +1,724 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Additional tag IDs written by the native writer
+const (
+	tagImageDescription  = 0x010E
+	tagDateTimeDigitized = 0x9004
+	tagExifVersion       = 0x9000
+	tagUserComment       = 0x9286
+	tagGPSVersionID      = 0x0000
+)
+
+// userCommentASCII starts an EXIF UserComment holding ASCII text
+var userCommentASCII = []byte("ASCII\x00\x00\x00")
+
+// tiffEntry is an IFD entry to be encoded
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// exifFields holds the values embedded by the native writer
+type exifFields struct {
+	DateTime    string // "2006:01:02 15:04:05"
+	Description string
+	HasGPS      bool
+	Latitude    float64
+	Longitude   float64
+	HasAltitude bool
+	Altitude    float64
+	GPSTime     time.Time    // UTC time for GPSDateStamp/GPSTimeStamp, zero to omit
+	UserComment string       // Device/app provenance with WriteProvenance, empty to omit
+	IPTCDate    string       // IPTC DateCreated, "20060102"
+	IPTCTime    string       // IPTC TimeCreated, "150405+0000"
+	Likes       []string     // Shared album likes with SharedComments
+	Comments    []string     // Shared album comments with SharedComments
+	Rating      int          // XMP rating, 0 to omit
+	Faces       []FaceRegion // Face rectangles with FaceRegions
+	Width       int          // Image size the regions apply to, 0 when unknown
+	Height      int
+}
+
+// newEXIFFields collects the values to embed from the metadata
+func newEXIFFields(meta *Metadata, photoTime time.Time, opts ApplyOptions) exifFields {
+	fields := exifFields{
+		DateTime:    photoTime.Format("2006:01:02 15:04:05"),
+		Description: meta.Description,
+		Rating:      meta.GetRating(),
+	}
+	if opts.WriteProvenance {
+		fields.UserComment = meta.GetProvenance()
+	}
+	if opts.SharedComments {
+		fields.Likes, fields.Comments = meta.GetLikes(), meta.GetComments()
+	}
+	if opts.FaceRegions {
+		fields.Faces = meta.GetFaces()
+	}
+	var offset time.Duration
+	if utc, err := meta.GetUTCTime(); err == nil {
+		offset = photoTime.Sub(utc)
+	}
+	fields.IPTCDate, fields.IPTCTime = iptcDateTime(photoTime, offset)
+	if lat, latOk := meta.GetLatitude(); latOk {
+		if lon, lonOk := meta.GetLongitude(); lonOk {
+			fields.HasGPS = true
+			fields.Latitude = lat
+			fields.Longitude = lon
+			if alt, altOk := meta.GetAltitude(); altOk {
+				fields.HasAltitude = true
+				fields.Altitude = alt
+			}
+			if utc, err := meta.GetUTCTime(); err == nil && opts.GPSTimestamps {
+				fields.GPSTime = utc
+			}
+		}
+	}
+	return fields
+}
+
+// changes lists the tags the native writer sets, under exiftool's names, with their
+// previous values from old (nil when the file had no EXIF)
+func (f exifFields) changes(opts ApplyOptions, old map[string]string) []FieldChange {
+	changes := []FieldChange{
+		{Tag: "DateTime", New: f.DateTime},
+		{Tag: "DateTimeOriginal", New: f.DateTime},
+		{Tag: "CreateDate", New: f.DateTime},
+	}
+	if f.Description != "" {
+		changes = append(changes, FieldChange{Tag: "ImageDescription", New: f.Description})
+	}
+	if f.UserComment != "" {
+		changes = append(changes, FieldChange{Tag: "UserComment", New: f.UserComment})
+	}
+	if f.HasGPS {
+		changes = append(changes,
+			FieldChange{Tag: "GPSLatitude", New: fmt.Sprintf("%f", f.Latitude)},
+			FieldChange{Tag: "GPSLongitude", New: fmt.Sprintf("%f", f.Longitude)})
+		if f.HasAltitude {
+			changes = append(changes, FieldChange{Tag: "GPSAltitude", New: fmt.Sprintf("%f", f.Altitude)})
+		}
+		if !f.GPSTime.IsZero() {
+			changes = append(changes,
+				FieldChange{Tag: "GPSDateStamp", New: f.GPSTime.Format("2006:01:02")},
+				FieldChange{Tag: "GPSTimeStamp", New: f.GPSTime.Format("15:04:05")})
+		}
+	}
+	changes = append(changes,
+		FieldChange{Tag: "IPTC:DateCreated", New: f.IPTCDate[:4] + ":" + f.IPTCDate[4:6] + ":" + f.IPTCDate[6:]},
+		FieldChange{Tag: "IPTC:TimeCreated", New: f.IPTCTime[:2] + ":" + f.IPTCTime[2:4] + ":" + f.IPTCTime[4:9] + ":" + f.IPTCTime[9:]})
+	if opts.WriteMarker {
+		changes = append(changes, FieldChange{Tag: "XMP-dc:Source", New: AppliedMarker})
+	}
+	if opts.OriginalName != "" {
+		changes = append(changes, FieldChange{Tag: "XMP-xmpMM:PreservedFileName", New: opts.OriginalName})
+	}
+	if len(opts.Keywords) > 0 {
+		changes = append(changes, FieldChange{Tag: "XMP-dc:Subject", New: strings.Join(opts.Keywords, ", ")})
+	}
+	if opts.Audit != nil {
+		changes = append(changes, FieldChange{Tag: "XMP-" + AuditPrefix + ":SourceSidecar", New: opts.Audit.Sidecar})
+	}
+	if len(f.Likes) > 0 {
+		changes = append(changes, FieldChange{Tag: "XMP-" + SocialPrefix + ":Likes", New: fmt.Sprint(len(f.Likes))})
+	}
+	if len(f.Comments) > 0 {
+		changes = append(changes, FieldChange{Tag: "XMP-" + SocialPrefix + ":Comments", New: strings.Join(f.Comments, ", ")})
+	}
+	if f.Rating > 0 {
+		changes = append(changes, FieldChange{Tag: "XMP-xmp:Rating", New: fmt.Sprint(f.Rating)})
+	}
+	if len(f.Faces) > 0 {
+		changes = append(changes, FieldChange{Tag: "XMP-mwg-rs:RegionInfo", New: fmt.Sprintf("%d faces", len(f.Faces))})
+	}
+	for i := range changes {
+		changes[i].Old = old[changes[i].Tag]
+	}
+	return changes
+}
+
+// exifChanges keeps the changes to EXIF tags, for formats the native writer only
+// writes the EXIF of
+func exifChanges(changes []FieldChange) []FieldChange {
+	var kept []FieldChange
+	for _, c := range changes {
+		if !strings.Contains(c.Tag, ":") {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// exifByteOrder is the byte order of the TIFF blocks the native writer produces
+var exifByteOrder = binary.BigEndian
+
+func asciiEntry(tag uint16, value string) tiffEntry {
+	data := append([]byte(value), 0)
+	return tiffEntry{tag: tag, typ: typeASCII, count: uint32(len(data)), data: data}
+}
+
+func longEntry(tag uint16, value uint32) tiffEntry {
+	data := make([]byte, 4)
+	exifByteOrder.PutUint32(data, value)
+	return tiffEntry{tag: tag, typ: typeLong, count: 1, data: data}
+}
+
+func rationalEntry(tag uint16, values ...[2]uint32) tiffEntry {
+	data := make([]byte, 0, 8*len(values))
+	for _, v := range values {
+		data = exifByteOrder.AppendUint32(data, v[0])
+		data = exifByteOrder.AppendUint32(data, v[1])
+	}
+	return tiffEntry{tag: tag, typ: typeRational, count: uint32(len(values)), data: data}
+}
+
+// inOrder converts an entry built in exifByteOrder to another byte order
+func inOrder(e tiffEntry, order binary.ByteOrder) tiffEntry {
+	unit := 0
+	switch e.typ {
+	case typeShort:
+		unit = 2
+	case typeLong, typeSLong, typeRational, typeSRational:
+		unit = 4 // Rationals are two longs
+	}
+	if order == exifByteOrder || unit == 0 {
+		return e
+	}
+	data := append([]byte{}, e.data...)
+	for i := 0; i+unit <= len(data); i += unit {
+		for a, b := i, i+unit-1; a < b; a, b = a+1, b-1 {
+			data[a], data[b] = data[b], data[a]
+		}
+	}
+	e.data = data
+	return e
+}
+
+// dmsRationals converts decimal degrees to degrees/minutes/seconds rationals
+func dmsRationals(value float64) [][2]uint32 {
+	value = math.Abs(value)
+	degrees := math.Floor(value)
+	minutesFloat := (value - degrees) * 60
+	minutes := math.Floor(minutesFloat)
+	seconds := (minutesFloat - minutes) * 60
+	return [][2]uint32{
+		{uint32(degrees), 1},
+		{uint32(minutes), 1},
+		{uint32(math.Round(seconds * 10000)), 10000},
+	}
+}
+
+// ifdSize returns the encoded size of an IFD including its out-of-line values
+func ifdSize(entries []tiffEntry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if n := uint32(len(e.data)); n > 4 {
+			size += n + n%2
+		}
+	}
+	return size
+}
+
+// encodeIFD encodes entries (sorted by tag) as an IFD placed at offset in the TIFF
+// block, followed by the offset of the next IFD (0 for none). Entries whose data fits
+// in 4 bytes, including entries copied from an existing IFD, are written inline as is.
+func encodeIFD(entries []tiffEntry, offset, next uint32, order binary.ByteOrder) []byte {
+	var table, values bytes.Buffer
+	valueOffset := offset + uint32(2+12*len(entries)+4)
+
+	binary.Write(&table, order, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(&table, order, e.tag)
+		binary.Write(&table, order, e.typ)
+		binary.Write(&table, order, e.count)
+		if len(e.data) <= 4 {
+			inline := make([]byte, 4)
+			copy(inline, e.data)
+			table.Write(inline)
+			continue
+		}
+		binary.Write(&table, order, valueOffset+uint32(values.Len()))
+		values.Write(e.data)
+		if len(e.data)%2 == 1 {
+			values.WriteByte(0)
+		}
+	}
+	binary.Write(&table, order, next)
+	return append(table.Bytes(), values.Bytes()...)
+}
+
+// ifd0Entries returns the IFD0 tags the native writer sets, without sub-IFD pointers
+func ifd0Entries(fields exifFields) []tiffEntry {
+	var entries []tiffEntry
+	if fields.Description != "" {
+		entries = append(entries, asciiEntry(tagImageDescription, fields.Description))
+	}
+	return append(entries, asciiEntry(tagDateTime, fields.DateTime))
+}
+
+// exifIFDEntries returns the Exif IFD tags the native writer sets
+func exifIFDEntries(fields exifFields) []tiffEntry {
+	entries := []tiffEntry{
+		asciiEntry(tagDateTimeOriginal, fields.DateTime),
+		asciiEntry(tagDateTimeDigitized, fields.DateTime),
+	}
+	if fields.UserComment != "" {
+		data := append(append([]byte{}, userCommentASCII...), fields.UserComment...)
+		entries = append(entries, tiffEntry{tag: tagUserComment, typ: typeUndefined, count: uint32(len(data)), data: data})
+	}
+	return entries
+}
+
+// gpsIFDEntries returns the GPS IFD tags the native writer sets, nil without GPS data
+func gpsIFDEntries(fields exifFields) []tiffEntry {
+	var gpsEntries []tiffEntry
+	if fields.HasGPS {
+		latRef, lonRef := "N", "E"
+		if fields.Latitude < 0 {
+			latRef = "S"
+		}
+		if fields.Longitude < 0 {
+			lonRef = "W"
+		}
+		gpsEntries = []tiffEntry{
+			{tag: tagGPSVersionID, typ: typeByte, count: 4, data: []byte{2, 3, 0, 0}},
+			asciiEntry(tagGPSLatitudeRef, latRef),
+			rationalEntry(tagGPSLatitude, dmsRationals(fields.Latitude)...),
+			asciiEntry(tagGPSLongitudeRef, lonRef),
+			rationalEntry(tagGPSLongitude, dmsRationals(fields.Longitude)...),
+		}
+		if fields.HasAltitude {
+			ref := byte(0)
+			if fields.Altitude < 0 {
+				ref = 1
+			}
+			gpsEntries = append(gpsEntries,
+				tiffEntry{tag: tagGPSAltitudeRef, typ: typeByte, count: 1, data: []byte{ref}},
+				rationalEntry(tagGPSAltitude, [2]uint32{uint32(math.Round(math.Abs(fields.Altitude) * 100)), 100}),
+			)
+		}
+		if !fields.GPSTime.IsZero() {
+			t := fields.GPSTime
+			gpsEntries = append(gpsEntries,
+				rationalEntry(tagGPSTimeStamp, [2]uint32{uint32(t.Hour()), 1}, [2]uint32{uint32(t.Minute()), 1}, [2]uint32{uint32(t.Second()), 1}),
+				asciiEntry(tagGPSDateStamp, t.Format("2006:01:02")),
+			)
+		}
+	}
+	return gpsEntries
+}
+
+// buildEXIFPayload encodes the fields as an APP1 payload ("Exif\0\0" + TIFF block)
+func buildEXIFPayload(fields exifFields) []byte {
+	exifEntries := append([]tiffEntry{{tag: tagExifVersion, typ: typeUndefined, count: 4, data: []byte("0232")}}, exifIFDEntries(fields)...)
+	gpsEntries := gpsIFDEntries(fields)
+
+	ifd0 := append(ifd0Entries(fields), longEntry(tagExifIFD, 0))
+	if gpsEntries != nil {
+		ifd0 = append(ifd0, longEntry(tagGPSIFD, 0))
+	}
+
+	// Sub-IFD pointers are inline, so sizes are known before the offsets are filled in
+	ifd0Offset := uint32(8)
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exifEntries)
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case tagExifIFD:
+			ifd0[i] = longEntry(tagExifIFD, exifOffset)
+		case tagGPSIFD:
+			ifd0[i] = longEntry(tagGPSIFD, gpsOffset)
+		}
+	}
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00*")
+	binary.Write(&tiff, exifByteOrder, ifd0Offset)
+	tiff.Write(encodeIFD(ifd0, ifd0Offset, 0, exifByteOrder))
+	tiff.Write(encodeIFD(exifEntries, exifOffset, 0, exifByteOrder))
+	if gpsEntries != nil {
+		tiff.Write(encodeIFD(gpsEntries, gpsOffset, 0, exifByteOrder))
+	}
+
+	return append(append([]byte{}, exifHeader...), tiff.Bytes()...)
+}
+
+// rewriteTIFF sets the fields in an existing TIFF block. The block is kept byte for
+// byte, so offsets into it (maker notes, thumbnails, interoperability data) stay
+// valid; the changed IFDs are appended to it and the header points at the new IFD0.
+// Tags the native writer doesn't set are carried over unchanged.
+func rewriteTIFF(block []byte, fields exifFields) ([]byte, error) {
+	if len(block) < 8 {
+		return nil, errMalformed
+	}
+	t, err := newTIFFReader(bytes.NewReader(block), block)
+	if err != nil {
+		return nil, err
+	}
+	tail, ifd0Offset, err := t.appendIFDs(t.order.Uint32(block[4:]), int64(len(block)), fields)
+	if err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, block...), tail...)
+	t.order.PutUint32(out[4:], ifd0Offset)
+	return out, nil
+}
+
+// newTIFFReader returns a reader for the TIFF data in r, in the byte order its
+// header gives. Anything but classic TIFF, such as BigTIFF, is refused.
+func newTIFFReader(r io.ReaderAt, header []byte) (*tiffReader, error) {
+	if len(header) < 8 {
+		return nil, errMalformed
+	}
+	t := &tiffReader{r: r}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errMalformed
+	}
+	// BigTIFF (43) has 8-byte offsets, which the 4-byte header patch would corrupt
+	if t.order.Uint16(header[2:4]) != 42 {
+		return nil, errMalformed
+	}
+	return t, nil
+}
+
+// appendIFDs sets the fields in the IFDs of the TIFF data, whose IFD0 is at ifd0At
+// and which ends at end. It returns the bytes to append to the data, holding the
+// changed IFDs, and the offset of the new IFD0 for the header.
+func (t *tiffReader) appendIFDs(ifd0At uint32, end int64, fields exifFields) ([]byte, uint32, error) {
+	ifd0, next, err := t.readIFDEntries(ifd0At)
+	if err != nil {
+		return nil, 0, err
+	}
+	var exifEntries, gpsEntries []tiffEntry
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagExifIFD:
+			if exifEntries, _, err = t.readIFDEntries(t.order.Uint32(e.data)); err != nil {
+				return nil, 0, err
+			}
+		case tagGPSIFD:
+			if gpsEntries, _, err = t.readIFDEntries(t.order.Uint32(e.data)); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	if exifEntries == nil {
+		exifEntries = []tiffEntry{{tag: tagExifVersion, typ: typeUndefined, count: 4, data: []byte("0232")}}
+	}
+	exifEntries = setEntries(exifEntries, exifIFDEntries(fields), t.order)
+	ifd0 = setEntries(ifd0, ifd0Entries(fields), t.order)
+	if gps := gpsIFDEntries(fields); gps != nil {
+		gpsEntries = setEntries(gpsEntries, gps, t.order)
+	}
+
+	// New IFDs go after the existing data, on a word boundary, all within reach of
+	// 32-bit offsets (with room for the two sub-IFD pointers IFD0 may gain)
+	if end+1+int64(ifdSize(exifEntries))+int64(ifdSize(gpsEntries))+int64(ifdSize(ifd0))+24 > math.MaxUint32 {
+		return nil, 0, errTIFFTooLarge
+	}
+	var tail []byte
+	if end%2 == 1 {
+		tail = append(tail, 0)
+	}
+	exifOffset := uint32(end) + uint32(len(tail))
+	gpsOffset := exifOffset + ifdSize(exifEntries)
+	ifd0Offset := gpsOffset
+	ifd0 = setEntries(ifd0, []tiffEntry{longEntry(tagExifIFD, exifOffset)}, t.order)
+	if gpsEntries != nil {
+		ifd0Offset += ifdSize(gpsEntries)
+		ifd0 = setEntries(ifd0, []tiffEntry{longEntry(tagGPSIFD, gpsOffset)}, t.order)
+	}
+
+	tail = append(tail, encodeIFD(exifEntries, exifOffset, 0, t.order)...)
+	if gpsEntries != nil {
+		tail = append(tail, encodeIFD(gpsEntries, gpsOffset, 0, t.order)...)
+	}
+	tail = append(tail, encodeIFD(ifd0, ifd0Offset, next, t.order)...)
+	return tail, ifd0Offset, nil
+}
+
+// readIFDEntries returns the entries of the IFD at offset in file order, their values
+// as the raw 4 bytes (inline data or offset), and the offset of the next IFD
+func (t *tiffReader) readIFDEntries(offset uint32) ([]tiffEntry, uint32, error) {
+	countBuf := make([]byte, 2)
+	if _, err := t.r.ReadAt(countBuf, int64(offset)); err != nil {
+		return nil, 0, errMalformed
+	}
+	count := int(t.order.Uint16(countBuf))
+	buf := make([]byte, count*12+4)
+	if _, err := t.r.ReadAt(buf, int64(offset)+2); err != nil {
+		return nil, 0, errMalformed
+	}
+	entries := make([]tiffEntry, count)
+	for i := range entries {
+		raw := buf[i*12 : i*12+12]
+		entries[i] = tiffEntry{tag: t.order.Uint16(raw[0:]), typ: t.order.Uint16(raw[2:]), count: t.order.Uint32(raw[4:]), data: raw[8:12]}
+	}
+	return entries, t.order.Uint32(buf[count*12:]), nil
+}
+
+// setEntries replaces or adds entries built in exifByteOrder, keeping the IFD sorted by tag
+func setEntries(entries, set []tiffEntry, order binary.ByteOrder) []tiffEntry {
+	for _, e := range set {
+		e = inOrder(e, order)
+		i := sort.Search(len(entries), func(i int) bool { return entries[i].tag >= e.tag })
+		if i < len(entries) && entries[i].tag == e.tag {
+			entries[i] = e
+			continue
+		}
+		entries = append(entries[:i], append([]tiffEntry{e}, entries[i:]...)...)
+	}
+	return entries
+}
+
+// isJPEGFile reports whether the path has a JPEG extension
+func isJPEGFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// jpegSegment is a JPEG marker segment before the image data
+type jpegSegment struct {
+	marker  byte // 0xE1 for Exif and XMP, 0xED for IPTC
+	payload []byte
+}
+
+// readJPEGSegments returns the segments between SOI and the image data, and the
+// offset where the image data (SOS) starts
+func readJPEGSegments(r io.ReadSeeker) ([]jpegSegment, int64, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil || head[0] != 0xFF || head[1] != 0xD8 {
+		return nil, 0, errMalformed
+	}
+	var segments []jpegSegment
+	offset := int64(2)
+	marker := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, marker[:2]); err != nil || marker[0] != 0xFF {
+			return nil, 0, errMalformed
+		}
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return segments, offset, nil
+		}
+		if _, err := io.ReadFull(r, marker[2:]); err != nil {
+			return nil, 0, errMalformed
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:]))
+		if length < 2 {
+			return nil, 0, errMalformed
+		}
+		payload := make([]byte, length-2)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, 0, errMalformed
+		}
+		segments = append(segments, jpegSegment{marker: marker[1], payload: payload})
+		offset += int64(2 + length)
+	}
+}
+
+// rewriteJPEG replaces the segments before a JPEG's image data with the ones edit
+// returns. The image data is copied byte for byte, and the copy replaces the original
+// (see replaceFile). It returns the change in size.
+func rewriteJPEG(jpegPath string, inPlace bool, edit func([]jpegSegment) ([]jpegSegment, error)) (int64, error) {
+	src, err := os.Open(jpegPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat image: %w", err)
+	}
+	segments, dataOffset, err := readJPEGSegments(src)
+	if err != nil {
+		return 0, err
+	}
+	if segments, err = edit(segments); err != nil {
+		return 0, err
+	}
+
+	out := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		if len(segment.payload)+2 > 0xFFFF {
+			return 0, fmt.Errorf("APP%d segment too large", segment.marker-0xE0)
+		}
+		out = append(out, 0xFF, segment.marker)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(segment.payload)+2))
+		out = append(out, segment.payload...)
+	}
+	if _, err := src.Seek(dataOffset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	tmpPath := TrackTempFile(jpegPath + ".exif-tmp")
+	defer RemoveTempFile(tmpPath)
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	_, err = dst.Write(out)
+	if err == nil {
+		_, err = io.Copy(dst, src)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write image: %w", err)
+	}
+	src.Close()
+
+	if err := replaceFile(tmpPath, jpegPath, inPlace); err != nil {
+		return 0, fmt.Errorf("failed to replace original image: %w", err)
+	}
+	return int64(len(out)) - dataOffset, nil
+}
+
+// isTIFFFile reports whether the file is a TIFF-based image the native writer
+// handles: TIFF itself and DNG raw files
+func isTIFFFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".tif" || ext == ".tiff" || ext == ".dng"
+}
+
+// rewriteTIFFFile sets the fields in a TIFF or DNG file. As with rewriteTIFF, the
+// file is kept byte for byte and the changed IFDs are appended to a copy, which
+// replaces the original (see replaceFile). It returns the change in size.
+func rewriteTIFFFile(tiffPath string, inPlace bool, fields exifFields) (int64, error) {
+	src, err := os.Open(tiffPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat image: %w", err)
+	}
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return 0, errMalformed
+	}
+	t, err := newTIFFReader(src, header)
+	if err != nil {
+		return 0, err
+	}
+	tail, ifd0Offset, err := t.appendIFDs(t.order.Uint32(header[4:]), info.Size(), fields)
+	if err != nil {
+		return 0, err
+	}
+	t.order.PutUint32(header[4:], ifd0Offset)
+	if _, err := src.Seek(int64(len(header)), io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	tmpPath := TrackTempFile(tiffPath + ".exif-tmp")
+	defer RemoveTempFile(tmpPath)
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	_, err = dst.Write(header)
+	if err == nil {
+		_, err = io.Copy(dst, src)
+	}
+	if err == nil {
+		_, err = dst.Write(tail)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write image: %w", err)
+	}
+	src.Close()
+
+	if err := replaceFile(tmpPath, tiffPath, inPlace); err != nil {
+		return 0, fmt.Errorf("failed to replace original image: %w", err)
+	}
+	return int64(len(tail)), nil
+}
+
+// setJPEGMetadata writes the fields into the Exif, XMP and IPTC segments of a JPEG,
+// merging them into the existing segments. Missing segments are inserted right after
+// SOI (and the JFIF APP0 segment, if present).
+func setJPEGMetadata(segments []jpegSegment, fields exifFields, opts ApplyOptions) ([]jpegSegment, error) {
+	exif, xmp, iptc := -1, -1, -1
+	for i, segment := range segments {
+		switch {
+		case segment.marker == 0xE1 && bytes.HasPrefix(segment.payload, exifHeader) && exif < 0:
+			exif = i
+		case segment.marker == 0xE1 && bytes.HasPrefix(segment.payload, xmpHeader) && xmp < 0:
+			xmp = i
+		case segment.marker == 0xED && bytes.HasPrefix(segment.payload, photoshopHeader) && iptc < 0:
+			iptc = i
+		}
+	}
+
+	if len(fields.Faces) > 0 {
+		fields.Width, fields.Height = jpegDimensions(segments)
+	}
+
+	var insert []jpegSegment
+	if exif >= 0 {
+		tiff, err := rewriteTIFF(segments[exif].payload[len(exifHeader):], fields)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update EXIF segment: %w", err)
+		}
+		segments[exif].payload = append(append([]byte{}, exifHeader...), tiff...)
+	} else {
+		insert = append(insert, jpegSegment{marker: 0xE1, payload: buildEXIFPayload(fields)})
+	}
+	if packet := nativeXMPPacket(fields, opts); packet != nil {
+		if xmp >= 0 {
+			merged := mergeXMP(segments[xmp].payload[len(xmpHeader):], packet)
+			segments[xmp].payload = append(append([]byte{}, xmpHeader...), merged...)
+		} else {
+			insert = append(insert, jpegSegment{marker: 0xE1, payload: append(append([]byte{}, xmpHeader...), packet.Bytes()...)})
+		}
+	}
+	if opts.StripGoogleXMP && xmp >= 0 {
+		if stripped, found := stripGoogleXMP(segments[xmp].payload[len(xmpHeader):]); found {
+			segments[xmp].payload = append(append([]byte{}, xmpHeader...), stripped...)
+		}
+	}
+	if iptc >= 0 {
+		merged, err := mergeIPTCPayload(segments[iptc].payload, fields)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update IPTC segment: %w", err)
+		}
+		segments[iptc].payload = merged
+	} else {
+		insert = append(insert, jpegSegment{marker: 0xED, payload: buildIPTCPayload(fields)})
+	}
+
+	at := 0
+	if len(segments) > 0 && segments[0].marker == 0xE0 {
+		at = 1
+	}
+	return append(segments[:at], append(insert, segments[at:]...)...), nil
+}
@@ -0,0 +1,265 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTIFF builds a 2x2 TIFF in the given byte order. With subIFDs it also has an
+// Exif IFD holding an older DateTimeOriginal and a GPS IFD holding other coordinates.
+func testTIFF(order binary.ByteOrder, subIFDs bool) []byte {
+	short := func(tag uint16, v uint16) tiffEntry {
+		data := make([]byte, 2)
+		order.PutUint16(data, v)
+		return tiffEntry{tag: tag, typ: typeShort, count: 1, data: data}
+	}
+	long := func(tag uint16, v uint32) tiffEntry {
+		data := make([]byte, 4)
+		order.PutUint32(data, v)
+		return tiffEntry{tag: tag, typ: typeLong, count: 1, data: data}
+	}
+	rationals := func(tag uint16, values ...uint32) tiffEntry {
+		data := make([]byte, 8*len(values))
+		for i, v := range values {
+			order.PutUint32(data[8*i:], v)
+			order.PutUint32(data[8*i+4:], 1)
+		}
+		return tiffEntry{tag: tag, typ: typeRational, count: uint32(len(values)), data: data}
+	}
+
+	header := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(header, "II")
+	} else {
+		copy(header, "MM")
+	}
+	order.PutUint16(header[2:], 42)
+	order.PutUint32(header[4:], 8)
+
+	ifd0 := []tiffEntry{short(0x0100, 2), short(0x0101, 2)}
+	if !subIFDs {
+		return append(header, encodeIFD(ifd0, 8, 0, order)...)
+	}
+	ifd0 = append(ifd0, long(tagExifIFD, 0), long(tagGPSIFD, 0))
+	ifd0Size := uint32(len(encodeIFD(ifd0, 8, 0, order)))
+	exifIFD := []tiffEntry{asciiEntry(tagDateTimeOriginal, "2001:01:01 00:00:00")}
+	exifAt := 8 + ifd0Size
+	exifData := encodeIFD(exifIFD, exifAt, 0, order)
+	gpsAt := exifAt + uint32(len(exifData))
+	gpsIFD := []tiffEntry{
+		asciiEntry(tagGPSLatitudeRef, "N"), rationals(tagGPSLatitude, 10, 0, 0),
+		asciiEntry(tagGPSLongitudeRef, "E"), rationals(tagGPSLongitude, 20, 0, 0),
+	}
+	ifd0[2], ifd0[3] = long(tagExifIFD, exifAt), long(tagGPSIFD, gpsAt)
+
+	out := append(header, encodeIFD(ifd0, 8, 0, order)...)
+	out = append(out, exifData...)
+	return append(out, encodeIFD(gpsIFD, gpsAt, 0, order)...)
+}
+
+func TestRewriteTIFFFileRoundTrip(t *testing.T) {
+	fields := exifFields{
+		DateTime:    "2019:07:14 16:20:00",
+		Description: "Harbour",
+		HasGPS:      true,
+		Latitude:    -33.8688,
+		Longitude:   151.2093,
+		HasAltitude: true,
+		Altitude:    35,
+	}
+	for _, tc := range []struct {
+		name    string
+		order   binary.ByteOrder
+		subIFDs bool
+	}{
+		{"II", binary.LittleEndian, false},
+		{"MM", binary.BigEndian, false},
+		{"II with Exif and GPS IFDs", binary.LittleEndian, true},
+		{"MM with Exif and GPS IFDs", binary.BigEndian, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := testTIFF(tc.order, tc.subIFDs)
+			path := filepath.Join(t.TempDir(), "photo.tif")
+			if err := os.WriteFile(path, original, 0644); err != nil {
+				t.Fatal(err)
+			}
+			for run := 1; run <= 2; run++ {
+				if _, err := rewriteTIFFFile(path, false, fields); err != nil {
+					t.Fatalf("run %d: %v", run, err)
+				}
+			}
+
+			written, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(written[:4], original[:4]) {
+				t.Errorf("header starts with %q, want %q", written[:4], original[:4])
+			}
+			if !bytes.Equal(written[8:len(original)], original[8:]) {
+				t.Error("the original TIFF data was not kept byte for byte")
+			}
+
+			data, err := readEXIF(path)
+			if err != nil {
+				t.Fatalf("reading back: %v", err)
+			}
+			if data.DateTimeOriginal != fields.DateTime {
+				t.Errorf("DateTimeOriginal = %q, want %q", data.DateTimeOriginal, fields.DateTime)
+			}
+			if !data.HasGPS || math.Abs(data.Latitude-fields.Latitude) > 1e-5 || math.Abs(data.Longitude-fields.Longitude) > 1e-5 {
+				t.Errorf("GPS = %v %f,%f, want %f,%f", data.HasGPS, data.Latitude, data.Longitude, fields.Latitude, fields.Longitude)
+			}
+			if !data.HasAltitude || math.Abs(data.Altitude-fields.Altitude) > 1e-2 {
+				t.Errorf("altitude = %v %f, want %f", data.HasAltitude, data.Altitude, fields.Altitude)
+			}
+		})
+	}
+}
+
+func TestRewriteTIFFFileRefusesBigTIFF(t *testing.T) {
+	// BigTIFF: magic 43, 8-byte offset size, reserved 0, then an 8-byte IFD0 offset
+	bigTIFF := []byte{'I', 'I', 43, 0, 8, 0, 0, 0, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	path := filepath.Join(t.TempDir(), "big.tif")
+	if err := os.WriteFile(path, bigTIFF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rewriteTIFFFile(path, false, exifFields{DateTime: "2019:07:14 16:20:00"}); !errors.Is(err, errMalformed) {
+		t.Fatalf("err = %v, want %v", err, errMalformed)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, bigTIFF) {
+		t.Error("the BigTIFF file was changed")
+	}
+}
+
+// testJPEG builds a JPEG from the given segments (after SOI) followed by a scan:
+// the SOS header, entropy-coded bytes holding stuffed and restart markers, and EOI
+func testJPEG(segments ...jpegSegment) []byte {
+	out := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		out = append(out, 0xFF, segment.marker)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(segment.payload)+2))
+		out = append(out, segment.payload...)
+	}
+	out = append(out, 0xFF, 0xDA, 0x00, 0x08, 0x01, 0x01, 0x00, 0x00, 0x3F, 0x00)
+	out = append(out, 0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56, 0x78, 0x9A)
+	return append(out, 0xFF, 0xD9)
+}
+
+// jpegScan returns the bytes of a JPEG from SOS on
+func jpegScan(t *testing.T, data []byte) []byte {
+	t.Helper()
+	_, offset, err := readJPEGSegments(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("reading segments: %v", err)
+	}
+	return data[offset:]
+}
+
+func TestRewriteJPEGRoundTrip(t *testing.T) {
+	jfif := jpegSegment{marker: 0xE0, payload: []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")}
+	exif := jpegSegment{marker: 0xE1, payload: append(append([]byte{}, exifHeader...), testTIFF(binary.LittleEndian, true)...)}
+	xmp := jpegSegment{marker: 0xE1, payload: append(append([]byte{}, xmpHeader...),
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"></rdf:RDF></x:xmpmeta>`...)}
+	fields := exifFields{
+		DateTime:    "2019:07:14 16:20:00",
+		Description: "Harbour",
+		HasGPS:      true,
+		Latitude:    -33.8688,
+		Longitude:   151.2093,
+		IPTCDate:    "20190714",
+		IPTCTime:    "162000+0000",
+	}
+	for _, tc := range []struct {
+		name     string
+		segments []jpegSegment
+	}{
+		{"no APP1", []jpegSegment{jfif}},
+		{"existing Exif APP1", []jpegSegment{jfif, exif}},
+		{"XMP APP1 before Exif", []jpegSegment{xmp, exif}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := testJPEG(tc.segments...)
+			path := filepath.Join(t.TempDir(), "photo.jpg")
+			if err := os.WriteFile(path, original, 0644); err != nil {
+				t.Fatal(err)
+			}
+			added, err := rewriteJPEG(path, false, func(segments []jpegSegment) ([]jpegSegment, error) {
+				return setJPEGMetadata(segments, fields, ApplyOptions{})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			written, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := int64(len(written) - len(original)); got != added {
+				t.Errorf("reported %d bytes added, the file grew by %d", added, got)
+			}
+			if !bytes.Equal(jpegScan(t, written), jpegScan(t, original)) {
+				t.Error("the image data after SOS was not kept byte for byte")
+			}
+
+			data, err := readEXIF(path)
+			if err != nil {
+				t.Fatalf("reading back: %v", err)
+			}
+			if data.DateTimeOriginal != fields.DateTime {
+				t.Errorf("DateTimeOriginal = %q, want %q", data.DateTimeOriginal, fields.DateTime)
+			}
+			if !data.HasGPS || math.Abs(data.Latitude-fields.Latitude) > 1e-5 || math.Abs(data.Longitude-fields.Longitude) > 1e-5 {
+				t.Errorf("GPS = %v %f,%f, want %f,%f", data.HasGPS, data.Latitude, data.Longitude, fields.Latitude, fields.Longitude)
+			}
+
+			segments, _, err := readJPEGSegments(bytes.NewReader(written))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// JFIF must stay first, and the original APP1 segments keep their order
+			if tc.segments[0].marker == 0xE0 && segments[0].marker != 0xE0 {
+				t.Errorf("first segment is APP%d, want JFIF APP0", segments[0].marker-0xE0)
+			}
+			exifAt, xmpAt, exifSegments := -1, -1, 0
+			for i, segment := range segments {
+				switch {
+				case segment.marker == 0xE1 && bytes.HasPrefix(segment.payload, exifHeader):
+					exifAt = i
+					exifSegments++
+				case segment.marker == 0xE1 && bytes.HasPrefix(segment.payload, xmpHeader) && xmpAt < 0:
+					xmpAt = i
+				}
+			}
+			if exifSegments != 1 {
+				t.Errorf("%d Exif APP1 segments, want 1", exifSegments)
+			}
+			if tc.segments[0].marker == 0xE1 && xmpAt > exifAt {
+				t.Errorf("XMP APP1 at %d moved after the Exif APP1 at %d", xmpAt, exifAt)
+			}
+		})
+	}
+}
+
+func TestRewriteJPEGRefusesMalformed(t *testing.T) {
+	// The APP1 length runs past the end of the file
+	truncated := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x10, 0x00, 'E', 'x', 'i', 'f'}
+	path := filepath.Join(t.TempDir(), "broken.jpg")
+	if err := os.WriteFile(path, truncated, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := rewriteJPEG(path, false, func(segments []jpegSegment) ([]jpegSegment, error) {
+		return setJPEGMetadata(segments, exifFields{DateTime: "2019:07:14 16:20:00"}, ApplyOptions{})
+	})
+	if !errors.Is(err, errMalformed) {
+		t.Fatalf("err = %v, want %v", err, errMalformed)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, truncated) {
+		t.Error("the malformed file was changed")
+	}
+}
@@ -0,0 +1,185 @@
+package metadata
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// googleEditNamespaces are the XMP namespaces whose properties only record how a
+// photo was edited or generated: Camera Raw style adjustments, the focus data kept to
+// re-edit a portrait's blur, and the Google Photos creation details
+var googleEditNamespaces = []string{
+	"http://ns.adobe.com/camera-raw-settings/1.0/",
+	"http://ns.google.com/photos/1.0/focus/",
+	"http://ns.google.com/photos/1.0/creations/",
+}
+
+// editHistoryProperties are the xmpMM properties holding an edit history
+var editHistoryProperties = []string{"History", "DerivedFrom", "Ingredients", "Pantry"}
+
+// xmpMMNamespace is the namespace of the XMP media management properties
+const xmpMMNamespace = "http://ns.adobe.com/xap/1.0/mm/"
+
+// googleEditGroups are the exiftool groups of googleEditNamespaces
+var googleEditGroups = []string{"XMP-crs", "XMP-GFocus", "XMP-GCreations"}
+
+// googleEditTag names the first Google edit tag found in the values read by
+// getExistingImageEXIF
+const googleEditTag = "GoogleEditData"
+
+// googleXMPArgs returns the exiftool arguments naming the same properties as
+// stripGoogleXMP, each followed by suffix: "=" removes them, "" reads them
+func googleXMPArgs(suffix string) []string {
+	var args []string
+	for _, group := range googleEditGroups {
+		args = append(args, "-"+group+":all"+suffix)
+	}
+	for _, name := range editHistoryProperties {
+		args = append(args, "-XMP-xmpMM:"+name+suffix)
+	}
+	return args
+}
+
+// isGoogleEditTag reports whether a tag printed by exiftool in the given group is one
+// stripGoogleXMP removes; structures are printed flattened, with the property name
+// as prefix
+func isGoogleEditTag(group, tag string) bool {
+	if containsString(googleEditGroups, group) {
+		return true
+	}
+	if group != "XMP-xmpMM" {
+		return false
+	}
+	for _, name := range editHistoryProperties {
+		if strings.HasPrefix(tag, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripGoogleXMP removes the edit history and editing breadcrumbs from an XMP packet
+// (see googleEditNamespaces and editHistoryProperties) and reports whether there were
+// any. Everything else is kept as it is, including the motion photo (GCamera,
+// Container), panorama (GPano), depth (GDepth, GImage) and HDR gain map data the
+// photo needs to be displayed.
+func stripGoogleXMP(xmp []byte) ([]byte, bool) {
+	out := xmp
+	for _, uri := range googleEditNamespaces {
+		for _, prefix := range boundPrefixes(out, uri) {
+			out = removeXMPAttributes(out, prefix, `[A-Za-z0-9_]+`)
+			out = removeXMPElements(out, prefix, "")
+			declaration := regexp.MustCompile(`\s+xmlns:` + regexp.QuoteMeta(prefix) + `=("` + regexp.QuoteMeta(uri) + `"|'` + regexp.QuoteMeta(uri) + `')`)
+			out = declaration.ReplaceAllLiteral(out, nil)
+		}
+	}
+	for _, prefix := range boundPrefixes(out, xmpMMNamespace) {
+		for _, name := range editHistoryProperties {
+			out = removeXMPAttributes(out, prefix, name)
+			out = removeXMPElements(out, prefix, name)
+		}
+	}
+	return out, !bytes.Equal(out, xmp)
+}
+
+// boundPrefixes returns the prefixes an XMP packet binds to a namespace URI
+func boundPrefixes(xmp []byte, uri string) []string {
+	declaration := regexp.MustCompile(`xmlns:([A-Za-z0-9_.-]+)=("` + regexp.QuoteMeta(uri) + `"|'` + regexp.QuoteMeta(uri) + `')`)
+	var prefixes []string
+	for _, match := range declaration.FindAllSubmatch(xmp, -1) {
+		if prefix := string(match[1]); !containsString(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// removeXMPAttributes removes the properties written as attributes whose local name
+// matches the name pattern
+func removeXMPAttributes(xmp []byte, prefix, name string) []byte {
+	attribute := regexp.MustCompile(`\s+` + regexp.QuoteMeta(prefix) + `:` + name + `=("[^"]*"|'[^']*')`)
+	return attribute.ReplaceAllLiteral(xmp, nil)
+}
+
+// removeXMPElements removes the elements of a prefix with their content, only those
+// with the local name when one is given, along with the indentation before them
+func removeXMPElements(xmp []byte, prefix, name string) []byte {
+	open := []byte("<" + prefix + ":" + name)
+	out := xmp
+	for from := 0; ; {
+		i := bytes.Index(out[from:], open)
+		if i < 0 {
+			return out
+		}
+		start := from + i
+		tag := elementName(out[start+1:])
+		if name != "" && tag != prefix+":"+name {
+			from = start + len(open)
+			continue
+		}
+		end := elementEnd(out, start, tag)
+		if end < 0 {
+			return out // Malformed; leave the rest alone
+		}
+		for start > 0 && (out[start-1] == ' ' || out[start-1] == '\t') {
+			start--
+		}
+		if start > 0 && out[start-1] == '\n' && end < len(out) && out[end] == '\n' {
+			end++
+		}
+		out = append(out[:start:start], out[end:]...)
+		from = start
+	}
+}
+
+// elementName returns the qualified name at the start of a tag
+func elementName(tag []byte) string {
+	end := bytes.IndexAny(tag, " \t\r\n/>")
+	if end < 0 {
+		return string(tag)
+	}
+	return string(tag[:end])
+}
+
+// elementEnd returns the offset just past the element starting at start, counting
+// nested elements of the same name, or -1 when it does not end
+func elementEnd(xmp []byte, start int, name string) int {
+	depth := 0
+	for i := start; i < len(xmp); {
+		next := bytes.IndexByte(xmp[i:], '<')
+		if next < 0 {
+			return -1
+		}
+		i += next
+		gt := bytes.IndexByte(xmp[i:], '>')
+		if gt < 0 {
+			return -1
+		}
+		tag := xmp[i+1 : i+gt]
+		switch {
+		case bytes.HasPrefix(tag, []byte("/")) && string(tag[1:]) == name:
+			depth--
+		case elementName(tag) == name && !bytes.HasSuffix(tag, []byte("/")):
+			depth++
+		}
+		i += gt + 1
+		if depth == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// googleXMPStripped reports whether an image has no Google edit history left to
+// remove when -strip-google-xmp is requested
+func googleXMPStripped(values map[string]string, imagePath string, opts ApplyOptions) bool {
+	if !opts.StripGoogleXMP {
+		return true
+	}
+	if !isJPEGFile(imagePath) {
+		return values[googleEditTag] == ""
+	}
+	_, found := stripGoogleXMP(readJPEGXMP(imagePath))
+	return !found
+}
@@ -0,0 +1,152 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tailSize is how much of the end of a file is read to find its end marker
+const tailSize = 4096
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// CheckIntegrity looks for the signs of an empty or cut-off download in a media file
+// before a writer is run on it: no bytes at all, a JPEG without its header or end
+// marker, a PNG without its IEND chunk, or an MP4/MOV/HEIC whose boxes run past the
+// end of the file. Such files are reported as ErrCorruptFile. Only structure that
+// can't be valid is flagged; files this check does not understand pass.
+func CheckIntegrity(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open media file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat media file: %w", err)
+	}
+	if info.Size() == 0 {
+		return corrupt("the file is empty")
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case ext == ".jpg" || ext == ".jpeg":
+		return checkJPEG(f, info.Size())
+	case ext == ".png":
+		return checkPNG(f, info.Size())
+	case isoBMFFExts[ext]:
+		return checkBoxes(f, info.Size(), true)
+	case ext == ".heic" || ext == ".heif" || ext == ".avif":
+		return checkBoxes(f, info.Size(), false)
+	}
+	return nil
+}
+
+// corrupt returns an ErrCorruptFile with the reason found
+func corrupt(reason string) error {
+	return fmt.Errorf("%w: %s", ErrCorruptFile, reason)
+}
+
+// checkJPEG checks that a JPEG starts with SOI, that its header segments fit in the
+// file and that its image data ends with EOI. Motion photos and some cameras append
+// data after EOI, so a file not ending with it is searched for one.
+func checkJPEG(f *os.File, size int64) error {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(f, head); err != nil || head[0] != 0xFF || head[1] != 0xD8 {
+		return corrupt("no JPEG header")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+	_, dataOffset, err := readJPEGSegments(f)
+	if err != nil {
+		// Only a header cut off by the end of the file is a truncation; other oddities
+		// are left to the writers
+		if offset, seekErr := f.Seek(0, io.SeekCurrent); seekErr == nil && offset >= size {
+			return corrupt("the JPEG header is cut off")
+		}
+		return nil
+	}
+
+	tail, err := readTail(f, size)
+	if err != nil {
+		return nil
+	}
+	if bytes.HasSuffix(bytes.TrimRight(tail, "\x00"), []byte{0xFF, 0xD9}) {
+		return nil
+	}
+	if _, err := f.Seek(dataOffset, io.SeekStart); err != nil {
+		return nil
+	}
+	buf := make([]byte, 1<<20)
+	var last byte
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if last == 0xFF && buf[0] == 0xD9 || bytes.Contains(buf[:n], []byte{0xFF, 0xD9}) {
+				return nil
+			}
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			return corrupt("the JPEG image data is cut off (no end marker)")
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// checkPNG checks the PNG signature and that the file still has its IEND chunk
+func checkPNG(f *os.File, size int64) error {
+	head := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(f, head); err != nil || !bytes.Equal(head, pngSignature) {
+		return corrupt("no PNG signature")
+	}
+	tail, err := readTail(f, size)
+	if err != nil {
+		return nil
+	}
+	if !bytes.Contains(tail, []byte("IEND")) {
+		return corrupt("the PNG is cut off (no IEND chunk)")
+	}
+	return nil
+}
+
+// checkBoxes checks that the top-level boxes of an ISO base media file fit in it and,
+// for videos, that the moov box (the index players need) is there
+func checkBoxes(f *os.File, size int64, video bool) error {
+	boxes, err := readBoxes(f, 0, size)
+	if errors.Is(err, errMalformed) || err == nil && len(boxes) == 0 {
+		return corrupt("a box runs past the end of the file")
+	}
+	if err != nil {
+		return nil
+	}
+	if !video {
+		return nil
+	}
+	for _, box := range boxes {
+		if box.typ == "moov" {
+			return nil
+		}
+	}
+	return corrupt("no moov box (the video index is missing)")
+}
+
+// readTail returns the last tailSize bytes of a file, or all of a smaller one
+func readTail(f *os.File, size int64) ([]byte, error) {
+	n := min(size, tailSize)
+	tail := make([]byte, n)
+	if _, err := f.ReadAt(tail, size-n); err != nil {
+		return nil, err
+	}
+	return tail, nil
+}
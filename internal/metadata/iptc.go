@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// photoshopHeader starts the APP13 segment holding a JPEG's IPTC data
+var photoshopHeader = []byte("Photoshop 3.0\x00")
+
+// iptcResourceID is the Photoshop image resource holding the IPTC-NAA record
+const iptcResourceID = 0x0404
+
+// IPTC application record (record 2) datasets written by the native writer
+const (
+	iptcRecordVersion = 0
+	iptcDateCreated   = 55
+	iptcTimeCreated   = 60
+)
+
+// iptcDateTime formats the photo time as IPTC DateCreated ("20060102") and
+// TimeCreated ("150405+0000"), with offset as the time's offset from UTC
+func iptcDateTime(t time.Time, offset time.Duration) (string, string) {
+	return t.Format("20060102"), t.Format("150405") + formatUTCOffset(offset, "")
+}
+
+// formatUTCOffset formats an offset from UTC as "+HHMM", with sep between hours and minutes
+func formatUTCOffset(offset time.Duration, sep string) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	minutes := int(offset.Minutes())
+	return fmt.Sprintf("%c%02d%s%02d", sign, minutes/60, sep, minutes%60)
+}
+
+// supportsIPTC reports whether IPTC dates are written for the file, which is the
+// case for the JPEG and TIFF-based formats legacy DAMs read them from
+func supportsIPTC(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".tif", ".tiff", ".dng":
+		return true
+	}
+	return false
+}
+
+// iptcRecord encodes the datasets the native writer sets, as IPTC application record datasets
+func iptcRecord(fields exifFields) []byte {
+	var record bytes.Buffer
+	writeDataset := func(dataset byte, value []byte) {
+		record.Write([]byte{0x1C, 2, dataset})
+		binary.Write(&record, binary.BigEndian, uint16(len(value)))
+		record.Write(value)
+	}
+	writeDataset(iptcRecordVersion, []byte{0, 4})
+	writeDataset(iptcDateCreated, []byte(fields.IPTCDate))
+	writeDataset(iptcTimeCreated, []byte(fields.IPTCTime))
+	return record.Bytes()
+}
+
+// mergeIPTCPayload sets DateCreated and TimeCreated in an existing APP13 payload,
+// keeping its other image resources and IPTC datasets. A payload without an IPTC
+// resource gets one.
+func mergeIPTCPayload(payload []byte, fields exifFields) ([]byte, error) {
+	var out bytes.Buffer
+	out.Write(photoshopHeader)
+	found := false
+	for rest := payload[len(photoshopHeader):]; len(rest) > 0; {
+		// "8BIM", ID, Pascal name padded to an even length, size, data padded likewise
+		if len(rest) < 12 || !bytes.HasPrefix(rest, []byte("8BIM")) {
+			return nil, errMalformed
+		}
+		nameLen := int(rest[6]) + 1
+		nameLen += nameLen % 2
+		if len(rest) < 6+nameLen+4 {
+			return nil, errMalformed
+		}
+		id := binary.BigEndian.Uint16(rest[4:])
+		size := int(binary.BigEndian.Uint32(rest[6+nameLen:]))
+		dataStart := 6 + nameLen + 4
+		if size < 0 || len(rest) < dataStart+size {
+			return nil, errMalformed
+		}
+		data := rest[dataStart : dataStart+size]
+		next := dataStart + size + size%2
+		if next > len(rest) {
+			next = len(rest)
+		}
+
+		if id == iptcResourceID && !found {
+			found = true
+			merged, err := mergeIPTCRecord(data, fields)
+			if err != nil {
+				return nil, err
+			}
+			writePhotoshopResource(&out, rest[6:6+nameLen], merged)
+		} else {
+			out.Write(rest[:next])
+		}
+		rest = rest[next:]
+	}
+	if !found {
+		writePhotoshopResource(&out, []byte{0, 0}, iptcRecord(fields))
+	}
+	return out.Bytes(), nil
+}
+
+// mergeIPTCRecord replaces the record version, DateCreated and TimeCreated datasets
+// of an IPTC-NAA block, keeping every other dataset in order
+func mergeIPTCRecord(data []byte, fields exifFields) ([]byte, error) {
+	var kept bytes.Buffer
+	for len(data) > 0 {
+		if len(data) < 5 || data[0] != 0x1C || data[3]&0x80 != 0 {
+			return nil, errMalformed // Extended-length datasets are not supported
+		}
+		end := 5 + int(binary.BigEndian.Uint16(data[3:]))
+		if end > len(data) {
+			return nil, errMalformed
+		}
+		record, dataset := data[1], data[2]
+		if record != 2 || (dataset != iptcRecordVersion && dataset != iptcDateCreated && dataset != iptcTimeCreated) {
+			kept.Write(data[:end])
+		}
+		data = data[end:]
+	}
+	// The record version must come first in record 2
+	return append(iptcRecord(fields), kept.Bytes()...), nil
+}
+
+// writePhotoshopResource appends an IPTC image resource with the given padded name
+func writePhotoshopResource(out *bytes.Buffer, name, data []byte) {
+	out.WriteString("8BIM")
+	binary.Write(out, binary.BigEndian, uint16(iptcResourceID))
+	out.Write(name)
+	binary.Write(out, binary.BigEndian, uint32(len(data)))
+	out.Write(data)
+	if len(data)%2 == 1 {
+		out.WriteByte(0)
+	}
+}
+
+// buildIPTCPayload encodes DateCreated and TimeCreated as an APP13 payload: a
+// Photoshop image resource block with the IPTC application record
+func buildIPTCPayload(fields exifFields) []byte {
+	var block bytes.Buffer
+	block.Write(photoshopHeader)
+	writePhotoshopResource(&block, []byte{0, 0}, iptcRecord(fields)) // Empty resource name, padded to an even length
+	return block.Bytes()
+}
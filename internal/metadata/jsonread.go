@@ -0,0 +1,58 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// MaxJSONSize is the largest file accepted as a JSON sidecar. Real Takeout sidecars are
+// a few kilobytes; anything this large is a misnamed media file or a corrupt export.
+const MaxJSONSize = 4 << 20
+
+// ErrJSONTooLarge is returned for "JSON" files larger than MaxJSONSize
+var ErrJSONTooLarge = errors.New("file too large to be a Takeout JSON file")
+
+// maxPooledBuffer bounds the buffers kept in jsonBuffers, so one large album file
+// doesn't pin its memory for the rest of the run
+const maxPooledBuffer = 256 << 10
+
+var jsonBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// readJSONFile reads a JSON file into a pooled buffer and passes its contents to fn.
+// The data is only valid until fn returns.
+func readJSONFile(path string, fn func(data []byte, info os.FileInfo) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read JSON file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read JSON file: %w", err)
+	}
+	if info.Size() > MaxJSONSize {
+		return fmt.Errorf("%w (%d bytes)", ErrJSONTooLarge, info.Size())
+	}
+
+	buf := jsonBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			jsonBuffers.Put(buf)
+		}
+	}()
+
+	// The file may grow between Stat and the read; never go past the limit
+	if _, err := buf.ReadFrom(io.LimitReader(f, MaxJSONSize+1)); err != nil {
+		return fmt.Errorf("failed to read JSON file: %w", err)
+	}
+	if buf.Len() > MaxJSONSize {
+		return ErrJSONTooLarge
+	}
+	return fn(buf.Bytes(), info)
+}
@@ -0,0 +1,201 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sidecar formats told apart by detectFormat
+const (
+	FormatTakeout      = "takeout"       // Google Photos Takeout (photoTakenTime, geoData, ...)
+	FormatAlbumArchive = "album-archive" // Album Archive and Picasa Web Albums (geo, dateTaken or a timestamp in ms, ...)
+	FormatPrintOrder   = "print-order"   // Print orders and Library API items (filename, mediaMetadata.creationTime)
+)
+
+// takeoutFields only appear in Takeout sidecars
+var takeoutFields = []string{"photoTakenTime", "creationTime", "geoData", "geoDataAlt", "googlePhotosOrigin"}
+
+// albumArchiveFields only appear in Album Archive and Picasa-era sidecars
+var albumArchiveFields = []string{"geo", "dateTaken", "taken", "timestamp", "published", "caption", "summary"}
+
+// legacyWrappers are the keys older exports nest an item's fields under
+var legacyWrappers = []string{"mediaItem", "photo", "item"}
+
+// dateLayouts are the date strings seen in older sidecars, and in the "formatted"
+// times of Takeout ones. Times without a zone are taken as UTC, like Takeout times.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006:01:02 15:04:05",
+	"2006-01-02",
+	"Jan 2, 2006, 3:04:05 PM MST",
+	"Jan 2, 2006, 3:04:05 PM MST",
+	"2 Jan 2006, 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04:05 MST",
+}
+
+// legacyFields is an item of an Album Archive or print order sidecar
+type legacyFields struct {
+	Title       string          `json:"title"`
+	Filename    string          `json:"filename"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Caption     string          `json:"caption"`
+	Summary     string          `json:"summary"`
+	DateTaken   json.RawMessage `json:"dateTaken"`
+	Taken       json.RawMessage `json:"taken"`
+	Timestamp   json.RawMessage `json:"timestamp"`
+	Published   json.RawMessage `json:"published"`
+	Geo         *struct {
+		Latitude  *float64 `json:"latitude"`
+		Lat       *float64 `json:"lat"`
+		Longitude *float64 `json:"longitude"`
+		Lon       *float64 `json:"lon"`
+		Lng       *float64 `json:"lng"`
+		Altitude  float64  `json:"altitude"`
+	} `json:"geo"`
+	MediaMetadata struct {
+		CreationTime json.RawMessage `json:"creationTime"`
+	} `json:"mediaMetadata"`
+	People LabelList `json:"people"`
+	Tags   LabelList `json:"tags"`
+}
+
+// detectFormat tells the sidecar formats apart by their fields. Documents with none
+// of the telling fields, such as album metadata.json files, are read as Takeout.
+func detectFormat(fields map[string]json.RawMessage) string {
+	for _, name := range takeoutFields {
+		if _, ok := fields[name]; ok {
+			return FormatTakeout
+		}
+	}
+	if _, ok := fields["mediaMetadata"]; ok {
+		return FormatPrintOrder
+	}
+	for _, name := range albumArchiveFields {
+		if _, ok := fields[name]; ok {
+			return FormatAlbumArchive
+		}
+	}
+	return FormatTakeout
+}
+
+// unwrapLegacy returns the fields of the item an older export nests under a wrapper
+// key, or fields itself
+func unwrapLegacy(fields map[string]json.RawMessage) (map[string]json.RawMessage, json.RawMessage) {
+	if len(fields) != 1 {
+		return fields, nil
+	}
+	for _, key := range legacyWrappers {
+		var inner map[string]json.RawMessage
+		if raw, ok := fields[key]; ok && json.Unmarshal(raw, &inner) == nil {
+			return inner, raw
+		}
+	}
+	return fields, nil
+}
+
+// decodeLegacy converts an Album Archive or print order sidecar to Takeout metadata
+func decodeLegacy(data []byte, format string) (*Metadata, error) {
+	var item legacyFields
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s JSON: %w", format, err)
+	}
+	meta := &Metadata{format: format}
+	meta.Title = firstNonEmpty(item.Title, item.Filename, item.Name)
+	meta.Description = firstNonEmpty(item.Description, item.Caption, item.Summary)
+	for _, raw := range []json.RawMessage{item.MediaMetadata.CreationTime, item.DateTaken, item.Taken, item.Timestamp} {
+		if t, ok := parseLegacyTime(raw); ok {
+			meta.PhotoTakenTime.Timestamp = strconv.FormatInt(t.Unix(), 10)
+			break
+		}
+	}
+	if t, ok := parseLegacyTime(item.Published); ok {
+		meta.CreationTime.Timestamp = strconv.FormatInt(t.Unix(), 10)
+	}
+	if geo := item.Geo; geo != nil {
+		lat, lon := firstSet(geo.Latitude, geo.Lat), firstSet(geo.Longitude, geo.Lon, geo.Lng)
+		if lat != nil && lon != nil {
+			meta.GeoData = GeoData{Latitude: *lat, Longitude: *lon, Altitude: geo.Altitude}
+		}
+	}
+	meta.People, meta.Tags = item.People, item.Tags
+	return meta, nil
+}
+
+// fillFormattedTimes sets the timestamps of a Takeout sidecar that only has the
+// formatted times, as some exports do
+func fillFormattedTimes(meta *Metadata) {
+	if meta.PhotoTakenTime.Timestamp == "" {
+		if t, ok := parseDateString(meta.PhotoTakenTime.Formatted); ok {
+			meta.PhotoTakenTime.Timestamp = strconv.FormatInt(t.Unix(), 10)
+		}
+	}
+	if meta.CreationTime.Timestamp == "" {
+		if t, ok := parseDateString(meta.CreationTime.Formatted); ok {
+			meta.CreationTime.Timestamp = strconv.FormatInt(t.Unix(), 10)
+		}
+	}
+}
+
+// parseLegacyTime reads a time written as a date string or a Unix time, in seconds or,
+// as Picasa did, in milliseconds, either as a number or a string
+func parseLegacyTime(raw json.RawMessage) (time.Time, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return time.Time{}, false
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		text = string(raw)
+	}
+	text = strings.TrimSpace(text)
+	if unix, err := strconv.ParseInt(text, 10, 64); err == nil {
+		if unix > 1e11 {
+			return time.UnixMilli(unix).UTC(), true
+		}
+		return time.Unix(unix, 0).UTC(), true
+	}
+	return parseDateString(text)
+}
+
+// parseDateString reads a date string in one of the dateLayouts
+func parseDateString(text string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// firstNonEmpty returns the first of values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// firstSet returns the first of values that is present in the JSON
+func firstSet(values ...*float64) *float64 {
+	for _, value := range values {
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// Format returns the sidecar format the metadata was read from, see detectFormat
+func (m *Metadata) Format() string {
+	if m.format == "" {
+		return FormatTakeout
+	}
+	return m.format
+}
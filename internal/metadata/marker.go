@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// AppliedMarker is written to XMP dc:source of every file this tool writes with
+// ApplyOptions.WriteMarker, so later runs can recognize it without reading the JSON
+const AppliedMarker = "google-takeout-exif-applier"
+
+// xmpHeader starts the APP1 segment holding a JPEG's XMP packet
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// HasAppliedMarker reports whether a previous run already wrote the metadata of this
+// file. Only JPEG, TIFF-based files and videos with an XMP sidecar are checked; other
+// formats always report false.
+func HasAppliedMarker(mediaPath string) bool {
+	if isVideoFile(mediaPath) {
+		data, err := os.ReadFile(mediaPath + ".xmp")
+		return err == nil && containsMarker(data)
+	}
+
+	f, err := os.Open(mediaPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	switch {
+	case header[0] == 0xFF && header[1] == 0xD8:
+		segment, err := findJPEGSegment(f, 0xE1, xmpHeader)
+		return err == nil && containsMarker(segment)
+	case bytes.Equal(header, []byte("II*\x00")) || bytes.Equal(header, []byte("MM\x00*")):
+		data, err := parseTIFF(f)
+		return err == nil && containsMarker(data.XMP)
+	}
+	return false
+}
+
+func containsMarker(xmp []byte) bool {
+	return bytes.Contains(xmp, []byte(AppliedMarker))
+}
+
+// nativeXMPPacket returns the XMP properties the native JPEG writer embeds: the
+// marker, the preserved file name, the keywords, the audit trail, the shared album
+// likes and comments, the rating and the face regions, or nil when none is wanted
+func nativeXMPPacket(fields exifFields, opts ApplyOptions) *xmpPacket {
+	if !opts.WriteMarker && opts.OriginalName == "" && len(opts.Keywords) == 0 && opts.Audit == nil &&
+		len(fields.Likes) == 0 && len(fields.Comments) == 0 && fields.Rating == 0 && len(fields.Faces) == 0 {
+		return nil
+	}
+	packet := newXMPPacket()
+	if opts.WriteMarker {
+		packet.Set("dc:source", AppliedMarker)
+	}
+	packet.Set("xmpMM:PreservedFileName", opts.OriginalName)
+	packet.AddToBag("dc:subject", opts.Keywords...)
+	packet.setAudit(fields, opts)
+	packet.setSocial(fields)
+	packet.setRating(fields)
+	packet.setRegions(fields)
+	return packet
+}
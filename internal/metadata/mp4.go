@@ -0,0 +1,211 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isoBMFFExts are the video formats built from ISO base media boxes, whose moov box
+// (the index) may come before or after the media data
+var isoBMFFExts = map[string]bool{".mp4": true, ".m4v": true, ".mov": true, ".3gp": true}
+
+// errNoVideoTrack is returned for ISO base media files without a video track header
+var errNoVideoTrack = errors.New("no video track")
+
+// mp4Box is the position of one box: its payload runs from start+header to start+size
+type mp4Box struct {
+	typ    string
+	start  int64
+	size   int64
+	header int64
+}
+
+// readBoxes lists the boxes between start and end
+func readBoxes(r io.ReaderAt, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		box := mp4Box{typ: string(header[4:8]), start: offset, size: int64(binary.BigEndian.Uint32(header[:4])), header: 8}
+		switch box.size {
+		case 0: // Box extends to the end of its parent
+			box.size = end - offset
+		case 1: // 64-bit size follows the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			box.size, box.header = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if box.size < box.header || offset+box.size > end {
+			return nil, errMalformed
+		}
+		boxes = append(boxes, box)
+		offset += box.size
+	}
+	return boxes, nil
+}
+
+// childBox returns the first child of parent with the given type
+func childBox(r io.ReaderAt, parent mp4Box, typ string) (mp4Box, bool) {
+	children, err := readBoxes(r, parent.start+parent.header, parent.start+parent.size)
+	if err != nil {
+		return mp4Box{}, false
+	}
+	for _, child := range children {
+		if child.typ == typ {
+			return child, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// topLevelBoxes lists the boxes of an MP4/MOV file
+func topLevelBoxes(f *os.File) ([]mp4Box, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return readBoxes(f, 0, info.Size())
+}
+
+// moovFirst reports whether the moov box of an MP4/MOV file comes before its mdat
+// box ("faststart"), which lets players start streaming before the whole file is read.
+// Files that aren't ISO base media or can't be read report false.
+func moovFirst(path string) bool {
+	if !isoBMFFExts[strings.ToLower(filepath.Ext(path))] {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	boxes, err := topLevelBoxes(f)
+	if err != nil {
+		return false
+	}
+	for _, box := range boxes {
+		switch box.typ {
+		case "moov":
+			return true
+		case "mdat":
+			return false
+		}
+	}
+	return false
+}
+
+// videoMatrixOffset returns the file offset of the transformation matrix in the track
+// header of the first video track. The matrix holds the display rotation.
+func videoMatrixOffset(f *os.File) (int64, error) {
+	boxes, err := topLevelBoxes(f)
+	if err != nil {
+		return 0, err
+	}
+	for _, moov := range boxes {
+		if moov.typ != "moov" {
+			continue
+		}
+		traks, err := readBoxes(f, moov.start+moov.header, moov.start+moov.size)
+		if err != nil {
+			return 0, err
+		}
+		for _, trak := range traks {
+			if trak.typ != "trak" || !isVideoTrack(f, trak) {
+				continue
+			}
+			tkhd, ok := childBox(f, trak, "tkhd")
+			if !ok {
+				continue
+			}
+			version := make([]byte, 1)
+			if _, err := f.ReadAt(version, tkhd.start+tkhd.header); err != nil {
+				return 0, err
+			}
+			// Version, flags, times, track ID, duration and the reserved, layer, group
+			// and volume fields come before the matrix
+			offset := tkhd.start + tkhd.header + 40
+			if version[0] == 1 {
+				offset += 12
+			}
+			if offset+36 > tkhd.start+tkhd.size {
+				return 0, errMalformed
+			}
+			return offset, nil
+		}
+	}
+	return 0, errNoVideoTrack
+}
+
+// isVideoTrack reports whether a trak box has a "vide" media handler
+func isVideoTrack(f *os.File, trak mp4Box) bool {
+	mdia, ok := childBox(f, trak, "mdia")
+	if !ok {
+		return false
+	}
+	hdlr, ok := childBox(f, mdia, "hdlr")
+	if !ok {
+		return false
+	}
+	handler := make([]byte, 4)
+	if _, err := f.ReadAt(handler, hdlr.start+hdlr.header+8); err != nil {
+		return false
+	}
+	return string(handler) == "vide"
+}
+
+// preserveRotation copies the display matrix of src's video track into dst when the
+// remux changed it, then reads it back to verify. Players that ignore rotation side
+// data handled by ffmpeg still find the original matrix in the track header. Files
+// without a readable video track header are left alone.
+func preserveRotation(src, dst string) error {
+	if !isoBMFFExts[strings.ToLower(filepath.Ext(src))] {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	srcOffset, err := videoMatrixOffset(in)
+	if err != nil {
+		return nil
+	}
+	want := make([]byte, 36)
+	if _, err := in.ReadAt(want, srcOffset); err != nil {
+		return nil
+	}
+
+	out, err := os.OpenFile(dst, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	dstOffset, err := videoMatrixOffset(out)
+	if err != nil {
+		return fmt.Errorf("rewritten file has no video track header: %w", err)
+	}
+	got := make([]byte, 36)
+	if _, err := out.ReadAt(got, dstOffset); err != nil {
+		return err
+	}
+	if bytes.Equal(got, want) {
+		return nil
+	}
+	if _, err := out.WriteAt(want, dstOffset); err != nil {
+		return fmt.Errorf("failed to restore the display matrix: %w", err)
+	}
+	if _, err := out.ReadAt(got, dstOffset); err != nil || !bytes.Equal(got, want) {
+		return fmt.Errorf("display matrix did not verify after restoring it")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Display matrices of the track header: 16.16 fixed point, with the last column 2.30
+var (
+	identityMatrix = []uint32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000}
+	rotate90Matrix = []uint32{0, 0x10000, 0, 0xFFFF0000, 0, 0, 0, 0, 0x40000000}
+)
+
+// rotationTestMP4 builds an MP4 file with a sound track followed by a video track
+// whose track header has the given version and display matrix
+func rotationTestMP4(version byte, matrix []uint32) []byte {
+	handler := func(typ string) []byte {
+		payload := append(make([]byte, 8), typ...)
+		return mp4TestBox("hdlr", append(payload, make([]byte, 13)...))
+	}
+	tkhd := fullBoxPayload(version, 84)
+	at := 40
+	if version == 1 {
+		tkhd, at = fullBoxPayload(version, 96), 52
+	}
+	for i, v := range matrix {
+		binary.BigEndian.PutUint32(tkhd[at+4*i:], v)
+	}
+	moov := mp4TestBox("moov",
+		mp4TestBox("mvhd", fullBoxPayload(0, 100)),
+		mp4TestBox("trak", mp4TestBox("tkhd", fullBoxPayload(0, 84)), mp4TestBox("mdia", handler("soun"))),
+		mp4TestBox("trak", mp4TestBox("tkhd", tkhd), mp4TestBox("mdia", handler("vide"))))
+	return append(mp4TestBox("ftyp", []byte("isom\x00\x00\x02\x00")), moov...)
+}
+
+// readMatrix returns the display matrix of the video track of an MP4 file
+func readMatrix(t *testing.T, path string) []uint32 {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	offset, err := videoMatrixOffset(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := make([]byte, 36)
+	if _, err := f.ReadAt(raw, offset); err != nil {
+		t.Fatal(err)
+	}
+	matrix := make([]uint32, 9)
+	for i := range matrix {
+		matrix[i] = binary.BigEndian.Uint32(raw[4*i:])
+	}
+	return matrix
+}
+
+func TestPreserveRotation(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		srcVersion byte
+		dstVersion byte
+		dst        []uint32
+	}{
+		{"remux dropped the rotation", 0, 0, identityMatrix},
+		{"remux kept the rotation", 0, 0, rotate90Matrix},
+		{"version 1 track header in the remux", 0, 1, identityMatrix},
+		{"version 1 track header in the original", 1, 0, identityMatrix},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src, dst := filepath.Join(dir, "video.mp4"), filepath.Join(dir, "_tmp_video.mp4")
+			if err := os.WriteFile(src, rotationTestMP4(tc.srcVersion, rotate90Matrix), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dst, rotationTestMP4(tc.dstVersion, tc.dst), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := preserveRotation(src, dst); err != nil {
+				t.Fatal(err)
+			}
+			if got := readMatrix(t, dst); !slices.Equal(got, rotate90Matrix) {
+				t.Errorf("matrix = %#x, want %#x", got, rotate90Matrix)
+			}
+		})
+	}
+}
+
+func TestPreserveRotationWithoutVideoTrack(t *testing.T) {
+	dir := t.TempDir()
+	video := rotationTestMP4(0, rotate90Matrix)
+	// Turning the video handler into a sound one leaves no video track
+	audio := bytes.Replace(video, []byte("vide"), []byte("soun"), 1)
+
+	src, dst := filepath.Join(dir, "video.mp4"), filepath.Join(dir, "_tmp_video.mp4")
+	if err := os.WriteFile(src, audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := preserveRotation(src, dst); err != nil {
+		t.Errorf("original without a video track: %v, want it left alone", err)
+	}
+
+	if err := os.WriteFile(src, video, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := preserveRotation(src, dst); err == nil {
+		t.Error("expected an error for a remux that lost its video track")
+	}
+}
@@ -0,0 +1,395 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// mp4Epoch is the origin of the creation and modification times in ISO base media files
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// QuickTime user data text atoms written by the native MP4 writer
+const (
+	mp4Location = "\xa9xyz" // ISO 6709 location string
+	mp4Comment  = "\xa9cmt"
+	mp4Title    = "\xa9nam"
+)
+
+// Language codes of the text atoms: "und" packed into 15 bits, and the code ffmpeg
+// and the Apple apps use for ©xyz
+const (
+	mp4LangUndetermined = 0x55C4
+	mp4LangLocation     = 0x15C7
+)
+
+// applyNativeMP4 writes the creation time, title, description and location of an
+// MP4/MOV file by editing its moov box, without ffmpeg. The media data is not
+// touched: the file is edited in place when the moov box keeps its size, and copied
+// once otherwise, with the chunk offsets adjusted for the shifted media data.
+func applyNativeMP4(videoPath string, meta *Metadata, opts ApplyOptions, result *ApplyResult) (*ApplyResult, error) {
+	photoTime, err := meta.GetPhotoTime()
+	if err != nil {
+		return result, fmt.Errorf("no valid timestamp in metadata: %w", err)
+	}
+
+	f, err := os.Open(videoPath)
+	if err != nil {
+		return result, fmt.Errorf("failed to open video: %w", err)
+	}
+	defer f.Close()
+	boxes, err := topLevelBoxes(f)
+	if err != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("failed to read video boxes: %w", err))
+	}
+	var moov mp4Box
+	for _, box := range boxes {
+		if box.typ == "moov" {
+			moov = box
+		}
+	}
+	if moov.typ == "" {
+		return result, writeFailed(videoPath, fmt.Errorf("no moov box: %w", errMalformed))
+	}
+	old := make([]byte, moov.size)
+	if _, err := f.ReadAt(old, moov.start); err != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("failed to read moov box: %w", err))
+	}
+
+	texts := map[string]string{mp4Title: meta.Title, mp4Comment: meta.Description}
+	if lat, ok := meta.GetLatitude(); ok {
+		if lon, ok := meta.GetLongitude(); ok {
+			location := fmt.Sprintf("%+08.4f%+09.4f", lat, lon)
+			if alt, ok := meta.GetAltitude(); ok {
+				location += fmt.Sprintf("%+.3f", alt)
+			}
+			texts[mp4Location] = location + "/"
+		}
+	}
+	oldTime, oldTexts := readMoovValues(old)
+	changes := []FieldChange{{Tag: "creation_time", Old: oldTime, New: photoTime.UTC().Format("2006-01-02T15:04:05")}}
+	for _, tag := range []struct{ name, atom string }{{"title", mp4Title}, {"comment", mp4Comment}, {"location", mp4Location}} {
+		if texts[tag.atom] != "" {
+			changes = append(changes, FieldChange{Tag: tag.name, Old: oldTexts[tag.atom], New: texts[tag.atom]})
+		}
+	}
+
+	updated, err := rewriteMoov(old, photoTime, texts, moov.start+moov.size)
+	if err != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("failed to update moov box: %w", err))
+	}
+	result.Changes = changes
+	if bytes.Equal(updated, old) {
+		return result, nil
+	}
+
+	if int64(len(updated)) == moov.size {
+		if err = detach(videoPath, opts); err == nil {
+			err = writeAtOffset(videoPath, updated, moov.start)
+		}
+	} else {
+		err = replaceMoov(f, videoPath, moov, updated, opts.InPlace)
+	}
+	if err != nil {
+		return result, writeFailed(videoPath, err)
+	}
+	if err := os.Chtimes(videoPath, photoTime, photoTime); err != nil {
+		return result, writeFailed(videoPath, fmt.Errorf("failed to update file times: %w", err))
+	}
+
+	result.Modified = true
+	result.BytesChanged = int64(len(updated)) - moov.size
+	return result, nil
+}
+
+// rewriteMoov returns a copy of a moov box with the movie, track and media times set
+// to t and the given udta text atoms replaced (empty values are left alone). Chunk
+// offsets past moovEnd, the end of the box in the file, move with the size change.
+func rewriteMoov(moov []byte, t time.Time, texts map[string]string, moovEnd int64) ([]byte, error) {
+	moov = append([]byte{}, moov...)
+	r := bytes.NewReader(moov)
+	root := mp4Box{typ: "moov", size: int64(len(moov)), header: boxHeaderSize(moov)}
+	children, err := readBoxes(r, root.header, root.size)
+	if err != nil {
+		return nil, err
+	}
+
+	seconds := uint64(t.UTC().Sub(mp4Epoch) / time.Second)
+	var udta []byte
+	udtaIndex := -1
+	for i, child := range children {
+		switch child.typ {
+		case "mvhd":
+			setMP4Times(moov[child.start+child.header:child.start+child.size], seconds)
+		case "trak":
+			if tkhd, ok := childBox(r, child, "tkhd"); ok {
+				setMP4Times(moov[tkhd.start+tkhd.header:tkhd.start+tkhd.size], seconds)
+			}
+			if mdia, ok := childBox(r, child, "mdia"); ok {
+				if mdhd, ok := childBox(r, mdia, "mdhd"); ok {
+					setMP4Times(moov[mdhd.start+mdhd.header:mdhd.start+mdhd.size], seconds)
+				}
+			}
+		case "udta":
+			if udtaIndex < 0 {
+				udta, udtaIndex = moov[child.start:child.start+child.size], i
+			}
+		}
+	}
+
+	newUdta, err := rewriteUdta(udta, texts)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte{}, moov[:root.header]...)
+	for i, child := range children {
+		if i == udtaIndex {
+			out = append(out, newUdta...)
+			continue
+		}
+		out = append(out, moov[child.start:child.start+child.size]...)
+	}
+	if udtaIndex < 0 {
+		out = append(out, newUdta...)
+	}
+	if err := setBoxSize(out, int64(len(out))); err != nil {
+		return nil, err
+	}
+	if delta := int64(len(out)) - root.size; delta != 0 {
+		if err := shiftChunkOffsets(out, moovEnd, delta); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// rewriteUdta returns a udta box with the given text atoms replaced, keeping the
+// other user data. udta may be nil.
+func rewriteUdta(udta []byte, texts map[string]string) ([]byte, error) {
+	out := []byte{0, 0, 0, 0, 'u', 'd', 't', 'a'}
+	if udta != nil {
+		header := boxHeaderSize(udta)
+		children, err := readBoxes(bytes.NewReader(udta), header, int64(len(udta)))
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if texts[child.typ] == "" {
+				out = append(out, udta[child.start:child.start+child.size]...)
+			}
+		}
+	}
+	for _, atom := range []string{mp4Title, mp4Comment, mp4Location} {
+		text := texts[atom]
+		if text == "" {
+			continue
+		}
+		lang := uint16(mp4LangUndetermined)
+		if atom == mp4Location {
+			lang = mp4LangLocation
+		}
+		out = binary.BigEndian.AppendUint32(out, uint32(12+len(text)))
+		out = append(out, atom...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(text)))
+		out = binary.BigEndian.AppendUint16(out, lang)
+		out = append(out, text...)
+	}
+	binary.BigEndian.PutUint32(out, uint32(len(out)))
+	return out, nil
+}
+
+// setMP4Times sets the creation and modification times of an mvhd, tkhd or mdhd
+// payload, which start with a version byte and flags
+func setMP4Times(payload []byte, seconds uint64) {
+	if len(payload) >= 20 && payload[0] == 1 {
+		binary.BigEndian.PutUint64(payload[4:], seconds)
+		binary.BigEndian.PutUint64(payload[12:], seconds)
+	} else if len(payload) >= 12 && seconds <= math.MaxUint32 {
+		binary.BigEndian.PutUint32(payload[4:], uint32(seconds))
+		binary.BigEndian.PutUint32(payload[8:], uint32(seconds))
+	}
+}
+
+// readMoovValues returns the movie creation time and the udta text atoms of a moov
+// box, keyed by atom type, for recording what was replaced
+func readMoovValues(moov []byte) (string, map[string]string) {
+	r := bytes.NewReader(moov)
+	children, err := readBoxes(r, boxHeaderSize(moov), int64(len(moov)))
+	if err != nil {
+		return "", nil
+	}
+	created, texts := "", make(map[string]string)
+	for _, child := range children {
+		payload := moov[child.start+child.header : child.start+child.size]
+		switch {
+		case child.typ == "mvhd" && len(payload) >= 12:
+			seconds := uint64(binary.BigEndian.Uint32(payload[4:]))
+			if payload[0] == 1 && len(payload) >= 20 {
+				seconds = binary.BigEndian.Uint64(payload[4:])
+			}
+			if seconds > 0 && seconds < math.MaxInt64/uint64(time.Second) {
+				created = mp4Epoch.Add(time.Duration(seconds) * time.Second).Format("2006-01-02T15:04:05")
+			}
+		case child.typ == "udta":
+			atoms, err := readBoxes(r, child.start+child.header, child.start+child.size)
+			if err != nil {
+				continue
+			}
+			for _, atom := range atoms {
+				data := moov[atom.start+atom.header : atom.start+atom.size]
+				if len(data) >= 4 && int(binary.BigEndian.Uint16(data))+4 <= len(data) {
+					texts[atom.typ] = string(data[4 : 4+binary.BigEndian.Uint16(data)])
+				}
+			}
+		}
+	}
+	return created, texts
+}
+
+// shiftChunkOffsets adds delta to every chunk offset of the moov box pointing at or
+// past from, whose data moves when the moov box before it changes size
+func shiftChunkOffsets(moov []byte, from, delta int64) error {
+	r := bytes.NewReader(moov)
+	traks, err := readBoxes(r, boxHeaderSize(moov), int64(len(moov)))
+	if err != nil {
+		return err
+	}
+	for _, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+		stbl, ok := mp4Path(r, trak, "mdia", "minf", "stbl")
+		if !ok {
+			continue
+		}
+		tables, err := readBoxes(r, stbl.start+stbl.header, stbl.start+stbl.size)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if table.typ != "stco" && table.typ != "co64" {
+				continue
+			}
+			payload := moov[table.start+table.header : table.start+table.size]
+			if len(payload) < 8 {
+				return errMalformed
+			}
+			width := 4
+			if table.typ == "co64" {
+				width = 8
+			}
+			count := int(binary.BigEndian.Uint32(payload[4:]))
+			if count > (len(payload)-8)/width {
+				return errMalformed
+			}
+			for i := 0; i < count; i++ {
+				entry := payload[8+i*width:]
+				if width == 8 {
+					if offset := int64(binary.BigEndian.Uint64(entry)); offset >= from {
+						binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+					}
+					continue
+				}
+				offset := int64(binary.BigEndian.Uint32(entry))
+				if offset < from {
+					continue
+				}
+				if offset+delta > math.MaxUint32 {
+					return fmt.Errorf("chunk offsets would overflow the 32-bit stco table")
+				}
+				binary.BigEndian.PutUint32(entry, uint32(offset+delta))
+			}
+		}
+	}
+	return nil
+}
+
+// mp4Path follows a chain of child box types below parent
+func mp4Path(r io.ReaderAt, parent mp4Box, types ...string) (mp4Box, bool) {
+	box := parent
+	for _, typ := range types {
+		var ok bool
+		if box, ok = childBox(r, box, typ); !ok {
+			return mp4Box{}, false
+		}
+	}
+	return box, true
+}
+
+// boxHeaderSize returns the header size of a box held in memory
+func boxHeaderSize(box []byte) int64 {
+	if len(box) >= 16 && binary.BigEndian.Uint32(box) == 1 {
+		return 16
+	}
+	return 8
+}
+
+// setBoxSize writes size into the header of a box held in memory, keeping a 64-bit
+// size field when it has one
+func setBoxSize(box []byte, size int64) error {
+	if boxHeaderSize(box) == 16 {
+		binary.BigEndian.PutUint64(box[8:], uint64(size))
+		return nil
+	}
+	if size > math.MaxUint32 {
+		return fmt.Errorf("box too large")
+	}
+	binary.BigEndian.PutUint32(box, uint32(size))
+	return nil
+}
+
+// writeAtOffset overwrites part of a file in place
+func writeAtOffset(path string, data []byte, offset int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open video for writing: %w", err)
+	}
+	_, err = f.WriteAt(data, offset)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write moov box: %w", err)
+	}
+	return nil
+}
+
+// replaceMoov writes a copy of the video with a new moov box next to it, then
+// replaces the original (see replaceFile)
+func replaceMoov(src *os.File, videoPath string, moov mp4Box, updated []byte, inPlace bool) error {
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read video: %w", err)
+	}
+	tempOutput := TrackTempFile(filepath.Join(filepath.Dir(videoPath), "_tmp_"+filepath.Base(videoPath)))
+	defer RemoveTempFile(tempOutput)
+	dst, err := os.OpenFile(tempOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	_, err = io.Copy(dst, io.NewSectionReader(src, 0, moov.start))
+	if err == nil {
+		_, err = dst.Write(updated)
+	}
+	if err == nil {
+		end := moov.start + moov.size
+		_, err = io.Copy(dst, io.NewSectionReader(src, end, info.Size()-end))
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write video: %w", err)
+	}
+	src.Close()
+	if err := replaceFile(tempOutput, videoPath, inPlace); err != nil {
+		return fmt.Errorf("failed to replace original video: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mp4TestBox encodes a box holding the concatenated payloads
+func mp4TestBox(typ string, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, typ...), payload...)
+}
+
+// fullBoxPayload returns a zeroed payload of a full box with the given version
+func fullBoxPayload(version byte, size int) []byte {
+	payload := make([]byte, size)
+	payload[0] = version
+	return payload
+}
+
+// testMoov builds a moov box with a version 0 mvhd and two tracks: the first with a
+// version 0 tkhd, a version 1 mdhd and an stco table, the second with a co64 table
+func testMoov(stco uint32, co64 uint64) []byte {
+	stcoPayload := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+	stcoPayload = binary.BigEndian.AppendUint32(stcoPayload, stco)
+	co64Payload := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+	co64Payload = binary.BigEndian.AppendUint64(co64Payload, co64)
+	track := func(table []byte) []byte {
+		return mp4TestBox("trak",
+			mp4TestBox("tkhd", fullBoxPayload(0, 84)),
+			mp4TestBox("mdia",
+				mp4TestBox("mdhd", fullBoxPayload(1, 36)),
+				mp4TestBox("minf", mp4TestBox("stbl", table))))
+	}
+	return mp4TestBox("moov",
+		mp4TestBox("mvhd", fullBoxPayload(0, 100)),
+		track(mp4TestBox("stco", stcoPayload)),
+		track(mp4TestBox("co64", co64Payload)))
+}
+
+// testMP4 builds an MP4 file whose two chunks hold "CHUNK-A" and "CHUNK-B", with the
+// moov box before or after the mdat box
+func testMP4(moovFirst bool) []byte {
+	ftyp := mp4TestBox("ftyp", []byte("isom\x00\x00\x02\x00isom"))
+	mdat := mp4TestBox("mdat", []byte("CHUNK-A\x00\x00\x00\x00\x00\x00\x00\x00\x00CHUNK-B"))
+	moovSize := len(testMoov(0, 0))
+	mdatAt := len(ftyp)
+	if moovFirst {
+		mdatAt += moovSize
+	}
+	moov := testMoov(uint32(mdatAt+8), uint64(mdatAt+8+16))
+	if moovFirst {
+		return bytes.Join([][]byte{ftyp, moov, mdat}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+// readTestMoov returns the moov box of an MP4 file
+func readTestMoov(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	boxes, err := topLevelBoxes(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, box := range boxes {
+		if box.typ == "moov" {
+			moov := make([]byte, box.size)
+			if _, err := f.ReadAt(moov, box.start); err != nil {
+				t.Fatal(err)
+			}
+			return moov
+		}
+	}
+	t.Fatal("no moov box")
+	return nil
+}
+
+// trakPayloads returns the payloads of the boxes at path below each trak of a moov box
+func trakPayloads(t *testing.T, moov []byte, path ...string) [][]byte {
+	t.Helper()
+	r := bytes.NewReader(moov)
+	children, err := readBoxes(r, boxHeaderSize(moov), int64(len(moov)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads [][]byte
+	for _, trak := range children {
+		if trak.typ != "trak" {
+			continue
+		}
+		if box, ok := mp4Path(r, trak, path...); ok {
+			payloads = append(payloads, moov[box.start+box.header:box.start+box.size])
+		}
+	}
+	return payloads
+}
+
+func TestApplyNativeMP4(t *testing.T) {
+	photoTime := time.Date(2019, 7, 14, 16, 20, 0, 0, time.UTC)
+	seconds := uint64(photoTime.Sub(mp4Epoch) / time.Second)
+	for _, tc := range []struct {
+		name      string
+		moovFirst bool
+	}{
+		{"moov before mdat", true},
+		{"moov after mdat", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "video.mp4")
+			if err := os.WriteFile(path, testMP4(tc.moovFirst), 0644); err != nil {
+				t.Fatal(err)
+			}
+			meta := &Metadata{Title: "Harbour at dusk", Description: "Boats", GeoData: GeoData{Latitude: -33.8688, Longitude: 151.2093}}
+			meta.SetPhotoTime(photoTime)
+
+			result, err := applyNativeMP4(path, meta, ApplyOptions{}, &ApplyResult{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Modified || result.BytesChanged <= 0 {
+				t.Fatalf("Modified = %v, BytesChanged = %d, want the moov box to grow", result.Modified, result.BytesChanged)
+			}
+
+			// Every chunk offset must still point at its chunk
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			moov := readTestMoov(t, path)
+			stco := trakPayloads(t, moov, "mdia", "minf", "stbl", "stco")
+			co64 := trakPayloads(t, moov, "mdia", "minf", "stbl", "co64")
+			if len(stco) != 1 || len(co64) != 1 {
+				t.Fatalf("found %d stco and %d co64 tables, want 1 each", len(stco), len(co64))
+			}
+			for _, chunk := range []struct {
+				offset int64
+				want   string
+			}{
+				{int64(binary.BigEndian.Uint32(stco[0][8:])), "CHUNK-A"},
+				{int64(binary.BigEndian.Uint64(co64[0][8:])), "CHUNK-B"},
+			} {
+				if chunk.offset+7 > int64(len(data)) || string(data[chunk.offset:chunk.offset+7]) != chunk.want {
+					t.Errorf("chunk offset %d does not point at %s", chunk.offset, chunk.want)
+				}
+			}
+
+			// Times count seconds from 1904, in 32 bits for version 0 boxes and 64 for version 1
+			mvhdBox, ok := childBox(bytes.NewReader(moov), mp4Box{size: int64(len(moov)), header: 8}, "mvhd")
+			if !ok {
+				t.Fatal("no mvhd box")
+			}
+			mvhd := moov[mvhdBox.start+mvhdBox.header : mvhdBox.start+mvhdBox.size]
+			tkhd := trakPayloads(t, moov, "tkhd")
+			mdhd := trakPayloads(t, moov, "mdia", "mdhd")
+			for name, got := range map[string][2]uint64{
+				"mvhd": {uint64(binary.BigEndian.Uint32(mvhd[4:])), uint64(binary.BigEndian.Uint32(mvhd[8:]))},
+				"tkhd": {uint64(binary.BigEndian.Uint32(tkhd[0][4:])), uint64(binary.BigEndian.Uint32(tkhd[0][8:]))},
+				"mdhd": {binary.BigEndian.Uint64(mdhd[0][4:]), binary.BigEndian.Uint64(mdhd[0][12:])},
+			} {
+				if got[0] != seconds || got[1] != seconds {
+					t.Errorf("%s times = %d, %d, want %d", name, got[0], got[1], seconds)
+				}
+			}
+
+			created, texts := readMoovValues(moov)
+			if created != "2019-07-14T16:20:00" {
+				t.Errorf("creation time = %q, want 2019-07-14T16:20:00", created)
+			}
+			if texts[mp4Title] != meta.Title || texts[mp4Comment] != meta.Description || texts[mp4Location] != "-33.8688+151.2093/" {
+				t.Errorf("texts = %q", texts)
+			}
+
+			// A second run finds nothing to change
+			again, err := applyNativeMP4(path, meta, ApplyOptions{}, &ApplyResult{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Modified {
+				t.Error("the second run modified the video again")
+			}
+		})
+	}
+}
+
+func TestRewriteMoovTruncated(t *testing.T) {
+	moov := testMoov(100, 200)
+	// The first trak claims to run past the end of the moov box
+	truncated := append([]byte{}, moov...)
+	trakAt := 8 + 8 + 100
+	binary.BigEndian.PutUint32(truncated[trakAt:], uint32(len(moov)))
+	// The stco table claims more entries than it holds
+	overcounted := append([]byte{}, moov...)
+	stcoAt := bytes.Index(overcounted, []byte("stco"))
+	binary.BigEndian.PutUint32(overcounted[stcoAt+8:], 1000)
+
+	for _, tc := range []struct {
+		name string
+		moov []byte
+	}{
+		{"box past its parent", truncated},
+		{"cut off", moov[:len(moov)-10]},
+		{"stco count too large", overcounted},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			texts := map[string]string{mp4Title: "Harbour at dusk"}
+			if _, err := rewriteMoov(tc.moov, time.Now(), texts, 0); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestApplyNativeMP4TruncatedFile(t *testing.T) {
+	data := testMP4(true)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, data[:len(data)-20], 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta := &Metadata{Title: "Harbour at dusk"}
+	meta.SetPhotoTime(time.Date(2019, 7, 14, 16, 20, 0, 0, time.UTC))
+	if _, err := applyNativeMP4(path, meta, ApplyOptions{}, &ApplyResult{}); err == nil {
+		t.Error("expected an error for a truncated video")
+	}
+}
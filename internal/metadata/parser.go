@@ -19,12 +19,101 @@ type Metadata struct {
 	GeoData          GeoData          `json:"geoData"`
 	GeoDataAlt       GeoDataAlt       `json:"geoDataAlt"`
 	PhotoTakenTime   PhotoTakenTime   `json:"photoTakenTime"`
+	Origin           Origin           `json:"googlePhotosOrigin"`
+	AppSource        AppSource        `json:"appSource"`
+	People           LabelList        `json:"people"`
+	Tags             LabelList        `json:"tags"`
+	Labels           LabelList        `json:"labels"`
+	Trashed          bool             `json:"trashed"` // In the Google Photos trash when exported
+	SharedComments   []SharedComment  `json:"sharedAlbumComments"`
 	Supplemental     *Metadata        `json:"supplemental,omitempty"`
+
+	photoTime time.Time     // Overrides the JSON timestamps when set
+	utcOffset time.Duration // Offset of photoTime from UTC when it holds local time
+	format    string        // Sidecar format the metadata was read from, empty for Takeout
+	rating    int           // XMP rating, from a Picasa star
+	picasa    bool          // A .picasa.ini entry was merged in
+	faces     []FaceRegion  // Face rectangles, see GetFaces
+}
+
+// Origin describes how the item reached Google Photos
+type Origin struct {
+	MobileUpload       *MobileUpload `json:"mobileUpload,omitempty"`
+	WebUpload          *struct{}     `json:"webUpload,omitempty"`
+	DriveDesktop       *struct{}     `json:"driveDesktopUploader,omitempty"`
+	FromSharedAlbum    *struct{}     `json:"fromSharedAlbum,omitempty"`
+	FromPartnerSharing *struct{}     `json:"fromPartnerSharing,omitempty"`
+	Composition        *Composition  `json:"composition,omitempty"`
+}
+
+// MobileUpload describes the device an item was uploaded from
+type MobileUpload struct {
+	DeviceType   string `json:"deviceType"`
+	DeviceFolder struct {
+		LocalFolderName string `json:"localFolderName"`
+	} `json:"deviceFolder"`
+}
+
+// Composition describes a Google-generated item (collage, animation, ...)
+type Composition struct {
+	Type string `json:"type"`
+}
+
+// AppSource identifies the app that created the item
+type AppSource struct {
+	AndroidPackageName string `json:"androidPackageName"`
+}
+
+// LabelList is a list of names from label-like JSON fields. It accepts plain string
+// arrays, arrays of objects with a "name" or "title", and comma-separated strings.
+type LabelList []string
+
+// UnmarshalJSON decodes any of the label shapes seen in exports, ignoring unknown ones
+func (l *LabelList) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		for _, part := range strings.Split(text, ",") {
+			l.add(part)
+		}
+		return nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil
+	}
+	for _, item := range items {
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			l.add(name)
+			continue
+		}
+		var named struct {
+			Name  string `json:"name"`
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(item, &named); err == nil {
+			if named.Name != "" {
+				l.add(named.Name)
+			} else {
+				l.add(named.Title)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *LabelList) add(name string) {
+	name = strings.TrimSpace(name)
+	if name != "" && !containsString(*l, name) {
+		*l = append(*l, name)
+	}
 }
 
 // CreationTime represents the creation timestamp
 type CreationTime struct {
 	Timestamp string `json:"timestamp"`
+	Formatted string `json:"formatted,omitempty"`
 }
 
 // ModificationTime represents the modification timestamp
@@ -35,6 +124,7 @@ type ModificationTime struct {
 // PhotoTakenTime represents when the photo was taken
 type PhotoTakenTime struct {
 	Timestamp string `json:"timestamp"`
+	Formatted string `json:"formatted,omitempty"`
 }
 
 // GeoData represents GPS coordinates
@@ -57,21 +147,19 @@ type GeoDataAlt struct {
 
 // ParseJSON parses the metadata from a Google Takeout JSON file
 func ParseJSON(jsonPath string) (*Metadata, error) {
-	data, err := os.ReadFile(jsonPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read JSON file: %w", err)
-	}
-
-	// Remove UTF-8 BOM if present
-	if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
-		data = data[3:]
-	}
+	return parseJSONWith(jsonPath, parseSupplementalJSON, false)
+}
 
-	var meta Metadata
-	err = json.Unmarshal(data, &meta)
+// parseJSONWith parses the primary JSON and merges its supplementals, reading every
+// document through parse. A folder-wide supplemental-metadata.json only contributes
+// the fields that describe the whole folder, unless legacyGlobal restores the old
+// behavior of merging every field from it.
+func parseJSONWith(jsonPath string, parse func(string) (*Metadata, error), legacyGlobal bool) (*Metadata, error) {
+	primary, err := parse(jsonPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+		return nil, err
 	}
+	meta := *primary
 
 	// Check for supplemental metadata in the same directory
 	baseDir := filepath.Dir(jsonPath)
@@ -86,19 +174,24 @@ func ParseJSON(jsonPath string) (*Metadata, error) {
 	// 2. Per-file supplemental: photo.jpg.supplemental-metadata.json
 	// 3. Global supplemental: supplemental-metadata.json
 
-	// First try exact supplemental-metadata.json in same directory (global)
+	// First try exact supplemental-metadata.json in same directory (global). It is not
+	// tied to any one photo, so per-photo fields (times, GPS, title, ...) are not taken from it.
 	supplementalPath := filepath.Join(baseDir, "supplemental-metadata.json")
-	if _, err := os.Stat(supplementalPath); err == nil {
-		supplemental, err := parseSupplementalJSON(supplementalPath)
+	if _, err := os.Stat(supplementalPath); err == nil && supplementalPath != jsonPath {
+		supplemental, err := parse(supplementalPath)
 		if err == nil {
-			meta = mergeMetadata(meta, *supplemental)
+			if legacyGlobal {
+				meta = mergeMetadata(meta, *supplemental)
+			} else {
+				meta = mergeFolderMetadata(meta, *supplemental)
+			}
 		}
 	}
 
 	// Then try per-file supplemental metadata: [mediafile].supplemental-metadata.json
 	perFileSupplementalPath := filepath.Join(baseDir, mediaFileName+".supplemental-metadata.json")
 	if _, err := os.Stat(perFileSupplementalPath); err == nil {
-		supplemental, err := parseSupplementalJSON(perFileSupplementalPath)
+		supplemental, err := parse(perFileSupplementalPath)
 		if err == nil {
 			meta = mergeMetadata(meta, *supplemental)
 		}
@@ -109,27 +202,53 @@ func ParseJSON(jsonPath string) (*Metadata, error) {
 
 // parseSupplementalJSON parses supplemental metadata, avoiding infinite recursion
 func parseSupplementalJSON(jsonPath string) (*Metadata, error) {
-	data, err := os.ReadFile(jsonPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read JSON file: %w", err)
-	}
+	var meta *Metadata
+	err := readJSONFile(jsonPath, func(data []byte, _ os.FileInfo) error {
+		var err error
+		meta, err = decodeJSON(data)
+		return err
+	})
+	return meta, err
+}
 
+// decodeJSON unmarshals a single JSON document, a Takeout sidecar or one of the older
+// formats detectFormat recognizes
+func decodeJSON(data []byte) (*Metadata, error) {
 	// Remove UTF-8 BOM if present
 	if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
 		data = data[3:]
 	}
 
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) == nil {
+		inner, raw := unwrapLegacy(fields)
+		if format := detectFormat(inner); format != FormatTakeout {
+			if raw != nil {
+				data = raw
+			}
+			return decodeLegacy(data, format)
+		}
+	}
+
 	var meta Metadata
-	err = json.Unmarshal(data, &meta)
+	err := json.Unmarshal(data, &meta)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
 	}
 
+	fillFormattedTimes(&meta)
+	meta.faces = takeoutFaces(data)
+
 	return &meta, nil
 }
 
-// GetPhotoTime returns the photo taken time, or creation time as fallback
+// GetPhotoTime returns the photo taken time, or creation time as fallback.
+// A time set with SetPhotoTime takes precedence over both.
 func (m *Metadata) GetPhotoTime() (time.Time, error) {
+	if !m.photoTime.IsZero() {
+		return m.photoTime, nil
+	}
+
 	if m.PhotoTakenTime.Timestamp != "" {
 		return parseTimestamp(m.PhotoTakenTime.Timestamp)
 	}
@@ -138,7 +257,56 @@ func (m *Metadata) GetPhotoTime() (time.Time, error) {
 		return parseTimestamp(m.CreationTime.Timestamp)
 	}
 
-	return time.Time{}, fmt.Errorf("no valid timestamp found in metadata")
+	return time.Time{}, fmt.Errorf("%w found in metadata", ErrBadTimestamp)
+}
+
+// SetPhotoTime overrides the time returned by GetPhotoTime
+func (m *Metadata) SetPhotoTime(t time.Time) {
+	m.photoTime = t.UTC()
+}
+
+// SetUTCOffset records that the photo time is local time at the given offset from UTC
+func (m *Metadata) SetUTCOffset(offset time.Duration) {
+	m.utcOffset = offset
+}
+
+// GetUTCOffset returns the offset set with SetUTCOffset, 0 when the photo time is UTC
+func (m *Metadata) GetUTCOffset() time.Duration {
+	return m.utcOffset
+}
+
+// GetUTCTime returns the photo time as UTC, undoing a local time offset
+func (m *Metadata) GetUTCTime() (time.Time, error) {
+	t, err := m.GetPhotoTime()
+	if err != nil {
+		return t, err
+	}
+	return t.Add(-m.utcOffset), nil
+}
+
+// GetModificationTime returns when the item's metadata was last changed in Google Photos
+func (m *Metadata) GetModificationTime() (time.Time, bool) {
+	if m.ModificationTime.Timestamp == "" {
+		return time.Time{}, false
+	}
+	t, err := parseTimestamp(m.ModificationTime.Timestamp)
+	return t, err == nil
+}
+
+// GetTakenAndCreationTimes returns both JSON timestamps; ok is false unless both parse
+func (m *Metadata) GetTakenAndCreationTimes() (taken, created time.Time, ok bool) {
+	if m.PhotoTakenTime.Timestamp == "" || m.CreationTime.Timestamp == "" {
+		return time.Time{}, time.Time{}, false
+	}
+	taken, err := parseTimestamp(m.PhotoTakenTime.Timestamp)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	created, err = parseTimestamp(m.CreationTime.Timestamp)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return taken, created, true
 }
 
 // GetLatitude returns the latitude, preferring geoData over geoDataAlt
@@ -174,6 +342,57 @@ func (m *Metadata) GetAltitude() (float64, bool) {
 	return 0, false
 }
 
+// GetProvenance returns a human-readable description of the item's device/app origin,
+// or an empty string if the JSON does not record one
+func (m *Metadata) GetProvenance() string {
+	var parts []string
+	switch {
+	case m.Origin.MobileUpload != nil:
+		origin := "mobile upload"
+		upload := m.Origin.MobileUpload
+		var details []string
+		if upload.DeviceType != "" {
+			details = append(details, upload.DeviceType)
+		}
+		if upload.DeviceFolder.LocalFolderName != "" {
+			details = append(details, "folder "+upload.DeviceFolder.LocalFolderName)
+		}
+		if len(details) > 0 {
+			origin = fmt.Sprintf("%s (%s)", origin, strings.Join(details, ", "))
+		}
+		parts = append(parts, origin)
+	case m.Origin.WebUpload != nil:
+		parts = append(parts, "web upload")
+	case m.Origin.DriveDesktop != nil:
+		parts = append(parts, "desktop uploader")
+	case m.Origin.FromSharedAlbum != nil:
+		parts = append(parts, "shared album")
+	case m.Origin.FromPartnerSharing != nil:
+		parts = append(parts, "partner sharing")
+	case m.Origin.Composition != nil:
+		parts = append(parts, "composition "+m.Origin.Composition.Type)
+	}
+	if m.AppSource.AndroidPackageName != "" {
+		parts = append(parts, "app "+m.AppSource.AndroidPackageName)
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return "Google Photos origin: " + strings.Join(parts, ", ")
+}
+
+// GetLabels returns the names from the people, tags and labels fields, without duplicates
+func (m *Metadata) GetLabels() []string {
+	var labels LabelList
+	for _, list := range []LabelList{m.People, m.Tags, m.Labels} {
+		for _, name := range list {
+			labels.add(name)
+		}
+	}
+	return labels
+}
+
 // mergeMetadata merges supplemental metadata into primary metadata
 func mergeMetadata(primary, supplemental Metadata) Metadata {
 	// Prefer primary over supplemental for most fields, but use supplemental if primary is empty
@@ -203,16 +422,55 @@ func mergeMetadata(primary, supplemental Metadata) Metadata {
 		(supplemental.GeoDataAlt.Latitude != 0 || supplemental.GeoDataAlt.Longitude != 0) {
 		primary.GeoDataAlt = supplemental.GeoDataAlt
 	}
+	if isEmptyOrigin(primary.Origin) {
+		primary.Origin = supplemental.Origin
+	}
+	if primary.AppSource.AndroidPackageName == "" {
+		primary.AppSource = supplemental.AppSource
+	}
+	if len(primary.SharedComments) == 0 {
+		primary.SharedComments = supplemental.SharedComments
+	}
+	if len(primary.faces) == 0 {
+		primary.faces = supplemental.faces
+	}
+	if len(primary.People) == 0 {
+		primary.People = supplemental.People
+	}
+	if len(primary.Tags) == 0 {
+		primary.Tags = supplemental.Tags
+	}
+	if len(primary.Labels) == 0 {
+		primary.Labels = supplemental.Labels
+	}
+	primary.Trashed = primary.Trashed || supplemental.Trashed
 	return primary
 }
 
+// mergeFolderMetadata merges the fields of a folder-wide supplemental that can
+// safely apply to every file in the folder: the upload origin and source app
+func mergeFolderMetadata(primary, supplemental Metadata) Metadata {
+	if isEmptyOrigin(primary.Origin) {
+		primary.Origin = supplemental.Origin
+	}
+	if primary.AppSource.AndroidPackageName == "" {
+		primary.AppSource = supplemental.AppSource
+	}
+	return primary
+}
+
+func isEmptyOrigin(o Origin) bool {
+	return o.MobileUpload == nil && o.WebUpload == nil && o.DriveDesktop == nil &&
+		o.FromSharedAlbum == nil && o.FromPartnerSharing == nil && o.Composition == nil
+}
+
 // parseTimestamp converts a timestamp string to time.Time
 func parseTimestamp(ts string) (time.Time, error) {
 	// Google Takeout uses Unix timestamp as string
 	var unixTime int64
 	_, err := fmt.Sscanf(ts, "%d", &unixTime)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("invalid timestamp format: %s", ts)
+		return time.Time{}, fmt.Errorf("%w: invalid format %q", ErrBadTimestamp, ts)
 	}
 
 	return time.Unix(unixTime, 0).UTC(), nil
@@ -0,0 +1,227 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PicasaIniNames are the names Picasa gave its per-folder database, newest first
+var PicasaIniNames = []string{".picasa.ini", "Picasa.ini", "picasa.ini"}
+
+// PicasaStarRating is the XMP rating a starred Picasa photo gets
+const PicasaStarRating = 5
+
+// picasaUnknownFace is the contact ID of a face Picasa found but nobody named
+const picasaUnknownFace = "ffffffffffffffff"
+
+// FaceRegion is a face on a photo, in MWG region terms: the center and size of the
+// rectangle as fractions of the image width and height
+type FaceRegion struct {
+	Name string // Empty for a face nobody named
+	X, Y float64
+	W, H float64
+}
+
+// PicasaEntry is what a .picasa.ini records about one file
+type PicasaEntry struct {
+	Caption  string
+	Keywords []string
+	Starred  bool
+	Faces    []FaceRegion
+}
+
+// PicasaIni is a parsed .picasa.ini file
+type PicasaIni struct {
+	files map[string]PicasaEntry // By lower-case file name, as Picasa ran on case-insensitive systems
+}
+
+// FindPicasaIni returns the Picasa database of a folder, "" when it has none
+func FindPicasaIni(dir string) string {
+	for _, name := range PicasaIniNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// ParsePicasaIni reads the captions, keywords, stars and faces of a .picasa.ini file.
+// Face names come from its [Contacts2] (or older [Contacts]) section.
+func ParsePicasaIni(path string) (*PicasaIni, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Picasa file: %w", err)
+	}
+	defer f.Close()
+
+	sections := make(map[string]map[string]string)
+	var order []string
+	var current map[string]string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		switch {
+		case line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := line[1 : len(line)-1]
+			if sections[name] == nil {
+				sections[name] = make(map[string]string)
+				order = append(order, name)
+			}
+			current = sections[name]
+		case current != nil:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				current[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Picasa file: %w", err)
+	}
+
+	contacts := make(map[string]string)
+	for _, name := range []string{"Contacts", "Contacts2"} {
+		for id, value := range sections[name] {
+			if contact, _, _ := strings.Cut(value, ";"); contact != "" {
+				contacts[id] = contact
+			}
+		}
+	}
+
+	ini := &PicasaIni{files: make(map[string]PicasaEntry)}
+	for _, name := range order {
+		if name == "Picasa" || name == "Contacts" || name == "Contacts2" || strings.HasPrefix(name, ".") {
+			continue // Folder settings, contacts and albums, not files
+		}
+		fields := sections[name]
+		entry := PicasaEntry{
+			Caption: fields["caption"],
+			Starred: fields["star"] == "yes",
+			Faces:   parsePicasaFaces(fields["faces"], contacts),
+		}
+		for _, keyword := range strings.Split(fields["keywords"], ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" && !containsString(entry.Keywords, keyword) {
+				entry.Keywords = append(entry.Keywords, keyword)
+			}
+		}
+		ini.files[strings.ToLower(name)] = entry
+	}
+	return ini, nil
+}
+
+// parsePicasaFaces reads a faces value, "rect64(3f845bcb59418507),8e62398ebda8c1a5;..."
+// where the rectangle packs left, top, right and bottom as 16-bit fractions of the
+// image size
+func parsePicasaFaces(value string, contacts map[string]string) []FaceRegion {
+	var faces []FaceRegion
+	for _, face := range strings.Split(value, ";") {
+		rect, id, _ := strings.Cut(strings.TrimSpace(face), ",")
+		hex, ok := strings.CutPrefix(rect, "rect64(")
+		if !ok || !strings.HasSuffix(hex, ")") {
+			continue
+		}
+		packed, err := strconv.ParseUint(strings.TrimSuffix(hex, ")"), 16, 64)
+		if err != nil {
+			continue
+		}
+		edge := func(shift uint) float64 { return float64(packed>>shift&0xFFFF) / 0xFFFF }
+		left, top, right, bottom := edge(48), edge(32), edge(16), edge(0)
+		if right <= left || bottom <= top {
+			continue
+		}
+		region := FaceRegion{X: (left + right) / 2, Y: (top + bottom) / 2, W: right - left, H: bottom - top}
+		if id != picasaUnknownFace {
+			region.Name = contacts[id]
+		}
+		faces = append(faces, region)
+	}
+	return faces
+}
+
+// Entry returns what the file records about a file in its folder
+func (ini *PicasaIni) Entry(name string) (PicasaEntry, bool) {
+	entry, ok := ini.files[strings.ToLower(name)]
+	return entry, ok
+}
+
+// MergePicasa merges what a .picasa.ini records about the file into the metadata.
+// With prefer the Picasa caption replaces the JSON description, otherwise it only
+// fills an empty one. Face names join the people and keywords the tags, either way;
+// a star gives the PicasaStarRating and the face rectangles are added to GetFaces.
+func (m *Metadata) MergePicasa(entry PicasaEntry, prefer bool) {
+	if entry.Caption != "" && (prefer || m.Description == "") {
+		m.Description = entry.Caption
+	}
+	var people, tags LabelList
+	for _, face := range entry.Faces {
+		people.add(face.Name)
+	}
+	for _, keyword := range entry.Keywords {
+		tags.add(keyword)
+	}
+	m.People, m.Tags = mergeLabels(m.People, people, prefer), mergeLabels(m.Tags, tags, prefer)
+	if entry.Starred {
+		m.rating = PicasaStarRating
+	}
+	m.faces = append(append([]FaceRegion{}, m.faces...), entry.Faces...)
+	m.picasa = true
+}
+
+// mergeLabels joins two name lists without duplicates, the Picasa names first with prefer
+func mergeLabels(takeout, picasa LabelList, prefer bool) LabelList {
+	first, second := takeout, picasa
+	if prefer {
+		first, second = picasa, takeout
+	}
+	var merged LabelList
+	for _, list := range []LabelList{first, second} {
+		for _, name := range list {
+			merged.add(name)
+		}
+	}
+	return merged
+}
+
+// setRating adds the rating to a packet
+func (x *xmpPacket) setRating(fields exifFields) {
+	if fields.Rating > 0 {
+		x.Set("xmp:Rating", strconv.Itoa(fields.Rating))
+	}
+}
+
+// ratingPresent reports whether the file already has the rating
+func ratingPresent(values map[string]string, imagePath string, meta *Metadata, opts ApplyOptions) bool {
+	rating := meta.GetRating()
+	if rating == 0 {
+		return true
+	}
+	if useExiftool(opts) {
+		return values["Rating"] == strconv.Itoa(rating)
+	}
+	if !isJPEGFile(imagePath) {
+		return true
+	}
+	xmp := readJPEGXMP(imagePath)
+	return bytes.Contains(xmp, []byte(">"+strconv.Itoa(rating)+"</xmp:Rating>")) ||
+		bytes.Contains(xmp, []byte(`xmp:Rating="`+strconv.Itoa(rating)+`"`))
+}
+
+// GetRating returns the XMP rating of the photo, 0 when it has none
+func (m *Metadata) GetRating() int {
+	return m.rating
+}
+
+// FromPicasa reports whether a .picasa.ini entry was merged into the metadata
+func (m *Metadata) FromPicasa() bool {
+	return m.picasa
+}
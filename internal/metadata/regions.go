@@ -0,0 +1,170 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MWG region XMP namespaces, written with ApplyOptions.FaceRegions
+const (
+	RegionsPrefix    = "mwg-rs"
+	RegionsNamespace = "http://www.metadataworkinggroup.com/schemas/regions/"
+	areaNamespace    = "http://ns.adobe.com/xmp/sType/Area#"
+	dimNamespace     = "http://ns.adobe.com/xap/1.0/sType/Dimensions#"
+)
+
+// takeoutFaces reads the face rectangles some Takeout exports give with the people
+// on a photo, {"name": ..., "boundingBox": {"left", "top", "width", "height"}} as
+// fractions of the image size
+func takeoutFaces(data []byte) []FaceRegion {
+	var doc struct {
+		People []struct {
+			Name        string `json:"name"`
+			BoundingBox *struct {
+				Left   float64 `json:"left"`
+				Top    float64 `json:"top"`
+				Width  float64 `json:"width"`
+				Height float64 `json:"height"`
+			} `json:"boundingBox"`
+		} `json:"people"`
+	}
+	if json.Unmarshal(data, &doc) != nil {
+		return nil
+	}
+	var faces []FaceRegion
+	for _, person := range doc.People {
+		box := person.BoundingBox
+		if box == nil || box.Width <= 0 || box.Height <= 0 || box.Left < 0 || box.Top < 0 ||
+			box.Left+box.Width > 1 || box.Top+box.Height > 1 {
+			continue
+		}
+		faces = append(faces, FaceRegion{Name: strings.TrimSpace(person.Name),
+			X: box.Left + box.Width/2, Y: box.Top + box.Height/2, W: box.Width, H: box.Height})
+	}
+	return faces
+}
+
+// GetFaces returns the face rectangles known for the photo, from its .picasa.ini
+// entry or its sidecar
+func (m *Metadata) GetFaces() []FaceRegion {
+	return m.faces
+}
+
+// regionNumber formats a normalized region coordinate
+func regionNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+// setRegions adds the faces to a packet as an MWG region list, which digiKam,
+// Lightroom and most photo managers show as face frames
+func (x *xmpPacket) setRegions(fields exifFields) {
+	if len(fields.Faces) == 0 {
+		return
+	}
+	var b strings.Builder
+	if fields.Width > 0 && fields.Height > 0 {
+		fmt.Fprintf(&b, "    <%s:AppliedToDimensions stDim:w=\"%d\" stDim:h=\"%d\" stDim:unit=\"pixel\"/>\n", RegionsPrefix, fields.Width, fields.Height)
+	}
+	fmt.Fprintf(&b, "    <%s:RegionList>\n     <rdf:Bag>\n", RegionsPrefix)
+	for _, face := range fields.Faces {
+		b.WriteString("      <rdf:li rdf:parseType=\"Resource\">\n")
+		fmt.Fprintf(&b, "       <%s:Area stArea:x=\"%s\" stArea:y=\"%s\" stArea:w=\"%s\" stArea:h=\"%s\" stArea:unit=\"normalized\"/>\n",
+			RegionsPrefix, regionNumber(face.X), regionNumber(face.Y), regionNumber(face.W), regionNumber(face.H))
+		if face.Name != "" {
+			fmt.Fprintf(&b, "       <%s:Name>%s</%s:Name>\n", RegionsPrefix, xmlEscape(face.Name), RegionsPrefix)
+		}
+		fmt.Fprintf(&b, "       <%s:Type>Face</%s:Type>\n      </rdf:li>\n", RegionsPrefix, RegionsPrefix)
+	}
+	fmt.Fprintf(&b, "     </rdf:Bag>\n    </%s:RegionList>\n", RegionsPrefix)
+	x.structs[RegionsPrefix+":Regions"] = b.String()
+}
+
+// regionArgs returns the exiftool argument writing the faces as an MWG region list
+func regionArgs(fields exifFields) []string {
+	if len(fields.Faces) == 0 {
+		return nil
+	}
+	var regions []string
+	for _, face := range fields.Faces {
+		region := fmt.Sprintf("Area={X=%s,Y=%s,W=%s,H=%s,Unit=normalized},Type=Face",
+			regionNumber(face.X), regionNumber(face.Y), regionNumber(face.W), regionNumber(face.H))
+		if face.Name != "" {
+			region += ",Name=" + exiftoolStructValue(face.Name)
+		}
+		regions = append(regions, "{"+region+"}")
+	}
+	info := "RegionList=[" + strings.Join(regions, ",") + "]"
+	if fields.Width > 0 && fields.Height > 0 {
+		info = fmt.Sprintf("AppliedToDimensions={W=%d,H=%d,Unit=pixel},", fields.Width, fields.Height) + info
+	}
+	return []string{"-XMP-mwg-rs:RegionInfo={" + info + "}"}
+}
+
+// exiftoolStructValue escapes the characters that delimit exiftool structure values
+func exiftoolStructValue(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(",={}[]|", r) {
+			b.WriteByte('|')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// regionsPresent reports whether the file already has the face regions
+func regionsPresent(values map[string]string, imagePath string, meta *Metadata, opts ApplyOptions) bool {
+	faces := meta.GetFaces()
+	if !opts.FaceRegions || len(faces) == 0 {
+		return true
+	}
+	if useExiftool(opts) {
+		xs := make([]string, len(faces))
+		for i, face := range faces {
+			xs[i] = regionNumber(face.X)
+		}
+		return values["RegionAreaX"] == strings.Join(xs, listSeparator)
+	}
+	if !isJPEGFile(imagePath) {
+		return true
+	}
+	xmp := readJPEGXMP(imagePath)
+	for _, face := range faces {
+		if !bytes.Contains(xmp, []byte(`stArea:x="`+regionNumber(face.X)+`" stArea:y="`+regionNumber(face.Y)+`"`)) {
+			return false
+		}
+	}
+	return true
+}
+
+// jpegDimensions returns the image size from a JPEG's frame header, 0 when it has none
+func jpegDimensions(segments []jpegSegment) (int, int) {
+	for _, segment := range segments {
+		switch segment.marker {
+		case 0xC4, 0xC8, 0xCC: // Huffman and arithmetic coding tables, not frames
+			continue
+		}
+		if segment.marker >= 0xC0 && segment.marker <= 0xCF && len(segment.payload) >= 5 {
+			p := segment.payload
+			return int(binary.BigEndian.Uint16(p[3:5])), int(binary.BigEndian.Uint16(p[1:3]))
+		}
+	}
+	return 0, 0
+}
+
+// imageDimensions returns the image size exiftool reports, 0 when unknown
+func imageDimensions(ctx context.Context, imagePath string) (int, int) {
+	output, err := exiftoolCommand(ctx, "-s", "-n", "-ImageWidth", "-ImageHeight", imagePath).Output()
+	if err != nil {
+		return 0, 0
+	}
+	values := parseExiftoolValues(string(output))
+	w, _ := strconv.Atoi(values["ImageWidth"])
+	h, _ := strconv.Atoi(values["ImageHeight"])
+	return w, h
+}
@@ -0,0 +1,143 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Shared album XMP namespace, written with ApplyOptions.SharedComments
+const (
+	SocialPrefix    = "gtsa"
+	SocialNamespace = "https://github.com/lvmj06/google-takeout-exif-applier/ns/social/1.0/"
+)
+
+// SharedComment is a comment or like left on a photo in a shared album
+type SharedComment struct {
+	Text             string       `json:"text"`
+	Liked            bool         `json:"liked"`
+	CreationTime     CreationTime `json:"creationTime"`
+	ContentOwnerName string       `json:"contentOwnerName"`
+}
+
+// GetLikes returns the names of the people who liked the photo in a shared album,
+// "unknown" for likes without a name
+func (m *Metadata) GetLikes() []string {
+	var names []string
+	for _, c := range m.SharedComments {
+		if !c.Liked {
+			continue
+		}
+		name := strings.TrimSpace(c.ContentOwnerName)
+		if name == "" {
+			name = "unknown"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// GetComments returns the shared album comments on the photo, oldest first as in the
+// JSON, as "Name (2006-01-02 15:04 UTC): text"
+func (m *Metadata) GetComments() []string {
+	var comments []string
+	for _, c := range m.SharedComments {
+		text := strings.TrimSpace(c.Text)
+		if text == "" {
+			continue
+		}
+		author := strings.TrimSpace(c.ContentOwnerName)
+		if author == "" {
+			author = "unknown"
+		}
+		if t, err := parseTimestamp(c.CreationTime.Timestamp); err == nil {
+			author += " (" + t.UTC().Format("2006-01-02 15:04") + " UTC)"
+		}
+		comments = append(comments, author+": "+text)
+	}
+	return comments
+}
+
+// SocialText renders the likes and comments as the text of a .comments.txt sidecar,
+// "" when there are none
+func (m *Metadata) SocialText() string {
+	likes, comments := m.GetLikes(), m.GetComments()
+	if len(likes) == 0 && len(comments) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	if m.Title != "" {
+		fmt.Fprintf(&b, "%s\n\n", m.Title)
+	}
+	if len(likes) > 0 {
+		fmt.Fprintf(&b, "Liked by (%d): %s\n", len(likes), strings.Join(likes, ", "))
+	}
+	if len(comments) > 0 {
+		if len(likes) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("Comments:\n")
+		for _, comment := range comments {
+			fmt.Fprintf(&b, "  %s\n", comment)
+		}
+	}
+	return b.String()
+}
+
+// setSocial adds the shared album likes and comments to a packet
+func (x *xmpPacket) setSocial(fields exifFields) {
+	if len(fields.Likes) > 0 {
+		x.Set(SocialPrefix+":Likes", strconv.Itoa(len(fields.Likes)))
+		x.SetBag(SocialPrefix+":LikedBy", fields.Likes...)
+	}
+	if len(fields.Comments) > 0 {
+		x.SetBag(SocialPrefix+":Comments", fields.Comments...)
+	}
+}
+
+// socialArgs returns the exiftool arguments writing the likes and comments, which
+// need the namespace definitions from exiftoolConfig
+func socialArgs(fields exifFields) []string {
+	group := "-XMP-" + SocialPrefix + ":"
+	var args []string
+	if len(fields.Likes) > 0 {
+		args = append(args, group+"Likes="+strconv.Itoa(len(fields.Likes)), group+"LikedBy=")
+		for _, name := range fields.Likes {
+			args = append(args, group+"LikedBy+="+name)
+		}
+	}
+	if len(fields.Comments) > 0 {
+		args = append(args, group+"Comments=")
+		for _, comment := range fields.Comments {
+			args = append(args, group+"Comments+="+comment)
+		}
+	}
+	return args
+}
+
+// socialPresent reports whether the file already has every comment and the likes
+func socialPresent(values map[string]string, imagePath string, meta *Metadata, opts ApplyOptions) bool {
+	if !opts.SharedComments {
+		return true
+	}
+	comments, likes := meta.GetComments(), meta.GetLikes()
+	if len(comments) == 0 && len(likes) == 0 {
+		return true
+	}
+	if useExiftool(opts) {
+		return slices.Equal(listItems(values["Comments"]), comments) &&
+			(len(likes) == 0 || values["Likes"] == strconv.Itoa(len(likes)))
+	}
+	if !isJPEGFile(imagePath) {
+		return true
+	}
+	xmp := readJPEGXMP(imagePath)
+	for _, comment := range comments {
+		if !bytes.Contains(xmp, []byte(">"+xmlEscape(comment)+"<")) {
+			return false
+		}
+	}
+	return len(likes) == 0 || bytes.Contains(xmp, []byte(">"+strconv.Itoa(len(likes))+"</"+SocialPrefix+":Likes>"))
+}
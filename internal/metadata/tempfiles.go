@@ -0,0 +1,62 @@
+package metadata
+
+import (
+	"os"
+	"sync"
+)
+
+// tempFiles are the temporary files and directories being written, next to the media
+// files or in the output directory, that an aborted run must not leave behind
+var tempFiles = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// TrackTempFile registers a temporary file or directory about to be written and
+// returns its path. RemoveTempFile removes it once it is no longer needed, and
+// UntrackTempFile keeps it when it became a result of the run.
+func TrackTempFile(path string) string {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	tempFiles.paths[path] = true
+	return path
+}
+
+// UntrackTempFile forgets a file registered with TrackTempFile, leaving it in place
+func UntrackTempFile(path string) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	delete(tempFiles.paths, path)
+}
+
+// RemoveTempFile removes a file registered with TrackTempFile, if it is still there,
+// and forgets it
+func RemoveTempFile(path string) {
+	os.RemoveAll(path)
+	UntrackTempFile(path)
+}
+
+// RemoveTempFiles removes every registered temporary file still there, for a run
+// that is quit or panics before the writes in progress could clean up after
+// themselves. It returns how many were removed. The registry stays locked, so the
+// writes still running can't start another temporary file before the process exits.
+func RemoveTempFiles() int {
+	tempFiles.Lock()
+	removed := 0
+	for path := range tempFiles.paths {
+		if _, err := os.Lstat(path); err == nil && os.RemoveAll(path) == nil {
+			removed++
+		}
+		delete(tempFiles.paths, path)
+	}
+	return removed
+}
+
+// RemoveTempFilesOnPanic removes the registered temporary files when the goroutine
+// panics, then lets the panic go on. It must be deferred directly.
+func RemoveTempFilesOnPanic() {
+	if r := recover(); r != nil {
+		RemoveTempFiles()
+		panic(r)
+	}
+}
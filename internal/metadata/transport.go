@@ -0,0 +1,60 @@
+package metadata
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MPEG transport stream framing: 188-byte packets starting with a sync byte, or 192
+// bytes in BDAV (.m2ts, .mts) files, where a 4-byte timecode comes first
+const (
+	tsSyncByte       = 0x47
+	tsPacketSize     = 188
+	bdavPacketSize   = 192
+	tsPacketsChecked = 4
+)
+
+// TransportStreamExts are the extensions of MPEG transport streams from camcorders and
+// TV recordings. ".ts" is also TypeScript source code and Qt translation files.
+var TransportStreamExts = map[string]bool{
+	".ts":   true,
+	".mts":  true,
+	".m2ts": true,
+}
+
+// IsTransportStreamExt reports whether a file has a transport stream extension
+func IsTransportStreamExt(path string) bool {
+	return TransportStreamExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// IsTransportStream reports whether a file's content is an MPEG transport stream: the
+// sync byte at the start of each of the first packets, in either framing. Files
+// shorter than that are not.
+func IsTransportStream(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	buf := make([]byte, bdavPacketSize*tsPacketsChecked)
+	n, _ := io.ReadFull(f, buf)
+	buf = buf[:n]
+	return syncedPackets(buf, 0, tsPacketSize) || syncedPackets(buf, 4, bdavPacketSize)
+}
+
+// syncedPackets reports whether the first packets of buf, size bytes apart from
+// offset on, all start with the sync byte
+func syncedPackets(buf []byte, offset, size int) bool {
+	if len(buf) < offset+size*(tsPacketsChecked-1)+1 {
+		return false
+	}
+	for i := 0; i < tsPacketsChecked; i++ {
+		if buf[offset+i*size] != tsSyncByte {
+			return false
+		}
+	}
+	return true
+}
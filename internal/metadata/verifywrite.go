@@ -0,0 +1,196 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrWriteUnverified is returned by VerifyWrite when written tags don't read back
+var ErrWriteUnverified = errors.New("written tags did not read back")
+
+// verifiedTags are the tags VerifyWrite reads through exiftool, whose values exiftool
+// prints (with -n) the way they were written; others, such as GPSAltitudeRef, are
+// printed differently and would be reported as changed
+var verifiedTags = map[string]bool{
+	"DateTimeOriginal": true,
+	"CreateDate":       true,
+	"ModifyDate":       true,
+	"DateTime":         true,
+	"GPSLatitude":      true,
+	"GPSLongitude":     true,
+	"GPSAltitude":      true,
+	"ImageDescription": true,
+	"Description":      true,
+	"Title":            true,
+	"Subject":          true,
+}
+
+// gpsRefTags are the reference tags holding the sign of the GPS values, which
+// exiftool prints (with -n) without it
+var gpsRefTags = map[string]string{
+	"GPSLatitude":  "GPSLatitudeRef",
+	"GPSLongitude": "GPSLongitudeRef",
+	"GPSAltitude":  "GPSAltitudeRef",
+}
+
+// VerifyWrite reads back the tags a write reported in changes and checks that they hold
+// the new values, catching writes that failed without an error (exiftool warnings,
+// tags a format can't hold). Tags are read natively from the EXIF of JPEG, TIFF and
+// DNG files and from the moov box of MP4/MOV files, the others through exiftool when
+// it is installed. Tags that can't be read either way are not checked. Times may be
+// 2 seconds off, for file systems that round file times.
+func VerifyWrite(ctx context.Context, path string, changes []FieldChange) error {
+	current := readBackValues(path)
+	args := []string{"-s", "-n"}
+	var unread []string
+	for _, c := range changes {
+		if name := tagName(c.Tag); verifiedTags[name] {
+			if _, ok := current[name]; !ok {
+				args, unread = append(args, "-"+c.Tag), append(unread, name)
+				if ref, ok := gpsRefTags[name]; ok {
+					args = append(args, "-"+ref)
+				}
+			}
+		}
+	}
+	if len(unread) > 0 && exiftoolAvailable() {
+		output, err := exiftoolCommand(ctx, append(args, path)...).Output()
+		if err == nil {
+			read := parseExiftoolValues(string(output))
+			for name, ref := range gpsRefTags {
+				if value, ok := read[name]; ok {
+					read[name] = signedGPSValue(value, read[ref])
+				}
+			}
+			// Tags exiftool doesn't print are missing from the file
+			for _, name := range unread {
+				current[name] = read[name]
+			}
+		}
+	}
+
+	var mismatches []string
+	for _, c := range changes {
+		value, ok := current[tagName(c.Tag)]
+		if !ok || sameTagValue(value, c.New) {
+			continue
+		}
+		if value == "" {
+			mismatches = append(mismatches, fmt.Sprintf("%s is missing, expected %q", c.Tag, c.New))
+		} else {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q, expected %q", c.Tag, value, c.New))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%w: %s", ErrWriteUnverified, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// tagName returns a tag's name without its group, as exiftool's -s output names it
+func tagName(tag string) string {
+	return tag[strings.LastIndex(tag, ":")+1:]
+}
+
+// readBackValues returns the tags the native readers find in the file, named as the
+// writers' changes name them, and its modification time
+func readBackValues(path string) map[string]string {
+	values := make(map[string]string)
+	if info, err := os.Stat(path); err == nil {
+		values["FileModifyDate"] = info.ModTime().UTC().Format("2006:01:02 15:04:05")
+	}
+	if existing, err := readEXIF(path); err == nil {
+		for tag, value := range existing.values() {
+			values[tag] = value
+		}
+		return values
+	}
+	if !isoBMFFExts[strings.ToLower(filepath.Ext(path))] {
+		return values
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+	boxes, err := topLevelBoxes(f)
+	if err != nil {
+		return values
+	}
+	for _, box := range boxes {
+		if box.typ != "moov" {
+			continue
+		}
+		moov := make([]byte, box.size)
+		if _, err := f.ReadAt(moov, box.start); err != nil {
+			return values
+		}
+		created, texts := readMoovValues(moov)
+		values["creation_time"] = created
+		// ffmpeg keeps some texts elsewhere than the QuickTime atoms, so only the
+		// atoms found are checked
+		for name, atom := range map[string]string{"title": mp4Title, "comment": mp4Comment, "location": mp4Location} {
+			if text, ok := texts[atom]; ok {
+				values[name] = text
+			}
+		}
+	}
+	return values
+}
+
+// signedGPSValue applies the sign held by a GPS reference tag (S, W, or 1 for below
+// sea level) to a value exiftool printed without it
+func signedGPSValue(value, ref string) string {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return value
+	}
+	v = math.Abs(v)
+	switch strings.ToUpper(strings.TrimSpace(ref)) {
+	case "S", "W", "1":
+		v = -v
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// sameTagValue reports whether a value read back matches the one written: equal, or
+// the same number (signed GPS values, so a coordinate in the wrong hemisphere is a
+// mismatch) or time
+func sameTagValue(got, want string) bool {
+	got, want = strings.TrimSpace(got), strings.TrimSpace(want)
+	if got == want {
+		return true
+	}
+	if g, err := strconv.ParseFloat(got, 64); err == nil {
+		if w, err := strconv.ParseFloat(want, 64); err == nil {
+			return math.Abs(g-w) < 1e-5
+		}
+	}
+	if g, ok := parseTagTime(got); ok {
+		if w, ok := parseTagTime(want); ok {
+			return g.Sub(w).Abs() <= 2*time.Second
+		}
+	}
+	return false
+}
+
+// parseTagTime parses a time as EXIF, QuickTime or RFC 3339 writes it, ignoring the
+// zone: the writers and readers agree on the zone of each tag
+func parseTagTime(value string) (time.Time, bool) {
+	if len(value) < 19 {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{"2006:01:02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value[:19]); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
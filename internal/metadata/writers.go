@@ -0,0 +1,116 @@
+package metadata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Writer selections for ApplyOptions.Writer
+const (
+	WriterAuto   = "auto"   // exiftool, ffmpeg and mkvpropedit when installed, the built-in writers otherwise
+	WriterNative = "native" // Only the built-in writers, even when the external tools are installed
+)
+
+// ValidateWriter checks that writer is one of the writer selections
+func ValidateWriter(writer string) error {
+	switch writer {
+	case "", WriterAuto, WriterNative:
+		return nil
+	}
+	return fmt.Errorf("unknown writer %q (expected %s or %s)", writer, WriterAuto, WriterNative)
+}
+
+// useExiftool reports whether exiftool writes the images the built-in writer can't
+// handle and checks the tags the native reader doesn't see
+func useExiftool(opts ApplyOptions) bool {
+	return opts.Writer != WriterNative && exiftoolAvailable()
+}
+
+// useTool reports whether an external video tool is selected and installed
+func useTool(opts ApplyOptions, name string) bool {
+	if opts.Writer == WriterNative {
+		return false
+	}
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// overwriteArg returns the exiftool option that replaces the original file, or with
+// ApplyOptions.InPlace overwrites it in place
+func overwriteArg(opts ApplyOptions) string {
+	if opts.InPlace {
+		return "-overwrite_original_in_place"
+	}
+	return "-overwrite_original"
+}
+
+// replaceFile puts a rewritten copy in place of the original. By default the copy is
+// renamed over it, which gives the path a new inode; with inPlace its content is
+// written into the original file instead, so it keeps its inode and every hardlink
+// to it sees the update. That is slower and not atomic: an
+// interrupted copy leaves the original cut off. The copy is removed either way.
+func replaceFile(tmpPath, path string, inPlace bool) error {
+	if !inPlace {
+		return os.Rename(tmpPath, path)
+	}
+	defer os.Remove(tmpPath)
+	src, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// detach gives a file that is still a hardlink of opts.LinkedTo its own copy of the
+// data, so changing it in place leaves the linked file alone. Writers that replace the
+// file with a rewritten copy don't need it.
+func detach(path string, opts ApplyOptions) error {
+	if opts.LinkedTo == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat linked file: %w", err)
+	}
+	if linked, err := os.Stat(opts.LinkedTo); err != nil || !os.SameFile(info, linked) {
+		return nil
+	}
+
+	tmpPath := TrackTempFile(path + ".detach-tmp")
+	defer RemoveTempFile(tmpPath)
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open linked file: %w", err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy linked file: %w", err)
+	}
+	src.Close()
+	if err := os.Chtimes(tmpPath, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to copy linked file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace linked file: %w", err)
+	}
+	return nil
+}
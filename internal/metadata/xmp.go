@@ -0,0 +1,345 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// xmpNamespaces maps the prefixes we write to their namespace URIs
+var xmpNamespaces = map[string]string{
+	"dc":        "http://purl.org/dc/elements/1.1/",
+	"exif":      "http://ns.adobe.com/exif/1.0/",
+	"photoshop": "http://ns.adobe.com/photoshop/1.0/",
+	"xmp":       "http://ns.adobe.com/xap/1.0/",
+	"xmpMM":     "http://ns.adobe.com/xap/1.0/mm/",
+}
+
+// xmpPacket accumulates properties for a standalone XMP document
+type xmpPacket struct {
+	simple  map[string]string // e.g. "xmp:CreateDate" -> value
+	langAlt map[string]string // e.g. "dc:title" -> x-default value
+	bags    map[string][]string
+	structs map[string]string // e.g. "mwg-rs:Regions" -> the structure's fields as XML
+	owned   map[string]bool   // Bags set with SetBag, whose existing values are dropped
+}
+
+func newXMPPacket() *xmpPacket {
+	return &xmpPacket{
+		simple:  make(map[string]string),
+		langAlt: make(map[string]string),
+		bags:    make(map[string][]string),
+		structs: make(map[string]string),
+		owned:   make(map[string]bool),
+	}
+}
+
+// Set sets a simple property, ignoring empty values
+func (x *xmpPacket) Set(name, value string) {
+	if value != "" {
+		x.simple[name] = value
+	}
+}
+
+// SetLangAlt sets a language alternative property (x-default only), ignoring empty values
+func (x *xmpPacket) SetLangAlt(name, value string) {
+	if value != "" {
+		x.langAlt[name] = value
+	}
+}
+
+// AddToBag appends unique values to an unordered array property such as dc:subject
+func (x *xmpPacket) AddToBag(name string, values ...string) {
+	for _, value := range values {
+		if value == "" || containsString(x.bags[name], value) {
+			continue
+		}
+		x.bags[name] = append(x.bags[name], value)
+	}
+}
+
+// SetBag sets an unordered array property the tool owns, such as the audit trail's
+// applied fields: merged into an existing packet, it replaces the values there
+// instead of adding to them, as the exiftool writer does
+func (x *xmpPacket) SetBag(name string, values ...string) {
+	delete(x.bags, name)
+	x.AddToBag(name, values...)
+	x.owned[name] = true
+}
+
+// Bytes renders the packet as an XMP sidecar document
+func (x *xmpPacket) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	buf.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	buf.Write(x.description())
+	buf.WriteString(" </rdf:RDF>\n")
+	buf.WriteString("</x:xmpmeta>\n")
+	buf.WriteString("<?xpacket end=\"w\"?>\n")
+	return buf.Bytes()
+}
+
+// description renders the packet's properties as one rdf:Description element
+func (x *xmpPacket) description() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("  <rdf:Description rdf:about=\"\"")
+
+	prefixes := make([]string, 0, len(xmpNamespaces))
+	for prefix := range xmpNamespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		fmt.Fprintf(&buf, "\n    xmlns:%s=\"%s\"", prefix, xmpNamespaces[prefix])
+	}
+	extensions := make([]string, 0, len(xmpExtensionNamespaces))
+	for prefix := range xmpExtensionNamespaces {
+		if x.uses(prefix) {
+			extensions = append(extensions, prefix)
+		}
+	}
+	sort.Strings(extensions)
+	for _, prefix := range extensions {
+		fmt.Fprintf(&buf, "\n    xmlns:%s=\"%s\"", prefix, xmpExtensionNamespaces[prefix])
+	}
+	buf.WriteString(">\n")
+
+	for _, name := range sortedKeys(x.simple) {
+		fmt.Fprintf(&buf, "   <%s>%s</%s>\n", name, xmlEscape(x.simple[name]), name)
+	}
+	for _, name := range sortedKeys(x.langAlt) {
+		fmt.Fprintf(&buf, "   <%s>\n    <rdf:Alt>\n     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n    </rdf:Alt>\n   </%s>\n",
+			name, xmlEscape(x.langAlt[name]), name)
+	}
+	bagNames := make([]string, 0, len(x.bags))
+	for name := range x.bags {
+		bagNames = append(bagNames, name)
+	}
+	sort.Strings(bagNames)
+	for _, name := range bagNames {
+		fmt.Fprintf(&buf, "   <%s>\n    <rdf:Bag>\n", name)
+		for _, value := range x.bags[name] {
+			fmt.Fprintf(&buf, "     <rdf:li>%s</rdf:li>\n", xmlEscape(value))
+		}
+		fmt.Fprintf(&buf, "    </rdf:Bag>\n   </%s>\n", name)
+	}
+	for _, name := range sortedKeys(x.structs) {
+		fmt.Fprintf(&buf, "   <%s rdf:parseType=\"Resource\">\n%s   </%s>\n", name, x.structs[name], name)
+	}
+
+	buf.WriteString("  </rdf:Description>\n")
+	return buf.Bytes()
+}
+
+// uses reports whether the packet has a property in the namespace of prefix
+func (x *xmpPacket) uses(prefix string) bool {
+	for name := range x.simple {
+		if strings.HasPrefix(name, prefix+":") {
+			return true
+		}
+	}
+	for name := range x.langAlt {
+		if strings.HasPrefix(name, prefix+":") {
+			return true
+		}
+	}
+	for name := range x.bags {
+		if strings.HasPrefix(name, prefix+":") {
+			return true
+		}
+	}
+	for name, fields := range x.structs {
+		if strings.HasPrefix(name, prefix+":") || strings.Contains(fields, prefix+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeXMP adds the packet's simple properties and bags to an existing XMP packet,
+// such as the one Google Photos embeds. Properties already present are updated in
+// place, whether written as elements or as attributes, and bag values are added to
+// an existing bag, except for the bags set with SetBag, which replace it; everything
+// else goes into a new rdf:Description. Structures replace the existing ones.
+// Language alternatives are not merged.
+func mergeXMP(existing []byte, x *xmpPacket) []byte {
+	out := append([]byte{}, existing...)
+	missing := newXMPPacket()
+	for _, name := range sortedKeys(x.simple) {
+		value := xmlEscape(x.simple[name])
+		element := regexp.MustCompile(`<` + regexp.QuoteMeta(name) + `>[^<]*</` + regexp.QuoteMeta(name) + `>`)
+		attribute := regexp.MustCompile(`(\s` + regexp.QuoteMeta(name) + `=)("[^"]*"|'[^']*')`)
+		switch {
+		case element.Match(out):
+			out = element.ReplaceAllLiteral(out, []byte("<"+name+">"+value+"</"+name+">"))
+		case attribute.Match(out):
+			out = attribute.ReplaceAll(out, []byte(`${1}"`+strings.ReplaceAll(value, "$", "$$")+`"`))
+		default:
+			missing.Set(name, x.simple[name])
+		}
+	}
+	bagNames := make([]string, 0, len(x.bags))
+	for name := range x.bags {
+		bagNames = append(bagNames, name)
+	}
+	sort.Strings(bagNames)
+	for _, name := range bagNames {
+		values := x.bags[name]
+		if x.owned[name] {
+			if prefix, local, ok := strings.Cut(name, ":"); ok {
+				out = removeXMPElements(out, prefix, local)
+			}
+			missing.SetBag(name, values...)
+			continue
+		}
+		start := bytes.Index(out, []byte("<"+name+">"))
+		end := -1
+		if start >= 0 {
+			end = bytes.Index(out[start:], []byte("</rdf:Bag>"))
+		}
+		if end < 0 {
+			missing.AddToBag(name, values...)
+			continue
+		}
+		end += start
+		var items bytes.Buffer
+		for _, value := range values {
+			item := "<rdf:li>" + xmlEscape(value) + "</rdf:li>"
+			if !bytes.Contains(out[start:end], []byte(item)) {
+				items.WriteString("     " + item + "\n")
+			}
+		}
+		out = append(out[:end], append(items.Bytes(), out[end:]...)...)
+	}
+	for name, fields := range x.structs {
+		if prefix, local, ok := strings.Cut(name, ":"); ok {
+			out = removeXMPElements(out, prefix, local)
+		}
+		missing.structs[name] = fields
+	}
+
+	if len(missing.simple) == 0 && len(missing.bags) == 0 && len(missing.structs) == 0 {
+		return out
+	}
+	closing := bytes.LastIndex(out, []byte("</rdf:RDF>"))
+	if closing < 0 {
+		return x.Bytes()
+	}
+	return append(out[:closing], append(missing.description(), out[closing:]...)...)
+}
+
+// buildXMPPacket fills an XMP packet with the date, caption and GPS data from the metadata
+func buildXMPPacket(meta *Metadata, photoTime time.Time) *xmpPacket {
+	x := newXMPPacket()
+	// With -tz-correct the photo time is the local wall-clock time at the recorded
+	// offset, which the stamp must carry for readers not to take it for UTC
+	stamp := photoTime.Format("2006-01-02T15:04:05") + "Z"
+	if offset := meta.GetUTCOffset(); offset != 0 {
+		stamp = photoTime.Format("2006-01-02T15:04:05") + formatUTCOffset(offset, ":")
+	}
+	x.Set("xmp:CreateDate", stamp)
+	x.Set("exif:DateTimeOriginal", stamp)
+	x.Set("photoshop:DateCreated", stamp)
+	x.SetLangAlt("dc:title", meta.Title)
+	x.SetLangAlt("dc:description", meta.Description)
+
+	if lat, latOk := meta.GetLatitude(); latOk {
+		if lon, lonOk := meta.GetLongitude(); lonOk {
+			x.Set("exif:GPSLatitude", xmpGPSCoordinate(lat, "N", "S"))
+			x.Set("exif:GPSLongitude", xmpGPSCoordinate(lon, "E", "W"))
+			if alt, altOk := meta.GetAltitude(); altOk {
+				ref := "0"
+				if alt < 0 {
+					ref = "1"
+				}
+				x.Set("exif:GPSAltitudeRef", ref)
+				x.Set("exif:GPSAltitude", fmt.Sprintf("%d/100", int64(math.Round(math.Abs(alt)*100))))
+			}
+		}
+	}
+	return x
+}
+
+// xmpGPSCoordinate formats a decimal coordinate in the XMP "DDD,MM.mmmmk" form
+func xmpGPSCoordinate(value float64, positive, negative string) string {
+	ref := positive
+	if value < 0 {
+		ref = negative
+		value = -value
+	}
+	degrees := math.Floor(value)
+	minutes := (value - degrees) * 60
+	return fmt.Sprintf("%d,%.6f%s", int(degrees), minutes, ref)
+}
+
+// xmpSimpleProperty matches a simple property as Bytes renders it
+var xmpSimpleProperty = regexp.MustCompile(`<([A-Za-z]+:[A-Za-z]+)>([^<]*)</`)
+
+// changes lists the packet's properties against the simple properties of the sidecar
+// it replaces; previous values of titles, descriptions and bags are not reported
+func (x *xmpPacket) changes(previous []byte) []FieldChange {
+	old := make(map[string]string)
+	for _, match := range xmpSimpleProperty.FindAllSubmatch(previous, -1) {
+		old[string(match[1])] = html.UnescapeString(string(match[2]))
+	}
+	var changes []FieldChange
+	for _, name := range sortedKeys(x.simple) {
+		changes = append(changes, FieldChange{Tag: name, Old: old[name], New: x.simple[name]})
+	}
+	for _, name := range sortedKeys(x.langAlt) {
+		changes = append(changes, FieldChange{Tag: name, New: x.langAlt[name]})
+	}
+	bagNames := make([]string, 0, len(x.bags))
+	for name := range x.bags {
+		bagNames = append(bagNames, name)
+	}
+	sort.Strings(bagNames)
+	for _, name := range bagNames {
+		changes = append(changes, FieldChange{Tag: name, New: strings.Join(x.bags[name], ", ")})
+	}
+	return changes
+}
+
+// writeXMPSidecar writes the packet to sidecarPath, reporting whether the file changed
+func writeXMPSidecar(sidecarPath string, x *xmpPacket) (bool, error) {
+	content := x.Bytes()
+	if existing, err := os.ReadFile(sidecarPath); err == nil && bytes.Equal(existing, content) {
+		return false, nil
+	}
+	if err := os.WriteFile(sidecarPath, content, 0644); err != nil {
+		return false, writeFailed(sidecarPath, fmt.Errorf("failed to write XMP sidecar: %w", err))
+	}
+	return true, nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
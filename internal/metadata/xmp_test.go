@@ -0,0 +1,45 @@
+package metadata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildXMPPacketStamp(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		offset time.Duration
+		want   string
+	}{
+		{"UTC", 0, "2019-07-14T16:20:00Z"},
+		{"east of UTC", 5*time.Hour + 30*time.Minute, "2019-07-14T16:20:00+05:30"},
+		{"west of UTC", -7 * time.Hour, "2019-07-14T16:20:00-07:00"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			meta := &Metadata{}
+			meta.SetPhotoTime(time.Date(2019, 7, 14, 16, 20, 0, 0, time.UTC))
+			meta.SetUTCOffset(tc.offset)
+			photoTime, err := meta.GetPhotoTime()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			packet := buildXMPPacket(meta, photoTime)
+			for _, name := range []string{"xmp:CreateDate", "exif:DateTimeOriginal", "photoshop:DateCreated"} {
+				if got := packet.simple[name]; got != tc.want {
+					t.Errorf("%s = %q, want %q", name, got, tc.want)
+				}
+			}
+
+			// The stamp must name the same instant as the UTC time
+			stamp, err := time.Parse(time.RFC3339, packet.simple["xmp:CreateDate"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			utc, _ := meta.GetUTCTime()
+			if !stamp.Equal(utc) {
+				t.Errorf("stamp is %v, want the instant %v", stamp.UTC(), utc)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// xmpExtensionNamespaces are the tool's own XMP namespaces and the region ones,
+// declared in a packet only when it has properties in them
+var xmpExtensionNamespaces = map[string]string{
+	AuditPrefix:   AuditNamespace,
+	SocialPrefix:  SocialNamespace,
+	RegionsPrefix: RegionsNamespace,
+	"stArea":      areaNamespace,
+	"stDim":       dimNamespace,
+}
+
+// exiftoolDefinitions declares the tool's namespaces to exiftool, which only writes
+// XMP tags it knows
+const exiftoolDefinitions = `%Image::ExifTool::UserDefined = (
+    'Image::ExifTool::XMP::Main' => {
+        ` + AuditPrefix + ` => {
+            SubDirectory => { TagTable => 'Image::ExifTool::UserDefined::` + AuditPrefix + `' },
+        },
+        ` + SocialPrefix + ` => {
+            SubDirectory => { TagTable => 'Image::ExifTool::UserDefined::` + SocialPrefix + `' },
+        },
+    },
+);
+%Image::ExifTool::UserDefined::` + AuditPrefix + ` = (
+    GROUPS => { 0 => 'XMP', 1 => 'XMP-` + AuditPrefix + `', 2 => 'Image' },
+    NAMESPACE => { '` + AuditPrefix + `' => '` + AuditNamespace + `' },
+    WRITABLE => 'string',
+    SourceSidecar => { },
+    ExportDate => { Writable => 'date' },
+    AppliedFields => { List => 'Bag' },
+);
+%Image::ExifTool::UserDefined::` + SocialPrefix + ` = (
+    GROUPS => { 0 => 'XMP', 1 => 'XMP-` + SocialPrefix + `', 2 => 'Image' },
+    NAMESPACE => { '` + SocialPrefix + `' => '` + SocialNamespace + `' },
+    WRITABLE => 'string',
+    Likes => { Writable => 'integer' },
+    LikedBy => { List => 'Bag' },
+    Comments => { List => 'Seq' },
+);
+1;
+`
+
+var (
+	exiftoolConfigMutex sync.Mutex
+	exiftoolConfigPath  string
+)
+
+// exiftoolConfig returns the path of an exiftool config file defining the tool's
+// namespaces. exiftool runs the file as Perl, so each run creates its own under a
+// random name, readable only by its user, instead of reusing a file another user
+// could have put there. It is a tracked temporary file, removed by
+// RemoveExiftoolConfig or when the run is quit.
+func exiftoolConfig() (string, error) {
+	exiftoolConfigMutex.Lock()
+	defer exiftoolConfigMutex.Unlock()
+	if exiftoolConfigPath != "" {
+		return exiftoolConfigPath, nil
+	}
+	f, err := os.CreateTemp("", "google-takeout-exif-applier-*.config")
+	if err != nil {
+		return "", fmt.Errorf("failed to create exiftool config: %w", err)
+	}
+	path := TrackTempFile(f.Name())
+	_, err = f.WriteString(exiftoolDefinitions)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		RemoveTempFile(path)
+		return "", fmt.Errorf("failed to write exiftool config: %w", err)
+	}
+	exiftoolConfigPath = path
+	return path, nil
+}
+
+// RemoveExiftoolConfig removes the exiftool config file once the writes are done; a
+// later write creates a new one
+func RemoveExiftoolConfig() {
+	exiftoolConfigMutex.Lock()
+	defer exiftoolConfigMutex.Unlock()
+	if exiftoolConfigPath != "" {
+		RemoveTempFile(exiftoolConfigPath)
+		exiftoolConfigPath = ""
+	}
+}
@@ -0,0 +1,248 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// AlbumReport summarizes an album folder that has album metadata
+type AlbumReport struct {
+	Folder     string
+	Title      string
+	MediaFiles int
+	Locations  []string
+	Narratives []string
+	Expected   int      // Items the album metadata lists or counts, 0 when it doesn't say
+	Found      int      // Media files in the folder, compared with Expected
+	Missing    []string // Members listed in the album metadata but not in the folder
+}
+
+// Incomplete reports whether the album folder holds fewer items than its metadata
+// says, as after an interrupted download or an archive part left out
+func (a AlbumReport) Incomplete() bool {
+	return a.Expected > 0 && (a.Found < a.Expected || len(a.Missing) > 0)
+}
+
+// IncompleteAlbums returns the album folders holding fewer items than their album
+// metadata lists, see AlbumReport.Incomplete
+func (s *Statistics) IncompleteAlbums() []AlbumReport {
+	var albums []AlbumReport
+	for _, album := range s.Albums {
+		if album.Incomplete() {
+			albums = append(albums, album)
+		}
+	}
+	return albums
+}
+
+// albumInfo caches what we know about an album folder
+type albumInfo struct {
+	names []string // Folder name and album title
+	meta  *metadata.AlbumMetadata
+}
+
+// WithAlbumFilter restricts processing to album folders whose folder name or album
+// title matches one of the patterns (glob or case-insensitive substring)
+func WithAlbumFilter(patterns []string) Option {
+	return func(p *Processor) error {
+		p.albumFilter = patterns
+		return nil
+	}
+}
+
+// WithAlbumKeywords adds the album's location enrichment names as keywords on member photos
+func WithAlbumKeywords(enabled bool) Option {
+	return func(p *Processor) error {
+		p.albumKeywords = enabled
+		return nil
+	}
+}
+
+// WithAlbumNameKeyword adds the album title (or album folder name) as a keyword on member photos
+func WithAlbumNameKeyword(enabled bool) Option {
+	return func(p *Processor) error {
+		p.albumNameKeyword = enabled
+		return nil
+	}
+}
+
+// WithLabelKeywords adds the names from the JSON people, tags and labels fields as keywords
+func WithLabelKeywords(enabled bool) Option {
+	return func(p *Processor) error {
+		p.labelKeywords = enabled
+		return nil
+	}
+}
+
+// yearFolder matches Takeout's automatic per-year folders, which are not albums
+var yearFolder = regexp.MustCompile(`^(Photos from|Fotos von|Photos de|Fotos de|Foto del) \d{4}$`)
+
+// album returns the cached album information for a folder. The names are the folder
+// name and, when an album metadata file is present, its (possibly localized) title
+func (p *Processor) album(dir string) *albumInfo {
+	p.albumMutex.Lock()
+	defer p.albumMutex.Unlock()
+
+	if info, ok := p.albumCache[dir]; ok {
+		return info
+	}
+
+	info := &albumInfo{names: []string{filepath.Base(dir)}}
+	if albumPath := metadata.FindAlbumMetadata(dir); albumPath != "" {
+		if album, err := metadata.ParseAlbumJSON(albumPath); err == nil {
+			info.meta = album
+			if album.Title != "" {
+				info.names = append(info.names, album.Title)
+			}
+		}
+	}
+	p.albumCache[dir] = info
+	return info
+}
+
+// matchesAlbumFilter reports whether the media file's album folder is selected
+func (p *Processor) matchesAlbumFilter(mediaPath string) bool {
+	if len(p.albumFilter) == 0 {
+		return true
+	}
+	for _, name := range p.album(filepath.Dir(mediaPath)).names {
+		for _, pattern := range p.albumFilter {
+			if matchAlbumPattern(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchAlbumPattern matches name against a glob pattern, or a substring when the
+// pattern has no glob characters; both comparisons are case-insensitive
+func matchAlbumPattern(pattern, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	if strings.ContainsAny(pattern, "*?[") {
+		matched, err := filepath.Match(pattern, name)
+		return err == nil && matched
+	}
+	return strings.Contains(name, pattern)
+}
+
+// albumKeywordsFor returns the album-level keywords to add to a member photo
+func (p *Processor) albumKeywordsFor(mediaPath string) []string {
+	if !p.albumKeywords && !p.albumNameKeyword {
+		return nil
+	}
+	dir := filepath.Dir(mediaPath)
+	info := p.album(dir)
+
+	var keywords []string
+	if title := p.albumTitle(dir); p.albumNameKeyword && title != "" {
+		keywords = append(keywords, title)
+	}
+	if p.albumKeywords && info.meta != nil {
+		keywords = append(keywords, info.meta.LocationNames()...)
+	}
+	return keywords
+}
+
+// albumTitle returns the title of the album a folder holds, or its folder name, ""
+// for the export root and the automatic per-year folders
+func (p *Processor) albumTitle(dir string) string {
+	info := p.album(dir)
+	switch {
+	case info.meta != nil && info.meta.Title != "":
+		return info.meta.Title
+	case !p.isRootDir(dir) && !yearFolder.MatchString(filepath.Base(dir)):
+		return filepath.Base(dir)
+	}
+	return ""
+}
+
+// buildAlbumReports summarizes every collected album folder that has album metadata
+func (p *Processor) buildAlbumReports() []AlbumReport {
+	counts := make(map[string]int)
+	for _, job := range p.jobs {
+		counts[filepath.Dir(job.mediaPath)]++
+	}
+	for dir := range p.albumDirs {
+		// Albums left without any media are the most incomplete of all
+		if p.matchesAlbumFilter(filepath.Join(dir, "metadata.json")) {
+			counts[dir] += 0
+		}
+	}
+
+	var reports []AlbumReport
+	for dir, count := range counts {
+		info := p.album(dir)
+		if info.meta == nil {
+			continue
+		}
+		folder, err := p.relPath(dir)
+		if err != nil {
+			folder = dir
+		}
+		report := AlbumReport{
+			Folder:     folder,
+			Title:      info.meta.Title,
+			MediaFiles: count,
+			Locations:  info.meta.LocationNames(),
+			Narratives: info.meta.Narratives(),
+		}
+		p.checkAlbumMembers(dir, info.meta, &report)
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Folder < reports[j].Folder })
+	return reports
+}
+
+// mergeAlbumReports adds the reports of a scan to those of earlier scans, as the
+// batches of Watch scan part of an album each. A folder scanned again counts the media
+// files of both scans; its member check is the latest one.
+func mergeAlbumReports(reports, scanned []AlbumReport) []AlbumReport {
+	// Statistics copies share the slice
+	reports = append([]AlbumReport(nil), reports...)
+	index := make(map[string]int, len(reports))
+	for i, report := range reports {
+		index[report.Folder] = i
+	}
+	for _, report := range scanned {
+		if i, ok := index[report.Folder]; ok {
+			report.MediaFiles += reports[i].MediaFiles
+			reports[i] = report
+			continue
+		}
+		index[report.Folder] = len(reports)
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Folder < reports[j].Folder })
+	return reports
+}
+
+// checkAlbumMembers compares the media files in an album folder with the item count
+// and members its album metadata gives
+func (p *Processor) checkAlbumMembers(dir string, album *metadata.AlbumMetadata, report *AlbumReport) {
+	if report.Expected = album.ExpectedItems(); report.Expected == 0 {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		p.warn(dir, "Cannot check the album %s against its metadata: %v", dir, err)
+		return
+	}
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && isSupportedMediaFile(entry.Name()) {
+			present[strings.ToLower(entry.Name())] = true
+			report.Found++
+		}
+	}
+	for _, member := range album.Members {
+		if !present[strings.ToLower(member)] {
+			report.Missing = append(report.Missing, member)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// ExtractedListName is the file ExtractArchives keeps in the extraction directory,
+// listing the archives fully extracted into it. The scan ignores it.
+const ExtractedListName = ".takeout-exif-extracted.json"
+
+// extractedArchive is an archive listed in the ExtractedListName file
+type extractedArchive struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+}
+
+// archivePart matches the part number and extension of a Takeout archive name, as in
+// takeout-20240101T120000Z-001.zip
+var archivePart = regexp.MustCompile(`(?i)(-\d+)?(\.zip|\.tgz|\.tar\.gz)$`)
+
+// IsTakeoutArchive reports whether a path names a Takeout archive: a .zip, .tgz or
+// .tar.gz file
+func IsTakeoutArchive(path string) bool {
+	return archivePart.MatchString(path)
+}
+
+// ArchiveDir returns the directory Takeout archives are extracted into by default:
+// next to the first one, named after it without its part number and extension
+// (takeout-20240101T120000Z-001.zip into takeout-20240101T120000Z)
+func ArchiveDir(archives []string) string {
+	name := archivePart.ReplaceAllString(filepath.Base(archives[0]), "")
+	if name == "" {
+		name = "takeout"
+	}
+	return filepath.Join(filepath.Dir(archives[0]), name)
+}
+
+// ExtractArchives extracts Takeout archives (zip or gzipped tar) into dir, merging
+// their trees the way unzipping every part into one folder does, and returns the
+// number of files extracted. The archives are kept. Archives a previous run already
+// extracted there (same name and size) are skipped, so the same command can be run
+// again; one interrupted halfway is extracted again. Entries that would land outside
+// dir are refused.
+func ExtractArchives(ctx context.Context, archives []string, dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	unlock, err := LockDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	listPath := filepath.Join(dir, ExtractedListName)
+	done, err := readExtractedList(listPath)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for i, archive := range archives {
+		info, err := os.Stat(archive)
+		if err != nil {
+			return total, fmt.Errorf("failed to access archive: %w", err)
+		}
+		if archiveExtracted(done, filepath.Base(archive), info.Size()) {
+			fmt.Printf("[ARCHIVE] Already extracted: %s\n", archive)
+			continue
+		}
+		fmt.Printf("[ARCHIVE] Extracting %s (%d of %d) into %s\n", archive, i+1, len(archives), dir)
+		files, err := extractArchive(ctx, archive, dir)
+		if err != nil {
+			return total, fmt.Errorf("failed to extract %s: %w", archive, err)
+		}
+		fmt.Printf("[ARCHIVE] Extracted %d files from %s\n", files, archive)
+		total += files
+
+		done = append(done, extractedArchive{Name: filepath.Base(archive), Size: info.Size(), Files: files})
+		if err := writeExtractedList(listPath, done); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// CountArchives returns the number of files ExtractArchives would extract into dir,
+// without writing anything: the regular files of the archives not extracted there yet.
+// Dry runs use it instead of extracting.
+func CountArchives(ctx context.Context, archives []string, dir string) (int, error) {
+	done, err := readExtractedList(filepath.Join(dir, ExtractedListName))
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, archive := range archives {
+		info, err := os.Stat(archive)
+		if err != nil {
+			return total, fmt.Errorf("failed to access archive: %w", err)
+		}
+		if archiveExtracted(done, filepath.Base(archive), info.Size()) {
+			continue
+		}
+		files, err := countArchive(ctx, archive)
+		if err != nil {
+			return total, fmt.Errorf("failed to read %s: %w", archive, err)
+		}
+		total += files
+	}
+	return total, nil
+}
+
+// countArchive returns the number of regular files in one archive
+func countArchive(ctx context.Context, path string) (int, error) {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return zipFileCount(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer gz.Close()
+
+	r := tar.NewReader(gz)
+	files := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+		header, err := r.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			files++
+		}
+	}
+}
+
+// readExtractedList returns the archives listed in the ExtractedListName file at
+// path, none when it doesn't exist
+func readExtractedList(path string) ([]extractedArchive, error) {
+	var done []extractedArchive
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil
+	}
+	if err := json.Unmarshal(data, &done); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return done, nil
+}
+
+// archiveExtracted reports whether the list of extracted archives has this one
+func archiveExtracted(done []extractedArchive, name string, size int64) bool {
+	for _, a := range done {
+		if a.Name == name && a.Size == size {
+			return true
+		}
+	}
+	return false
+}
+
+// writeExtractedList replaces the list of extracted archives
+func writeExtractedList(path string, done []extractedArchive) error {
+	data, err := json.MarshalIndent(done, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode extracted archives: %w", err)
+	}
+	tmp := metadata.TrackTempFile(path + ".tmp")
+	defer metadata.RemoveTempFile(tmp)
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write extracted archives: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write extracted archives: %w", err)
+	}
+	return nil
+}
+
+// extractArchive extracts the regular files of one archive into dir
+func extractArchive(ctx context.Context, path, dir string) (int, error) {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return extractZipArchive(ctx, path, dir)
+	}
+	return extractTarArchive(ctx, path, dir)
+}
+
+func extractZipArchive(ctx context.Context, path, dir string) (int, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer r.Close()
+
+	files := 0
+	for _, f := range r.File {
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+		if !f.Mode().IsRegular() {
+			continue // Directories are created with their files; links are not extracted
+		}
+		target, err := archiveTarget(dir, f.Name)
+		if err != nil {
+			return files, err
+		}
+		src, err := f.Open()
+		if err != nil {
+			return files, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		err = writeExtracted(src, target, f.Modified)
+		src.Close()
+		if err != nil {
+			return files, err
+		}
+		files++
+	}
+	return files, nil
+}
+
+func extractTarArchive(ctx context.Context, path, dir string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer gz.Close()
+
+	r := tar.NewReader(gz)
+	files := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+		header, err := r.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		target, err := archiveTarget(dir, header.Name)
+		if err != nil {
+			return files, err
+		}
+		if err := writeExtracted(r, target, header.ModTime); err != nil {
+			return files, err
+		}
+		files++
+	}
+}
+
+// archiveTarget returns where an archive entry is extracted below dir
+func archiveTarget(dir, name string) (string, error) {
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("archive entry %q points outside the archive", name)
+	}
+	return filepath.Join(dir, local), nil
+}
+
+// writeExtracted writes an extracted file through a temporary file renamed into
+// place, so an interrupted extraction leaves no cut-off file, and gives it the
+// modification time from the archive
+func writeExtracted(src io.Reader, dst string, modified time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := metadata.TrackTempFile(dst + extractingSuffix)
+	defer metadata.RemoveTempFile(tmp)
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	_, err = io.Copy(out, src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", dst, err)
+	}
+	if !modified.IsZero() {
+		os.Chtimes(tmp, modified, modified)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", dst, err)
+	}
+	return nil
+}
+
+// RepackArchive writes the files below dir into a new zip archive at dst, with their
+// paths relative to dir and their modification times, and returns the number of
+// files. Media files are stored as they are, the rest is compressed. The lock, run
+// state and extraction list files are left out, and so is dst when it is inside dir.
+func RepackArchive(ctx context.Context, dir, dst string) (int, error) {
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return 0, err
+	}
+	tmp := metadata.TrackTempFile(dst + ".tmp")
+	defer metadata.RemoveTempFile(tmp)
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	files := 0
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Name() == LockFileName || info.Name() == ExtractedListName || info.Name() == StateFileName {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && (abs == absDst || abs == absDst+".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		if isSupportedMediaFile(path) {
+			header.Method = zip.Store
+		}
+		entry, err := w.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.Copy(entry, src); err != nil {
+			return err
+		}
+		files++
+		return nil
+	})
+	if err == nil {
+		err = w.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return 0, fmt.Errorf("failed to move archive into place: %w", err)
+	}
+	return files, nil
+}
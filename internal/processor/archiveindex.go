@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// archiveIndexName is the export index Google places at the top of a Takeout archive
+const archiveIndexName = "archive_browser.html"
+
+// IndexCheck compares the media files listed in archive_browser.html with those on disk
+type IndexCheck struct {
+	IndexPath string
+	Listed    int      // Media entries in the index
+	Found     int      // Listed entries with a file of that name on disk
+	Missing   []string // Listed names with no file on disk, sorted
+}
+
+// findArchiveIndex looks for the export index in the root and its parents, since
+// the root may be the Takeout folder or the Google Photos folder inside it
+func findArchiveIndex(root string) string {
+	dir := root
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(dir, archiveIndexName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ""
+}
+
+// readArchiveIndex returns the media file names listed in the index with their counts.
+// The page is parsed leniently; any text node naming a supported media file counts.
+func readArchiveIndex(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive index: %w", err)
+	}
+	defer f.Close()
+
+	decoder := xml.NewDecoder(f)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	names := make(map[string]int)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse archive index: %w", err)
+		}
+		text, ok := token.(xml.CharData)
+		if !ok {
+			continue
+		}
+		name := strings.TrimSpace(string(text))
+		if name != "" && !strings.ContainsAny(name, "/\\\n") && isSupportedMediaFile(name) {
+			names[name]++
+		}
+	}
+	return names, nil
+}
+
+// checkArchiveIndex cross-checks the media names seen during the walk against the
+// export index, when one is present
+func (p *Processor) checkArchiveIndex() {
+	indexPath := findArchiveIndex(p.rootDir)
+	if indexPath == "" {
+		return
+	}
+	listed, err := readArchiveIndex(indexPath)
+	if err != nil {
+		p.warn(indexPath, "Ignoring %s: %v", indexPath, err)
+		return
+	}
+
+	seen, err := p.seenCounts(listed)
+	if err != nil {
+		p.warn(indexPath, "Ignoring %s: %v", indexPath, err)
+		return
+	}
+
+	check := &IndexCheck{IndexPath: indexPath}
+	for name, count := range listed {
+		check.Listed += count
+		found := min(count, seen[name])
+		check.Found += found
+		for i := found; i < count; i++ {
+			check.Missing = append(check.Missing, name)
+		}
+	}
+	sort.Strings(check.Missing)
+	if len(check.Missing) > 0 {
+		p.warn(indexPath, "%d of %d media files listed in %s were not found on disk", len(check.Missing), check.Listed, archiveIndexName)
+	}
+
+	p.update(func(s *Statistics) { s.IndexCheck = check })
+}
@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// WithAuditXMP embeds an audit trail in every written file: an XMP block in the
+// tool's own namespace naming the sidecar the metadata came from, the export date and
+// the tags written, for troubleshooting long after the export is gone
+func WithAuditXMP(enabled bool) Option {
+	return func(p *Processor) error {
+		p.auditXMP = enabled
+		return nil
+	}
+}
+
+// auditTrail describes the source of a job's metadata. Takeout zips keep the time
+// Google created each file, so an extracted sidecar's modification time is the export
+// date; a manifest was written later and gives none.
+func (p *Processor) auditTrail(job fileJob, info os.FileInfo) *metadata.AuditTrail {
+	if !p.auditXMP {
+		return nil
+	}
+	audit := &metadata.AuditTrail{Sidecar: filepath.Base(job.jsonPath)}
+	if job.matchRule != MatchManifest {
+		audit.ExportDate = info.ModTime()
+	}
+	return audit
+}
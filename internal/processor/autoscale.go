@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// autoscaleInterval is how often the worker count is reconsidered
+const autoscaleInterval = 2 * time.Second
+
+// WithWorkers enables worker autoscaling between min and max workers. The pool
+// grows while per-file latency stays near its best observed value and throughput
+// keeps improving, and shrinks when latency climbs (IO contention) or video jobs,
+// which run their own multi-threaded remux, dominate. max 0 keeps a fixed pool.
+func WithWorkers(min, max int) Option {
+	return func(p *Processor) error {
+		if max == 0 {
+			p.minWorkers, p.maxWorkers = 0, 0
+			return nil
+		}
+		if min < 1 || max < min {
+			return fmt.Errorf("invalid worker bounds %d-%d (need 1 <= min <= max)", min, max)
+		}
+		p.minWorkers, p.maxWorkers = min, max
+		return nil
+	}
+}
+
+// workerPool runs processWorker goroutines whose number may change during the run
+type workerPool struct {
+	p    *Processor
+	ctx  context.Context
+	jobs chan fileJob
+	wg   sync.WaitGroup
+	stop chan struct{} // Each token retires one worker after its current job
+	size int           // Only changed by start and the autoscaler
+
+	mu        sync.Mutex // Protects the samples below
+	completed int
+	busy      time.Duration
+	videoBusy time.Duration
+}
+
+func newWorkerPool(ctx context.Context, p *Processor, jobs chan fileJob) *workerPool {
+	return &workerPool{p: p, ctx: ctx, jobs: jobs, stop: make(chan struct{}, p.workerCount+p.maxWorkers)}
+}
+
+// start launches n more workers
+func (w *workerPool) start(n int) {
+	for i := 0; i < n; i++ {
+		w.wg.Add(1)
+		go w.run()
+	}
+	w.size += n
+}
+
+// retire asks one worker to exit once it finishes its current job
+func (w *workerPool) retire() {
+	w.stop <- struct{}{}
+	w.size--
+}
+
+// run processes jobs until the channel is closed or the worker is retired
+func (w *workerPool) run() {
+	defer w.wg.Done()
+	defer metadata.RemoveTempFilesOnPanic()
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+		select {
+		case <-w.stop:
+			return
+		case job, ok := <-w.jobs:
+			if !ok {
+				return
+			}
+			if w.p.ioLimit != nil {
+				w.p.ioLimit.wait(w.ctx)
+			}
+			if w.p.aborted() || w.ctx.Err() != nil {
+				continue
+			}
+			var took time.Duration
+			if !w.p.scheduled(w.ctx, func() {
+				started := time.Now()
+				w.p.processMediaFile(w.ctx, job)
+				took = time.Since(started)
+			}) {
+				continue
+			}
+			w.observe(took, isVideoFile(job.mediaPath))
+			w.p.recordDuration(job, took)
+		}
+	}
+}
+
+// observe records the time one job took
+func (w *workerPool) observe(d time.Duration, video bool) {
+	w.mu.Lock()
+	w.completed++
+	w.busy += d
+	if video {
+		w.videoBusy += d
+	}
+	w.mu.Unlock()
+}
+
+// takeSample returns and resets the samples collected since the last call
+func (w *workerPool) takeSample() (completed int, busy, videoBusy time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	completed, busy, videoBusy = w.completed, w.busy, w.videoBusy
+	w.completed, w.busy, w.videoBusy = 0, 0, 0
+	return completed, busy, videoBusy
+}
+
+// autoscale adjusts the pool size until done is closed
+func (w *workerPool) autoscale(done <-chan struct{}) {
+	ticker := time.NewTicker(autoscaleInterval)
+	defer ticker.Stop()
+
+	var best time.Duration // Lowest average per-file latency seen so far
+	var lastThroughput float64
+	grew := false
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-w.p.abort:
+			return
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		completed, busy, videoBusy := w.takeSample()
+		if completed == 0 {
+			continue
+		}
+		latency := busy / time.Duration(completed)
+		throughput := float64(completed) / autoscaleInterval.Seconds()
+		if best == 0 || latency < best {
+			best = latency
+		}
+
+		var reason string
+		switch {
+		case w.size > w.p.minWorkers && videoBusy*2 > busy:
+			reason = "video jobs saturate the pool"
+		case w.size > w.p.minWorkers && grew && throughput < lastThroughput*0.9:
+			reason = "throughput dropped after growing"
+		case w.size > w.p.minWorkers && latency > 2*best:
+			reason = "latency rising (likely IO wait)"
+		}
+
+		before := w.size
+		switch {
+		case reason != "":
+			w.retire()
+			grew = false
+		case w.size < w.p.maxWorkers && latency*2 <= best*3:
+			w.start(1)
+			grew = true
+			reason = "latency low"
+		default:
+			grew = false
+		}
+		lastThroughput = throughput
+
+		if w.p.verbose && w.size != before {
+			fmt.Printf("[SCALE] Workers %d -> %d: %s (%v/file, %.1f files/s)\n",
+				before, w.size, reason, latency.Round(time.Millisecond), throughput)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// How a run is split into batches
+const (
+	BatchByYear  = "year"  // By the year of the photo time, oldest first
+	BatchByAlbum = "album" // By album folder, in path order
+)
+
+// batchUnknownYear names the year batch of files without a photo time
+const batchUnknownYear = "unknown"
+
+// ValidateBatchBy checks that by is one of the batch modes
+func ValidateBatchBy(by string) error {
+	switch by {
+	case "", BatchByYear, BatchByAlbum:
+		return nil
+	}
+	return fmt.Errorf("unknown batch mode %q (expected %s or %s)", by, BatchByYear, BatchByAlbum)
+}
+
+// Batch is one part of a batched run
+type Batch struct {
+	Name  string // Year or album folder relative to its export root
+	Index int    // 1-based position in the run
+	Count int    // Number of batches in the run
+	Files int    // Media files in the batch
+}
+
+// batchCheckpoint is the file recording which batches a previous run completed
+type batchCheckpoint struct {
+	BatchBy string   `json:"batchBy"`
+	Done    []string `json:"done"`
+}
+
+// WithBatches processes the run in batches by year or album instead of all at once.
+// After each batch, handler (if not nil) receives the batch and its statistics, and
+// the batch is recorded in the checkpoint file. A later run with the same checkpoint
+// skips the completed batches, so an interruption loses at most one batch. Dry runs
+// neither read nor write the checkpoint. Empty by disables batching.
+func WithBatches(by, checkpoint string, handler func(Batch, Statistics)) Option {
+	return func(p *Processor) error {
+		if err := ValidateBatchBy(by); err != nil {
+			return err
+		}
+		p.batchBy, p.batchCheckpoint, p.batchHandler = by, checkpoint, handler
+		return nil
+	}
+}
+
+// loadBatchCheckpoint reads the batches completed by a previous run from the
+// checkpoint, once it is known whether this is a dry run
+func (p *Processor) loadBatchCheckpoint() error {
+	p.batchesDone = make(map[string]bool)
+	if p.batchBy == "" || p.batchCheckpoint == "" || p.dryRun {
+		return nil
+	}
+	data, err := os.ReadFile(p.batchCheckpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var cp batchCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("failed to parse checkpoint %s: %w", p.batchCheckpoint, err)
+	}
+	if cp.BatchBy != p.batchBy {
+		return fmt.Errorf("checkpoint %s is for batches by %s, not %s", p.batchCheckpoint, cp.BatchBy, p.batchBy)
+	}
+	for _, name := range cp.Done {
+		p.batchesDone[name] = true
+	}
+	return nil
+}
+
+// runBatches processes the jobs batch by batch, skipping the batches a previous run
+// completed, and stops after the batch during which the run was interrupted or aborted
+func (p *Processor) runBatches(ctx context.Context) {
+	names, batches := p.splitBatches()
+	for i, name := range names {
+		jobs := batches[name]
+		batch := Batch{Name: name, Index: i + 1, Count: len(names), Files: len(jobs)}
+		if p.batchesDone[name] {
+			fmt.Printf("[BATCH] %d/%d %s: completed by a previous run, skipping %d files\n", batch.Index, batch.Count, name, len(jobs))
+			for _, job := range jobs {
+				p.recordSkip(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath,
+					Message: "batch " + name + " was completed by a previous run"}, SkipAlreadyProcessed)
+			}
+			continue
+		}
+
+		fmt.Printf("[BATCH] %d/%d %s: %d files\n", batch.Index, batch.Count, name, len(jobs))
+		before, started := p.getStatsCopy(), time.Now()
+		p.runJobs(ctx, jobs)
+		if ctx.Err() != nil || p.aborted() {
+			return
+		}
+		if p.batchHandler != nil {
+			stats := batchStats(before, p.getStatsCopy())
+			stats.TotalFiles, stats.Elapsed = len(jobs), time.Since(started)
+			p.batchHandler(batch, stats)
+		}
+		p.batchesDone[name] = true
+		if err := p.writeCheckpoint(names); err != nil {
+			p.warn(p.batchCheckpoint, "%v", err)
+		}
+	}
+}
+
+// splitBatches groups the jobs into batches, keeping the queue order within each,
+// and returns the batch names in processing order
+func (p *Processor) splitBatches() ([]string, map[string][]fileJob) {
+	batches := make(map[string][]fileJob)
+	var names []string
+	for _, job := range p.jobs {
+		name := p.batchName(job)
+		if _, ok := batches[name]; !ok {
+			names = append(names, name)
+		}
+		batches[name] = append(batches[name], job)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		if p.batchBy == BatchByYear && (names[i] == batchUnknownYear || names[j] == batchUnknownYear) {
+			return names[j] == batchUnknownYear && names[i] != batchUnknownYear
+		}
+		return names[i] < names[j]
+	})
+	return names, batches
+}
+
+// batchName returns the batch a job belongs to
+func (p *Processor) batchName(job fileJob) string {
+	if p.batchBy == BatchByAlbum {
+		dir := filepath.Dir(job.mediaPath)
+		if rel, err := p.relPath(dir); err == nil && rel != "." {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.Base(dir)
+	}
+	var photoTime time.Time
+	if job.meta != nil {
+		photoTime, _ = job.meta.GetPhotoTime()
+	} else {
+		photoTime = p.jobPhotoTime(job)
+	}
+	if photoTime.IsZero() {
+		return batchUnknownYear
+	}
+	return strconv.Itoa(photoTime.UTC().Year())
+}
+
+// writeCheckpoint records the completed batches, in run order
+func (p *Processor) writeCheckpoint(names []string) error {
+	if p.batchCheckpoint == "" || p.dryRun {
+		return nil
+	}
+	cp := batchCheckpoint{BatchBy: p.batchBy, Done: []string{}}
+	for _, name := range names {
+		if p.batchesDone[name] {
+			cp.Done = append(cp.Done, name)
+		}
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	// Replace the checkpoint atomically so an interruption can't leave half of it
+	tmp := metadata.TrackTempFile(p.batchCheckpoint + ".tmp")
+	defer metadata.UntrackTempFile(tmp)
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, p.batchCheckpoint); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// batchStats returns what changed between two snapshots taken before and after a
+// batch: the counters' differences and the details added in between
+func batchStats(before, after Statistics) Statistics {
+	stats := Statistics{
+		JSONFiles:          after.JSONFiles - before.JSONFiles,
+		LegacyFiles:        after.LegacyFiles - before.LegacyFiles,
+		PicasaFiles:        after.PicasaFiles - before.PicasaFiles,
+		ProcessedFiles:     after.ProcessedFiles - before.ProcessedFiles,
+		ModifiedFiles:      after.ModifiedFiles - before.ModifiedFiles,
+		UnmodifiedFiles:    after.UnmodifiedFiles - before.UnmodifiedFiles,
+		SkippedFiles:       after.SkippedFiles - before.SkippedFiles,
+		PartnerFiles:       after.PartnerFiles - before.PartnerFiles,
+		CreationFiles:      after.CreationFiles - before.CreationFiles,
+		CorruptFiles:       after.CorruptFiles - before.CorruptFiles,
+		TransportStreams:   after.TransportStreams - before.TransportStreams,
+		SyncedFiles:        after.SyncedFiles - before.SyncedFiles,
+		ClonedFiles:        after.ClonedFiles - before.ClonedFiles,
+		LinkedFiles:        after.LinkedFiles - before.LinkedFiles,
+		WriteMismatches:    after.WriteMismatches - before.WriteMismatches,
+		ErrorCount:         after.ErrorCount - before.ErrorCount,
+		BytesChanged:       after.BytesChanged - before.BytesChanged,
+		ModifiedDetails:    after.ModifiedDetails[len(before.ModifiedDetails):],
+		UnmodifiedDetails:  after.UnmodifiedDetails[len(before.UnmodifiedDetails):],
+		TimestampConflicts: after.TimestampConflicts[len(before.TimestampConflicts):],
+		TimezoneAudit:      after.TimezoneAudit[len(before.TimezoneAudit):],
+		SuspectedMatches:   after.SuspectedMatches[len(before.SuspectedMatches):],
+		OversizedVideos:    after.OversizedVideos[len(before.OversizedVideos):],
+		Files:              after.Files[len(before.Files):],
+	}
+	for reason, n := range after.SkipReasons {
+		if n -= before.SkipReasons[reason]; n > 0 {
+			if stats.SkipReasons == nil {
+				stats.SkipReasons = make(map[string]int)
+			}
+			stats.SkipReasons[reason] = n
+		}
+	}
+	for name, stage := range after.Stages {
+		prev := before.Stages[name]
+		if stage.Files -= prev.Files; stage.Files > 0 {
+			stage.Duration -= prev.Duration
+			stage.BytesRead -= prev.BytesRead
+			stage.BytesWritten -= prev.BytesWritten
+			if stats.Stages == nil {
+				stats.Stages = make(map[string]StageStats)
+			}
+			stats.Stages[name] = stage
+		}
+	}
+	return stats
+}
@@ -0,0 +1,293 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"google-takeout-exif-applier/internal/config"
+)
+
+// supplementalSuffix is the marker Google inserts before ".json" in newer exports.
+// Long names get it truncated to fit the 51 character filename limit.
+const supplementalSuffix = ".supplemental-metadata"
+
+// maxJSONNameLength is the longest media name Google keeps before appending ".json"
+// in older exports; longer names are cut at this length
+const maxJSONNameLength = 46
+
+// editedSuffixes are the localized markers Google appends to edited copies, which
+// share the original's sidecar
+var editedSuffixes = []string{"-edited", "-bearbeitet", "-modifié", "-editado", "-modificato", "-bewerkt"}
+
+// duplicateNumber matches the "(n)" Google adds to duplicate file names
+var duplicateNumber = regexp.MustCompile(`\(\d+\)`)
+
+// Match strategy names recorded for files not matched by a candidate strategy
+const (
+	MatchNone        = "none"         // No sidecar was found
+	MatchPreviousRun = "previous-run" // Sidecar carried over by -retry-from
+)
+
+// CandidateStrategy generates possible sidecar file names for a media file name,
+// most likely first. Library users can add their own with WithCandidateStrategies.
+type CandidateStrategy struct {
+	Name     string
+	Generate func(mediaName string) []string
+}
+
+// defaultStrategies lists the JSON naming schemes observed in Takeout exports, in the
+// order they are tried
+var defaultStrategies = []CandidateStrategy{
+	// IMG_1234.jpg -> IMG_1234.json
+	{Name: "replaced-extension", Generate: func(name string) []string {
+		return []string{strings.TrimSuffix(name, filepath.Ext(name)) + ".json"}
+	}},
+	// IMG_1234(1).jpg -> IMG_1234.jpg(1).json, IMG_1234.jpg.supplemental-metadata(1).json
+	{Name: "numbered-duplicate", Generate: func(name string) []string {
+		stem, number, ok := splitDuplicateNumber(name)
+		if !ok {
+			return nil
+		}
+		return withSuffixes(stem, number)
+	}},
+	// IMG_1234.jpg -> IMG_1234.jpg.json, IMG_1234.jpg.supplemental-metadata.json
+	{Name: "exact", Generate: func(name string) []string {
+		return []string{name + ".json", name + supplementalSuffix + ".json"}
+	}},
+	// IMG_1234.jpg -> IMG_1234.jpg.supplemental-meta.json, ..., IMG_1234.jpg.s.json
+	{Name: "truncated-suffix", Generate: func(name string) []string {
+		return withSuffixes(name, "")[2:]
+	}},
+	// IMG_1234-edited.jpg -> IMG_1234.jpg.json, including duplicates of edited copies
+	{Name: "edited", Generate: func(name string) []string {
+		original, ok := stripEditedSuffix(name)
+		if !ok {
+			return nil
+		}
+		candidates := withSuffixes(original, "")
+		if stem, number, ok := splitDuplicateNumber(original); ok {
+			candidates = append(withSuffixes(stem, number), candidates...)
+		}
+		return candidates
+	}},
+	// a-very-long-file-name-from-a-camera-app-0001.jpg -> a-very-long-file-name-from-a-camera-app-0001.j.json
+	{Name: "truncated-name", Generate: func(name string) []string {
+		var candidates []string
+		for _, full := range []string{name, name + supplementalSuffix} {
+			if len(full) > maxJSONNameLength {
+				candidates = append(candidates, truncateName(full, maxJSONNameLength)+".json")
+			}
+		}
+		return candidates
+	}},
+	// IMG_1234.HEIC.jpg -> IMG_1234.HEIC.json, IMG_1234.jpg.jpg -> IMG_1234.jpg.json
+	{Name: "double-extension", Generate: func(name string) []string {
+		inner := strings.TrimSuffix(name, filepath.Ext(name))
+		if filepath.Ext(inner) == "" {
+			return nil
+		}
+		return withSuffixes(inner, "")
+	}},
+}
+
+// jsonCandidate is a possible sidecar path and the rule that produced it
+type jsonCandidate struct {
+	Path string
+	Rule string
+}
+
+// DefaultCandidateStrategies returns the built-in sidecar naming schemes in their default order
+func DefaultCandidateStrategies() []CandidateStrategy {
+	return append([]CandidateStrategy(nil), defaultStrategies...)
+}
+
+// PatternStrategy builds a strategy from a regular expression matched against the
+// media file name and a sidecar name template using its groups ($1, ${name})
+func PatternStrategy(name, pattern, template string) (CandidateStrategy, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return CandidateStrategy{}, fmt.Errorf("invalid sidecar pattern %q: %w", pattern, err)
+	}
+	return CandidateStrategy{Name: name, Generate: func(mediaName string) []string {
+		match := re.FindStringSubmatchIndex(mediaName)
+		if match == nil {
+			return nil
+		}
+		candidate := string(re.ExpandString(nil, template, mediaName, match))
+		if candidate == "" || strings.ContainsAny(candidate, `/\`) {
+			return nil
+		}
+		return []string{candidate}
+	}}, nil
+}
+
+// WithCandidateStrategies replaces the chain of sidecar naming strategies tried for
+// every media file. An empty chain restores the default.
+func WithCandidateStrategies(strategies []CandidateStrategy) Option {
+	return func(p *Processor) error {
+		p.candidateStrategies = strategies
+		return nil
+	}
+}
+
+// WithSidecarMatching configures the strategy chain from the config file. Names refer to
+// built-in strategies or to custom rules; custom rules not named in order are tried
+// after it. An empty order means the default chain.
+func WithSidecarMatching(order []string, rules []config.SidecarRule) Option {
+	return func(p *Processor) error {
+		available := make(map[string]CandidateStrategy)
+		for _, strategy := range defaultStrategies {
+			available[strategy.Name] = strategy
+		}
+		custom := make([]CandidateStrategy, 0, len(rules))
+		for _, rule := range rules {
+			if _, exists := available[rule.Name]; exists {
+				return fmt.Errorf("sidecar rule %q: name is already used", rule.Name)
+			}
+			strategy, err := PatternStrategy(rule.Name, rule.Pattern, rule.JSON)
+			if err != nil {
+				return fmt.Errorf("sidecar rule %q: %w", rule.Name, err)
+			}
+			available[rule.Name] = strategy
+			custom = append(custom, strategy)
+		}
+
+		if len(order) == 0 {
+			if len(custom) > 0 {
+				p.candidateStrategies = append(DefaultCandidateStrategies(), custom...)
+			}
+			return nil
+		}
+
+		chain := make([]CandidateStrategy, 0, len(order)+len(custom))
+		used := make(map[string]bool)
+		for _, name := range order {
+			strategy, ok := available[name]
+			if !ok {
+				return fmt.Errorf("unknown sidecar strategy %q", name)
+			}
+			if used[name] {
+				continue
+			}
+			used[name] = true
+			chain = append(chain, strategy)
+		}
+		for _, strategy := range custom {
+			if !used[strategy.Name] {
+				chain = append(chain, strategy)
+			}
+		}
+		p.candidateStrategies = chain
+		return nil
+	}
+}
+
+// jsonCandidates returns the possible sidecar paths for a media file in the order
+// they should be tried, without duplicates
+func jsonCandidates(mediaPath string, strategies []CandidateStrategy) []jsonCandidate {
+	if len(strategies) == 0 {
+		strategies = defaultStrategies
+	}
+	dir, name := filepath.Split(mediaPath)
+	seen := make(map[string]bool)
+	var candidates []jsonCandidate
+	for _, strategy := range strategies {
+		for _, candidate := range strategy.Generate(name) {
+			if candidate == name || seen[candidate] {
+				continue
+			}
+			seen[candidate] = true
+			candidates = append(candidates, jsonCandidate{Path: dir + candidate, Rule: strategy.Name})
+		}
+	}
+	return candidates
+}
+
+// matchSidecar returns the first candidate for which exists reports true
+func matchSidecar(mediaPath string, strategies []CandidateStrategy, exists func(string) bool) (jsonCandidate, bool) {
+	for _, candidate := range jsonCandidates(mediaPath, strategies) {
+		if exists(candidate.Path) {
+			return candidate, true
+		}
+	}
+	return jsonCandidate{}, false
+}
+
+// withSuffixes returns stem+number+".json" preceded by the full and every truncated
+// form of the supplemental suffix, longest first
+func withSuffixes(stem, number string) []string {
+	candidates := []string{stem + number + ".json"}
+	for n := len(supplementalSuffix); n >= 2; n-- {
+		candidates = append(candidates, stem+supplementalSuffix[:n]+number+".json")
+	}
+	return candidates
+}
+
+// splitDuplicateNumber removes a single "(n)" from the name, returning the name
+// without it and the number. Names with no or several numbers are not duplicates.
+func splitDuplicateNumber(name string) (string, string, bool) {
+	matches := duplicateNumber.FindAllString(name, -1)
+	if len(matches) != 1 {
+		return "", "", false
+	}
+	return strings.Replace(name, matches[0], "", 1), matches[0], true
+}
+
+// stripEditedSuffix removes a localized "-edited" marker before the extension
+func stripEditedSuffix(name string) (string, bool) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for _, suffix := range editedSuffixes {
+		if strings.HasSuffix(strings.ToLower(stem), suffix) {
+			return stem[:len(stem)-len(suffix)] + ext, true
+		}
+	}
+	return "", false
+}
+
+// truncateName cuts name to at most n bytes without splitting a UTF-8 sequence
+func truncateName(name string, n int) string {
+	if len(name) <= n {
+		return name
+	}
+	for n > 0 && !isRuneStart(name[n]) {
+		n--
+	}
+	return name[:n]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// checkSupplementalData finds the JSON sidecar of a media file and the strategy that
+// matched it. Errors other than a missing file stop the search and are returned with
+// the offending path.
+func (p *Processor) checkSupplementalData(mediaPath string) (os.FileInfo, string, string, error) {
+	var info os.FileInfo
+	var err error
+	candidate, ok := matchSidecar(mediaPath, p.activeStrategies(), func(path string) bool {
+		info, err = os.Stat(path)
+		return err == nil || !os.IsNotExist(err)
+	})
+	if ok {
+		return info, candidate.Path, candidate.Rule, err
+	}
+	if mirror, ok := p.mirrorPath(mediaPath); ok {
+		candidate, ok = matchSidecar(mirror, p.activeStrategies(), func(path string) bool {
+			info, err = os.Stat(path)
+			return err == nil || !os.IsNotExist(err)
+		})
+		if ok {
+			return info, candidate.Path, jsonRootPrefix + candidate.Rule, err
+		}
+	}
+
+	// Report the conventional name when nothing matched
+	jsonPath := mediaPath + ".json"
+	info, err = os.Stat(jsonPath)
+	return info, jsonPath, MatchNone, err
+}
@@ -0,0 +1,179 @@
+package processor
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"google-takeout-exif-applier/internal/config"
+)
+
+// Names observed in real Takeout exports: the media file, the sidecars present in
+// its folder, and the sidecar it must be matched to
+var observedNames = []struct {
+	media    string
+	present  []string
+	wantJSON string
+	wantRule string
+}{
+	{"IMG_1234.jpg", []string{"IMG_1234.jpg.json"}, "IMG_1234.jpg.json", "exact"},
+	{"IMG_1234.jpg", []string{"IMG_1234.json"}, "IMG_1234.json", "replaced-extension"},
+	{"IMG_1234.JPG", []string{"IMG_1234.JPG.supplemental-metadata.json"}, "IMG_1234.JPG.supplemental-metadata.json", "exact"},
+	{"PXL_20230405_123456789.jpg", []string{"PXL_20230405_123456789.jpg.supplemental-metad.json"}, "PXL_20230405_123456789.jpg.supplemental-metad.json", "truncated-suffix"},
+	{"PXL_20230405_123456789.MP.jpg", []string{"PXL_20230405_123456789.MP.jpg.supplemental-me.json"}, "PXL_20230405_123456789.MP.jpg.supplemental-me.json", "truncated-suffix"},
+	{"Screenshot_20200101-101010_Chrome.jpg", []string{"Screenshot_20200101-101010_Chrome.jpg.s.json"}, "Screenshot_20200101-101010_Chrome.jpg.s.json", "truncated-suffix"},
+	{"IMG_1234(1).jpg", []string{"IMG_1234.jpg(1).json"}, "IMG_1234.jpg(1).json", "numbered-duplicate"},
+	{"IMG_1234(2).jpg", []string{"IMG_1234.jpg.supplemental-metadata(2).json"}, "IMG_1234.jpg.supplemental-metadata(2).json", "numbered-duplicate"},
+	{"IMG_1234(1).jpg", []string{"IMG_1234.jpg.supplemental-metad(1).json"}, "IMG_1234.jpg.supplemental-metad(1).json", "numbered-duplicate"},
+	{"IMG_1234(1).jpg", []string{"IMG_1234(1).jpg.json"}, "IMG_1234(1).jpg.json", "exact"},
+	{"IMG_1234(1).jpg", []string{"IMG_1234.jpg(1).json", "IMG_1234(1).jpg.json"}, "IMG_1234.jpg(1).json", "numbered-duplicate"},
+	{"Holiday (1) (2).jpg", []string{"Holiday (1) (2).jpg.json"}, "Holiday (1) (2).jpg.json", "exact"},
+	{"IMG_1234-edited.jpg", []string{"IMG_1234.jpg.json"}, "IMG_1234.jpg.json", "edited"},
+	{"IMG_1234-bearbeitet.jpg", []string{"IMG_1234.jpg.supplemental-metadata.json"}, "IMG_1234.jpg.supplemental-metadata.json", "edited"},
+	{"IMG_1234(1)-edited.jpg", []string{"IMG_1234.jpg(1).json"}, "IMG_1234.jpg(1).json", "edited"},
+	{"IMG_1234-edited.jpg", []string{"IMG_1234-edited.jpg.json", "IMG_1234.jpg.json"}, "IMG_1234-edited.jpg.json", "exact"},
+	{"original_a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6_P.jpg", []string{"original_a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6_P.jp.json"}, "original_a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6_P.jp.json", "truncated-name"},
+	{"20190612_183004_very_long_name_from_camera.jpg", []string{"20190612_183004_very_long_name_from_camera.jpg.json"}, "20190612_183004_very_long_name_from_camera.jpg.json", "exact"},
+	{"IMG_1234.HEIC.jpg", []string{"IMG_1234.HEIC.json"}, "IMG_1234.HEIC.json", "replaced-extension"},
+	{"IMG_1234.HEIC.jpg", []string{"IMG_1234.HEIC.supplemental-metadata.json"}, "IMG_1234.HEIC.supplemental-metadata.json", "double-extension"},
+	{"IMG_1234.jpg.jpg", []string{"IMG_1234.jpg.supplemental-metadata.json"}, "IMG_1234.jpg.supplemental-metadata.json", "double-extension"},
+	{"MVIMG_20191231_235959.jpg", nil, "", ""},
+}
+
+func TestMatchSidecarObservedNames(t *testing.T) {
+	dir := filepath.Join("Takeout", "Google Photos", "Photos from 2020")
+	for _, tc := range observedNames {
+		t.Run(tc.media, func(t *testing.T) {
+			present := make(map[string]bool)
+			for _, name := range tc.present {
+				present[filepath.Join(dir, name)] = true
+			}
+			got, ok := matchSidecar(filepath.Join(dir, tc.media), nil, func(path string) bool { return present[path] })
+
+			if tc.wantJSON == "" {
+				if ok {
+					t.Fatalf("matched %s (%s), want no match", got.Path, got.Rule)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no match, want %s", tc.wantJSON)
+			}
+			if want := filepath.Join(dir, tc.wantJSON); got.Path != want || got.Rule != tc.wantRule {
+				t.Errorf("matched %s (%s), want %s (%s)", got.Path, got.Rule, want, tc.wantRule)
+			}
+		})
+	}
+}
+
+// Every candidate must stay in the media file's folder, end in ".json", be unique and
+// never be the media file itself, whatever the name looks like
+func TestJSONCandidatesProperties(t *testing.T) {
+	stems := []string{"IMG_1234", "a", "(1)", "x(12)y", "Holiday (1) (2)", "photo-edited", "photo(3)-Bearbeitet",
+		"été à Paris", strings.Repeat("long_", 12), strings.Repeat("é", 30), ".hidden", "no.dots.here"}
+	exts := []string{".jpg", ".JPG", ".heic", ".jpg.jpg", ".HEIC.jpg", ""}
+	dir := filepath.Join("root", "album")
+
+	for _, stem := range stems {
+		for _, ext := range exts {
+			mediaPath := filepath.Join(dir, stem+ext)
+			candidates := jsonCandidates(mediaPath, nil)
+			if len(candidates) == 0 {
+				t.Errorf("%s: no candidates", mediaPath)
+			}
+			seen := make(map[string]bool)
+			for _, c := range candidates {
+				if filepath.Dir(c.Path) != dir {
+					t.Errorf("%s: candidate %s leaves the folder", mediaPath, c.Path)
+				}
+				if !strings.HasSuffix(c.Path, ".json") {
+					t.Errorf("%s: candidate %s is not a JSON file", mediaPath, c.Path)
+				}
+				if c.Path == mediaPath {
+					t.Errorf("%s: candidate is the media file itself", mediaPath)
+				}
+				if seen[c.Path] {
+					t.Errorf("%s: duplicate candidate %s", mediaPath, c.Path)
+				}
+				if !utf8.ValidString(c.Path) {
+					t.Errorf("%s: candidate %q is not valid UTF-8", mediaPath, c.Path)
+				}
+				seen[c.Path] = true
+			}
+		}
+	}
+}
+
+// The candidate order must not depend on anything but the name
+func TestJSONCandidatesDeterministic(t *testing.T) {
+	first := jsonCandidates("IMG_1234(1)-edited.HEIC.jpg", nil)
+	for i := 0; i < 10; i++ {
+		again := jsonCandidates("IMG_1234(1)-edited.HEIC.jpg", nil)
+		if len(again) != len(first) {
+			t.Fatalf("candidate count changed: %d != %d", len(again), len(first))
+		}
+		for j := range first {
+			if again[j] != first[j] {
+				t.Fatalf("candidate %d changed: %v != %v", j, again[j], first[j])
+			}
+		}
+	}
+}
+
+func TestWithSidecarMatching(t *testing.T) {
+	rules := []config.SidecarRule{
+		{Name: "burst", Pattern: `^(.+)_BURST\d+(\.[^.]+)$`, JSON: "${1}${2}.json"},
+	}
+	tests := []struct {
+		order   []string
+		media   string
+		present string
+		want    []string // Strategy names in chain order
+		wantErr bool
+	}{
+		{order: nil, media: "IMG_BURST001.jpg", present: "IMG.jpg.json",
+			want: append(strategyNames(defaultStrategies), "burst")},
+		{order: []string{"burst", "exact"}, media: "IMG_BURST001.jpg", present: "IMG.jpg.json",
+			want: []string{"burst", "exact"}},
+		{order: []string{"exact"}, media: "IMG_BURST001.jpg", present: "IMG.jpg.json",
+			want: []string{"exact", "burst"}},
+		{order: []string{"exact", "missing"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		p := &Processor{}
+		err := WithSidecarMatching(tc.order, rules)(p)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("order %v: expected an error", tc.order)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("order %v: %v", tc.order, err)
+		}
+		if got := strategyNames(p.candidateStrategies); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("order %v: chain %v, want %v", tc.order, got, tc.want)
+		}
+		got, ok := matchSidecar(tc.media, p.candidateStrategies, func(path string) bool { return path == tc.present })
+		if !ok || got.Rule != "burst" {
+			t.Errorf("order %v: matched %v, want the burst rule", tc.order, got)
+		}
+	}
+
+	if err := WithSidecarMatching(nil, []config.SidecarRule{{Name: "exact", Pattern: ".", JSON: "x.json"}})(&Processor{}); err == nil {
+		t.Error("expected an error for a rule shadowing a built-in strategy")
+	}
+	if err := WithSidecarMatching(nil, []config.SidecarRule{{Name: "bad", Pattern: "(", JSON: "x.json"}})(&Processor{}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func strategyNames(strategies []CandidateStrategy) []string {
+	names := make([]string, 0, len(strategies))
+	for _, strategy := range strategies {
+		names = append(names, strategy.Name)
+	}
+	return names
+}
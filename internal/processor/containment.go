@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// roots returns the root directory followed by the merged export roots
+func (p *Processor) roots() []string {
+	return append([]string{p.rootDir}, p.mergeRoots...)
+}
+
+// checkDirs refuses an output, quarantine, reorganize, relocated library or partner
+// directory inside one of the export roots, and an export root inside the relocated library.
+// New calls it once every option is applied, so the merged export roots are known.
+func (p *Processor) checkDirs() error {
+	var reorganizeDir string
+	if hasStep(p.pipeline.Steps, StageReorganize) {
+		reorganizeDir = p.pipeline.Dir
+	}
+	dirs := []struct{ name, path string }{
+		{"output directory", p.outputDir},
+		{"quarantine directory", p.quarantineDir},
+		{"reorganize directory", reorganizeDir},
+		{"library directory", p.relocatedDir},
+		{"partner directory", p.partnerOpts.OutputDir},
+	}
+	for _, root := range p.roots() {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return fmt.Errorf("failed to resolve export directory: %w", err)
+		}
+		for _, dir := range dirs {
+			if dir.path == "" {
+				continue
+			}
+			if _, inside := relInside(root, dir.path); inside {
+				return fmt.Errorf("%s %s is inside the export %s", dir.name, dir.path, root)
+			}
+		}
+		if p.relocatedDir != "" {
+			if _, inside := relInside(p.relocatedDir, root); inside {
+				return fmt.Errorf("the export %s is inside the library directory %s", root, p.relocatedDir)
+			}
+		}
+	}
+	return nil
+}
+
+// realRoots returns the root directories and the JSON root with symlinks resolved
+func (p *Processor) realRoots() []string {
+	p.rootOnce.Do(func() {
+		roots := p.roots()
+		if p.jsonRoot != "" {
+			roots = append(roots, p.jsonRoot)
+		}
+		for _, root := range roots {
+			real := root
+			if resolved, err := filepath.EvalSymlinks(root); err == nil {
+				real = resolved
+			}
+			p.rootReals = append(p.rootReals, real)
+		}
+	})
+	return p.rootReals
+}
+
+// isContained reports whether path, after resolving symlinks and junctions, is inside a root
+func (p *Processor) isContained(path string) bool {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	for _, root := range p.realRoots() {
+		if _, ok := relInside(root, real); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// relPath returns path relative to the root it was found under. Sidecars in the
+// JSON root are relative to it, as if they were next to their media files.
+func (p *Processor) relPath(path string) (string, error) {
+	for _, root := range p.mergeRoots {
+		if rel, ok := relInside(root, path); ok {
+			return rel, nil
+		}
+	}
+	if p.jsonRoot != "" {
+		if rel, ok := relInside(p.jsonRoot, path); ok {
+			return rel, nil
+		}
+	}
+	return filepath.Rel(p.rootDir, path)
+}
+
+// relInside returns path relative to root when it does not leave root
+func relInside(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// checkContainment records an escape and returns false when path resolves outside the root
+func (p *Processor) checkContainment(mediaPath, path string) bool {
+	if p.isContained(path) {
+		return true
+	}
+	target, _ := filepath.EvalSymlinks(path)
+	p.warn(path, "Skipping %s: resolves outside the Takeout root (%s)", path, target)
+	p.update(func(s *Statistics) { s.Escapes = append(s.Escapes, fmt.Sprintf("  %s -> %s", path, target)) })
+	p.recordSkip(FileResult{Path: mediaPath, Message: "resolves outside the Takeout root"}, SkipOutsideRoot)
+	return false
+}
+
+// isRootDir reports whether dir is the root or one of the merged export roots
+func (p *Processor) isRootDir(dir string) bool {
+	rel, err := p.relPath(dir)
+	return err == nil && rel == "."
+}
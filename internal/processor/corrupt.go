@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// WithQuarantineDir moves media files found empty or cut off (see
+// metadata.CheckIntegrity) under dir, keeping their path relative to the export, so
+// they can be downloaded again. In output mode they are copied there instead, since
+// the export is never changed. Their sidecars stay where they are. Without a
+// quarantine directory such files are only counted and skipped.
+func WithQuarantineDir(dir string) Option {
+	return func(p *Processor) error {
+		if dir == "" {
+			p.quarantineDir = ""
+			return nil
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve quarantine directory: %w", err)
+		}
+		p.quarantineDir = abs
+		return nil
+	}
+}
+
+// skipCorrupt checks the file a job is about to write (or copy) and, when it is empty
+// or truncated, records it as corrupt and quarantines it. It reports whether the job
+// must stop there.
+func (p *Processor) skipCorrupt(job fileJob, source string) bool {
+	err := metadata.CheckIntegrity(source)
+	if !errors.Is(err, metadata.ErrCorruptFile) {
+		return false // Unreadable files are reported by the writers
+	}
+	p.counters.corruptFiles.Add(1)
+	fmt.Printf("[CORRUPT] %s: %v\n", source, err)
+	result := FileResult{Path: job.mediaPath, JSONPath: job.jsonPath, Message: err.Error(), Err: err}
+	if p.quarantineDir != "" {
+		if target, qErr := p.quarantine(job.mediaPath, source); qErr != nil {
+			p.warn(source, "Failed to quarantine %s: %v", source, qErr)
+		} else {
+			result.Output = target
+		}
+	}
+	p.recordSkip(result, SkipCorrupt)
+	return true
+}
+
+// quarantine moves (in output mode copies) a corrupt file under the quarantine
+// directory and returns its new path
+func (p *Processor) quarantine(mediaPath, source string) (string, error) {
+	rel, err := p.relPath(mediaPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute relative path: %w", err)
+	}
+	target := filepath.Join(p.quarantineDir, rel)
+	if p.dryRun {
+		fmt.Printf("[DRY-RUN] Would quarantine %s to %s\n", source, target)
+		return target, nil
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		return "", fmt.Errorf("%s already exists", target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if p.outputDir != "" {
+		err = p.copyVerified(source, target)
+	} else {
+		err = p.moveFile(source, target)
+	}
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("[CORRUPT] Quarantined %s\n", target)
+	return target, nil
+}
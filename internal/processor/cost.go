@@ -0,0 +1,174 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// maxSampleVideoSize keeps the cost sampling from copying huge videos
+const maxSampleVideoSize = 512 << 20
+
+// CostEstimate is the expected duration of a real run, derived from timing the
+// metadata write on copies of a few sampled files
+type CostEstimate struct {
+	ImageFiles      int           // Images that would be written
+	VideoFiles      int           // Videos that would be written
+	VideoBytes      int64         // Total size of those videos
+	ImageSamples    int           // Images timed
+	VideoSamples    int           // Videos timed
+	ImageCost       time.Duration // Average time per image write
+	VideoThroughput float64       // Bytes per second for video writes (remux or sidecar)
+	Workers         int
+	Total           time.Duration // Estimated wall time with all workers busy
+}
+
+// EstimateCost times the metadata write for up to samplesPerType images and videos,
+// using temporary copies so nothing in the tree is touched, and extrapolates the
+// duration of a real run. Scan is run first if needed.
+func (p *Processor) EstimateCost(ctx context.Context, samplesPerType int) (*CostEstimate, error) {
+	defer metadata.RemoveExiftoolConfig()
+	if _, err := p.Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	var images, videos []fileJob
+	est := &CostEstimate{Workers: p.workerCount}
+	if p.maxWorkers > 0 {
+		est.Workers = p.maxWorkers
+	}
+	for _, job := range p.jobs {
+		if job.jsonErr != nil || job.jsonInfo.IsDir() {
+			continue
+		}
+		if p.maxVideoSize > 0 && job.size > p.maxVideoSize && isVideoFile(job.mediaPath) {
+			continue // Skipped as too large
+		}
+		if isVideoFile(job.mediaPath) {
+			est.VideoFiles++
+			est.VideoBytes += job.size
+			videos = append(videos, job)
+		} else {
+			est.ImageFiles++
+			images = append(images, job)
+		}
+	}
+	if est.ImageFiles == 0 && est.VideoFiles == 0 {
+		return est, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "takeout-cost-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sampling directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var imageTime, videoTime time.Duration
+	var videoSampleBytes int64
+	for _, job := range spreadSample(images, samplesPerType) {
+		if d, ok := p.timeSample(ctx, job, tmpDir); ok {
+			imageTime += d
+			est.ImageSamples++
+		}
+	}
+	for _, job := range spreadSample(videos, samplesPerType) {
+		if job.size > maxSampleVideoSize {
+			continue
+		}
+		if d, ok := p.timeSample(ctx, job, tmpDir); ok {
+			videoTime += d
+			videoSampleBytes += job.size
+			est.VideoSamples++
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("cost estimate interrupted: %w", err)
+	}
+
+	var serial time.Duration
+	if est.ImageSamples > 0 {
+		est.ImageCost = imageTime / time.Duration(est.ImageSamples)
+		serial += est.ImageCost * time.Duration(est.ImageFiles)
+	}
+	if est.VideoSamples > 0 && videoTime > 0 {
+		est.VideoThroughput = float64(videoSampleBytes) / videoTime.Seconds()
+		serial += time.Duration(float64(est.VideoBytes) / est.VideoThroughput * float64(time.Second))
+	}
+	est.Total = serial / time.Duration(est.Workers)
+	return est, nil
+}
+
+// spreadSample picks up to n jobs spread evenly over the list
+func spreadSample(jobs []fileJob, n int) []fileJob {
+	if len(jobs) <= n {
+		return jobs
+	}
+	sample := make([]fileJob, 0, n)
+	for i := 0; i < n; i++ {
+		sample = append(sample, jobs[i*len(jobs)/n])
+	}
+	return sample
+}
+
+// timeSample applies the job's metadata to a temporary copy of its media file and
+// returns how long the write took
+func (p *Processor) timeSample(ctx context.Context, job fileJob, tmpDir string) (time.Duration, bool) {
+	if ctx.Err() != nil {
+		return 0, false
+	}
+	meta := job.meta
+	if meta == nil {
+		var err error
+		if meta, err = p.metaCache.ParseJSON(job.jsonPath); err != nil {
+			return 0, false
+		}
+	}
+
+	sampleDir, err := os.MkdirTemp(tmpDir, "sample-")
+	if err != nil {
+		return 0, false
+	}
+	defer os.RemoveAll(sampleDir)
+	copyPath := filepath.Join(sampleDir, filepath.Base(job.mediaPath))
+	if err := copyFile(job.mediaPath, copyPath); err != nil {
+		return 0, false
+	}
+
+	started := time.Now()
+	if _, err := metadata.ApplyToFile(ctx, copyPath, meta, p.applyOpts); err != nil {
+		if p.verbose {
+			fmt.Printf("[COST] Sample write failed for %s: %v\n", job.mediaPath, err)
+		}
+		return 0, false
+	}
+	elapsed := time.Since(started)
+	if p.verbose {
+		fmt.Printf("[COST] %s: %v\n", job.mediaPath, elapsed.Round(time.Millisecond))
+	}
+	return elapsed, true
+}
+
+// copyFile copies src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
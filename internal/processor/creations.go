@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// creationPattern matches the names Google Photos gives the collages, animations and
+// stylized photos it creates from a user's photos, such as IMG_1234-COLLAGE.jpg or
+// 20190704_183012-ANIMATION.gif, with an optional duplicate number
+var creationPattern = regexp.MustCompile(`-(COLLAGE|ANIMATION|EFFECTS|MIX)(?:\(\d+\))?$`)
+
+// CreationKeyword is the keyword added to Google Photos creations with -tag-creations
+const CreationKeyword = "Google Photos creation"
+
+// WithTagCreations adds CreationKeyword to the collages, animations and effects Google
+// Photos created, so they can be filtered out of a library. They are always
+// processed like other media and listed in the summary and report either way.
+func WithTagCreations(enabled bool) Option {
+	return func(p *Processor) error {
+		p.tagCreations = enabled
+		return nil
+	}
+}
+
+// creationKind returns the kind of Google Photos creation a media file is
+// ("collage", "animation", "effects" or "mix"), or "" for an ordinary photo or video.
+// Renamed creations are still recognized by the composition origin in their sidecar,
+// when meta is given.
+func creationKind(path string, meta *metadata.Metadata) string {
+	name := filepath.Base(path)
+	if m := creationPattern.FindStringSubmatch(strings.TrimSuffix(name, filepath.Ext(name))); m != nil {
+		return strings.ToLower(m[1])
+	}
+	if meta != nil && meta.Origin.Composition != nil {
+		if kind := strings.ToLower(meta.Origin.Composition.Type); kind != "" {
+			return kind
+		}
+		return "composition"
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// descriptionValues are what the placeholders of a description template are filled from
+type descriptionValues struct {
+	meta      *metadata.Metadata
+	photoTime time.Time // Zero when the file has no usable photo time
+	album     string
+	filename  string
+}
+
+// descriptionFields render the placeholders of a description template
+var descriptionFields = map[string]func(v descriptionValues) string{
+	"description": func(v descriptionValues) string { return v.meta.Description },
+	"title":       func(v descriptionValues) string { return v.meta.Title },
+	"album":       func(v descriptionValues) string { return v.album },
+	"filename":    func(v descriptionValues) string { return v.filename },
+	"people":      func(v descriptionValues) string { return strings.Join(v.meta.People, ", ") },
+	"date":        func(v descriptionValues) string { return photoTimeFormat(v.photoTime, "2006-01-02") },
+	"yyyy":        func(v descriptionValues) string { return photoTimeFormat(v.photoTime, "2006") },
+	"mm":          func(v descriptionValues) string { return photoTimeFormat(v.photoTime, "01") },
+	"dd":          func(v descriptionValues) string { return photoTimeFormat(v.photoTime, "02") },
+}
+
+// descriptionTrim is what is trimmed from the ends of an expanded description, so the
+// separators next to an empty placeholder don't dangle
+const descriptionTrim = " \t-–—|,;:·"
+
+// photoTimeFormat formats the photo time, "" when there is none
+func photoTimeFormat(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// WithDescriptionTemplate writes the description from a template instead of the JSON
+// description as it is, e.g. "{description} — imported from Google Photos {album}".
+// The fields are {description}, {title}, {album}, {filename}, {people}, {date},
+// {yyyy}, {mm} and {dd}; empty ones leave out the separators around them at the ends
+// of the text, and a template expanding to nothing leaves the description empty. An
+// empty template writes the description unchanged.
+func WithDescriptionTemplate(template string) Option {
+	return func(p *Processor) error {
+		for _, match := range templateField.FindAllStringSubmatch(template, -1) {
+			if _, ok := descriptionFields[match[1]]; !ok {
+				return fmt.Errorf("unknown field %s in description template", match[0])
+			}
+		}
+		p.descriptionTemplate = template
+		return nil
+	}
+}
+
+// applyDescriptionTemplate replaces the description of a media file's metadata with
+// the expanded description template
+func (p *Processor) applyDescriptionTemplate(mediaPath string, meta *metadata.Metadata) {
+	if p.descriptionTemplate == "" {
+		return
+	}
+	values := descriptionValues{
+		meta:     meta,
+		album:    p.albumTitle(filepath.Dir(mediaPath)),
+		filename: filepath.Base(mediaPath),
+	}
+	if t, err := meta.GetPhotoTime(); err == nil {
+		values.photoTime = t
+	}
+	expanded := templateField.ReplaceAllStringFunc(p.descriptionTemplate, func(field string) string {
+		return descriptionFields[field[1:len(field)-1]](values)
+	})
+	meta.Description = strings.Trim(expanded, descriptionTrim+"\r\n")
+}
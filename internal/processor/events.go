@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Event types sent on the Events channel
+const (
+	EventFileStarted = "file-started" // A worker picked up a media file
+	EventFileDone    = "file-done"    // A media file has its final FileResult, whatever the status
+	EventWarning     = "warning"      // Something was ignored or could not be cleaned up; the run goes on
+	EventError       = "error"        // A media file failed; also sent as EventFileDone
+)
+
+// eventBufferSize lets workers run ahead of a slow subscriber for a while
+const eventBufferSize = 256
+
+// Event is one step of a run, for front-ends that show progress without parsing stdout
+type Event struct {
+	Type    string
+	Time    time.Time
+	Path    string      // Media file, or the file a warning is about
+	Result  *FileResult // Outcome of the file for EventFileDone and EventError
+	Message string      // Human-readable text of a warning or error
+	Err     error       // Cause of an error, for errors.Is/As
+}
+
+// Events returns a channel receiving the progress of Scan and Process. It must be
+// called before the run starts and drained until it is closed, which happens when
+// Process returns; workers wait when its buffer is full. Once the run's context is
+// cancelled, events the subscriber doesn't take right away are dropped, so a
+// subscriber that stops reading can't hold the run up. Without a call to Events no
+// events are sent.
+func (p *Processor) Events() <-chan Event {
+	p.eventsOnce.Do(func() {
+		p.events = make(chan Event, eventBufferSize)
+		p.eventsStop = make(chan struct{})
+	})
+	return p.events
+}
+
+// emit sends an event to the subscriber, if there is one and the channel is open
+func (p *Processor) emit(event Event) {
+	if p.events == nil {
+		return
+	}
+	event.Time = time.Now()
+	p.eventsMutex.RLock()
+	defer p.eventsMutex.RUnlock()
+	if p.eventsClosed {
+		return
+	}
+	select {
+	case p.events <- event:
+		return
+	default:
+	}
+	select {
+	case p.events <- event:
+	case <-p.eventsStop:
+	}
+}
+
+// stopEvents stops senders from waiting for the subscriber
+func (p *Processor) stopEvents() {
+	if p.events != nil {
+		p.eventsStopOnce.Do(func() { close(p.eventsStop) })
+	}
+}
+
+// watchEvents stops senders from waiting for the subscriber once ctx is cancelled; the
+// returned function undoes it at the end of the run
+func (p *Processor) watchEvents(ctx context.Context) func() bool {
+	return context.AfterFunc(ctx, p.stopEvents)
+}
+
+// closeEvents closes the Events channel at the end of Process. Senders still waiting
+// are released first; later events are dropped.
+func (p *Processor) closeEvents() {
+	if p.events == nil {
+		return
+	}
+	p.stopEvents()
+	p.eventsMutex.Lock()
+	defer p.eventsMutex.Unlock()
+	if !p.eventsClosed {
+		p.eventsClosed = true
+		close(p.events)
+	}
+}
+
+// warn logs a warning and sends it as an EventWarning
+func (p *Processor) warn(path, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	fmt.Printf("[WARN] %s\n", message)
+	p.emit(Event{Type: EventWarning, Path: path, Message: message})
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+func TestEventsClosedOnCancel(t *testing.T) {
+	dir := t.TempDir()
+	// More events than the channel buffers, so the worker ends up waiting on it
+	writeTakeoutPhotos(t, dir, eventBufferSize)
+	p, err := New(dir, WithApplyOptions(metadata.ApplyOptions{Writer: metadata.WriterNative}), WithWorkerCount(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := p.Events()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type outcome struct {
+		stats Statistics
+		err   error
+	}
+	finished := make(chan outcome, 1)
+	go func() {
+		stats, err := p.Process(ctx)
+		finished <- outcome{stats, err}
+	}()
+
+	// A subscriber that stops reading holds the run up until it is cancelled
+	deadline := time.Now().Add(10 * time.Second)
+	for len(events) < cap(events) {
+		if time.Now().After(deadline) {
+			t.Fatal("the event buffer never filled up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-finished:
+		t.Fatal("the run finished without its events being read")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+
+	var result outcome
+	select {
+	case result = <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the run still waits on the subscriber after being cancelled")
+	}
+	if !errors.Is(result.err, context.Canceled) {
+		t.Errorf("cancelled run returned %v, want context.Canceled", result.err)
+	}
+
+	// The events sent before the cancel are still there, then the channel is closed
+	var received, done int
+	for event := range events {
+		received++
+		if event.Type == EventFileDone {
+			done++
+		}
+	}
+	if received < eventBufferSize {
+		t.Errorf("%d events received, want the %d buffered ones", received, eventBufferSize)
+	}
+	if processed := len(result.stats.Files); done > processed {
+		t.Errorf("%d file-done events for %d files processed", done, processed)
+	}
+}
@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ReadFileList reads one media path per line from r, ignoring blank lines and
+// lines starting with "#"
+func ReadFileList(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+	return paths, nil
+}
+
+// WithFileList makes Scan process only the given media paths instead of walking the
+// root directory. Relative paths are resolved against the current directory, then the root.
+func WithFileList(paths []string) Option {
+	return func(p *Processor) error {
+		p.fileList = paths
+		if p.fileList == nil {
+			p.fileList = []string{}
+		}
+		return nil
+	}
+}
+
+// RetryItem is a media file to re-process together with the sidecar it was matched to
+type RetryItem struct {
+	MediaPath string
+	JSONPath  string // Empty to resolve the sidecar again
+}
+
+// WithRetryItems makes Scan process only the given media files, reusing their previous
+// sidecar match instead of searching again
+func WithRetryItems(items []RetryItem) Option {
+	return func(p *Processor) error {
+		paths := make([]string, 0, len(items))
+		p.presetSidecars = make(map[string]string, len(items))
+		for _, item := range items {
+			paths = append(paths, item.MediaPath)
+			if item.JSONPath != "" {
+				if abs, err := filepath.Abs(item.MediaPath); err == nil {
+					p.presetSidecars[abs] = item.JSONPath
+				}
+			}
+		}
+		return WithFileList(paths)(p)
+	}
+}
+
+// resolveSidecar returns the sidecar for a media file and how it was matched,
+// preferring a preset match. With a manifest, sidecars are not used.
+func (p *Processor) resolveSidecar(mediaPath string) (os.FileInfo, string, string, error) {
+	defer func(started time.Time) { p.lookupTime += time.Since(started) }(time.Now())
+	if p.manifestPath != "" {
+		return nil, "", MatchNone, os.ErrNotExist
+	}
+	if jsonPath, ok := p.presetSidecars[mediaPath]; ok {
+		info, err := os.Stat(jsonPath)
+		return info, jsonPath, MatchPreviousRun, err
+	}
+	return p.checkSupplementalData(mediaPath)
+}
+
+// scanFileList collects the media files from the explicit file list
+func (p *Processor) scanFileList() {
+	for _, path := range p.fileList {
+		resolved, info, err := p.resolveListedPath(path)
+		if err != nil {
+			p.recordError()
+			fmt.Printf("[ERROR] Cannot access listed file %s: %v\n", path, err)
+			p.recordResult(FileResult{Path: path, Status: StatusError, Message: err.Error(), Err: err})
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		if !isSupportedMediaFile(resolved) {
+			p.counters.otherFiles.Add(1)
+			p.recordSkip(FileResult{Path: resolved, Message: "unsupported file type"}, SkipUnsupportedType)
+			continue
+		}
+		p.collectFile(resolved, info)
+	}
+}
+
+// resolveListedPath finds a listed path relative to the current directory or the root
+func (p *Processor) resolveListedPath(path string) (string, os.FileInfo, error) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = append(candidates, filepath.Join(p.rootDir, path))
+	}
+
+	var firstErr error
+	for _, candidate := range candidates {
+		abs, err := filepath.Abs(candidate)
+		if err != nil {
+			return "", nil, err
+		}
+		info, err := os.Stat(abs)
+		if err == nil {
+			return abs, info, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", nil, firstErr
+}
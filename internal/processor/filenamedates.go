@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"google-takeout-exif-applier/internal/config"
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Date sources of a filename date rule
+const (
+	DateSourceEXIF     = "exif"     // DateTimeOriginal embedded in the file
+	DateSourceFilename = "filename" // Date in the file name
+	DateSourceJSON     = "json"     // Photo time from the Takeout sidecar
+)
+
+// filenameDateRule is a compiled config.FilenameDateRule
+type filenameDateRule struct {
+	name    string
+	pattern *regexp.Regexp
+	sources []string
+}
+
+// DefaultFilenameDateRules returns the rules used when the config file has none:
+// WhatsApp (IMG-20190101-WA0001.jpg, VID-20190101-WA0001.mp4) and Telegram
+// (photo_2019-01-01_12-30-45.jpg) media, which carry no EXIF date
+func DefaultFilenameDateRules() []config.FilenameDateRule {
+	return []config.FilenameDateRule{
+		{Name: "whatsapp", Pattern: `^(?:IMG|VID|AUD|PTT|STK)-(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})-WA\d+`},
+		{Name: "telegram", Pattern: `^(?:photo|video)_(?P<year>\d{4})-(?P<month>\d{2})-(?P<day>\d{2})_(?P<hour>\d{2})-(?P<minute>\d{2})-(?P<second>\d{2})`},
+	}
+}
+
+// WithFilenameDateRules compiles the file name date rules from the config file; nil
+// rules mean DefaultFilenameDateRules and an empty list disables them. The first rule
+// matching a media file's name decides where its date comes from.
+func WithFilenameDateRules(rules []config.FilenameDateRule) Option {
+	return func(p *Processor) error {
+		if rules == nil {
+			rules = DefaultFilenameDateRules()
+		}
+		compiled := make([]filenameDateRule, 0, len(rules))
+		for _, rule := range rules {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("filename date rule %q: %w", rule.Name, err)
+			}
+			for _, group := range []string{"year", "month", "day"} {
+				if pattern.SubexpIndex(group) < 0 {
+					return fmt.Errorf("filename date rule %q: pattern has no %s group", rule.Name, group)
+				}
+			}
+			sources := rule.Sources
+			if len(sources) == 0 {
+				sources = []string{DateSourceEXIF, DateSourceFilename, DateSourceJSON}
+			}
+			for _, source := range sources {
+				switch source {
+				case DateSourceEXIF, DateSourceFilename, DateSourceJSON:
+				default:
+					return fmt.Errorf("filename date rule %q: unknown date source %q (expected %s, %s or %s)",
+						rule.Name, source, DateSourceEXIF, DateSourceFilename, DateSourceJSON)
+				}
+			}
+			compiled = append(compiled, filenameDateRule{name: rule.Name, pattern: pattern, sources: sources})
+		}
+		p.filenameDateRules = compiled
+		return nil
+	}
+}
+
+// applyFilenameDateRules takes the photo time from the first available source of the
+// first rule matching the file name. A name holding only a date keeps the JSON time
+// when it falls on that date (within a day either side for time zones), since the
+// sidecar then has the more precise time of day; otherwise noon of that date is used.
+func (p *Processor) applyFilenameDateRules(ctx context.Context, mediaPath string, meta *metadata.Metadata) {
+	name := filepath.Base(mediaPath)
+	for _, rule := range p.filenameDateRules {
+		m := rule.pattern.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		nameTime, timeOfDay, ok := rule.nameTime(m)
+		if !ok {
+			return
+		}
+		jsonTime, jsonErr := meta.GetPhotoTime()
+		for _, source := range rule.sources {
+			switch source {
+			case DateSourceEXIF:
+				if exifTime, ok := metadata.ReadEXIFTime(ctx, mediaPath); ok {
+					p.useFilenameDate(rule, mediaPath, meta, exifTime, "embedded EXIF date")
+					return
+				}
+			case DateSourceFilename:
+				if !timeOfDay && jsonErr == nil && jsonTime.After(nameTime.Add(-24*time.Hour)) && jsonTime.Before(nameTime.Add(48*time.Hour)) {
+					p.useFilenameDate(rule, mediaPath, meta, jsonTime, "JSON time on the file name's date")
+					return
+				}
+				if !timeOfDay {
+					nameTime = nameTime.Add(12 * time.Hour)
+				}
+				p.useFilenameDate(rule, mediaPath, meta, nameTime, "file name date")
+				return
+			case DateSourceJSON:
+				if jsonErr == nil {
+					return
+				}
+			}
+		}
+		return
+	}
+}
+
+// nameTime returns the date (and time, if the pattern has one) captured from a name
+func (r filenameDateRule) nameTime(m []string) (time.Time, bool, bool) {
+	field := func(group string) (int, bool) {
+		i := r.pattern.SubexpIndex(group)
+		if i < 0 || m[i] == "" {
+			return 0, false
+		}
+		n, err := strconv.Atoi(m[i])
+		return n, err == nil
+	}
+	year, _ := field("year")
+	month, _ := field("month")
+	day, _ := field("day")
+	hour, timeOfDay := field("hour")
+	minute, _ := field("minute")
+	second, _ := field("second")
+	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+	// Reject impossible dates such as 20191341 instead of letting time.Date normalize
+	// them, and numbers too early to be a date from these apps
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day || year < 1990 {
+		return time.Time{}, false, false
+	}
+	return t, timeOfDay, true
+}
+
+// useFilenameDate sets the photo time chosen by a filename date rule
+func (p *Processor) useFilenameDate(rule filenameDateRule, mediaPath string, meta *metadata.Metadata, t time.Time, reason string) {
+	meta.SetPhotoTime(t)
+	if p.verbose {
+		fmt.Printf("    Filename date rule %s: using the %s, %s, for %s\n", rule.name, reason, t.Format("2006-01-02 15:04:05"), filepath.Base(mediaPath))
+	}
+}
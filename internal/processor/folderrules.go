@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google-takeout-exif-applier/internal/config"
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// folderRule is a compiled config.FolderRule
+type folderRule struct {
+	segments []string // Glob per folder segment
+	date     time.Time
+	shift    TimeShift
+}
+
+// WithFolderRules compiles the per-folder date overrides and offsets from the config file.
+// The first rule whose folder matches a media file's directory (or one of its parents) wins.
+func WithFolderRules(rules []config.FolderRule) Option {
+	return func(p *Processor) error {
+		compiled := make([]folderRule, 0, len(rules))
+		for _, rule := range rules {
+			fr := folderRule{segments: strings.Split(strings.Trim(filepath.ToSlash(rule.Folder), "/"), "/")}
+			for _, segment := range fr.segments {
+				if _, err := path.Match(segment, ""); err != nil {
+					return fmt.Errorf("folder rule %q: %w", rule.Folder, err)
+				}
+			}
+			var err error
+			if rule.Date != "" {
+				fr.date, err = parseFixedDate(rule.Date)
+			} else {
+				fr.shift, err = ParseTimeShift(rule.Shift)
+			}
+			if err != nil {
+				return fmt.Errorf("folder rule %q: %w", rule.Folder, err)
+			}
+			compiled = append(compiled, fr)
+		}
+		p.folderRules = compiled
+		return nil
+	}
+}
+
+// matches reports whether the rule's folder pattern matches the leading segments of dir
+func (r folderRule) matches(dir []string) bool {
+	if len(dir) < len(r.segments) {
+		return false
+	}
+	for i, segment := range r.segments {
+		if matched, _ := path.Match(strings.ToLower(segment), strings.ToLower(dir[i])); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// applyFolderRules overrides or shifts the photo time for media in a matching folder
+func (p *Processor) applyFolderRules(mediaPath string, meta *metadata.Metadata) {
+	if len(p.folderRules) == 0 {
+		return
+	}
+	rel, err := p.relPath(filepath.Dir(mediaPath))
+	if err != nil {
+		return
+	}
+	dir := strings.Split(filepath.ToSlash(rel), "/")
+
+	for _, rule := range p.folderRules {
+		if !rule.matches(dir) {
+			continue
+		}
+		if !rule.date.IsZero() {
+			meta.SetPhotoTime(rule.date)
+		} else if photoTime, err := meta.GetPhotoTime(); err == nil {
+			meta.SetPhotoTime(rule.shift.Apply(photoTime))
+		}
+		if p.verbose {
+			photoTime, _ := meta.GetPhotoTime()
+			fmt.Printf("    Folder rule %s: using %s\n", strings.Join(rule.segments, "/"), photoTime.Format("2006-01-02 15:04:05"))
+		}
+		return
+	}
+}
@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Folder kinds reported by TakeInventory
+const (
+	FolderYear    = "year"    // "Photos from YYYY" and its localized forms
+	FolderAlbum   = "album"   // Has an album metadata file
+	FolderPartner = "partner" // Inside a "Partner sharing" folder
+)
+
+// ExtensionCount is the number and total size of files with one extension
+type ExtensionCount struct {
+	Files int
+	Bytes int64
+}
+
+// FolderInventory describes the files directly inside one folder
+type FolderInventory struct {
+	Path     string // Relative to the root
+	Kind     string // FolderYear, FolderAlbum, FolderPartner or empty
+	Media    int
+	Sidecars int
+	Other    int
+	Bytes    int64
+}
+
+// Inventory is a quick census of a Takeout tree, taken without matching any sidecar
+type Inventory struct {
+	Root       string
+	Files      int
+	Bytes      int64
+	MediaFiles int
+	ImageFiles int
+	VideoFiles int
+	Sidecars   int // JSON files other than album metadata
+	AlbumFiles int // Album metadata files
+	OtherFiles int
+	Extensions map[string]ExtensionCount // Lower-case extension ("" for none)
+	Folders    []FolderInventory         // Folders holding files, by path
+	Localized  map[string]int            // Localized folder prefixes and file names seen, with counts
+}
+
+// localizedPhotoRoots are the non-English names of the "Google Photos" export folder
+var localizedPhotoRoots = map[string]bool{
+	"Google Fotos":   true,
+	"Google Foto":    true,
+	"Google Zdjęcia": true,
+	"Google フォト":     true,
+}
+
+// TakeInventory walks root and counts its files by extension and folder. Nothing is
+// parsed or matched, so it is fast even on large exports.
+func TakeInventory(root string) (*Inventory, error) {
+	inv := &Inventory{
+		Root:       root,
+		Extensions: make(map[string]ExtensionCount),
+		Localized:  make(map[string]int),
+	}
+	folders := make(map[string]*FolderInventory)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if prefix := localizedYearPrefix(info.Name()); prefix != "" {
+				inv.Localized[prefix+" YYYY"]++
+			}
+			if localizedPhotoRoots[info.Name()] {
+				inv.Localized[info.Name()]++
+			}
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		folder := folders[dir]
+		if folder == nil {
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				rel = dir
+			}
+			folder = &FolderInventory{Path: filepath.ToSlash(rel), Kind: folderKind(rel)}
+			folders[dir] = folder
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		count := inv.Extensions[ext]
+		count.Files++
+		count.Bytes += info.Size()
+		inv.Extensions[ext] = count
+		inv.Files++
+		inv.Bytes += info.Size()
+		folder.Bytes += info.Size()
+
+		switch {
+		case isSupportedMediaFile(path):
+			inv.MediaFiles++
+			folder.Media++
+			if isVideoFile(path) {
+				inv.VideoFiles++
+			} else {
+				inv.ImageFiles++
+			}
+		case metadata.IsAlbumMetadataFile(path):
+			inv.AlbumFiles++
+			folder.Other++
+			if folder.Kind == "" {
+				folder.Kind = FolderAlbum
+			}
+			if info.Name() != "metadata.json" {
+				inv.Localized[info.Name()]++
+			}
+		case ext == ".json":
+			inv.Sidecars++
+			folder.Sidecars++
+		default:
+			inv.OtherFiles++
+			folder.Other++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, folder := range folders {
+		inv.Folders = append(inv.Folders, *folder)
+	}
+	sort.Slice(inv.Folders, func(i, j int) bool { return inv.Folders[i].Path < inv.Folders[j].Path })
+	return inv, nil
+}
+
+// folderKind classifies a folder by its own name and its parents
+func folderKind(rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for _, part := range parts {
+		if isPartnerFolderName(part) {
+			return FolderPartner
+		}
+	}
+	if yearFolder.MatchString(parts[len(parts)-1]) {
+		return FolderYear
+	}
+	return ""
+}
+
+// localizedYearPrefix returns the prefix of a non-English year folder name
+func localizedYearPrefix(name string) string {
+	if !yearFolder.MatchString(name) || strings.HasPrefix(name, "Photos from ") {
+		return ""
+	}
+	return strings.TrimSpace(name[:len(name)-4])
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithWorkerCount sets the number of workers processing files at once; 0 keeps the
+// default of one per CPU, at least 2. With WithWorkers it is the number the
+// autoscaled pool starts with. WithLowMemory caps it.
+func WithWorkerCount(n int) Option {
+	return func(p *Processor) error {
+		if n < 0 {
+			return fmt.Errorf("invalid worker count %d", n)
+		}
+		if n > 0 {
+			p.workerCount = n
+		}
+		return nil
+	}
+}
+
+// WithIOLimits throttles the workers to at most maxIOPS file operations (a sidecar
+// read, a media file read or rewrite, an output copy) and bandwidth bytes read and
+// written per second, for exports on a NAS or a USB drive that a full pool would
+// saturate. A worker finishing a file over the budget waits before starting the
+// next one, so a large video is paid for after it is written. 0 disables a limit.
+func WithIOLimits(maxIOPS int, bandwidth int64) Option {
+	return func(p *Processor) error {
+		if maxIOPS < 0 || bandwidth < 0 {
+			return fmt.Errorf("invalid IO limits %d operations/s, %d bytes/s", maxIOPS, bandwidth)
+		}
+		p.ioLimit = nil
+		if maxIOPS > 0 || bandwidth > 0 {
+			p.ioLimit = &ioLimiter{iops: maxIOPS, bandwidth: bandwidth}
+		}
+		return nil
+	}
+}
+
+// ioLimiter paces the workers: every operation moves a clock forward by the time it
+// takes at the limit, and workers wait for the clock to catch up with the wall time
+type ioLimiter struct {
+	iops      int
+	bandwidth int64
+
+	mu   sync.Mutex
+	next time.Time // When the operations charged so far are paid for
+}
+
+// charge adds operations and bytes done by the workers
+func (l *ioLimiter) charge(ops int, bytes int64) {
+	var cost time.Duration
+	if l.iops > 0 {
+		cost = time.Duration(ops) * time.Second / time.Duration(l.iops)
+	}
+	if l.bandwidth > 0 {
+		cost = max(cost, time.Duration(float64(bytes)/float64(l.bandwidth)*float64(time.Second)))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now := time.Now(); l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(cost)
+}
+
+// wait blocks until the operations charged so far are paid for or ctx is cancelled
+func (l *ioLimiter) wait(ctx context.Context) {
+	l.mu.Lock()
+	delay := time.Until(l.next)
+	l.mu.Unlock()
+	if delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// chargeIO counts the IO of a worker stage against the limits. Only the workers
+// charge it, since only they wait for the limits; the sidecars Scan reads ahead of
+// the run are not counted.
+func (p *Processor) chargeIO(stage string, read, written int64) {
+	if p.ioLimit == nil {
+		return
+	}
+	switch stage {
+	case StageReadJSON:
+		p.ioLimit.charge(1, read)
+	case StageWriteImage, StageWriteVideo:
+		ops := 1
+		if written > 0 {
+			ops++
+		}
+		p.ioLimit.charge(ops, read+written)
+	}
+}
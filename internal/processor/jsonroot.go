@@ -0,0 +1,50 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// jsonRootPrefix marks the match strategies of sidecars found under the JSON root,
+// e.g. "json-root:exact"
+const jsonRootPrefix = "json-root:"
+
+// WithJSONRoot also looks for sidecars in a directory tree that mirrors the export,
+// for tools that move the JSON files out of the media folders: the sidecar of
+// <root>/Photos from 2019/IMG_1234.jpg is then also searched in
+// <dir>/Photos from 2019/. The media file's own folder is tried first, and every
+// naming strategy applies in both places. Empty disables the extra search.
+func WithJSONRoot(dir string) Option {
+	return func(p *Processor) error {
+		if dir == "" {
+			p.jsonRoot = ""
+			return nil
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve JSON root: %w", err)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return fmt.Errorf("failed to access JSON root: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("JSON root %s is not a directory", abs)
+		}
+		p.jsonRoot = abs
+		return nil
+	}
+}
+
+// mirrorPath returns where a media file would be in the JSON root tree
+func (p *Processor) mirrorPath(mediaPath string) (string, bool) {
+	if p.jsonRoot == "" {
+		return "", false
+	}
+	rel, err := p.relPath(mediaPath)
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(p.jsonRoot, rel), true
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MatchLivePhoto is the match strategy recorded for a Live Photo video that uses the
+// sidecar of its still image
+const MatchLivePhoto = "live-photo"
+
+// livePhotoVideoExts and livePhotoImageExts are the extensions of the two halves of
+// a Live Photo exported as separate files
+var (
+	livePhotoVideoExts = map[string]bool{".mov": true, ".mp4": true}
+	livePhotoImageExts = []string{".heic", ".heif", ".jpg", ".jpeg"}
+)
+
+// pairLivePhotos gives Live Photo videos without a sidecar (IMG_1234.MOV) the sidecar
+// of the still image next to them (IMG_1234.HEIC), so they don't keep their upload
+// date. The shared sidecar is deleted only once every file using it is done.
+// The strict matching mode leaves them unmatched.
+func (p *Processor) pairLivePhotos() {
+	if p.matchMode == MatchModeStrict {
+		return
+	}
+	for i := range p.jobs {
+		job := &p.jobs[i]
+		if !os.IsNotExist(job.jsonErr) || !livePhotoVideoExts[strings.ToLower(filepath.Ext(job.mediaPath))] {
+			continue
+		}
+		image, ok := livePhotoImage(job.mediaPath)
+		if !ok {
+			continue
+		}
+		info, jsonPath, _, err := p.resolveSidecar(image)
+		if err != nil || info.IsDir() || !p.checkContainment(job.mediaPath, jsonPath) {
+			continue
+		}
+		if p.verbose {
+			fmt.Printf("[MATCH] Live Photo video %s uses %s\n", job.mediaPath, jsonPath)
+		}
+		job.jsonInfo, job.jsonPath, job.jsonErr, job.matchRule = info, jsonPath, nil, MatchLivePhoto
+		job.pairedImage = image
+		p.update(func(s *Statistics) {
+			if s.MatchStrategies[MatchNone]--; s.MatchStrategies[MatchNone] == 0 {
+				delete(s.MatchStrategies, MatchNone)
+			}
+			s.MatchStrategies[MatchLivePhoto]++
+		})
+	}
+}
+
+// livePhotoImage finds the still image next to a Live Photo video
+func livePhotoImage(videoPath string) (string, bool) {
+	stem := strings.TrimSuffix(videoPath, filepath.Ext(videoPath))
+	for _, ext := range livePhotoImageExts {
+		for _, candidate := range []string{stem + ext, stem + strings.ToUpper(ext)} {
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return candidate, true
+			}
+		}
+	}
+	return "", false
+}
+
+// countSidecarUsers records how many jobs apply each sidecar, so deleteSidecar keeps
+// it until the last of them is done. A sidecar borrowed by a Live Photo video whose
+// image is not part of this run is never deleted, as the image still needs it.
+func (p *Processor) countSidecarUsers() {
+	p.sidecarUsers = make(map[string]int)
+	queued := make(map[string]bool, len(p.jobs))
+	for _, job := range p.jobs {
+		queued[job.mediaPath] = true
+		if job.jsonErr == nil {
+			p.sidecarUsers[job.jsonPath]++
+		}
+	}
+	for _, job := range p.jobs {
+		if job.pairedImage != "" && !queued[job.pairedImage] {
+			p.sidecarUsers[job.jsonPath]++
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Limits of low-memory mode
+const (
+	lowMemoryWorkers   = 2  // Concurrent workers, also the autoscaling ceiling
+	lowMemoryQueueSize = 64 // Buffered stats updates
+)
+
+// WithLowMemory keeps memory use flat on small devices such as NAS boxes with 512MB of
+// RAM, at the cost of speed and detail: parsed sidecars are not cached, the names seen
+// by the walk go to a temporary file instead of an in-memory index, the per-file
+// detail lists and tag changes are not kept (the -report still lists every file's
+// outcome), and at most two workers run with small buffers, whatever WithWorkers and
+// WithWorkerCount ask for.
+func WithLowMemory(enabled bool) Option {
+	return func(p *Processor) error {
+		p.lowMemory = enabled
+		p.metaCache.SetDisabled(enabled)
+		return nil
+	}
+}
+
+// startLowMemory caps the workers and creates the name index of low-memory mode,
+// once the worker options are applied
+func (p *Processor) startLowMemory() error {
+	if !p.lowMemory {
+		return nil
+	}
+	p.workerCount = min(p.workerCount, lowMemoryWorkers)
+	if p.maxWorkers > lowMemoryWorkers {
+		p.minWorkers, p.maxWorkers = min(p.minWorkers, lowMemoryWorkers), lowMemoryWorkers
+	}
+
+	f, err := os.CreateTemp("", "takeout-names-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to create name index: %w", err)
+	}
+	p.seenFile, p.seenWriter = f, bufio.NewWriter(f)
+	return nil
+}
+
+// seeMedia records a media file name found by the walk, for the index check
+func (p *Processor) seeMedia(name string) {
+	if p.seenWriter == nil {
+		p.seenMedia[name]++
+		return
+	}
+	// The export index never lists names with line breaks, so they needn't be counted
+	if !strings.Contains(name, "\n") {
+		p.seenWriter.WriteString(name + "\n")
+	}
+}
+
+// seenCounts returns how often each of the listed names was found by the walk,
+// reading the temporary name index in low-memory mode
+func (p *Processor) seenCounts(listed map[string]int) (map[string]int, error) {
+	if p.seenWriter == nil {
+		return p.seenMedia, nil
+	}
+	if err := p.seenWriter.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write name index: %w", err)
+	}
+	if _, err := p.seenFile.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("failed to read name index: %w", err)
+	}
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(p.seenFile)
+	for scanner.Scan() {
+		if name := scanner.Text(); listed[name] > 0 {
+			counts[name]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read name index: %w", err)
+	}
+	return counts, nil
+}
+
+// dropSeenMedia removes the temporary name index once the index check is done
+func (p *Processor) dropSeenMedia() {
+	if p.seenFile == nil {
+		return
+	}
+	p.seenFile.Close()
+	os.Remove(p.seenFile.Name())
+	p.seenFile, p.seenWriter = nil, nil
+}
+
+// queueSize returns the buffer size for a channel, smaller in low-memory mode
+func (p *Processor) queueSize(n int) int {
+	if p.lowMemory {
+		return min(n, lowMemoryQueueSize)
+	}
+	return n
+}
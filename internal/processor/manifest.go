@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google-takeout-exif-applier/internal/manifest"
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// MatchManifest is the match strategy recorded for media files found in a manifest
+const MatchManifest = "manifest"
+
+// ExportManifest scans the export and writes the prepared metadata of every media
+// file with a sidecar to w, keyed by the file's SHA-256, without modifying anything.
+// Sidecars are parsed, merged and adjusted exactly as a run would, so the manifest
+// can be applied later, elsewhere, to files that were renamed or moved. Files whose
+// sidecar can't be used are skipped with a warning. It returns the number of entries.
+func (p *Processor) ExportManifest(ctx context.Context, w *manifest.Writer) (int, error) {
+	if _, err := p.Scan(ctx); err != nil {
+		return 0, err
+	}
+	written := 0
+	for i := range p.jobs {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		job := &p.jobs[i]
+		if job.jsonErr != nil || job.jsonInfo.IsDir() || job.jsonInfo.Size() > metadata.MaxJSONSize {
+			continue
+		}
+		meta := job.meta
+		if meta == nil {
+			var err error
+			if meta, err = p.loadMetadata(ctx, job.mediaPath, job.jsonPath); err != nil {
+				p.warn(job.jsonPath, "Skipping %s: %v", job.mediaPath, err)
+				continue
+			}
+		}
+		if !p.force && !titleMatches(job.mediaPath, meta.Title) {
+			p.warn(job.mediaPath, "Skipping %s: its JSON describes %q; use -force to include it", job.mediaPath, meta.Title)
+			continue
+		}
+		sum, err := fileSHA256(job.mediaPath)
+		if err != nil {
+			p.warn(job.mediaPath, "Skipping %s: %v", job.mediaPath, err)
+			continue
+		}
+		rel, err := p.relPath(job.mediaPath)
+		if err != nil {
+			rel = filepath.Base(job.mediaPath)
+		}
+		entry, err := manifest.NewEntry(hex.EncodeToString(sum), job.size, filepath.ToSlash(rel), meta)
+		if err != nil {
+			p.warn(job.jsonPath, "Skipping %s: %v", job.mediaPath, err)
+			continue
+		}
+		if err := w.Add(entry); err != nil {
+			return written, err
+		}
+		written++
+		if p.verbose {
+			fmt.Printf("[MANIFEST] %s (%s)\n", rel, entry.SHA256[:12])
+		}
+	}
+	return written, nil
+}
+
+// WithManifest takes the metadata of the scanned media files from a manifest written
+// by ExportManifest instead of from JSON sidecars. Files are matched by content
+// hash, so the root may be any library holding copies of the exported files, under
+// any name. The metadata was prepared when the manifest was exported; sidecars next
+// to the files and the time options are ignored, and nothing is deleted.
+func WithManifest(path string, entries []manifest.Entry) Option {
+	return func(p *Processor) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to access manifest: %w", err)
+		}
+		p.manifestPath, p.manifestInfo = path, info
+		p.manifestEntries = make(map[string]manifest.Entry, len(entries))
+		p.manifestSizes = make(map[int64]bool, len(entries))
+		for _, entry := range entries {
+			p.manifestEntries[entry.SHA256] = entry
+			p.manifestSizes[entry.Size] = true
+		}
+		return nil
+	}
+}
+
+// matchManifest gives every job whose content is in the manifest its metadata. Only
+// files with the size of some entry are hashed.
+func (p *Processor) matchManifest(ctx context.Context) error {
+	if p.manifestPath == "" {
+		return nil
+	}
+	for i := range p.jobs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		job := &p.jobs[i]
+		if !p.manifestSizes[job.size] {
+			continue
+		}
+		sum, err := fileSHA256(job.mediaPath)
+		if err != nil {
+			p.warn(job.mediaPath, "Cannot hash %s: %v", job.mediaPath, err)
+			continue
+		}
+		entry, ok := p.manifestEntries[hex.EncodeToString(sum)]
+		if !ok {
+			continue
+		}
+		if p.verbose {
+			fmt.Printf("[MATCH] %s is %s in the manifest\n", job.mediaPath, entry.Path)
+		}
+		job.jsonInfo, job.jsonPath, job.jsonErr, job.matchRule = p.manifestInfo, p.manifestPath, nil, MatchManifest
+		job.meta = entry.Meta()
+		p.update(func(s *Statistics) {
+			if s.MatchStrategies[MatchNone]--; s.MatchStrategies[MatchNone] == 0 {
+				delete(s.MatchStrategies, MatchNone)
+			}
+			s.MatchStrategies[MatchManifest]++
+		})
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package processor
+
+import "fmt"
+
+// skipMarked skips a file already carrying the applied marker as already processed
+func (p *Processor) skipMarked(mediaPath, jsonPath string) {
+	fmt.Printf("[SKIP] Already processed: %s\n", mediaPath)
+	p.recordSkip(FileResult{Path: mediaPath, JSONPath: jsonPath, Message: "marked by a previous run"}, SkipAlreadyProcessed)
+
+	if !p.dryRun {
+		p.deleteSidecar(jsonPath)
+	}
+}
@@ -0,0 +1,181 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Sidecar matching modes, from fewest to most heuristics
+const (
+	MatchModeStrict     = "strict"     // Only Google's documented sidecar names
+	MatchModeNormal     = "normal"     // The naming-scheme chain and Live Photo pairing
+	MatchModeAggressive = "aggressive" // Also title-index and fuzzy matching
+)
+
+// Match strategy names recorded by the aggressive mode
+const (
+	MatchTitleIndex = "title-index" // A sidecar in the folder whose "title" is the file name
+	MatchFuzzy      = "fuzzy"       // A sidecar whose name matches ignoring case and punctuation
+)
+
+// strictStrategy is the built-in strategy of the strict mode: "<name>.json" and
+// "<name>.supplemental-metadata.json", the sidecar names Google documents
+const strictStrategy = "exact"
+
+// ValidateMatchMode checks that mode is one of the supported matching modes
+func ValidateMatchMode(mode string) error {
+	switch mode {
+	case "", MatchModeStrict, MatchModeNormal, MatchModeAggressive:
+		return nil
+	}
+	return fmt.Errorf("unknown match mode %q (expected %s, %s or %s)", mode, MatchModeStrict, MatchModeNormal, MatchModeAggressive)
+}
+
+// WithMatchMode trades matching recall against the risk of wrong matches. strict only
+// accepts the exact names Google documents and ignores the configured strategy chain;
+// aggressive additionally matches the leftover files of a folder to its unused
+// sidecars by their JSON title and by loosely compared names. Empty means normal.
+func WithMatchMode(mode string) Option {
+	return func(p *Processor) error {
+		if err := ValidateMatchMode(mode); err != nil {
+			return err
+		}
+		p.matchMode = mode
+		return nil
+	}
+}
+
+// activeStrategies returns the sidecar naming chain for the matching mode
+func (p *Processor) activeStrategies() []CandidateStrategy {
+	if p.matchMode == MatchModeStrict {
+		for _, strategy := range defaultStrategies {
+			if strategy.Name == strictStrategy {
+				return []CandidateStrategy{strategy}
+			}
+		}
+	}
+	return p.candidateStrategies
+}
+
+// matchLeftovers runs the aggressive heuristics for the media files still without a
+// sidecar. Only sidecars no other file uses are considered, and a file is matched only
+// when exactly one of them fits.
+func (p *Processor) matchLeftovers() {
+	if p.matchMode != MatchModeAggressive {
+		return
+	}
+	claimed := make(map[string]bool)
+	unmatched := make(map[string][]int) // Folder -> jobs without a sidecar
+	for i, job := range p.jobs {
+		if job.jsonErr == nil {
+			claimed[job.jsonPath] = true
+		} else if os.IsNotExist(job.jsonErr) {
+			dir := filepath.Dir(job.mediaPath)
+			unmatched[dir] = append(unmatched[dir], i)
+		}
+	}
+
+	for dir, indexes := range unmatched {
+		sidecars := p.unclaimedSidecars(dir, claimed)
+		for _, i := range indexes {
+			job := &p.jobs[i]
+			name := filepath.Base(job.mediaPath)
+			jsonPath, rule := leftoverSidecar(name, sidecars)
+			if jsonPath == "" || claimed[jsonPath] || !p.checkContainment(job.mediaPath, jsonPath) {
+				continue
+			}
+			info, err := os.Stat(jsonPath)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			claimed[jsonPath] = true
+			if p.verbose {
+				fmt.Printf("[MATCH] %s uses %s (%s)\n", job.mediaPath, jsonPath, rule)
+			}
+			job.jsonInfo, job.jsonPath, job.jsonErr, job.matchRule = info, jsonPath, nil, rule
+			p.update(func(s *Statistics) {
+				if s.MatchStrategies[MatchNone]--; s.MatchStrategies[MatchNone] == 0 {
+					delete(s.MatchStrategies, MatchNone)
+				}
+				s.MatchStrategies[rule]++
+			})
+		}
+	}
+}
+
+// leftoverSidecar picks the sidecar of a media file by JSON title, then by fuzzy name
+func leftoverSidecar(name string, sidecars []leftoverJSON) (string, string) {
+	var byTitle, byName []string
+	key := fuzzyKey(name)
+	for _, sidecar := range sidecars {
+		if sidecar.title != "" && strings.EqualFold(sidecar.title, name) {
+			byTitle = append(byTitle, sidecar.path)
+		}
+		if key != "" && sidecar.key == key {
+			byName = append(byName, sidecar.path)
+		}
+	}
+	switch {
+	case len(byTitle) == 1:
+		return byTitle[0], MatchTitleIndex
+	case len(byTitle) == 0 && len(byName) == 1:
+		return byName[0], MatchFuzzy
+	}
+	return "", ""
+}
+
+// leftoverJSON is an unused sidecar of a folder with the title it describes
+type leftoverJSON struct {
+	path  string
+	title string
+	key   string // fuzzyKey of the sidecar name
+}
+
+// unclaimedSidecars lists the JSON files of a folder that no media file uses, except
+// album and folder metadata
+func (p *Processor) unclaimedSidecars(dir string, claimed map[string]bool) []leftoverJSON {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var sidecars []leftoverJSON
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".json") || claimed[path] ||
+			entry.Name() == "supplemental-metadata.json" || metadata.IsAlbumMetadataFile(path) {
+			continue
+		}
+		sidecar := leftoverJSON{path: path, key: fuzzyKey(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))}
+		if meta, err := p.metaCache.ParseJSON(path); err == nil {
+			sidecar.title = meta.Title
+		}
+		sidecars = append(sidecars, sidecar)
+	}
+	return sidecars
+}
+
+// fuzzyKey reduces a media or sidecar name to the letters and digits before its first
+// dot, lower-cased, followed by its duplicate number: "IMG 1234(1).JPG" and
+// "img_1234.jpg.supplemental-me(1).json" both become "img1234(1)"
+func fuzzyKey(name string) string {
+	number := ""
+	if matches := duplicateNumber.FindAllString(name, -1); len(matches) == 1 {
+		number = matches[0]
+		name = strings.Replace(name, number, "", 1)
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String() + number
+}
@@ -0,0 +1,15 @@
+package processor
+
+// MatchRate returns the share of media files whose JSON sidecar was found, from 0 to
+// 1, and how many media files it is taken over. A rate far below 1 usually means
+// archive parts were not extracted, leaving their photos without the sidecars.
+func (s *Statistics) MatchRate() (float64, int) {
+	media := 0
+	for _, n := range s.MatchStrategies {
+		media += n
+	}
+	if media == 0 {
+		return 1, 0
+	}
+	return float64(media-s.MatchStrategies[MatchNone]) / float64(media), media
+}
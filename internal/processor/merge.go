@@ -0,0 +1,199 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Rules for choosing between copies of a photo found in several exports
+const (
+	ConflictNewest = "newest" // Sidecar with the latest modification time wins
+	ConflictGPS    = "gps"    // Sidecar with GPS data wins, then the newest
+)
+
+// MergeConflict records a photo present in several exports whose sidecars disagree
+type MergeConflict struct {
+	Path   string   // Media path relative to the export roots
+	Winner string   // Sidecar whose metadata was applied
+	Others []string // Sidecars of the superseded copies
+	Fields []string // Metadata fields that differed
+	Reason string
+}
+
+// ValidateConflictRule checks that rule is one of the supported merge conflict rules
+func ValidateConflictRule(rule string) error {
+	switch rule {
+	case "", ConflictNewest, ConflictGPS:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict rule %q (expected %s or %s)", rule, ConflictNewest, ConflictGPS)
+}
+
+// WithMergeRoots adds other Takeout exports of the same library to the scan. A photo
+// found at the same relative path in several exports is processed once, from the
+// copy whose sidecar wins under rule; the other copies are left untouched.
+func WithMergeRoots(roots []string, rule string) Option {
+	return func(p *Processor) error {
+		p.mergeRoots = roots
+		p.conflictRule = rule
+		return nil
+	}
+}
+
+// resolveDuplicates keeps one job per relative path across the export roots
+func (p *Processor) resolveDuplicates() {
+	if len(p.mergeRoots) == 0 {
+		return
+	}
+
+	groups := make(map[string][]int)
+	var keys []string
+	for i, job := range p.jobs {
+		key := job.mediaPath
+		if rel, err := p.relPath(job.mediaPath); err == nil {
+			key = filepath.ToSlash(rel)
+		}
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	keep := make(map[int]bool, len(groups))
+	for _, key := range keys {
+		indexes := groups[key]
+		if len(indexes) == 1 {
+			keep[indexes[0]] = true
+			continue
+		}
+		winner := p.resolveConflict(key, indexes)
+		keep[winner] = true
+	}
+
+	jobs := p.jobs[:0]
+	for i, job := range p.jobs {
+		if keep[i] {
+			jobs = append(jobs, job)
+		}
+	}
+	p.jobs = jobs
+}
+
+// resolveConflict picks the job to process among copies of the same photo, records
+// the others as skipped and returns the winner's index
+func (p *Processor) resolveConflict(key string, indexes []int) int {
+	metas := make(map[int]*metadata.Metadata, len(indexes))
+	for _, i := range indexes {
+		job := p.jobs[i]
+		if job.jsonErr != nil || job.jsonInfo.IsDir() || job.jsonInfo.Size() > metadata.MaxJSONSize {
+			continue
+		}
+		if meta, err := p.metaCache.ParseJSON(job.jsonPath); err == nil {
+			metas[i] = meta
+		}
+	}
+
+	winner, reason := indexes[0], "first export"
+	for _, i := range indexes[1:] {
+		if better, why := p.preferSidecar(metas[i], p.jobs[i], metas[winner], p.jobs[winner]); better {
+			winner, reason = i, why
+		}
+	}
+
+	conflict := MergeConflict{Path: key, Winner: p.jobs[winner].jsonPath, Reason: reason}
+	for _, i := range indexes {
+		if i == winner {
+			continue
+		}
+		job := p.jobs[i]
+		if p.verbose {
+			fmt.Printf("[MERGE] %s superseded by %s (%s)\n", job.mediaPath, p.jobs[winner].mediaPath, reason)
+		}
+		p.recordSkip(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath,
+			Message: "duplicate of " + p.jobs[winner].mediaPath}, SkipDuplicate)
+
+		if metas[i] == nil || metas[winner] == nil {
+			continue
+		}
+		if fields := differingFields(metas[winner], metas[i]); len(fields) > 0 {
+			conflict.Others = append(conflict.Others, job.jsonPath)
+			conflict.Fields = appendMissing(conflict.Fields, fields...)
+		}
+	}
+
+	if len(conflict.Others) > 0 {
+		p.update(func(s *Statistics) { s.MergeConflicts = append(s.MergeConflicts, conflict) })
+	}
+	return winner
+}
+
+// preferSidecar reports whether candidate should replace current under the conflict
+// rule, and why. A copy without a usable sidecar never wins over one with a sidecar.
+func (p *Processor) preferSidecar(candidate *metadata.Metadata, candidateJob fileJob, current *metadata.Metadata, currentJob fileJob) (bool, string) {
+	if candidate == nil {
+		return false, ""
+	}
+	if current == nil {
+		return true, "only sidecar"
+	}
+	if p.conflictRule == ConflictGPS {
+		_, candidateGPS := candidate.GetLatitude()
+		_, currentGPS := current.GetLatitude()
+		if candidateGPS != currentGPS {
+			return candidateGPS, "has GPS"
+		}
+	}
+	if modifiedAt(candidate, candidateJob).After(modifiedAt(current, currentJob)) {
+		return true, "newest metadata"
+	}
+	return false, ""
+}
+
+// modifiedAt returns the sidecar's modification time, falling back to the file time
+func modifiedAt(meta *metadata.Metadata, job fileJob) time.Time {
+	if t, ok := meta.GetModificationTime(); ok {
+		return t
+	}
+	return job.jsonInfo.ModTime()
+}
+
+// differingFields lists the written metadata fields on which two sidecars disagree
+func differingFields(a, b *metadata.Metadata) []string {
+	var fields []string
+	timeA, errA := a.GetPhotoTime()
+	timeB, errB := b.GetPhotoTime()
+	if (errA == nil) != (errB == nil) || !timeA.Equal(timeB) {
+		fields = append(fields, "time")
+	}
+	latA, _ := a.GetLatitude()
+	latB, _ := b.GetLatitude()
+	lonA, _ := a.GetLongitude()
+	lonB, _ := b.GetLongitude()
+	if latA != latB || lonA != lonB {
+		fields = append(fields, "gps")
+	}
+	if a.Description != b.Description {
+		fields = append(fields, "description")
+	}
+	return fields
+}
+
+// appendMissing appends the values not already in list
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// copyChunkSize is the unit for copying, hashing and hole detection
+const copyChunkSize = 1 << 20
+
+// progressThreshold is the size above which cross-device copies report progress
+const progressThreshold = 64 << 20
+
+// moveFile moves src to dst. When a rename is not possible (e.g. dst is on another
+// filesystem or drive), the file is copied, verified against a SHA-256 of the
+// source, and only then is the source removed.
+func (p *Processor) moveFile(src, dst string) error {
+	renameErr := os.Rename(src, dst)
+	if renameErr == nil {
+		return nil
+	}
+	// Only fall back to copying when the rename failed between two valid locations
+	if _, err := os.Lstat(src); err != nil {
+		return renameErr
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("destination already exists: %s", dst)
+	}
+
+	if p.verbose {
+		fmt.Printf("    Rename failed (%v), copying instead\n", renameErr)
+	}
+	if err := p.copyVerified(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("copied but failed to remove source: %w", err)
+	}
+	return nil
+}
+
+// copyVerified copies src to dst, keeping runs of zero bytes as holes in the
+// destination, and checks that the copy hashes the same as the source. On a
+// copy-on-write filesystem dst is cloned from src instead, sharing its data until
+// either is rewritten; a clone needs no checksum.
+func (p *Processor) copyVerified(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create destination: %w", err)
+	}
+	// A copy cut off by an abort is removed, finished ones are kept
+	metadata.TrackTempFile(dst)
+	defer metadata.UntrackTempFile(dst)
+	if cloneFile(out, in) {
+		p.counters.clonedFiles.Add(1)
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("failed to write destination: %w", err)
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+
+	srcHash := sha256.New()
+	buf := make([]byte, copyChunkSize)
+	zero := make([]byte, copyChunkSize)
+	var copied int64
+	nextReport := int64(progressThreshold)
+	for {
+		n, readErr := io.ReadFull(in, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			srcHash.Write(chunk)
+			if bytes.Equal(chunk, zero[:n]) {
+				_, err = out.Seek(int64(n), io.SeekCurrent)
+			} else {
+				_, err = out.Write(chunk)
+			}
+			if err != nil {
+				out.Close()
+				return fmt.Errorf("failed to write destination: %w", err)
+			}
+			copied += int64(n)
+		}
+		if info.Size() > progressThreshold && copied >= nextReport {
+			fmt.Printf("[COPY] %s: %d%%\n", filepath.Base(src), copied*100/info.Size())
+			nextReport += progressThreshold
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			out.Close()
+			return fmt.Errorf("failed to read source: %w", readErr)
+		}
+	}
+
+	// A trailing hole needs an explicit size
+	if err := out.Truncate(copied); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write destination: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to flush destination: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write destination: %w", err)
+	}
+
+	dstSum, err := fileSHA256(dst)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(dstSum, srcHash.Sum(nil)) {
+		return fmt.Errorf("checksum mismatch after copying %s", src)
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// fileSHA256 returns the SHA-256 of a file's contents
+func fileSHA256(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// WithSyncMTime enables setting the file time from embedded EXIF for media without a sidecar
+func WithSyncMTime(enabled bool) Option {
+	return func(p *Processor) error {
+		p.syncMTime = enabled
+		return nil
+	}
+}
+
+// syncFileTime sets the modification time of a sidecar-less media file from its EXIF
+// time. target is the file to change: the media file itself or its output copy.
+func (p *Processor) syncFileTime(ctx context.Context, mediaPath, target string) {
+	if p.dryRun {
+		t, ok := metadata.ReadEXIFTime(ctx, mediaPath)
+		if !ok {
+			p.recordSkip(FileResult{Path: mediaPath, Message: "no metadata file and no EXIF time", Err: ErrNoSidecar}, SkipNoSidecar)
+			return
+		}
+		fmt.Printf("[DRY-RUN] Would set file time from EXIF: %s\n", mediaPath)
+		p.counters.syncedFiles.Add(1)
+		p.recordResult(FileResult{Path: mediaPath, Status: StatusWouldModify, Message: "file time from EXIF " + t.Format("2006-01-02 15:04:05")})
+		return
+	}
+
+	t, ok, err := metadata.SyncFileTime(ctx, target)
+	if err != nil {
+		p.recordError()
+		fmt.Printf("[ERROR] Failed to sync file time of %s: %v\n", mediaPath, err)
+		p.recordResult(FileResult{Path: mediaPath, Status: StatusError, Message: err.Error(), Err: err})
+		return
+	}
+	if !ok {
+		if p.verbose {
+			fmt.Printf("[SKIP] No metadata file and no EXIF time: %s\n", mediaPath)
+		}
+		p.recordSkip(FileResult{Path: mediaPath, Message: "no metadata file and no EXIF time", Err: ErrNoSidecar}, SkipNoSidecar)
+		return
+	}
+
+	p.counters.syncedFiles.Add(1)
+	if p.verbose {
+		fmt.Printf("[OK] File time set from EXIF (%s): %s\n", t.Format("2006-01-02 15:04:05"), mediaPath)
+	}
+	p.recordResult(FileResult{Path: mediaPath, Status: StatusModified, Message: "file time from EXIF " + t.Format("2006-01-02 15:04:05")})
+}
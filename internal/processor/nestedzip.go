@@ -0,0 +1,263 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// zipMagic starts the first local file header of a zip archive
+var zipMagic = []byte("PK\x03\x04")
+
+// extractingSuffix names the temporary directory an archive is extracted into
+const extractingSuffix = ".extracting"
+
+// extractedSuffix is added to the directory name of an archive whose stem is taken by
+// a folder it was not extracted into; "photos (extracted)" sorts before photos.zip,
+// so the walk has seen it by the time it reaches the archive, as it has photos/
+const extractedSuffix = " (extracted)"
+
+// Limits on what a nested archive may expand to, against zip bombs
+const (
+	nestedZipMaxRatio = 100     // Times the archive size...
+	nestedZipMinLimit = 1 << 30 // ...unless it stays under this
+)
+
+// WithExtractZips extracts the zip archives found inside the export, such as the split
+// parts of long videos, next to themselves (photos.zip into photos/) and processes
+// their contents. The archives are kept; one already extracted by a previous run, as
+// recorded in the ExtractedListName file of its directory, is not extracted again.
+// Archives are extracted during the scan, before the confirmation prompt, but not in
+// dry-run mode, nor with an output directory, a relocated library or a manifest,
+// which leave the export untouched. Without it they are skipped.
+func WithExtractZips(enabled bool) Option {
+	return func(p *Processor) error {
+		p.extractZips = enabled
+		return nil
+	}
+}
+
+// isNestedArchive reports whether a file found by the walk is a zip archive
+func isNestedArchive(path string) bool {
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, len(zipMagic))
+	_, err = io.ReadFull(f, header)
+	return err == nil && bytes.Equal(header, zipMagic)
+}
+
+// collectArchive counts a zip archive found during the walk and, with -extract-zips,
+// extracts it and walks its contents
+func (p *Processor) collectArchive(ctx context.Context, path string) error {
+	p.counters.otherFiles.Add(1)
+	skip := func(message string) {
+		p.recordSkip(FileResult{Path: path, Message: message}, SkipNestedArchive)
+	}
+	if !p.extractZips {
+		skip("nested zip archive; use -extract-zips to process its contents")
+		return nil
+	}
+	if p.outputDir != "" || p.relocatedDir != "" || p.manifestPath != "" {
+		skip("nested zip archive; not extracted since the export is left untouched")
+		return nil
+	}
+	dir, extracted := nestedArchiveDir(path)
+	switch {
+	case dir == "":
+		skip("nested zip archive; folders named after it exist already")
+		return nil
+	case extracted:
+		// The walk visits the directory before the archive, so its files were already seen
+		skip("nested zip archive, already extracted to " + dir)
+		return nil
+	}
+	if p.dryRun {
+		files, err := zipFileCount(path)
+		if err != nil {
+			p.warn(path, "Cannot read %s: %v", path, err)
+			skip(fmt.Sprintf("unreadable nested zip archive: %v", err))
+			return nil
+		}
+		fmt.Printf("[ZIP] Would extract %d files from %s\n", files, path)
+		skip(fmt.Sprintf("nested zip archive with %d files, extracted by a real run", files))
+		return nil
+	}
+
+	files, err := extractZip(path, dir)
+	if err != nil {
+		p.warn(path, "Cannot extract %s: %v", path, err)
+		skip(fmt.Sprintf("nested zip archive could not be extracted: %v", err))
+		return nil
+	}
+	fmt.Printf("[ZIP] Extracted %d files from %s\n", files, path)
+	skip("nested zip archive, extracted to " + dir)
+	return p.walkDir(ctx, dir)
+}
+
+// nestedArchiveDir returns the directory a nested archive is extracted into, next to
+// it and named after it, and whether the archive was already extracted there. It
+// returns "" when folders of both names exist without the archive's marker.
+func nestedArchiveDir(path string) (string, bool) {
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, dir := range []string{stem, stem + extractedSuffix} {
+		if _, err := os.Lstat(dir); errors.Is(err, os.ErrNotExist) {
+			return dir, false
+		}
+		if extractedInto(dir, path) {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// extractedInto reports whether dir holds the marker of the archive's extraction
+func extractedInto(dir, archive string) bool {
+	info, err := os.Stat(archive)
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ExtractedListName))
+	if err != nil {
+		return false
+	}
+	var done []extractedArchive
+	return json.Unmarshal(data, &done) == nil && archiveExtracted(done, filepath.Base(archive), info.Size())
+}
+
+// isPartialExtraction reports whether a directory is left over from an interrupted
+// extraction, which the walk must not process; the next extraction replaces it
+func isPartialExtraction(dir string) bool {
+	if !strings.HasSuffix(dir, extractingSuffix) {
+		return false
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(dir, extractingSuffix), extractedSuffix)
+	for _, ext := range []string{".zip", ".ZIP"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// zipFileCount returns the number of files in a zip archive
+func zipFileCount(path string) (int, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	files := 0
+	for _, f := range r.File {
+		if f.Mode().IsRegular() {
+			files++
+		}
+	}
+	return files, nil
+}
+
+// extractZip extracts the regular files of a zip archive into dir, which must not
+// exist, keeping their modification times, and marks it with an ExtractedListName
+// file naming the archive. The files go to a temporary directory that is renamed into
+// place at the end, so an interrupted extraction is redone by the next run. Entries
+// that would land outside dir are refused, and so are archives that would expand to
+// more than nestedZipMaxRatio times their size or than the free space.
+func extractZip(path, dir string) (int, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer r.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	var size uint64
+	for _, f := range r.File {
+		size += f.UncompressedSize64
+	}
+	if limit := max(uint64(info.Size())*nestedZipMaxRatio, nestedZipMinLimit); size > limit {
+		return 0, fmt.Errorf("archive would expand to %d bytes, over %d times its size", size, nestedZipMaxRatio)
+	}
+	if free, ok := freeSpace(filepath.Dir(dir)); ok && size > uint64(free) {
+		return 0, fmt.Errorf("archive would expand to %d bytes, more than the %d bytes free", size, free)
+	}
+
+	tmpDir := metadata.TrackTempFile(dir + extractingSuffix)
+	defer metadata.UntrackTempFile(tmpDir)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return 0, fmt.Errorf("failed to remove a previous partial extraction: %w", err)
+	}
+	files := 0
+	for _, f := range r.File {
+		name := filepath.FromSlash(f.Name)
+		if !filepath.IsLocal(name) {
+			os.RemoveAll(tmpDir)
+			return 0, fmt.Errorf("archive entry %q points outside the archive", f.Name)
+		}
+		if !f.Mode().IsRegular() {
+			continue // Directories are created with their files; links are not extracted
+		}
+		if err := extractZipFile(f, filepath.Join(tmpDir, name)); err != nil {
+			os.RemoveAll(tmpDir)
+			return 0, err
+		}
+		files++
+	}
+	if files == 0 {
+		os.RemoveAll(tmpDir)
+		return 0, fmt.Errorf("archive has no files")
+	}
+	// zip.File checks that entries hold no more than their headers say
+	marker := []extractedArchive{{Name: filepath.Base(path), Size: info.Size(), Files: files}}
+	if err := writeExtractedList(filepath.Join(tmpDir, ExtractedListName), marker); err != nil {
+		os.RemoveAll(tmpDir)
+		return 0, err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		os.RemoveAll(tmpDir)
+		return 0, fmt.Errorf("failed to move extracted files into place: %w", err)
+	}
+	return files, nil
+}
+
+// extractZipFile writes one archive entry to dst
+func extractZipFile(f *zip.File, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	src, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	defer src.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	_, err = io.Copy(out, src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+	}
+	if modified := f.Modified; !modified.IsZero() {
+		os.Chtimes(dst, modified, modified)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+package processor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ioprio_set arguments: the idle IO class only gets disk time no one else wants
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// lowerPriority moves every thread of the process to the idle IO class and the
+// lowest CPU priority. Both are per thread on Linux and inherited by the threads and
+// the exiftool and ffmpeg processes started afterwards.
+func lowerPriority() error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return fmt.Errorf("failed to list threads: %w", err)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle<<ioprioClassShift); errno != 0 {
+			return fmt.Errorf("failed to lower IO priority: %w", errno)
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, 19); err != nil {
+			return fmt.Errorf("failed to lower CPU priority: %w", err)
+		}
+	}
+	return nil
+}
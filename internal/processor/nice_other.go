@@ -0,0 +1,10 @@
+//go:build !linux
+
+package processor
+
+import "errors"
+
+// lowerPriority is not supported here
+func lowerPriority() error {
+	return errors.New("IO priorities are only supported on Linux")
+}
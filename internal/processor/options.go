@@ -0,0 +1,23 @@
+package processor
+
+// Option configures a Processor created by New. Options may be given in any order:
+// the settings checked against others (the directories against the merged export
+// roots, low-memory mode against the worker counts, the batch checkpoint against
+// dry-run mode) are checked by New once all of them are applied.
+type Option func(*Processor) error
+
+// WithDryRun reports what would be done without modifying any file
+func WithDryRun(enabled bool) Option {
+	return func(p *Processor) error {
+		p.dryRun = enabled
+		return nil
+	}
+}
+
+// WithVerbose logs every file and decision
+func WithVerbose(enabled bool) Option {
+	return func(p *Processor) error {
+		p.verbose = enabled
+		return nil
+	}
+}
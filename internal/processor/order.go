@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported job orders
+const (
+	OrderPath   = "path"
+	OrderSize   = "size"
+	OrderOldest = "oldest-first"
+)
+
+// ValidateOrder checks that order is one of the supported job orders
+func ValidateOrder(order string) error {
+	switch order {
+	case "", OrderPath, OrderSize, OrderOldest:
+		return nil
+	}
+	return fmt.Errorf("unknown order %q (expected %s, %s or %s)", order, OrderPath, OrderSize, OrderOldest)
+}
+
+// WithOrder configures the order in which media files are queued, and the album
+// folders (matched by case-insensitive substring) that are processed first
+func WithOrder(order string, priorityAlbums []string) Option {
+	return func(p *Processor) error {
+		p.order = order
+		p.priorityAlbums = priorityAlbums
+		return nil
+	}
+}
+
+// sortJobs orders the collected jobs according to the configured order and album priorities
+func (p *Processor) sortJobs() {
+	var less func(a, b fileJob) bool
+	switch p.order {
+	case OrderSize:
+		less = func(a, b fileJob) bool { return a.size < b.size }
+	case OrderOldest:
+		taken := make(map[string]time.Time, len(p.jobs))
+		for _, job := range p.jobs {
+			taken[job.mediaPath] = p.jobPhotoTime(job)
+		}
+		less = func(a, b fileJob) bool {
+			ta, tb := taken[a.mediaPath], taken[b.mediaPath]
+			// Files without a usable timestamp go last
+			if ta.IsZero() != tb.IsZero() {
+				return !ta.IsZero()
+			}
+			return ta.Before(tb)
+		}
+	default:
+		less = func(a, b fileJob) bool { return a.mediaPath < b.mediaPath }
+	}
+
+	sort.SliceStable(p.jobs, func(i, j int) bool {
+		pi, pj := p.albumPriority(p.jobs[i].mediaPath), p.albumPriority(p.jobs[j].mediaPath)
+		if pi != pj {
+			return pi < pj
+		}
+		return less(p.jobs[i], p.jobs[j])
+	})
+}
+
+// albumPriority returns the index of the first priority album matching the file's
+// folder, or len(priorityAlbums) when none match
+func (p *Processor) albumPriority(mediaPath string) int {
+	album := strings.ToLower(filepath.Base(filepath.Dir(mediaPath)))
+	for i, name := range p.priorityAlbums {
+		if strings.Contains(album, strings.ToLower(name)) {
+			return i
+		}
+	}
+	return len(p.priorityAlbums)
+}
+
+// jobPhotoTime returns the photo time from the job's prepared metadata or sidecar, or
+// the zero time
+func (p *Processor) jobPhotoTime(job fileJob) time.Time {
+	meta := job.meta
+	if meta == nil {
+		if job.jsonErr != nil || job.jsonInfo.IsDir() {
+			return time.Time{}
+		}
+		var err error
+		if meta, err = p.metaCache.ParseJSON(job.jsonPath); err != nil {
+			return time.Time{}
+		}
+	}
+	photoTime, err := meta.GetPhotoTime()
+	if err != nil {
+		return time.Time{}
+	}
+	return photoTime
+}
@@ -0,0 +1,249 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Output modes for WithOutputMode
+const (
+	OutputCopy     = "copy"     // Every media file is copied
+	OutputHardlink = "hardlink" // Files the run leaves unchanged are hardlinked, the others copied
+)
+
+// WithOutputMode chooses how the output directory gets its files. With OutputHardlink
+// every media file is first hardlinked into the output tree; a writer that replaces
+// the file with a rewritten one breaks the link on its own, and the few that change a
+// file in place copy it first, so the export is never changed and only the files
+// whose bytes change take space. Files that can't be linked, e.g. because the output
+// is on another filesystem, are copied.
+func WithOutputMode(mode string) Option {
+	return func(p *Processor) error {
+		switch mode {
+		case "", OutputCopy:
+			p.outputMode = OutputCopy
+		case OutputHardlink:
+			p.outputMode = OutputHardlink
+		default:
+			return fmt.Errorf("unknown output mode %q (expected %s or %s)", mode, OutputCopy, OutputHardlink)
+		}
+		return nil
+	}
+}
+
+// WithOutputDir makes the run write into copies under dir, at the same path relative
+// to their export root, leaving the media files and JSON sidecars in the export
+// untouched. The directory must not be inside the export. An empty dir edits in place.
+func WithOutputDir(dir string) Option {
+	return func(p *Processor) error {
+		if dir == "" {
+			p.outputDir = ""
+			return nil
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve output directory: %w", err)
+		}
+		p.outputDir = abs
+		return nil
+	}
+}
+
+// nearestDir returns dir, or its closest parent when it does not exist yet
+func nearestDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// WithNormalizeNames cleans up the file names written to the output directory: the
+// "(1)" Google adds to duplicates is dropped, look-alike Unicode characters are
+// replaced by their ASCII forms and characters invalid on Windows are replaced.
+// The original name is recorded in XMP xmpMM:PreservedFileName.
+func WithNormalizeNames(enabled bool) Option {
+	return func(p *Processor) error {
+		p.normalizeNames = enabled
+		return nil
+	}
+}
+
+// planOutputs assigns every job its path in the output directory. Names that collide,
+// usually because normalization or the name template made them equal, are numbered
+// in queue order after the files whose path was kept, so the same export always
+// produces the same names and IMG_1234.jpg keeps its name when IMG_1234(1).jpg is
+// normalized. The names given out are kept, so the batches of Watch don't reuse them.
+func (p *Processor) planOutputs(ctx context.Context) {
+	if p.outputDir == "" {
+		return
+	}
+	wanted := make([]string, len(p.jobs))
+	kept := make([]bool, len(p.jobs))
+	for i := range p.jobs {
+		job := &p.jobs[i]
+		rel, err := p.relPath(job.mediaPath)
+		if err != nil {
+			rel = filepath.Base(job.mediaPath)
+		}
+		dir, name := filepath.Split(rel)
+		if p.renameToTitle {
+			if title := p.titleName(ctx, job); title != "" {
+				name = title
+			}
+		}
+		if p.normalizeNames {
+			name = normalizeFileName(name)
+		}
+		if p.nameTemplate != "" {
+			if photoTime, ok := p.prepareJob(ctx, job); ok {
+				dir, name = expandNameTemplate(p.nameTemplate, photoTime, dir, name)
+			}
+		}
+		wanted[i] = filepath.Join(dir, name)
+		kept[i] = wanted[i] == rel
+	}
+
+	if p.outputTaken == nil {
+		p.outputTaken = make(map[string]bool)
+	}
+	for _, pass := range []bool{true, false} {
+		for i := range p.jobs {
+			if kept[i] == pass {
+				p.jobs[i].outputPath = uniquePath(filepath.Join(p.outputDir, wanted[i]), p.outputTaken)
+			}
+		}
+	}
+}
+
+// uniquePath returns path, or path with "_2", "_3", ... before the extension when it
+// is already taken. Paths are compared case-insensitively, as on Windows and macOS.
+func uniquePath(path string, taken map[string]bool) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	candidate := path
+	for n := 2; taken[strings.ToLower(candidate)]; n++ {
+		candidate = stem + "_" + strconv.Itoa(n) + ext
+	}
+	taken[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// confusables maps look-alike Unicode characters to the ASCII character they imitate;
+// an empty replacement removes the character
+var confusables = map[rune]string{
+	'\u00a0': " ", '\u2000': " ", '\u2001': " ", '\u2002': " ", '\u2003': " ", '\u2004': " ",
+	'\u2005': " ", '\u2006': " ", '\u2007': " ", '\u2008': " ", '\u2009': " ", '\u200a': " ",
+	'\u202f': " ", '\u205f': " ", '\u3000': " ",
+	'\u200b': "", '\u200c': "", '\u200d': "", '\u2060': "", '\ufeff': "",
+	'\u2010': "-", '\u2011': "-", '\u2012': "-", '\u2013': "-", '\u2014': "-", '\u2015': "-", '\u2212': "-",
+	'\u2018': "'", '\u2019': "'", '\u201a': "'", '\u201b': "'", '\u2032': "'",
+	'\u201c': "'", '\u201d': "'", '\u201e': "'", '\u2033': "'",
+	'\u2024': ".", '\u2026': "...", '\u2044': "_", '\u2215': "_", '\u29f8': "_",
+}
+
+// windowsInvalid lists the characters Windows does not allow in file names
+const windowsInvalid = `<>:"/\|?*`
+
+// normalizeFileName returns a clean version of a Takeout file name, keeping its
+// extension (lower-cased)
+func normalizeFileName(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if number := duplicateNumber.FindString(stem); number != "" && strings.HasSuffix(stem, number) {
+		stem = strings.TrimSuffix(stem, number)
+	}
+
+	var b strings.Builder
+	for _, r := range stem {
+		switch {
+		case r >= '\uff01' && r <= '\uff5e': // Full-width ASCII
+			r -= 0xfee0
+		case r < 0x20 || r == 0x7f:
+			continue
+		}
+		if replacement, ok := confusables[r]; ok {
+			b.WriteString(replacement)
+			continue
+		}
+		if strings.ContainsRune(windowsInvalid, r) {
+			b.WriteRune('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	stem = strings.Join(strings.Fields(b.String()), " ")
+	stem = strings.TrimRight(stem, ". ")
+	if stem == "" {
+		stem = "unnamed"
+	}
+	return stem + ext
+}
+
+// outputRel returns a path written by the run relative to the directory it was
+// written under: the output directory in output mode, otherwise its export root
+func (p *Processor) outputRel(path string) (string, error) {
+	if p.outputDir == "" {
+		return p.relPath(path)
+	}
+	return filepath.Rel(p.outputDir, path)
+}
+
+// linkToOutput hardlinks a media file to its planned output path in OutputHardlink
+// mode and copies it otherwise, or when it can't be linked. It reports whether the
+// output is a link.
+func (p *Processor) linkToOutput(mediaPath, outputPath string) (bool, error) {
+	if p.outputMode != OutputHardlink {
+		return false, p.copyToOutput(mediaPath, outputPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return false, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to replace previous copy: %w", err)
+	}
+	err := os.Link(mediaPath, outputPath)
+	if err == nil {
+		return true, nil
+	}
+	if p.verbose {
+		fmt.Printf("    Hardlink failed (%v), copying instead\n", err)
+	}
+	return false, p.copyToOutput(mediaPath, outputPath)
+}
+
+// countLinked counts an output file that is still a hardlink of its media file
+func (p *Processor) countLinked(mediaPath, outputPath string) {
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return
+	}
+	if source, err := os.Stat(mediaPath); err == nil && os.SameFile(info, source) {
+		p.counters.linkedFiles.Add(1)
+	}
+}
+
+// copyToOutput copies a media file to its planned output path, replacing the copy
+// left by an earlier run
+func (p *Processor) copyToOutput(mediaPath, outputPath string) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace previous copy: %w", err)
+	}
+	if err := p.copyVerified(mediaPath, outputPath); err != nil {
+		return fmt.Errorf("failed to copy to output directory: %w", err)
+	}
+	return nil
+}
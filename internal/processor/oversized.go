@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+)
+
+// OversizedVideo is a video skipped for being larger than WithMaxVideoSize allows
+type OversizedVideo struct {
+	Path string
+	Size int64
+}
+
+// WithMaxVideoSize skips videos larger than limit bytes as SkipTooLarge instead of
+// remuxing them, which takes hours and twice their size in free space on small
+// devices. They are listed in Statistics.OversizedVideos (split videos by their
+// parts), to be processed later on a machine up to it; 0 disables the limit.
+func WithMaxVideoSize(limit int64) Option {
+	return func(p *Processor) error {
+		p.maxVideoSize = max(limit, 0)
+		return nil
+	}
+}
+
+// skipOversized records a video over the size limit as skipped and reports whether
+// the job must stop there. Its sidecar is kept for the later run.
+func (p *Processor) skipOversized(job fileJob) bool {
+	if p.maxVideoSize == 0 || job.size <= p.maxVideoSize || !isVideoFile(job.mediaPath) {
+		return false
+	}
+	fmt.Printf("[SKIP] %s is larger than -max-video-size (%d bytes)\n", job.mediaPath, job.size)
+	listed := []OversizedVideo{{Path: job.mediaPath, Size: job.size}}
+	if len(job.splitParts) > 0 {
+		listed = listed[:0]
+		for _, part := range job.splitParts {
+			video := OversizedVideo{Path: part}
+			if info, err := os.Stat(part); err == nil {
+				video.Size = info.Size()
+			}
+			listed = append(listed, video)
+		}
+	}
+	p.update(func(s *Statistics) { s.OversizedVideos = append(s.OversizedVideos, listed...) })
+	p.recordSkip(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath,
+		Message: fmt.Sprintf("%d bytes, over the -max-video-size limit", job.size)}, SkipTooLarge)
+	return true
+}
@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// PartnerOptions controls how items shared by a Google Photos partner are handled
+type PartnerOptions struct {
+	OutputDir   string // Move partner items under this root, preserving their relative path
+	Tag         bool   // Add a "Partner: <name>" keyword to partner items
+	DefaultName string // Partner name used when none can be parsed from the folder structure
+}
+
+// WithPartnerOptions configures partner sharing detection and routing
+func WithPartnerOptions(opts PartnerOptions) Option {
+	return func(p *Processor) error {
+		if opts.OutputDir != "" {
+			abs, err := filepath.Abs(opts.OutputDir)
+			if err != nil {
+				return fmt.Errorf("failed to resolve partner directory: %w", err)
+			}
+			opts.OutputDir = abs
+		}
+		p.partnerOpts = opts
+		return nil
+	}
+}
+
+// detectPartner reports whether the media file came from partner sharing, either
+// through the JSON origin or a "Partner sharing" folder, and the partner's name if known.
+func (p *Processor) detectPartner(mediaPath string, meta *metadata.Metadata) (bool, string) {
+	rel, err := p.relPath(mediaPath)
+	if err != nil {
+		rel = mediaPath
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+
+	// Folder layout: .../Partner sharing/<Partner Name>/.../photo.jpg
+	for i, part := range parts[:len(parts)-1] {
+		if !isPartnerFolderName(part) {
+			continue
+		}
+		if i+1 < len(parts)-1 {
+			return true, parts[i+1]
+		}
+		return true, p.partnerOpts.DefaultName
+	}
+
+	if meta.Origin.FromPartnerSharing != nil {
+		return true, p.partnerOpts.DefaultName
+	}
+	return false, ""
+}
+
+// isPartnerFolderName matches folder names like "Partner sharing" or "partner-shared"
+func isPartnerFolderName(name string) bool {
+	normalized := strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToLower(name))
+	return strings.HasPrefix(normalized, "partner shar")
+}
+
+// partnerKeyword returns the keyword used to tag partner items
+func partnerKeyword(name string) string {
+	if name == "" {
+		return "Partner sharing"
+	}
+	return "Partner: " + name
+}
+
+// routePartnerFile moves a processed partner item (its copy in output mode) under
+// the partner output root and returns its new path, or mediaPath when it could not
+// be moved
+func (p *Processor) routePartnerFile(mediaPath string) (string, error) {
+	rel, err := p.outputRel(mediaPath)
+	if err != nil {
+		return mediaPath, fmt.Errorf("failed to compute relative path: %w", err)
+	}
+	target := filepath.Join(p.partnerOpts.OutputDir, rel)
+
+	if p.dryRun {
+		fmt.Printf("[DRY-RUN] Would move partner item to: %s\n", target)
+		return target, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return mediaPath, fmt.Errorf("failed to create partner output directory: %w", err)
+	}
+	if err := p.moveFile(mediaPath, target); err != nil {
+		return mediaPath, fmt.Errorf("failed to move partner item: %w", err)
+	}
+	if p.verbose {
+		fmt.Printf("    Moved partner item to: %s\n", target)
+	}
+	return target, nil
+}
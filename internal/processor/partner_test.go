@@ -0,0 +1,31 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithPartnerOptionsDir(t *testing.T) {
+	root := t.TempDir()
+
+	// A relative directory is resolved when the option is applied
+	p, err := New(root, WithPartnerOptions(PartnerOptions{OutputDir: "partner"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := filepath.Abs("partner"); p.partnerOpts.OutputDir != want {
+		t.Errorf("partner directory %q, want %q", p.partnerOpts.OutputDir, want)
+	}
+
+	// One inside the export would move processed files back into it
+	for _, inside := range []string{root, filepath.Join(root, "Partner sharing"), filepath.Join(root, "Photos", "..", "partner")} {
+		_, err := New(root, WithPartnerOptions(PartnerOptions{OutputDir: inside}))
+		if err == nil || !strings.Contains(err.Error(), "partner directory") {
+			t.Errorf("partner directory %s inside the export: %v, want it refused", inside, err)
+		}
+	}
+	if _, err := New(root, WithPartnerOptions(PartnerOptions{OutputDir: filepath.Join(t.TempDir(), "partner")})); err != nil {
+		t.Errorf("partner directory outside the export: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// pauseCheckInterval is how often a paused run looks whether the pause file is gone
+const pauseCheckInterval = 2 * time.Second
+
+// Pause stops handing out new files until Resume; the files in progress are finished.
+// Nothing already done is lost, and the run goes on where it stopped.
+func (p *Processor) Pause() {
+	p.setPaused(true)
+}
+
+// Resume goes on with a run stopped by Pause
+func (p *Processor) Resume() {
+	p.setPaused(false)
+}
+
+// TogglePause pauses a running run or resumes a paused one, and reports whether it
+// is now paused
+func (p *Processor) TogglePause() bool {
+	p.pauseMutex.Lock()
+	paused := !p.userPaused
+	p.pauseMutex.Unlock()
+	p.setPaused(paused)
+	return paused
+}
+
+// WithPauseFile pauses the run while a file exists at path: creating it pauses once the
+// files in progress are finished, deleting it resumes. An empty path disables it.
+func WithPauseFile(path string) Option {
+	return func(p *Processor) error {
+		p.pauseFile = path
+		return nil
+	}
+}
+
+// setPaused records a pause or resume request and wakes the waiting workers
+func (p *Processor) setPaused(paused bool) {
+	p.pauseMutex.Lock()
+	changed := p.userPaused != paused
+	p.userPaused = paused
+	if changed && p.pauseWake != nil {
+		close(p.pauseWake)
+		p.pauseWake = nil
+	}
+	p.pauseMutex.Unlock()
+	p.pausedNow()
+}
+
+// pausedNow reports whether the run is paused, by Pause or the pause file, and
+// announces when that changes. The wake channel is closed by the next Pause or Resume.
+func (p *Processor) pausedNow() (bool, <-chan struct{}) {
+	paused := false
+	if p.pauseFile != "" {
+		_, err := os.Stat(p.pauseFile)
+		paused = err == nil
+	}
+
+	p.pauseMutex.Lock()
+	defer p.pauseMutex.Unlock()
+	paused = paused || p.userPaused
+	if paused != p.pauseAnnounced {
+		if paused {
+			fmt.Println("[PAUSE] Paused, the files in progress are finished first")
+		} else {
+			fmt.Println("[PAUSE] Resuming")
+		}
+		p.pauseAnnounced = paused
+	}
+	if p.pauseWake == nil {
+		p.pauseWake = make(chan struct{})
+	}
+	return paused, p.pauseWake
+}
+
+// waitPaused holds a worker back while the run is paused, and reports whether it
+// should go on with its file
+func (p *Processor) waitPaused(ctx context.Context) bool {
+	for {
+		paused, wake := p.pausedNow()
+		if !paused {
+			return true
+		}
+		timer := time.NewTimer(pauseCheckInterval)
+		select {
+		case <-timer.C:
+		case <-wake:
+			timer.Stop()
+		case <-p.abort:
+			timer.Stop()
+			return false
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
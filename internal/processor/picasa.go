@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Sources of the metadata merged with WithPicasa
+const (
+	PicasaSourceJSON = "json"   // The Takeout sidecar
+	PicasaSourceIni  = "picasa" // The folder's .picasa.ini
+)
+
+// WithPicasa merges what the .picasa.ini of a media file's folder records about it,
+// captions, keywords, stars and face names, into the metadata from its sidecar.
+// Sources is the priority of PicasaSourceJSON and PicasaSourceIni, the first one
+// winning where both have a caption (empty = the JSON first).
+func WithPicasa(enabled bool, sources []string) Option {
+	return func(p *Processor) error {
+		prefer := false
+		if len(sources) > 0 {
+			for _, source := range sources {
+				switch source {
+				case PicasaSourceJSON, PicasaSourceIni:
+				default:
+					return fmt.Errorf("unknown Picasa source %q (expected %s or %s)", source, PicasaSourceJSON, PicasaSourceIni)
+				}
+			}
+			prefer = sources[0] == PicasaSourceIni
+		}
+		p.picasa, p.picasaPrefer = enabled, prefer
+		return nil
+	}
+}
+
+// picasaIni returns the cached Picasa database of a folder, nil when it has none
+func (p *Processor) picasaIni(dir string) *metadata.PicasaIni {
+	p.picasaMutex.Lock()
+	defer p.picasaMutex.Unlock()
+
+	if ini, ok := p.picasaCache[dir]; ok {
+		return ini
+	}
+	var ini *metadata.PicasaIni
+	if path := metadata.FindPicasaIni(dir); path != "" {
+		var err error
+		if ini, err = metadata.ParsePicasaIni(path); err != nil {
+			p.warn(path, "Ignoring %s: %v", path, err)
+		}
+	}
+	p.picasaCache[dir] = ini
+	return ini
+}
+
+// applyPicasa merges the .picasa.ini entry of a media file into its metadata
+func (p *Processor) applyPicasa(mediaPath string, meta *metadata.Metadata) {
+	if !p.picasa || meta.FromPicasa() {
+		return
+	}
+	ini := p.picasaIni(filepath.Dir(mediaPath))
+	if ini == nil {
+		return
+	}
+	entry, ok := ini.Entry(filepath.Base(mediaPath))
+	if !ok {
+		return
+	}
+	meta.MergePicasa(entry, p.picasaPrefer)
+	if p.verbose {
+		fmt.Printf("[PICASA] Merged the .picasa.ini entry of %s\n", mediaPath)
+	}
+}
@@ -0,0 +1,288 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PipelineApply is the first step of every pipeline, the metadata run itself
+const PipelineApply = "apply"
+
+// DefaultReorganizeTemplate files reorganized copies by year and month
+const DefaultReorganizeTemplate = "{yyyy}/{mm}/{original}"
+
+// Duplicate is a processed file whose content another processed file already has
+type Duplicate struct {
+	Path     string // The duplicate, left out of the reorganized library
+	Original string // The file kept instead
+}
+
+// PipelineOptions configures the steps run after the metadata is applied
+type PipelineOptions struct {
+	Steps    []string // PipelineApply followed by StageDedupe, StageReorganize and StageVerify, in that order
+	Dir      string   // Library the reorganize step copies the files into
+	Template string   // Folders and names of the reorganized copies (empty = DefaultReorganizeTemplate)
+}
+
+// WithPipeline chains steps after the metadata run in the same invocation, working on
+// the run's file results instead of walking the tree again: StageDedupe finds files
+// with the same content, StageReorganize copies the others into a library sorted by
+// photo time, and StageVerify checks the copies (or the written files) against the
+// checksums recorded while writing, which are recorded for it. Each step is timed
+// as a run stage.
+func WithPipeline(opts PipelineOptions) Option {
+	return func(p *Processor) error {
+		if len(opts.Steps) == 0 {
+			p.pipeline = PipelineOptions{}
+			return nil
+		}
+		order := []string{PipelineApply, StageDedupe, StageReorganize, StageVerify}
+		if opts.Steps[0] != PipelineApply {
+			return fmt.Errorf("a pipeline starts with %s", PipelineApply)
+		}
+		next := 1
+		for _, step := range opts.Steps[1:] {
+			i := indexOf(order, step)
+			if i < 0 {
+				return fmt.Errorf("unknown pipeline step %q (expected %s)", step, strings.Join(order, ", "))
+			}
+			if i < next {
+				return fmt.Errorf("pipeline step %s is out of order or repeated (expected the order %s)", step, strings.Join(order, ", "))
+			}
+			next = i + 1
+		}
+		if hasStep(opts.Steps, StageReorganize) {
+			if opts.Dir == "" {
+				return errors.New("the reorganize step needs a library directory")
+			}
+			abs, err := filepath.Abs(opts.Dir)
+			if err != nil {
+				return fmt.Errorf("failed to resolve reorganize directory: %w", err)
+			}
+			opts.Dir = abs
+			if opts.Template == "" {
+				opts.Template = DefaultReorganizeTemplate
+			}
+			if err := validateNameTemplate(opts.Template); err != nil {
+				return err
+			}
+		}
+		p.pipeline = opts
+		return nil
+	}
+}
+
+// indexOf returns the position of s in list, -1 when it is not there
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasStep reports whether a pipeline includes a step
+func hasStep(steps []string, step string) bool {
+	return indexOf(steps, step) >= 0
+}
+
+// runPipeline runs the steps after the metadata run on the files it wrote
+func (p *Processor) runPipeline(ctx context.Context) {
+	if len(p.pipeline.Steps) < 2 || p.dryRun {
+		return
+	}
+	files := p.writtenFiles()
+	var duplicates map[string]string
+	if hasStep(p.pipeline.Steps, StageDedupe) {
+		duplicates = p.dedupe(files)
+	}
+	copies := make(map[string]string)
+	if hasStep(p.pipeline.Steps, StageReorganize) && ctx.Err() == nil {
+		copies = p.reorganize(ctx, files, duplicates)
+	}
+	if hasStep(p.pipeline.Steps, StageVerify) && ctx.Err() == nil {
+		p.verify(ctx, files, copies)
+	}
+}
+
+// writtenFiles returns the results of the files the run wrote or found up to date,
+// in path order
+func (p *Processor) writtenFiles() []FileResult {
+	var files []FileResult
+	for _, f := range p.getStatsCopy().Files {
+		if f.Status == StatusModified || f.Status == StatusUnchanged {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// resultPath returns where a processed file is after the run
+func resultPath(f FileResult) string {
+	if f.Output != "" {
+		return f.Output
+	}
+	return f.Path
+}
+
+// dedupe finds written files with the same checksum and returns each duplicate's
+// original, the first of them in path order
+func (p *Processor) dedupe(files []FileResult) map[string]string {
+	started := time.Now()
+	first := make(map[string]string)
+	duplicates := make(map[string]string)
+	var found []Duplicate
+	for _, f := range files {
+		if f.SHA256 == "" {
+			continue
+		}
+		original, ok := first[f.SHA256]
+		if !ok {
+			first[f.SHA256] = f.Path
+			continue
+		}
+		duplicates[f.Path] = original
+		found = append(found, Duplicate{Path: f.Path, Original: original})
+		if p.verbose {
+			fmt.Printf("[DEDUPE] %s has the same content as %s\n", f.Path, original)
+		}
+	}
+	p.update(func(s *Statistics) { s.Duplicates = append(s.Duplicates, found...) })
+	p.recordStage(StageDedupe, len(files), time.Since(started), 0, 0)
+	return duplicates
+}
+
+// reorganize copies the written files, without duplicates, into the library named by
+// the template and returns the copy of each file. A copy with the same content left by
+// an earlier run is kept; other names already taken are numbered.
+func (p *Processor) reorganize(ctx context.Context, files []FileResult, duplicates map[string]string) map[string]string {
+	started := time.Now()
+	copies := make(map[string]string)
+	taken := make(map[string]bool)
+	var copied int
+	var read, written int64
+	for _, f := range files {
+		if ctx.Err() != nil || p.aborted() {
+			break
+		}
+		if _, dup := duplicates[f.Path]; dup {
+			continue
+		}
+		source := resultPath(f)
+		target, err := p.reorganizedPath(f, source)
+		if err != nil {
+			p.recordError()
+			fmt.Printf("[ERROR] Cannot reorganize %s: %v\n", source, err)
+			continue
+		}
+		wanted := target
+		target = uniquePath(wanted, taken)
+		for {
+			sum, err := FileChecksum(target)
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			if err == nil && sum == f.SHA256 {
+				break // Copied by an earlier run
+			}
+			target = uniquePath(wanted, taken)
+		}
+
+		if _, err := os.Lstat(target); err == nil {
+			copies[f.Path] = target
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			p.recordError()
+			fmt.Printf("[ERROR] Cannot reorganize %s: failed to create directory: %v\n", source, err)
+			continue
+		}
+		if err := p.copyVerified(source, target); err != nil {
+			os.Remove(target)
+			p.recordError()
+			fmt.Printf("[ERROR] Cannot reorganize %s: %v\n", source, err)
+			continue
+		}
+		copies[f.Path] = target
+		copied++
+		if info, err := os.Stat(target); err == nil {
+			read += info.Size()
+			written += info.Size()
+		}
+		if p.verbose {
+			fmt.Printf("[REORGANIZE] %s -> %s\n", source, target)
+		}
+	}
+	p.update(func(s *Statistics) { s.Reorganized += copied })
+	p.recordStage(StageReorganize, len(copies), time.Since(started), read, written)
+	return copies
+}
+
+// reorganizedPath returns where the template puts the copy of a file. Files without
+// a photo time keep their folder relative to the export.
+func (p *Processor) reorganizedPath(f FileResult, source string) (string, error) {
+	rel, err := p.relPath(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute relative path: %w", err)
+	}
+	dir, name := filepath.Dir(rel), filepath.Base(source)
+	if !f.PhotoTime.IsZero() {
+		dir, name = expandNameTemplate(p.pipeline.Template, f.PhotoTime, dir, name)
+	}
+	return filepath.Join(p.pipeline.Dir, dir, name), nil
+}
+
+// verify checks the reorganized copies, or without a reorganize step the written
+// files, against the checksums recorded while writing
+func (p *Processor) verify(ctx context.Context, files []FileResult, copies map[string]string) {
+	started := time.Now()
+	reorganized := hasStep(p.pipeline.Steps, StageReorganize)
+	var checked int
+	var read int64
+	var failures []string
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		path := resultPath(f)
+		if reorganized {
+			var ok bool
+			if path, ok = copies[f.Path]; !ok {
+				continue // A duplicate, or its copy failed and was reported
+			}
+		}
+		if f.SHA256 == "" {
+			continue
+		}
+		checked++
+		sum, err := FileChecksum(path)
+		var failure string
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			failure = "missing"
+		case err != nil:
+			failure = err.Error()
+		case sum != f.SHA256:
+			failure = "changed since it was written"
+		default:
+			if info, err := os.Stat(path); err == nil {
+				read += info.Size()
+			}
+			continue
+		}
+		p.recordError()
+		fmt.Printf("[ERROR] Verification failed for %s: %s\n", path, failure)
+		failures = append(failures, fmt.Sprintf("%s: %s", path, failure))
+	}
+	p.update(func(s *Statistics) { s.VerifyFailures = append(s.VerifyFailures, failures...) })
+	p.recordStage(StageVerify, checked, time.Since(started), read, 0)
+}
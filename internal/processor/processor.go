@@ -1,42 +1,197 @@
 package processor
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
+	"google-takeout-exif-applier/internal/manifest"
 	"google-takeout-exif-applier/internal/metadata"
 )
 
+// ErrTooManyErrors is returned by Process when the -max-errors limit aborted the run
+var ErrTooManyErrors = errors.New("too many errors")
+
+// ErrNoSidecar is recorded in FileResult.Err for media files without a JSON sidecar
+var ErrNoSidecar = errors.New("no JSON sidecar found")
+
 type Statistics struct {
-	TotalFiles        int
-	JSONFiles         int
-	ProcessedFiles    int
-	ModifiedFiles     int
-	UnmodifiedFiles   int
-	SkippedFiles      int
-	ErrorCount        int
-	ModifiedDetails   []string
-	UnmodifiedDetails []string
-	mu                sync.Mutex // Protect concurrent access to stats
+	TotalFiles         int // MediaFiles + SidecarFiles + OtherFiles
+	MediaFiles         int // Files with a media extension found by the scan, processed or skipped
+	SidecarFiles       int // JSON files found by the scan, whether or not they match a media file
+	OtherFiles         int // Everything else, NonMediaFiles and files skipped as an unsupported type included
+	JSONFiles          int
+	NonMediaFiles      int // HTML and CSV indexes and other files that are not media, ignored by the scan
+	LegacyFiles        int // Sidecars in Album Archive or print order formats, see metadata.Metadata.Format
+	PicasaFiles        int // Files with a .picasa.ini entry merged in, see WithPicasa
+	ProcessedFiles     int
+	ModifiedFiles      int
+	UnmodifiedFiles    int
+	SkippedFiles       int
+	SkipReasons        map[string]int // Skipped files per reason, see SkipReasonNames
+	PartnerFiles       int
+	CreationFiles      int // Collages, animations and effects created by Google Photos
+	CorruptFiles       int // Empty or truncated media files, skipped as SkipCorrupt
+	TransportStreams   int // .ts, .mts and .m2ts files found to be MPEG transport streams
+	SyncedFiles        int // Sidecar-less files whose time was set from EXIF
+	ClonedFiles        int // Copies made as copy-on-write clones instead of byte copies
+	LinkedFiles        int // Output files left as hardlinks of the export, see WithOutputMode
+	WriteMismatches    int // Written files whose tags did not read back as written, see WithVerifyWrites
+	ErrorCount         int
+	BytesChanged       int64 // Bytes added by native EXIF segment insertion
+	ModifiedDetails    []string
+	UnmodifiedDetails  []string
+	Albums             []AlbumReport
+	TimestampConflicts []string              // Files whose taken and creation times differ beyond the threshold
+	TimezoneAudit      []string              // Files whose time looks off by a whole number of hours
+	Escapes            []string              // Paths resolving outside the root through symlinks or junctions
+	MergeConflicts     []MergeConflict       // Photos in several exports whose sidecars disagree
+	SuspectedMatches   []string              // Files skipped because their sidecar's title names another photo
+	MatchStrategies    map[string]int        // Media files per sidecar match strategy
+	IndexCheck         *IndexCheck           // Cross-check against archive_browser.html, nil without one
+	Duplicates         []Duplicate           // Processed files with the content of another, with the dedupe step
+	Reorganized        int                   // Files copied by the reorganize step
+	VerifyFailures     []string              // Files that failed the verify step and why
+	SlowestFiles       []FileTiming          // Files that took longest, slowest first, see WithSlowestFiles
+	OversizedVideos    []OversizedVideo      // Videos skipped as SkipTooLarge, see WithMaxVideoSize
+	Stages             map[string]StageStats // Time and IO volume per run stage
+	Elapsed            time.Duration         // Wall time of the scan and the processing, without prompts
+	Files              []FileResult
 }
 
 type Processor struct {
-	rootDir      string
-	dryRun       bool
-	verbose      bool
-	stats        Statistics
-	deletedFiles map[string]bool // Track deleted supplemental files
-	deletedMutex sync.Mutex      // Protect deletedFiles map
-	workerCount  int             // Number of concurrent workers
+	rootDir             string
+	dryRun              bool
+	verbose             bool
+	stats               Statistics   // Detail lists, only touched by the stats collector
+	counters            statCounters // Hot-path counters, updated atomically
+	updates             chan func(*Statistics)
+	collectorOnce       sync.Once
+	deletedFiles        map[string]bool // Track deleted supplemental files
+	sidecarUsers        map[string]int  // Jobs still to apply each sidecar
+	deletedMutex        sync.Mutex      // Protect deletedFiles and sidecarUsers
+	workerCount         int             // Number of concurrent workers
+	minWorkers          int             // Autoscaling bounds (maxWorkers 0 = fixed pool)
+	maxWorkers          int
+	applyOpts           metadata.ApplyOptions
+	partnerOpts         PartnerOptions
+	jobs                []fileJob         // Media files collected by Scan
+	fileList            []string          // Explicit media paths to process instead of walking the root
+	presetSidecars      map[string]string // Sidecar matches carried over by -retry-from
+	syncMTime           bool              // Set file times from EXIF for media without a sidecar
+	rootOnce            sync.Once
+	rootReals           []string // Root directories with symlinks resolved
+	mergeRoots          []string // Other Takeout exports of the same library
+	conflictRule        string   // How duplicates across exports are resolved
+	plan                *Plan
+	maxErrors           int           // Abort once this many errors occurred (0 = no limit)
+	abort               chan struct{} // Closed when the run is aborted
+	abortOnce           sync.Once
+	order               string   // Job queue order (path, size, oldest-first)
+	priorityAlbums      []string // Album folders queued before everything else
+	albumFilter         []string // Only process these album folders (empty = all)
+	albumKeywords       bool     // Add album location enrichments as keywords
+	albumNameKeyword    bool     // Add the album title as a keyword
+	labelKeywords       bool     // Add JSON people/tags/labels as keywords
+	tagCreations        bool     // Add CreationKeyword to Google Photos creations
+	sharedComments      string   // Where shared album likes and comments go (xmp, text; empty = nowhere)
+	descriptionTemplate string   // Template of the written description (empty = the JSON description)
+	albumCache          map[string]*albumInfo
+	albumDirs           map[string]bool // Folders with an album metadata file, found by the walk
+	albumMutex          sync.Mutex
+	picasa              bool // Merge .picasa.ini entries into the metadata
+	picasaPrefer        bool // Picasa entries win over the JSON
+	picasaCache         map[string]*metadata.PicasaIni
+	picasaMutex         sync.Mutex
+	timePolicy          string             // Timestamp to use when taken/creation times conflict
+	timeThreshold       time.Duration      // Gap above which taken/creation times conflict (0 = off)
+	folderRules         []folderRule       // Per-folder date overrides and offsets
+	filenameDateRules   []filenameDateRule // Date sources for media named by apps like WhatsApp
+	timeShift           TimeShift          // Clock-skew correction applied to every file
+	cameraShifts        map[string]TimeShift
+	tzAudit             bool // Report whole-hour differences against GPS local time
+	tzCorrect           bool // Write the GPS-derived local time instead of UTC
+	metaCache           *metadata.Cache
+	candidateStrategies []CandidateStrategy // Sidecar naming schemes to try (nil = default)
+	matchMode           string              // Sidecar matching heuristics (strict, normal, aggressive)
+	force               bool                // Apply sidecars whose title does not match the file name
+	checksums           bool                // Record file checksums in the results
+	auditXMP            bool                // Embed the source of the metadata in XMP
+	seenMedia           map[string]int      // Media file names found by the walk, for the index check
+	seenFile            *os.File            // Temporary name index replacing seenMedia in low-memory mode
+	seenWriter          *bufio.Writer       // Buffers writes to seenFile
+	lowMemory           bool                // Trade speed and detail for flat memory use
+	extractZips         bool                // Extract zips found in the export and process their contents
+	mergeSplitVideos    bool                // Join the parts of split videos before applying metadata
+	fileTimeout         time.Duration       // Deadline for processing one file (0 = none)
+	outputDir           string              // Write into copies under this directory (empty = in place)
+	outputTaken         map[string]bool     // Output paths given out, kept across the batches of Watch
+	outputMode          string              // OutputCopy or OutputHardlink
+	quarantineDir       string              // Move corrupt media files here (empty = leave them)
+	normalizeNames      bool                // Clean up file names in the output directory
+	nameTemplate        string              // Output file name template (empty = keep names)
+	renameToTitle       bool                // Rename media with generated names to their JSON title
+	renameJournal       string              // Journal recording the renames made in place
+	journalMutex        sync.Mutex          // Serialize writes to renameJournal
+	lookupTime          time.Duration       // Time spent looking up sidecars during the walk
+	scanTime            time.Duration       // Wall time of Scan, for Statistics.Elapsed
+	jsonRoot            string              // Mirrored directory tree holding sidecars (empty = none)
+	relocatedDir        string              // Library holding copies to write instead of the export
+	relocatedMatch      string              // How the copies are found (name-size, hash)
+	manifestPath        string              // Manifest providing the metadata instead of sidecars
+	manifestInfo        os.FileInfo
+	manifestEntries     map[string]manifest.Entry // By SHA-256
+	manifestSizes       map[int64]bool            // Sizes of the manifest's files, to hash only candidates
+	batchBy             string                    // Split the run into batches (year, album; empty = one run)
+	batchCheckpoint     string                    // File recording the completed batches
+	batchHandler        func(Batch, Statistics)   // Called after each batch
+	batchesDone         map[string]bool           // Batches completed by this or a previous run
+	events              chan Event                // Progress for a subscriber, nil without one
+	eventsOnce          sync.Once
+	eventsStop          chan struct{} // Closed once senders must no longer wait for the subscriber
+	eventsStopOnce      sync.Once
+	eventsMutex         sync.RWMutex // Held for writing to close events, for reading to send
+	eventsClosed        bool
+	pipeline            PipelineOptions // Steps chained after the metadata run
+	slowestFiles        int             // How many of the slowest files to keep
+	quietWindows        []quietWindow   // Pause or throttle during these, see WithQuietHours
+	quietMode           string          // QuietPause or QuietThrottle
+	quietAnnounced      time.Time       // End of the quiet hours last announced, zero once resumed
+	quietMutex          sync.Mutex
+	throttleSlot        chan struct{} // Held by the one file processed while throttled
+	pauseFile           string        // The run is paused while this file exists
+	userPaused          bool          // Paused by Pause or TogglePause
+	pauseAnnounced      bool          // Whether the last announcement was a pause
+	pauseWake           chan struct{} // Closed when Pause or Resume is called
+	pauseMutex          sync.Mutex
+	maxVideoSize        int64           // Skip larger videos (0 = no limit)
+	excludeTransport    bool            // Skip .ts, .mts and .m2ts files without sniffing them
+	verifyWrites        bool            // Read the written tags back, see WithVerifyWrites
+	resume              bool            // Continue the interrupted run, see WithResume
+	resumed             map[string]bool // Files the interrupted run completed
+	state               *runState       // Journal of the completed files, nil in dry runs
+	ioLimit             *ioLimiter      // Paces the workers, nil without WithIOLimits
 }
 
 type fileJob struct {
-	mediaPath string
+	mediaPath   string
+	jsonPath    string
+	jsonInfo    os.FileInfo
+	jsonErr     error
+	matchRule   string // Strategy that found the sidecar, MatchNone when none was found
+	size        int64
+	outputPath  string             // Destination of the copy in output mode, or the relocated copy
+	meta        *metadata.Metadata // Metadata prepared by Scan or taken from the manifest, nil otherwise
+	pairedImage string             // Still image whose sidecar a Live Photo video uses
+	splitParts  []string           // Parts to join into mediaPath before processing it
+	renamePath  string             // New name from the JSON title, given after the metadata is written
 }
 
 type processResult struct {
@@ -44,36 +199,190 @@ type processResult struct {
 	jobData   fileJob
 }
 
-func New(rootDir string, dryRun, verbose bool) *Processor {
+// New creates a processor for the Takeout export at rootDir, configured by opts. It
+// returns the error of the first option that rejects its value, or of the settings
+// checked against each other once all options are applied.
+func New(rootDir string, opts ...Option) (*Processor, error) {
 	// Default to number of CPUs for worker count, but at least 2
 	workerCount := runtime.NumCPU()
 	if workerCount < 2 {
 		workerCount = 2
 	}
 
-	return &Processor{
+	p := &Processor{
 		rootDir:      rootDir,
-		dryRun:       dryRun,
-		verbose:      verbose,
 		workerCount:  workerCount,
 		deletedFiles: make(map[string]bool),
+		abort:        make(chan struct{}),
+		albumCache:   make(map[string]*albumInfo),
+		albumDirs:    make(map[string]bool),
+		picasaCache:  make(map[string]*metadata.PicasaIni),
+		throttleSlot: make(chan struct{}, 1),
+		metaCache:    metadata.NewCache(),
+		seenMedia:    make(map[string]int),
+		slowestFiles: defaultSlowestFiles,
+	}
+	WithFilenameDateRules(nil)(p) // The built-in rules always compile
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.checkDirs(); err != nil {
+		return nil, err
+	}
+	if err := p.loadBatchCheckpoint(); err != nil {
+		return nil, err
+	}
+	if err := p.loadState(); err != nil {
+		return nil, err
 	}
+	if err := p.startLowMemory(); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
-func (p *Processor) Process() (Statistics, error) {
-	// Create channels for worker pool
-	jobChan := make(chan fileJob, p.workerCount*2)
-	var wg sync.WaitGroup
+// WithFileTimeout gives each file its own deadline within the run's context, so one
+// stuck exiftool or ffmpeg call fails that file instead of stalling a worker; 0 disables it
+func WithFileTimeout(d time.Duration) Option {
+	return func(p *Processor) error {
+		p.fileTimeout = d
+		return nil
+	}
+}
+
+// WithMaxErrors aborts the run once n errors have been encountered; 0 disables the limit
+func WithMaxErrors(n int) Option {
+	return func(p *Processor) error {
+		p.maxErrors = n
+		return nil
+	}
+}
+
+// recordError counts an error and aborts the run when the error limit is reached
+func (p *Processor) recordError() {
+	count := p.counters.errorCount.Add(1)
+	if p.maxErrors > 0 && count >= int64(p.maxErrors) {
+		p.abortOnce.Do(func() {
+			fmt.Printf("[ERROR] Reached the limit of %d errors, aborting\n", p.maxErrors)
+			close(p.abort)
+		})
+	}
+}
 
-	// Start worker goroutines
-	for i := 0; i < p.workerCount; i++ {
-		wg.Add(1)
-		go p.processWorker(&wg, jobChan)
+// aborted reports whether the run has been aborted
+func (p *Processor) aborted() bool {
+	select {
+	case <-p.abort:
+		return true
+	default:
+		return false
 	}
+}
+
+// WithApplyOptions configures how metadata is written to media files. The writer
+// selection is checked.
+func WithApplyOptions(opts metadata.ApplyOptions) Option {
+	return func(p *Processor) error {
+		if err := metadata.ValidateWriter(opts.Writer); err != nil {
+			return err
+		}
+		p.applyOpts = opts
+		return nil
+	}
+}
 
-	// Collect media files to process
-	var filesToProcess []string
-	err := filepath.Walk(p.rootDir, func(path string, info os.FileInfo, err error) error {
+// WithLegacyGlobalSupplemental merges every field of a folder's supplemental-metadata.json
+// into each file, instead of only the folder-wide origin fields
+func WithLegacyGlobalSupplemental(enabled bool) Option {
+	return func(p *Processor) error {
+		p.metaCache.SetLegacyGlobalSupplemental(enabled)
+		return nil
+	}
+}
+
+// Plan summarizes the work found by Scan, before any file is modified
+type Plan struct {
+	TotalFiles   int
+	MediaFiles   int
+	ImageFiles   int
+	VideoFiles   int
+	MatchedFiles int      // Media files with a JSON sidecar
+	Actions      []string // Destructive actions the run will take
+	Hints        []string // Advice about the filesystem, shown with the actions
+}
+
+// Scan walks the root directory and resolves JSON sidecars without modifying anything.
+// Process calls Scan itself when it has not been run yet. Cancelling ctx stops the walk.
+func (p *Processor) Scan(ctx context.Context) (*Plan, error) {
+	if p.plan != nil {
+		return p.plan, nil
+	}
+
+	// Collect media files to process, either from the explicit list or by walking the root
+	started, counted := time.Now(), p.counters.scanned()
+	var err error
+	if p.fileList != nil {
+		p.scanFileList()
+	} else {
+		err = p.walkRoot(ctx)
+	}
+	if err != nil {
+		p.recordError()
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+
+	// Only a full walk can be compared with the export index
+	if p.fileList == nil {
+		p.checkArchiveIndex()
+	}
+	p.dropSeenMedia()
+
+	walked, lookups := time.Since(started), p.lookupTime
+	matchStarted := time.Now()
+	p.resolveDuplicates()
+	p.pairLivePhotos()
+	p.matchLeftovers()
+	p.findSplitVideos()
+	if err := p.matchManifest(ctx); err != nil {
+		p.recordError()
+		return nil, err
+	}
+	if err := p.relocateJobs(ctx); err != nil {
+		p.recordError()
+		return nil, err
+	}
+	p.countSidecarUsers()
+	p.recordStage(StageScan, int(p.counters.scanned()-counted), walked-lookups, 0, 0)
+	p.recordStage(StageMatch, len(p.jobs), lookups+time.Since(matchStarted), 0, 0)
+	p.sortJobs()
+	p.planOutputs(ctx)
+	p.planTitleRenames(ctx)
+	albums := p.buildAlbumReports()
+	p.update(func(s *Statistics) { s.Albums = mergeAlbumReports(s.Albums, albums) })
+	p.plan = p.buildPlan()
+	p.scanTime = time.Since(started)
+	return p.plan, nil
+}
+
+// walkRoot collects every media file below the root directory and the merged export roots
+func (p *Processor) walkRoot(ctx context.Context) error {
+	for _, root := range p.roots() {
+		if err := p.walkDir(ctx, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkDir collects every media file below one root
+func (p *Processor) walkDir(ctx context.Context, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
 			// If it's a "file not found" error for a supplemental metadata file, just skip it
 			// (it may have been deleted during processing)
@@ -84,200 +393,323 @@ func (p *Processor) Process() (Statistics, error) {
 		}
 
 		if info.IsDir() {
+			if isPartialExtraction(path) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-
-		p.stats.mu.Lock()
-		p.stats.TotalFiles++
-		p.stats.mu.Unlock()
-
-		// Skip supplemental metadata files - these are handled as part of media file processing
-		p.deletedMutex.Lock()
-		deleted := p.deletedFiles[path]
-		p.deletedMutex.Unlock()
-
-		if strings.HasSuffix(path, ".supplemental-metadata.json") || deleted {
-			return nil
+		if isNestedArchive(path) {
+			return p.collectArchive(ctx, path)
 		}
-
-		// Check if it's a supported media file (not JSON, not supplemental)
-		if isSupportedMediaFile(path) {
-			if p.verbose {
-				fmt.Printf("[MEDIA] Found media file: %s\n", path)
-			}
-			filesToProcess = append(filesToProcess, path)
+		if info.Name() == LockFileName || info.Name() == ExtractedListName || info.Name() == StateFileName {
+			return nil
 		}
 
+		p.collectFile(path, info)
 		return nil
 	})
+}
 
-	if err != nil {
-		p.stats.mu.Lock()
-		p.stats.ErrorCount++
-		p.stats.mu.Unlock()
-		close(jobChan)
-		wg.Wait()
-		return p.getStatsCopy(), fmt.Errorf("error walking directory: %w", err)
+// collectFile counts a file found during the scan as media, sidecar or other, and
+// queues it if it is a media file
+func (p *Processor) collectFile(path string, info os.FileInfo) {
+	// Skip supplemental metadata files - these are handled as part of media file processing
+	p.deletedMutex.Lock()
+	deleted := p.deletedFiles[path]
+	p.deletedMutex.Unlock()
+
+	if strings.HasSuffix(path, ".supplemental-metadata.json") || deleted {
+		p.counters.sidecarFiles.Add(1)
+		return
 	}
 
-	// Send jobs to workers
-	go func() {
-		for _, mediaPath := range filesToProcess {
-			jobChan <- fileJob{mediaPath: mediaPath}
+	// Check if it's a supported media file (not JSON, not supplemental)
+	if !isSupportedMediaFile(path) {
+		switch {
+		case strings.EqualFold(filepath.Ext(path), ".json"):
+			p.counters.sidecarFiles.Add(1)
+			if metadata.IsAlbumMetadataFile(path) {
+				p.albumDirs[filepath.Dir(path)] = true
+			}
+		case isNonMediaFile(path):
+			p.counters.otherFiles.Add(1)
+			p.counters.nonMediaFiles.Add(1)
+		default:
+			p.counters.otherFiles.Add(1)
+			p.recordSkip(FileResult{Path: path, Message: "unsupported file type"}, SkipUnsupportedType)
 		}
-		close(jobChan)
-	}()
-
-	// Wait for all workers to complete
-	wg.Wait()
-
-	return p.getStatsCopy(), nil
+		return
+	}
+	if p.skipTransportStream(path) {
+		p.counters.otherFiles.Add(1)
+		return
+	}
+	p.counters.mediaFiles.Add(1)
+	p.seeMedia(filepath.Base(path))
+	if !p.matchesAlbumFilter(path) {
+		p.recordSkip(FileResult{Path: path, Message: "not in selected albums"}, SkipFilteredOut)
+		return
+	}
+	if p.skipResumed(path) {
+		return
+	}
+	if p.verbose {
+		fmt.Printf("[MEDIA] Found media file: %s\n", path)
+	}
+	// Never touch files that symlinks or junctions lead outside the root
+	if !p.checkContainment(path, path) {
+		return
+	}
+	job := fileJob{mediaPath: path, size: info.Size()}
+	job.jsonInfo, job.jsonPath, job.matchRule, job.jsonErr = p.resolveSidecar(path)
+	if job.jsonErr == nil && !p.checkContainment(path, job.jsonPath) {
+		return
+	}
+	p.update(func(s *Statistics) {
+		if s.MatchStrategies == nil {
+			s.MatchStrategies = make(map[string]int)
+		}
+		s.MatchStrategies[job.matchRule]++
+	})
+	p.jobs = append(p.jobs, job)
 }
 
-// getStatsCopy returns a copy of statistics without the mutex
-func (p *Processor) getStatsCopy() Statistics {
-	p.stats.mu.Lock()
-	defer p.stats.mu.Unlock()
-	return Statistics{
-		TotalFiles:        p.stats.TotalFiles,
-		JSONFiles:         p.stats.JSONFiles,
-		ProcessedFiles:    p.stats.ProcessedFiles,
-		ModifiedFiles:     p.stats.ModifiedFiles,
-		UnmodifiedFiles:   p.stats.UnmodifiedFiles,
-		SkippedFiles:      p.stats.SkippedFiles,
-		ErrorCount:        p.stats.ErrorCount,
-		ModifiedDetails:   p.stats.ModifiedDetails,
-		UnmodifiedDetails: p.stats.UnmodifiedDetails,
+// buildPlan counts the collected jobs and lists the destructive actions they imply
+func (p *Processor) buildPlan() *Plan {
+	plan := &Plan{
+		TotalFiles: int(p.counters.scanned()),
+		MediaFiles: len(p.jobs),
+	}
+	var matchedImages, matchedVideos int
+	for _, job := range p.jobs {
+		matched := job.jsonErr == nil && !job.jsonInfo.IsDir()
+		if isVideoFile(job.mediaPath) {
+			plan.VideoFiles++
+			if matched {
+				matchedVideos++
+			}
+		} else {
+			plan.ImageFiles++
+			if matched {
+				matchedImages++
+			}
+		}
+		if matched {
+			plan.MatchedFiles++
+		}
 	}
-}
 
-// processWorker processes media files from the job channel
-func (p *Processor) processWorker(wg *sync.WaitGroup, jobChan chan fileJob) {
-	defer wg.Done()
-	for job := range jobChan {
-		p.processMediaFile(job.mediaPath)
+	if p.dryRun {
+		return plan
+	}
+	var joined, parts int
+	for _, job := range p.jobs {
+		if len(job.splitParts) > 0 {
+			joined, parts = joined+1, parts+len(job.splitParts)
+		}
+	}
+	if joined > 0 {
+		plan.Actions = append(plan.Actions, fmt.Sprintf("Join %d parts into %d split videos with ffmpeg, keeping the parts", parts, joined))
+	}
+	if unmatched := plan.MediaFiles - plan.MatchedFiles; p.syncMTime && unmatched > 0 {
+		plan.Actions = append(plan.Actions, fmt.Sprintf("Set file times from EXIF for up to %d media files without JSON", unmatched))
+	}
+	if plan.MatchedFiles == 0 {
+		return plan
+	}
+	if p.outputDir != "" {
+		if p.outputMode == OutputHardlink {
+			plan.Actions = append(plan.Actions, fmt.Sprintf("Hardlink %d media files into %s and replace the links of the files whose metadata changes with copies", plan.MediaFiles, p.outputDir))
+		} else {
+			plan.Actions = append(plan.Actions, fmt.Sprintf("Copy %d media files to %s and write metadata to the copies", plan.MediaFiles, p.outputDir))
+		}
+		if fs := copyOnWriteFS(p.rootDir); fs != "" && fs == copyOnWriteFS(nearestDir(p.outputDir)) {
+			plan.Hints = append(plan.Hints, fmt.Sprintf("Both directories are on %s: the copies are cloned where the filesystem allows it, sharing their data with the export until the metadata is written", fs))
+		}
+		if p.partnerOpts.OutputDir != "" {
+			plan.Actions = append(plan.Actions, fmt.Sprintf("Move copies of partner-shared items to %s", p.partnerOpts.OutputDir))
+		}
+		return plan
+	}
+	if p.relocatedDir != "" {
+		plan.Actions = append(plan.Actions, fmt.Sprintf("Write metadata to the copies of up to %d media files in %s, matched by %s",
+			plan.MatchedFiles, p.relocatedDir, p.relocatedMatch))
+		return plan
+	}
+	if fs := copyOnWriteFS(p.rootDir); fs == "btrfs" || fs == "ZFS" {
+		plan.Hints = append(plan.Hints, fmt.Sprintf("The export is on %s: take a snapshot first to be able to roll this run back, or use -output, where the copies are cloned instead of copied", fs))
 	}
+	if matchedImages > 0 {
+		plan.Actions = append(plan.Actions, fmt.Sprintf("Rewrite metadata of up to %d images in place", matchedImages))
+	}
+	if matchedVideos > 0 {
+		if p.applyOpts.VideoXMPSidecar {
+			plan.Actions = append(plan.Actions, fmt.Sprintf("Write XMP sidecars for up to %d videos", matchedVideos))
+		} else {
+			plan.Actions = append(plan.Actions, fmt.Sprintf("Remux and replace up to %d videos", matchedVideos))
+		}
+	}
+	var renames int
+	for _, job := range p.jobs {
+		if job.renamePath != "" {
+			renames++
+		}
+	}
+	if renames > 0 {
+		plan.Actions = append(plan.Actions, fmt.Sprintf("Rename %d media files with generated names to their JSON title, recording them in %s", renames, p.renameJournal))
+	}
+	if p.manifestPath == "" {
+		plan.Actions = append(plan.Actions, fmt.Sprintf("Delete up to %d JSON sidecar files after applying them", len(p.sidecarUsers)))
+	}
+	if p.partnerOpts.OutputDir != "" {
+		plan.Actions = append(plan.Actions, fmt.Sprintf("Move partner-shared items to %s", p.partnerOpts.OutputDir))
+	}
+	return plan
 }
 
-func (p *Processor) checkSupplementalData(mediaPath string) (os.FileInfo, string, error) {
-	var info os.FileInfo
-	var err error
-	var jsonPath string
-	var newMediaPath string
-
-	// Check first if json will be found by replacing the file extension with json.
-	ext := filepath.Ext(mediaPath)
-	newMediaPath = mediaPath
-	jsonPath = strings.TrimSuffix(mediaPath, ext) + ".json"
-
-	info, err = os.Stat(jsonPath)
+// Process applies the metadata of every scanned file. When ctx is cancelled no new
+// files are started, running tool invocations are killed, and the context error is
+// returned together with the statistics gathered so far.
+func (p *Processor) Process(ctx context.Context) (Statistics, error) {
+	defer p.closeEvents()
+	defer p.watchEvents(ctx)()
+	defer metadata.RemoveExiftoolConfig()
+	if _, err := p.Scan(ctx); err != nil {
+		return p.getStatsCopy(), err
+	}
+	started := time.Now()
+	p.startState()
+	if p.batchBy != "" {
+		p.runBatches(ctx)
+	} else {
+		p.runJobs(ctx, p.jobs)
+	}
+	if ctx.Err() == nil && !p.aborted() {
+		p.runPipeline(ctx)
+	}
+	elapsed := p.scanTime + time.Since(started)
+	p.update(func(s *Statistics) { s.Elapsed = elapsed })
+	p.finishState(ctx.Err() == nil && !p.aborted())
 
-	if err == nil {
-		return info, jsonPath, err
+	if err := ctx.Err(); err != nil {
+		return p.getStatsCopy(), fmt.Errorf("run interrupted: %w", err)
 	}
+	if p.aborted() {
+		return p.getStatsCopy(), fmt.Errorf("%w: aborted after %d errors", ErrTooManyErrors, p.maxErrors)
+	}
+	return p.getStatsCopy(), nil
+}
 
-	// Check if media path has (1), (2) suffixes before extension.
-	// Compile the regex once for efficiency
-	//var re = regexp.MustCompile(`\((\d+)\)(\.[^.]+)?$`)
-	var re = regexp.MustCompile(`\(\d+\)`)
-	var matches []string
-	var match string
+// runJobs processes jobs with the worker pool and returns once every started job is
+// done, stopping early when the run is aborted or ctx is cancelled
+func (p *Processor) runJobs(ctx context.Context, jobs []fileJob) {
+	// Create channels for worker pool
+	jobChan := make(chan fileJob, p.workerCount*2)
+	pool := newWorkerPool(ctx, p, jobChan)
 
-	// FindStringSubmatch returns a slice of strings:
-	// [full_match, captured_group_1, captured_group_2, ...]
-	// In our regex, captured_group_1 will be the '1' or '2'
-	idx := strings.LastIndex(mediaPath, `\`)
-	if idx != -1 {
-		matches = re.FindAllString(mediaPath[idx+1:], -1)
+	// Start worker goroutines, within the autoscaling bounds when set
+	initial := p.workerCount
+	if p.maxWorkers > 0 {
+		initial = min(max(initial, p.minWorkers), p.maxWorkers)
 	}
+	pool.start(initial)
 
-	if len(matches) == 1 {
-		match = matches[0]
-		fileName := strings.Replace(mediaPath[idx+1:], match, "", 1)
-		newMediaPath = mediaPath[:idx+1] + fileName
-	} else {
-		newMediaPath = mediaPath
-	}
-
-	jsonSuffixes := [...]string{
-		"",
-		".supplemental-metadata",
-		".supplemental-metadat",
-		".supplemental-metada",
-		".supplemental-metad",
-		".supplemental-meta",
-		".supplemental-met",
-		".supplemental-me",
-		".supplemental-m",
-		".supplemental-",
-		".supplemental",
-		".supplementa",
-		".supplement",
-		".supplemen",
-		".suppleme",
-		".supplem",
-		".supple",
-		".suppl",
-		".supp",
-		".sup",
-		".su",
-		".s",
-	}
-
-	for _, suffix := range jsonSuffixes {
-		// Look for supplemental metadata file: [mediafile].supplemental-metadata.json
-		if match != "" {
-			suffix = suffix + match + ".json"
-		} else {
-			suffix = suffix + ".json"
+	// Send jobs to workers, stopping early if the run is aborted or cancelled
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		defer close(jobChan)
+		for _, job := range jobs {
+			select {
+			case jobChan <- job:
+			case <-p.abort:
+				return
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
 
-		jsonPath = newMediaPath + suffix
-
-		// Check if metadata exists
-		info, err = os.Stat(jsonPath)
-
-		if err == nil {
-			return info, jsonPath, err
-		}
+	// The autoscaler must be done adding workers before waiting on them
+	if p.maxWorkers > 0 {
+		pool.autoscale(fed)
 	}
 
-	// Reset newMediaPath
-	newMediaPath = mediaPath
-
-	// Another check for files with (1), (2)... but are not duplicates
-	for _, suffix := range jsonSuffixes {
+	// Wait for all workers to complete
+	pool.wg.Wait()
+}
 
-		// Look for supplemental metadata file: [mediafile].supplemental-metadata.json
-		suffix = suffix + ".json"
+func (p *Processor) processMediaFile(ctx context.Context, job fileJob) bool {
+	if p.fileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.fileTimeout)
+		defer cancel()
+	}
 
-		jsonPath = newMediaPath + suffix
+	p.emit(Event{Type: EventFileStarted, Path: job.mediaPath})
+	if p.skipOversized(job) {
+		return false
+	}
+	if len(job.splitParts) > 0 && !p.joinSplitVideo(ctx, job) {
+		return false
+	}
 
-		// Check if metadata exists
-		info, err = os.Stat(jsonPath)
+	// Supplemental metadata file was resolved during the scan
+	mediaPath, info, jsonPath, err := job.mediaPath, job.jsonInfo, job.jsonPath, job.jsonErr
 
-		if err == nil {
-			return info, jsonPath, err
-		}
+	// In output and relocated mode the copy is written and the export is left as it is
+	target := mediaPath
+	if job.outputPath != "" {
+		target = job.outputPath
 	}
 
-	return info, jsonPath, err
-}
-
-func (p *Processor) processMediaFile(mediaPath string) bool {
-	// Look for supplemental metadata file: [mediafile].supplemental-metadata.json
-	info, jsonPath, err := p.checkSupplementalData(mediaPath)
+	// Empty and cut-off downloads only make the writers fail with confusing errors;
+	// check the file that is written, or copied in output mode. A dry run has not
+	// joined split videos, so there is nothing to check yet.
+	source := target
+	if p.outputDir != "" {
+		source = mediaPath
+	}
+	if !(p.dryRun && len(job.splitParts) > 0) && p.skipCorrupt(job, source) {
+		return false
+	}
 
 	if err != nil {
-		if os.IsNotExist(err) {
+		// Media without a sidecar are still copied, so the output library is complete
+		var copied string
+		if os.IsNotExist(err) && p.outputDir != "" && !p.dryRun {
+			copied = target
+			started := time.Now()
+			var linked bool
+			var copyErr error
+			if p.syncMTime {
+				// Setting the file time would change the linked export file too
+				copyErr = p.copyToOutput(mediaPath, target)
+			} else {
+				linked, copyErr = p.linkToOutput(mediaPath, target)
+			}
+			if linked {
+				p.counters.linkedFiles.Add(1)
+			}
+			p.recordWrite(mediaPath, target, job.size, copyErr == nil && !linked, time.Since(started))
+			if copyErr != nil {
+				p.recordError()
+				fmt.Printf("[ERROR] %s: %v\n", mediaPath, copyErr)
+				p.recordResult(FileResult{Path: mediaPath, Status: StatusError, Message: copyErr.Error(), Err: copyErr})
+				return false
+			}
+		}
+		if os.IsNotExist(err) && p.syncMTime {
+			p.syncFileTime(ctx, mediaPath, target)
+		} else if os.IsNotExist(err) {
 			if p.verbose {
 				fmt.Printf("[SKIP] No metadata file for: %s\n", mediaPath)
 			}
+			p.recordSkip(FileResult{Path: mediaPath, Output: copied, Message: "no metadata file", Err: fmt.Errorf("%w: %w", ErrNoSidecar, err)}, SkipNoSidecar)
 		} else {
-			p.stats.mu.Lock()
-			p.stats.ErrorCount++
-			p.stats.mu.Unlock()
+			p.recordError()
 			fmt.Printf("[ERROR] Cannot access metadata file %s: %v\n", jsonPath, err)
+			p.recordResult(FileResult{Path: mediaPath, JSONPath: jsonPath, Status: StatusError, Message: err.Error(), Err: err})
 		}
 		return false
 	}
@@ -286,130 +718,338 @@ func (p *Processor) processMediaFile(mediaPath string) bool {
 		if p.verbose {
 			fmt.Printf("[SKIP] Metadata path is a directory: %s\n", jsonPath)
 		}
+		p.recordSkip(FileResult{Path: mediaPath, Message: "metadata path is a directory"}, SkipBadSidecar)
 		return false
 	}
 
-	// Parse metadata from JSON - it will automatically find supplemental files
-	meta, err := metadata.ParseJSON(jsonPath)
-	if err != nil {
-		p.stats.mu.Lock()
-		p.stats.ErrorCount++
-		p.stats.mu.Unlock()
-		fmt.Printf("[ERROR] Failed to parse metadata from %s: %v\n", jsonPath, err)
+	// Files written by a previous run carry a marker; don't read their JSON again
+	if p.applyOpts.WriteMarker && metadata.HasAppliedMarker(target) {
+		p.skipMarked(mediaPath, jsonPath)
 		return false
 	}
 
-	p.stats.mu.Lock()
-	p.stats.JSONFiles++
-	p.stats.mu.Unlock()
+	// A huge "JSON" file is a misnamed media file, not a sidecar; don't load it
+	if job.matchRule != MatchManifest && info.Size() > metadata.MaxJSONSize {
+		p.warn(jsonPath, "Ignoring %s: %d bytes is too large for a JSON sidecar", jsonPath, info.Size())
+		p.recordSkip(FileResult{Path: mediaPath, JSONPath: jsonPath, Message: "metadata file too large", Err: metadata.ErrJSONTooLarge}, SkipBadSidecar)
+		return false
+	}
+
+	// The metadata may already have been prepared by Scan to name the output copy
+	meta := job.meta
+	if meta == nil {
+		started := time.Now()
+		meta, err = p.loadMetadata(ctx, mediaPath, jsonPath)
+		p.recordStage(StageReadJSON, 1, time.Since(started), info.Size(), 0)
+		p.chargeIO(StageReadJSON, info.Size(), 0)
+		if err != nil {
+			p.recordError()
+			fmt.Printf("[ERROR] Failed to parse metadata from %s: %v\n", jsonPath, err)
+			p.recordResult(FileResult{Path: mediaPath, JSONPath: jsonPath, Status: StatusError, Message: err.Error(), Err: err})
+			return false
+		}
+	}
+
+	p.counters.jsonFiles.Add(1)
+	if meta.FromPicasa() {
+		p.counters.picasaFiles.Add(1)
+	}
+	if format := meta.Format(); format != metadata.FormatTakeout {
+		p.counters.legacyFiles.Add(1)
+		if p.verbose {
+			fmt.Printf("[INFO] Reading %s as a %s sidecar\n", jsonPath, format)
+		}
+	}
+
+	// Items deleted in Google Photos are exported too; leave them alone
+	if meta.Trashed {
+		if p.verbose {
+			fmt.Printf("[SKIP] In the Google Photos trash: %s\n", mediaPath)
+		}
+		p.recordSkip(FileResult{Path: mediaPath, JSONPath: jsonPath, Message: "in the Google Photos trash"}, SkipTrashed)
+		return false
+	}
+
+	// A sidecar describing a differently named photo was probably matched by mistake;
+	// manifest matches are by content and may have any name, and a joined video uses
+	// the sidecar of its first part, and a generated name is meant to differ from the
+	// title it is renamed to
+	renaming := p.renameToTitle && isGeneratedName(mediaPath)
+	if !p.force && job.matchRule != MatchManifest && job.matchRule != MatchSplitParts && !renaming && !titleMatches(mediaPath, meta.Title) {
+		p.skipTitleMismatch(job, meta.Title)
+		return false
+	}
+
+	applyOpts := p.applyOpts
+	applyOpts.Audit = p.auditTrail(job, info)
+	applyOpts.SharedComments = p.sharedComments == SharedCommentsXMP
+	if albumKeywords := p.albumKeywordsFor(mediaPath); len(albumKeywords) > 0 {
+		applyOpts.Keywords = append(append([]string{}, applyOpts.Keywords...), albumKeywords...)
+	}
+	if labels := meta.GetLabels(); p.labelKeywords && len(labels) > 0 {
+		applyOpts.Keywords = append(append([]string{}, applyOpts.Keywords...), labels...)
+	}
+	isPartner, partnerName := p.detectPartner(mediaPath, meta)
+	if isPartner {
+		p.counters.partnerFiles.Add(1)
+		if p.partnerOpts.Tag {
+			applyOpts.Keywords = append(append([]string{}, applyOpts.Keywords...), partnerKeyword(partnerName))
+		}
+	}
+	routePartner := isPartner && p.partnerOpts.OutputDir != ""
+	photoTime, _ := meta.GetPhotoTime()
+	creation := creationKind(mediaPath, meta)
+	if creation != "" {
+		p.counters.creationFiles.Add(1)
+		if p.tagCreations {
+			applyOpts.Keywords = append(append([]string{}, applyOpts.Keywords...), CreationKeyword)
+		}
+	}
 
 	// Apply metadata to media file
 	if p.dryRun {
-		fmt.Printf("[DRY-RUN] Would apply metadata to: %s\n", mediaPath)
+		if p.outputDir != "" {
+			fmt.Printf("[DRY-RUN] Would copy %s to %s and apply metadata\n", mediaPath, target)
+		} else {
+			fmt.Printf("[DRY-RUN] Would apply metadata to: %s\n", target)
+		}
+		if job.renamePath != "" {
+			fmt.Printf("[DRY-RUN] Would rename %s to %s\n", target, filepath.Base(job.renamePath))
+		}
 		if p.verbose {
 			fmt.Printf("          Metadata: %+v\n", meta)
-			fmt.Printf("          Would delete: %s\n", jsonPath)
+			if p.outputDir == "" && p.relocatedDir == "" && p.manifestPath == "" {
+				fmt.Printf("          Would delete: %s\n", jsonPath)
+			}
 		}
-		p.stats.mu.Lock()
-		p.stats.ProcessedFiles++
-		p.stats.ModifiedFiles++
+		p.counters.processedFiles.Add(1)
+		p.counters.modifiedFiles.Add(1)
 		detail := fmt.Sprintf("  %s (would be modified)", filepath.Base(mediaPath))
-		p.stats.ModifiedDetails = append(p.stats.ModifiedDetails, detail)
-		p.stats.mu.Unlock()
+		if !p.lowMemory {
+			p.update(func(s *Statistics) { s.ModifiedDetails = append(s.ModifiedDetails, detail) })
+		}
+		p.recordResult(FileResult{Path: mediaPath, JSONPath: jsonPath, Output: job.outputPath, Status: StatusWouldModify, Creation: creation, PhotoTime: photoTime})
+		if routePartner {
+			target, _ = p.routePartnerFile(target)
+		}
+		p.writeSharedComments(target, meta)
 		return true
 	}
 
-	result, err := metadata.ApplyToFile(mediaPath, meta)
+	writeStarted := time.Now()
+	var linked bool
+	if p.outputDir != "" {
+		linked, err = p.linkToOutput(mediaPath, target)
+		if err != nil {
+			p.recordError()
+			fmt.Printf("[ERROR] %s: %v\n", mediaPath, err)
+			p.recordResult(FileResult{Path: mediaPath, JSONPath: jsonPath, Status: StatusError, Message: err.Error(), Err: err})
+			return false
+		}
+		if linked {
+			// Rewriting the link in place would change the export
+			applyOpts.LinkedTo, applyOpts.InPlace = mediaPath, false
+		}
+		if name := filepath.Base(mediaPath); filepath.Base(target) != name {
+			applyOpts.OriginalName = name
+		}
+	}
+	if job.renamePath != "" {
+		applyOpts.OriginalName = filepath.Base(target)
+	}
+
+	result, err := metadata.ApplyToFile(ctx, target, meta, applyOpts)
+	p.recordWrite(mediaPath, target, job.size, (p.outputDir != "" && !linked) || (err == nil && result.Modified), time.Since(writeStarted))
+	if err == nil && result.Modified && p.verifyWrites {
+		if err = metadata.VerifyWrite(ctx, target, result.Changes); err != nil {
+			p.counters.writeMismatches.Add(1)
+		}
+	}
+	if linked {
+		p.countLinked(mediaPath, target)
+	}
 	if err != nil {
-		p.stats.mu.Lock()
-		p.stats.ErrorCount++
-		p.stats.mu.Unlock()
+		p.recordError()
 		fmt.Printf("[ERROR] Failed to apply metadata to %s: %v\n", mediaPath, err)
+		p.recordResult(FileResult{Path: mediaPath, JSONPath: jsonPath, Status: StatusError, Message: err.Error(), Err: err})
 		return false
 	}
 
-	p.stats.mu.Lock()
-	p.stats.ProcessedFiles++
+	p.counters.processedFiles.Add(1)
 	if result.Modified {
-		p.stats.ModifiedFiles++
+		p.counters.modifiedFiles.Add(1)
+		p.counters.bytesChanged.Add(result.BytesChanged)
 		detail := fmt.Sprintf("  %s", result.Details)
-		if result.NewData != "" {
-			detail = fmt.Sprintf("%s\n    Modified: %s", detail, result.NewData)
+		if summary := result.Summary(); summary != "" {
+			detail = fmt.Sprintf("%s\n    Modified: %s", detail, summary)
 		}
-		p.stats.ModifiedDetails = append(p.stats.ModifiedDetails, detail)
-		fmt.Printf("[OK] Metadata modified: %s\n", mediaPath)
-		if p.verbose && result.ExistingData != "" {
-			fmt.Printf("    Previous: %s\n", result.ExistingData)
-			fmt.Printf("    Updated:  %s\n", result.NewData)
+		if !p.lowMemory {
+			p.update(func(s *Statistics) { s.ModifiedDetails = append(s.ModifiedDetails, detail) })
+		}
+		fmt.Printf("[OK] Metadata modified: %s\n", target)
+		if p.verbose {
+			for _, change := range result.Changes {
+				fmt.Printf("    %s\n", change)
+			}
 		}
 	} else {
-		p.stats.UnmodifiedFiles++
+		p.counters.unmodifiedFiles.Add(1)
 		detail := fmt.Sprintf("  %s", result.Details)
-		if result.ExistingData != "" {
-			detail = fmt.Sprintf("%s\n    Verified: %s", detail, result.ExistingData)
+		if summary := result.Summary(); summary != "" {
+			detail = fmt.Sprintf("%s\n    Verified: %s", detail, summary)
+		}
+		if !p.lowMemory {
+			p.update(func(s *Statistics) { s.UnmodifiedDetails = append(s.UnmodifiedDetails, detail) })
 		}
-		p.stats.UnmodifiedDetails = append(p.stats.UnmodifiedDetails, detail)
-		fmt.Printf("[SKIP] Already up-to-date: %s\n", mediaPath)
-		if p.verbose && result.ExistingData != "" {
-			fmt.Printf("    Verified: %s\n", result.ExistingData)
+		fmt.Printf("[SKIP] Already up-to-date: %s\n", target)
+		if p.verbose {
+			for _, change := range result.Changes {
+				fmt.Printf("    %s\n", change)
+			}
 		}
 	}
-	p.stats.mu.Unlock()
+
+	output := job.outputPath
+	if job.renamePath != "" {
+		target = p.renameFileToTitle(target, job.renamePath)
+		output = target
+	}
+
+	if result.Modified {
+		p.recordResult(FileResult{Path: mediaPath, JSONPath: jsonPath, Output: output, Status: StatusModified, Message: result.Summary(),
+			Changes: result.Changes, BytesChanged: result.BytesChanged, SHA256: p.checksum(target), Creation: creation, PhotoTime: photoTime})
+	} else {
+		p.recordResult(FileResult{Path: mediaPath, JSONPath: jsonPath, Output: output, Status: StatusUnchanged, Message: result.Summary(),
+			Changes: result.Changes, SHA256: p.checksum(target), Creation: creation, PhotoTime: photoTime})
+	}
 
 	// Delete supplemental metadata file after successful processing
-	err = os.Remove(jsonPath)
+	p.deleteSidecar(jsonPath)
+
+	if routePartner {
+		if target, err = p.routePartnerFile(target); err != nil {
+			p.recordError()
+			fmt.Printf("[ERROR] %s: %v\n", mediaPath, err)
+		}
+	}
+	// Written once the file is where it stays, so it is not left behind in the export
+	p.writeSharedComments(target, meta)
+
+	return true
+}
+
+// loadMetadata parses the JSON sidecar of a media file, merges its .picasa.ini entry
+// and applies the time policy, folder rules, time shifts, timezone audit and
+// description template, giving the metadata that will be written
+func (p *Processor) loadMetadata(ctx context.Context, mediaPath, jsonPath string) (*metadata.Metadata, error) {
+	// Parse metadata from JSON - it will automatically find supplemental files
+	meta, err := p.metaCache.ParseJSON(jsonPath)
 	if err != nil {
-		fmt.Printf("[WARN] Failed to delete supplemental metadata file %s: %v\n", jsonPath, err)
-	} else {
-		p.deletedMutex.Lock()
-		p.deletedFiles[jsonPath] = true // Mark as deleted to skip if encountered in walk
-		p.deletedMutex.Unlock()
+		return nil, err
+	}
+
+	p.applyPicasa(mediaPath, meta)
+	p.applyTimePolicy(mediaPath, meta)
+	p.applyFilenameDateRules(ctx, mediaPath, meta)
+	p.applyFolderRules(mediaPath, meta)
+	p.applyTimeShift(ctx, mediaPath, meta)
+	p.auditTimezone(ctx, mediaPath, meta)
+	p.applyDescriptionTemplate(mediaPath, meta)
+	return meta, nil
+}
+
+// deleteSidecar removes a JSON sidecar once every job using it has applied it. Output
+// and relocated mode never touch the export, so sidecars are kept there, and a
+// manifest is not a sidecar.
+func (p *Processor) deleteSidecar(jsonPath string) {
+	if p.outputDir != "" || p.relocatedDir != "" || p.manifestPath != "" {
+		return
+	}
+	p.deletedMutex.Lock()
+	p.sidecarUsers[jsonPath]--
+	remaining := p.sidecarUsers[jsonPath]
+	p.deletedMutex.Unlock()
+	if remaining > 0 {
 		if p.verbose {
-			fmt.Printf("    Deleted: %s\n", jsonPath)
+			fmt.Printf("    Kept for %d more files: %s\n", remaining, jsonPath)
 		}
+		return
 	}
+	if err := os.Remove(jsonPath); err != nil {
+		p.warn(jsonPath, "Failed to delete supplemental metadata file %s: %v", jsonPath, err)
+		return
+	}
+	p.deletedMutex.Lock()
+	p.deletedFiles[jsonPath] = true // Mark as deleted to skip if encountered in walk
+	p.deletedMutex.Unlock()
+	if p.verbose {
+		fmt.Printf("    Deleted: %s\n", jsonPath)
+	}
+}
 
-	return true
+// Image formats
+var imageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".bmp":  true,
+	".webp": true,
+	".tiff": true,
+	".tif":  true,
+	".heic": true,
+	".heif": true,
+	".dng":  true,
+}
+
+// Video formats
+var videoExts = map[string]bool{
+	".mp4":  true,
+	".avi":  true,
+	".mov":  true,
+	".mkv":  true,
+	".flv":  true,
+	".wmv":  true,
+	".webm": true,
+	".m4v":  true,
+	".3gp":  true,
+	".ogv":  true,
+	".ts":   true,
+	".mts":  true,
+	".m2ts": true,
+}
+
+// Files that are obviously not media: Takeout's own HTML and CSV indexes and print
+// orders, and what operating systems and Picasa leave in photo folders
+var nonMediaExts = map[string]bool{
+	".html":     true,
+	".htm":      true,
+	".csv":      true,
+	".txt":      true,
+	".css":      true,
+	".js":       true,
+	".pdf":      true,
+	".ini":      true, // desktop.ini, .picasa.ini
+	".db":       true, // Thumbs.db
+	".ds_store": true,
 }
 
 func isSupportedMediaFile(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
 
-	// Image formats
-	imageExts := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".bmp":  true,
-		".webp": true,
-		".tiff": true,
-		".tif":  true,
-		".heic": true,
-		".heif": true,
-		".dng":  true,
-	}
-
-	// Video formats
-	videoExts := map[string]bool{
-		".mp4":  true,
-		".avi":  true,
-		".mov":  true,
-		".mkv":  true,
-		".flv":  true,
-		".wmv":  true,
-		".webm": true,
-		".m4v":  true,
-		".3gp":  true,
-		".ogv":  true,
-		".ts":   true,
-		".mts":  true,
-		".m2ts": true,
-	}
-
 	if imageExts[ext] || videoExts[ext] {
 		return true
 	}
 
 	return false
 }
+
+// isNonMediaFile reports whether a file is one the scan ignores without counting it as
+// skipped, see Statistics.NonMediaFiles
+func isNonMediaFile(path string) bool {
+	return nonMediaExts[strings.ToLower(filepath.Ext(path))]
+}
+
+func isVideoFile(path string) bool {
+	return videoExts[strings.ToLower(filepath.Ext(path))]
+}
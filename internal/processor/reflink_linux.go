@@ -0,0 +1,47 @@
+//go:build linux
+
+package processor
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, which makes a file share another file's data
+const ficlone = 0x40049409
+
+// Filesystem magic numbers from statfs
+const (
+	btrfsMagic    = 0x9123683E
+	zfsMagic      = 0x2FC12FC1
+	xfsMagic      = 0x58465342
+	bcachefsMagic = 0xCA451A4E
+)
+
+// cloneFile makes the empty file dst share the data of src (a reflink, like cp
+// --reflink) on copy-on-write filesystems. It reports false, leaving dst empty, when
+// the filesystem can't clone or the two files are on different filesystems.
+func cloneFile(dst, src *os.File) bool {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	return errno == 0
+}
+
+// copyOnWriteFS returns the name of the copy-on-write filesystem path is on, empty
+// for other filesystems
+func copyOnWriteFS(path string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return ""
+	}
+	switch uint32(st.Type) {
+	case btrfsMagic:
+		return "btrfs"
+	case zfsMagic:
+		return "ZFS"
+	case xfsMagic:
+		return "XFS"
+	case bcachefsMagic:
+		return "bcachefs"
+	}
+	return ""
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package processor
+
+import "os"
+
+// cloneFile is not supported here; dst is always copied
+func cloneFile(dst, src *os.File) bool {
+	return false
+}
+
+// copyOnWriteFS does not detect filesystems here
+func copyOnWriteFS(path string) string {
+	return ""
+}
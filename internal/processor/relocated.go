@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// How media files of the export are found again in a relocated library
+const (
+	RelocatedByNameSize = "name-size" // Same file name (ignoring case) and size
+	RelocatedByHash     = "hash"      // Same content (SHA-256), whatever the name
+)
+
+// ValidateRelocatedMatch checks that match is one of the relocated matching rules
+func ValidateRelocatedMatch(match string) error {
+	switch match {
+	case "", RelocatedByNameSize, RelocatedByHash:
+		return nil
+	}
+	return fmt.Errorf("unknown relocated match %q (expected %s or %s)", match, RelocatedByNameSize, RelocatedByHash)
+}
+
+// WithRelocatedDir writes the metadata of the export's sidecars to the copies of its
+// media files in another library instead of to the export, for media that was
+// copied elsewhere before the metadata was applied. The copies are found by name and
+// size or by content hash (match, empty means name-size); media files without
+// exactly one copy are skipped. The export itself, including its sidecars, is left
+// untouched. Neither directory may be inside the other. Empty dir disables it.
+func WithRelocatedDir(dir, match string) Option {
+	return func(p *Processor) error {
+		if err := ValidateRelocatedMatch(match); err != nil {
+			return err
+		}
+		if dir == "" {
+			p.relocatedDir = ""
+			return nil
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve library directory: %w", err)
+		}
+		if match == "" {
+			match = RelocatedByNameSize
+		}
+		p.relocatedDir, p.relocatedMatch = abs, match
+		return nil
+	}
+}
+
+// relocateJobs points every job at its copy in the relocated library, through
+// outputPath, and drops the jobs without exactly one copy
+func (p *Processor) relocateJobs(ctx context.Context) error {
+	if p.relocatedDir == "" {
+		return nil
+	}
+	jobSizes := make(map[int64]bool, len(p.jobs))
+	for _, job := range p.jobs {
+		jobSizes[job.size] = true
+	}
+
+	// Only files as large as some export file can be copies of one
+	var copies []fileJob
+	librarySizes := make(map[int64]bool)
+	exports := make(map[string]bool)
+	for _, root := range p.roots() {
+		if abs, err := filepath.Abs(root); err == nil {
+			exports[abs] = true
+		}
+	}
+	err := filepath.WalkDir(p.relocatedDir, func(path string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			return err
+		}
+		// The export's own files are not copies of themselves
+		if entry.IsDir() && exports[path] {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || !isSupportedMediaFile(path) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if jobSizes[info.Size()] {
+			copies = append(copies, fileJob{mediaPath: path, size: info.Size()})
+			librarySizes[info.Size()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk library directory: %w", err)
+	}
+
+	index := make(map[string][]string)
+	for _, c := range copies {
+		if key, ok := p.relocationKey(c.mediaPath, c.size); ok {
+			index[key] = append(index[key], c.mediaPath)
+		}
+	}
+
+	claimed := make(map[string]string) // Library copy -> export file writing it
+	kept := p.jobs[:0]
+	for _, job := range p.jobs {
+		var matches []string
+		if librarySizes[job.size] {
+			if key, ok := p.relocationKey(job.mediaPath, job.size); ok {
+				matches = index[key]
+			}
+		}
+		switch {
+		case len(matches) == 0:
+			p.recordSkip(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath, Message: "no copy in the library"}, SkipNotInLibrary)
+		case len(matches) > 1:
+			p.recordSkip(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath,
+				Message: fmt.Sprintf("%d copies in the library: %s", len(matches), strings.Join(matches, ", "))}, SkipNotInLibrary)
+		case claimed[matches[0]] != "":
+			p.recordSkip(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath,
+				Message: "duplicate of " + claimed[matches[0]]}, SkipDuplicate)
+		default:
+			claimed[matches[0]] = job.mediaPath
+			job.outputPath = matches[0]
+			if p.verbose {
+				fmt.Printf("[RELOCATED] %s -> %s\n", job.mediaPath, job.outputPath)
+			}
+			kept = append(kept, job)
+		}
+	}
+	p.jobs = kept
+	return nil
+}
+
+// relocationKey identifies a media file for finding it in the relocated library
+func (p *Processor) relocationKey(path string, size int64) (string, bool) {
+	if p.relocatedMatch == RelocatedByHash {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			p.warn(path, "Cannot hash %s: %v", path, err)
+			return "", false
+		}
+		return hex.EncodeToString(sum), true
+	}
+	return strings.ToLower(filepath.Base(path)) + "/" + strconv.FormatInt(size, 10), true
+}
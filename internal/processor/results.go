@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"encoding/hex"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// File statuses recorded in FileResult
+const (
+	StatusModified    = "modified"
+	StatusUnchanged   = "unchanged"
+	StatusWouldModify = "would-modify"
+	StatusSkipped     = "skipped"
+	StatusError       = "error"
+)
+
+// FileResult records the outcome of processing a single media file
+type FileResult struct {
+	Path         string // Media file path
+	JSONPath     string // Matched sidecar, empty when none was found
+	Output       string // Copy written in output mode or new name from -rename-to-title, empty otherwise
+	Status       string
+	SkipReason   string                 // Why a skipped file was left alone, see SkipReasonNames
+	Message      string                 // Error message, skip reason or summary of the applied data
+	Changes      []metadata.FieldChange // Tags written or verified, with their previous values
+	BytesChanged int64                  // Bytes added by the native EXIF writer
+	SHA256       string                 // Checksum of the file after the run, when checksums are enabled
+	Creation     string                 // Kind of Google Photos creation (collage, animation, ...), empty for other media
+	PhotoTime    time.Time              // Time written to the file, zero for files not written
+	Err          error                  // Cause of an error or skip, for errors.Is/As; nil otherwise
+}
+
+// FileChecksum returns the hex SHA-256 of a file, as recorded in FileResult.SHA256
+func FileChecksum(path string) (string, error) {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// WithChecksums records the SHA-256 of every written or verified media file, so a
+// later check can tell whether something else modified it after the run
+func WithChecksums(enabled bool) Option {
+	return func(p *Processor) error {
+		p.checksums = enabled
+		return nil
+	}
+}
+
+// checksum returns the file's checksum when checksums are enabled or a pipeline step
+// needs them
+func (p *Processor) checksum(path string) string {
+	if !p.checksums && len(p.pipeline.Steps) < 2 {
+		return ""
+	}
+	sum, err := FileChecksum(path)
+	if err != nil {
+		p.warn(path, "Failed to checksum %s: %v", path, err)
+		return ""
+	}
+	return sum
+}
+
+// recordResult stores the outcome of a media file for the report and sends it to the
+// Events subscriber
+func (p *Processor) recordResult(result FileResult) {
+	if result.Creation == "" {
+		result.Creation = creationKind(result.Path, nil)
+	}
+	stored := result
+	if p.lowMemory {
+		stored.Changes = nil
+	}
+	p.update(func(s *Statistics) { s.Files = append(s.Files, stored) })
+	if result.Status == StatusModified || result.Status == StatusUnchanged {
+		p.markDone(result.Path)
+	}
+	p.emit(Event{Type: EventFileDone, Path: result.Path, Result: &result, Message: result.Message, Err: result.Err})
+	if result.Status == StatusError {
+		p.emit(Event{Type: EventError, Path: result.Path, Result: &result, Message: result.Message, Err: result.Err})
+	}
+}
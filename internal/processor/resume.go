@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// StateFileName is the journal Process keeps in the directory it writes to (the one
+// Lock takes), listing the media files completed so far. It is removed once the run
+// completes, so one left behind belongs to an interrupted run, which WithResume
+// continues. The scan ignores it.
+const StateFileName = ".takeout-exif-state.json"
+
+// stateSaveInterval is how often the journal is rewritten during a run; a crash
+// loses at most this much work, which is redone (as up-to-date files) on resume
+const stateSaveInterval = 30 * time.Second
+
+// stateFile is the content of the StateFileName journal
+type stateFile struct {
+	Updated time.Time `json:"updated"`
+	Done    []string  `json:"done"` // Slash-separated paths relative to the root
+}
+
+// runState is the journal of the run in progress
+type runState struct {
+	sync.Mutex
+	path  string
+	done  map[string]bool
+	saved time.Time
+}
+
+// WithResume continues the run interrupted in the directory this run writes to: the
+// media files its journal lists as completed are skipped as already processed without
+// looking for their sidecars, and the others are processed as usual. Without a journal
+// to resume, everything is processed. Without WithResume, a journal left behind is
+// replaced.
+func WithResume(enabled bool) Option {
+	return func(p *Processor) error {
+		p.resume = enabled
+		return nil
+	}
+}
+
+// statePath returns where the journal is kept: in the -output or -relocated directory
+// when one is set, so runs into different directories don't share one, and otherwise
+// in the root directory
+func (p *Processor) statePath() string {
+	return filepath.Join(p.lockDirs()[0], StateFileName)
+}
+
+// loadState reads the journal of the interrupted run for WithResume, once the
+// directory the run writes to is known
+func (p *Processor) loadState() error {
+	if !p.resume {
+		return nil
+	}
+	path := p.statePath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("[RESUME] No interrupted run to resume in %s, processing everything\n", filepath.Dir(path))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read run state: %w", err)
+	}
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse run state %s: %w", path, err)
+	}
+	p.resumed = make(map[string]bool, len(state.Done))
+	for _, key := range state.Done {
+		p.resumed[key] = true
+	}
+	fmt.Printf("[RESUME] Resuming the run interrupted at %s: %d files already done\n",
+		state.Updated.Local().Format("2006-01-02 15:04:05"), len(p.resumed))
+	return nil
+}
+
+// stateKey returns how the journal names a media file
+func (p *Processor) stateKey(path string) string {
+	root, err := filepath.Abs(p.rootDir)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	if rel, err := filepath.Rel(root, abs); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(abs)
+}
+
+// skipResumed skips a media file the interrupted run completed. It reports whether
+// the file must be left out.
+func (p *Processor) skipResumed(path string) bool {
+	if !p.resumed[p.stateKey(path)] {
+		return false
+	}
+	if p.verbose {
+		fmt.Printf("[SKIP] Completed by the interrupted run: %s\n", path)
+	}
+	p.recordSkip(FileResult{Path: path, Message: "completed by the interrupted run (-resume)"}, SkipAlreadyProcessed)
+	return true
+}
+
+// startState starts the journal of a run that writes, keeping the files a resumed
+// run already completed
+func (p *Processor) startState() {
+	if p.dryRun {
+		return
+	}
+	path := p.statePath()
+	if p.resumed == nil {
+		if _, err := os.Stat(path); err == nil {
+			fmt.Printf("[RESUME] Starting over: %s of an interrupted run is replaced (use -resume to continue it)\n", path)
+		}
+	}
+	state := &runState{path: path, done: make(map[string]bool, len(p.resumed)), saved: time.Now()}
+	for key := range p.resumed {
+		state.done[key] = true
+	}
+	p.state = state
+}
+
+// markDone records a media file written or found up-to-date in the journal, saving
+// it when it was last saved stateSaveInterval ago
+func (p *Processor) markDone(path string) {
+	if p.state == nil {
+		return
+	}
+	key := p.stateKey(path)
+	p.state.Lock()
+	defer p.state.Unlock()
+	p.state.done[key] = true
+	if time.Since(p.state.saved) >= stateSaveInterval {
+		p.saveState()
+	}
+}
+
+// finishState removes the journal of a completed run, or saves it for -resume
+func (p *Processor) finishState(completed bool) {
+	if p.state == nil {
+		return
+	}
+	p.state.Lock()
+	defer p.state.Unlock()
+	if completed {
+		if err := os.Remove(p.state.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			p.warn(p.state.path, "Failed to remove run state: %v", err)
+		}
+		return
+	}
+	p.saveState()
+	fmt.Printf("[RESUME] %d files done, run again with -resume to continue\n", len(p.state.done))
+}
+
+// saveState replaces the journal atomically. p.state must be locked.
+func (p *Processor) saveState() {
+	state := stateFile{Updated: time.Now().UTC(), Done: make([]string, 0, len(p.state.done))}
+	for key := range p.state.done {
+		state.Done = append(state.Done, key)
+	}
+	sort.Strings(state.Done)
+	p.state.saved = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		p.warn(p.state.path, "Failed to encode run state: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(p.state.path), 0755); err != nil {
+		p.warn(p.state.path, "Failed to write run state: %v", err)
+		return
+	}
+	tmp := metadata.TrackTempFile(p.state.path + ".tmp")
+	defer metadata.RemoveTempFile(tmp)
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		p.warn(p.state.path, "Failed to write run state: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, p.state.path); err != nil {
+		p.warn(p.state.path, "Failed to write run state: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// testJPEG is a JPEG without metadata segments, which the native writer handles
+// without exiftool
+var testJPEG = []byte{
+	0xFF, 0xD8,
+	0xFF, 0xDA, 0x00, 0x08, 0x01, 0x01, 0x00, 0x00, 0x3F, 0x00,
+	0x12, 0x34, 0x56, 0x78,
+	0xFF, 0xD9,
+}
+
+// writeTakeoutPhoto creates a photo with its JSON sidecar in dir
+func writeTakeoutPhoto(t *testing.T, dir, name, title string, taken int64) {
+	t.Helper()
+	sidecar := fmt.Sprintf(`{"title": %q, "photoTakenTime": {"timestamp": "%d"}}`, title, taken)
+	if err := os.WriteFile(filepath.Join(dir, name), testJPEG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".supplemental-metadata.json"), []byte(sidecar), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTakeoutPhotos creates n photos with their JSON sidecars in dir and returns
+// their names
+func writeTakeoutPhotos(t *testing.T, dir string, n int) []string {
+	t.Helper()
+	var names []string
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("IMG_%04d.jpg", i)
+		writeTakeoutPhoto(t, dir, name, name, int64(1563121200+i*60))
+		names = append(names, name)
+	}
+	return names
+}
+
+// filesWithStatus returns the sorted names of the files of a run with the given status
+func filesWithStatus(stats Statistics, status string) []string {
+	var names []string
+	for _, file := range stats.Files {
+		if file.Status == status {
+			names = append(names, filepath.Base(file.Path))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestResumeInterruptedRun(t *testing.T) {
+	const total, interruptAfter = 8, 3
+	dir := t.TempDir()
+	names := writeTakeoutPhotos(t, dir, total)
+	options := func(extra ...Option) []Option {
+		return append([]Option{
+			WithApplyOptions(metadata.ApplyOptions{Writer: metadata.WriterNative}),
+			WithWorkerCount(1),
+			WithOrder(OrderPath, nil),
+		}, extra...)
+	}
+
+	// The first run stops at a damaged sidecar, like an interrupted run: the error
+	// limit leaves the files after it unstarted, deterministically with a single worker
+	damaged := filepath.Join(dir, names[interruptAfter]+".supplemental-metadata.json")
+	sidecar, err := os.ReadFile(damaged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(damaged, sidecar[:len(sidecar)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(dir, options(WithMaxErrors(1))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := p.Process(context.Background())
+	if !errors.Is(err, ErrTooManyErrors) {
+		t.Fatalf("first run returned %v, want ErrTooManyErrors", err)
+	}
+	completed := names[:interruptAfter]
+	if got := filesWithStatus(first, StatusModified); fmt.Sprint(got) != fmt.Sprint(completed) {
+		t.Fatalf("first run processed %v, want %v", got, completed)
+	}
+
+	// The journal lists exactly the completed files
+	data, err := os.ReadFile(filepath.Join(dir, StateFileName))
+	if err != nil {
+		t.Fatalf("no journal left by the interrupted run: %v", err)
+	}
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(state.Done) != fmt.Sprint(completed) {
+		t.Errorf("journal lists %v, want %v", state.Done, completed)
+	}
+
+	// Once the file is repaired, the resumed run processes only the remaining files
+	if err := os.WriteFile(damaged, sidecar, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err = New(dir, options(WithResume(true))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.Process(context.Background())
+	if err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	if got, want := filesWithStatus(second, StatusModified), names[interruptAfter:]; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("resumed run processed %v, want %v", got, want)
+	}
+	if got := filesWithStatus(second, StatusSkipped); fmt.Sprint(got) != fmt.Sprint(completed) {
+		t.Errorf("resumed run skipped %v, want %v", got, completed)
+	}
+	if n := second.SkipReasons[SkipAlreadyProcessed]; n != len(completed) {
+		t.Errorf("%d files skipped as already processed, want %d", n, len(completed))
+	}
+
+	// A completed run removes its journal
+	if _, err := os.Stat(filepath.Join(dir, StateFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal left after the resumed run completed: %v", err)
+	}
+}
+
+func TestResumeOutputDir(t *testing.T) {
+	const total, interruptAfter = 6, 2
+	dir, outputs := t.TempDir(), t.TempDir()
+	names := writeTakeoutPhotos(t, dir, total)
+	run := func(output string, extra ...Option) (Statistics, error) {
+		t.Helper()
+		p, err := New(dir, append([]Option{
+			WithApplyOptions(metadata.ApplyOptions{Writer: metadata.WriterNative}),
+			WithWorkerCount(1),
+			WithOrder(OrderPath, nil),
+			WithOutputDir(filepath.Join(outputs, output)),
+		}, extra...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.Process(context.Background())
+	}
+
+	// A run into output A stops partway, keeping its journal there and not in the export
+	damaged := filepath.Join(dir, names[interruptAfter]+".supplemental-metadata.json")
+	sidecar, err := os.ReadFile(damaged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(damaged, sidecar[:len(sidecar)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("A", WithMaxErrors(1)); !errors.Is(err, ErrTooManyErrors) {
+		t.Fatalf("first run returned %v, want ErrTooManyErrors", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputs, "A", StateFileName)); err != nil {
+		t.Fatalf("no journal in the output directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, StateFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal written into the export: %v", err)
+	}
+	if err := os.WriteFile(damaged, sidecar, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming into output B has no interrupted run to continue: the files only
+	// copied to A are processed too, and A's journal is left alone
+	second, err := run("B", WithResume(true))
+	if err != nil {
+		t.Fatalf("run into B: %v", err)
+	}
+	if got := filesWithStatus(second, StatusModified); fmt.Sprint(got) != fmt.Sprint(names) {
+		t.Errorf("run into B processed %v, want %v", got, names)
+	}
+	if _, err := os.Stat(filepath.Join(outputs, "A", StateFileName)); err != nil {
+		t.Errorf("journal of A gone after the run into B: %v", err)
+	}
+
+	// Resuming into output A continues where it stopped
+	third, err := run("A", WithResume(true))
+	if err != nil {
+		t.Fatalf("resumed run into A: %v", err)
+	}
+	if got, want := filesWithStatus(third, StatusModified), names[interruptAfter:]; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("resumed run into A processed %v, want %v", got, want)
+	}
+	if got, want := filesWithStatus(third, StatusSkipped), names[:interruptAfter]; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("resumed run into A skipped %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(outputs, "A", StateFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal left in A after the resumed run completed: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+)
+
+// FolderSummary counts the outcomes of the media files of one folder
+type FolderSummary struct {
+	Folder      string // Relative to the export root when inside it
+	Files       int
+	Matched     int // Files with a JSON sidecar
+	Unmatched   int // Files without one
+	WouldModify int // Files a real run would write (dry-run)
+}
+
+// SummarizeFolders groups the media file results by folder, sorted by folder name, so coverage
+// can be skimmed without reading every file
+func SummarizeFolders(root string, files []FileResult) []FolderSummary {
+	byFolder := make(map[string]*FolderSummary)
+	for _, f := range files {
+		if f.SkipReason == SkipUnsupportedType || f.SkipReason == SkipNotMedia || f.SkipReason == SkipNestedArchive {
+			continue
+		}
+		dir := filepath.Dir(f.Path)
+		if rel, ok := relInside(root, dir); ok {
+			dir = rel
+		}
+		summary, ok := byFolder[dir]
+		if !ok {
+			summary = &FolderSummary{Folder: dir}
+			byFolder[dir] = summary
+		}
+		summary.Files++
+		switch {
+		case f.JSONPath != "":
+			summary.Matched++
+		case errors.Is(f.Err, ErrNoSidecar):
+			summary.Unmatched++
+		}
+		if f.Status == StatusWouldModify {
+			summary.WouldModify++
+		}
+	}
+
+	summaries := make([]FolderSummary, 0, len(byFolder))
+	for _, summary := range byFolder {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Folder < summaries[j].Folder })
+	return summaries
+}
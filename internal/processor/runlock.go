@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// LockFileName is the lock file a run keeps in each directory it writes to while it
+// works on it. The scan ignores it.
+const LockFileName = ".takeout-exif.lock"
+
+// ErrLocked is returned by Lock when another run is working on the directory
+var ErrLocked = errors.New("another run is working on this directory")
+
+// errLockHeld is returned by lockFile when another process holds the lock
+var errLockHeld = errors.New("lock held by another process")
+
+// runLock is the content of the lock file, telling who holds it
+type runLock struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// Lock takes the lock of every directory the run writes to, so two runs started on
+// them at the same time (a cron job overlapping a manual run) can't race on the same
+// files and sidecars: the -output or -relocated directory when one is set, since the
+// export is then left untouched, and otherwise the root directory and the merged
+// export roots. The returned function releases the locks; they are also dropped
+// when the run is quit or crashes.
+func (p *Processor) Lock() (func(), error) {
+	var unlocks []func()
+	unlockAll := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, dir := range p.lockDirs() {
+		unlock, err := LockDir(dir)
+		if err != nil {
+			unlockAll()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return unlockAll, nil
+}
+
+// lockDirs returns the directories Lock takes the lock of
+func (p *Processor) lockDirs() []string {
+	switch {
+	case p.outputDir != "":
+		return []string{p.outputDir}
+	case p.relocatedDir != "":
+		return []string{p.relocatedDir}
+	}
+	return p.roots()
+}
+
+// LockDir takes the lock of a directory like Processor.Lock, for work done on it
+// before a processor is created, such as ExtractArchives. The directory is created if
+// needed. The lock is held by the operating system on the open lock file, so a run
+// that crashed holds none and nothing has to be taken over.
+func LockDir(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	path := filepath.Join(dir, LockFileName)
+	host, _ := os.Hostname()
+	data, err := json.Marshal(runLock{PID: os.Getpid(), Host: host, Started: time.Now().UTC()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock file: %w", err)
+	}
+
+	var f *os.File
+	for f == nil {
+		if f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644); err != nil {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			if !errors.Is(err, errLockHeld) {
+				return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+			}
+			holder := readRunLock(path)
+			return nil, fmt.Errorf("%w: %s (pid %d on %s, started %s)",
+				ErrLocked, path, holder.PID, holder.Host, holder.Started.Local().Format(time.DateTime))
+		}
+		// A run releasing its lock removes the file first; a lock taken on a file that
+		// was removed meanwhile protects nothing, so try again with the current one
+		if !sameOpenFile(f, path) {
+			f.Close()
+			f = nil
+		}
+	}
+
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt(data, 0)
+	}
+	if err != nil {
+		os.Remove(path)
+		f.Close()
+		return nil, fmt.Errorf("failed to write lock file: %w", err)
+	}
+	metadata.TrackTempFile(path)
+	return func() {
+		metadata.RemoveTempFile(path)
+		f.Close()
+	}, nil
+}
+
+// sameOpenFile reports whether the open file f is still the one at path
+func sameOpenFile(f *os.File, path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	openInfo, err := f.Stat()
+	return err == nil && os.SameFile(info, openInfo)
+}
+
+// readRunLock reads who holds a lock file; an unreadable one gives an empty holder
+func readRunLock(path string) runLock {
+	var lock runLock
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &lock)
+	}
+	return lock
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+
+package processor
+
+import "os"
+
+// lockFile can't lock files on this system; the lock file only tells who runs
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockDirHeld(t *testing.T) {
+	dir := t.TempDir()
+	unlock, err := LockDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	// The lock is taken on each open of the file, so a second one in this process
+	// conflicts like another run would
+	_, err = LockDir(dir)
+	if err == nil {
+		t.Skip("files can't be locked on this system")
+	}
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second lock returned %v, want ErrLocked", err)
+	}
+	if !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("error %q doesn't name the holder pid %d", err, os.Getpid())
+	}
+	if holder := readRunLock(filepath.Join(dir, LockFileName)); holder.PID != os.Getpid() {
+		t.Errorf("lock file names pid %d after the failed attempt, want %d", holder.PID, os.Getpid())
+	}
+}
+
+func TestLockDirStale(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, LockFileName)
+
+	// A run that crashed leaves its lock file behind, without the lock; it is longer
+	// than the new content, which must replace it entirely
+	stale, err := json.Marshal(runLock{PID: 999999, Host: "old-host", Started: time.Now().Add(-time.Hour).UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(stale, "\n\n\n\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := LockDir(dir)
+	if err != nil {
+		t.Fatalf("stale lock not reclaimed: %v", err)
+	}
+	defer unlock()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var holder runLock
+	if err := json.Unmarshal(data, &holder); err != nil {
+		t.Fatalf("reclaimed lock file %q: %v", data, err)
+	}
+	if host, _ := os.Hostname(); holder.PID != os.Getpid() || holder.Host != host {
+		t.Errorf("reclaimed lock names pid %d on %s, want %d on %s", holder.PID, holder.Host, os.Getpid(), host)
+	}
+}
+
+func TestLockDirRelease(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "output")
+	unlock, err := LockDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, LockFileName)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("no lock file while locked: %v", err)
+	}
+
+	unlock()
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left after release: %v", err)
+	}
+	unlock, err = LockDir(dir)
+	if err != nil {
+		t.Fatalf("locking again after release: %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// lockFile takes an exclusive lock on f without waiting, returning errLockHeld when
+// another process holds it. The locked byte lies far past the content, so other runs
+// can still read who holds the lock. Windows drops the lock when the process exits.
+func lockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	overlapped.OffsetHigh = 0x7fffffff
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r != 0 {
+		return nil
+	}
+	if errors.Is(err, errorLockViolation) {
+		return errLockHeld
+	}
+	return err
+}
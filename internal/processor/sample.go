@@ -0,0 +1,96 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// CopySample scans the export and copies n randomly chosen media files under dir, at
+// the same path relative to their export root, together with their JSON sidecars, the
+// still image of a Live Photo video and the folder metadata files they depend on.
+// Processing dir with a new Processor then shows what the run would do to real data
+// without touching the export. It returns the number of media files copied.
+func (p *Processor) CopySample(ctx context.Context, dir string, n int) (int, error) {
+	if n < 1 {
+		return 0, fmt.Errorf("invalid sample size %d", n)
+	}
+	if _, err := p.Scan(ctx); err != nil {
+		return 0, err
+	}
+
+	picked := rand.Perm(len(p.jobs))
+	if len(picked) > n {
+		picked = picked[:n]
+	}
+	copied := make(map[string]bool)
+	for _, i := range picked {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		job := p.jobs[i]
+		for _, path := range p.sampleFiles(job) {
+			if copied[path] {
+				continue
+			}
+			copied[path] = true
+			if err := p.copySampleFile(path, dir); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(picked), nil
+}
+
+// sampleFiles lists the files a sampled job needs to be processed the same way
+func (p *Processor) sampleFiles(job fileJob) []string {
+	files := []string{job.mediaPath}
+	if job.jsonErr == nil {
+		files = append(files, job.jsonPath)
+	}
+	if job.pairedImage != "" {
+		files = append(files, job.pairedImage)
+	}
+
+	folder := filepath.Dir(job.mediaPath)
+	optional := []string{
+		job.mediaPath + supplementalSuffix + ".json",
+		filepath.Join(folder, "supplemental-metadata.json"),
+	}
+	if albumPath := metadata.FindAlbumMetadata(folder); albumPath != "" {
+		optional = append(optional, albumPath)
+	}
+	for _, path := range optional {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// copySampleFile copies one export file under dir, keeping its modification time
+func (p *Processor) copySampleFile(path, dir string) error {
+	rel, err := p.relPath(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	target := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create sample directory: %w", err)
+	}
+	if err := p.copyVerified(path, target); err != nil {
+		return fmt.Errorf("failed to copy %s to the sample: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to set file times of %s: %w", target, err)
+	}
+	return nil
+}
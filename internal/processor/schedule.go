@@ -0,0 +1,253 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What processing does during quiet hours
+const (
+	QuietPause    = "pause"    // Stop starting files until the window ends
+	QuietThrottle = "throttle" // One file at a time, idle three quarters of the time
+)
+
+// throttleDutyCycle is how much longer a throttled file's turn lasts than the file
+// itself took, leaving the disks to others the rest of the time
+const throttleDutyCycle = 4
+
+// quietCheckInterval is the longest a paused run sleeps before looking at the clock
+// again, so clock changes and suspended machines are noticed
+const quietCheckInterval = time.Minute
+
+// weekdayNames are the day names of a quiet hours window, Sunday first like time.Weekday
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// quietWindow is a daily time window during which processing is paused or throttled
+type quietWindow struct {
+	days       [7]bool // Days the window starts on, by time.Weekday
+	start, end int     // Minutes after midnight; end <= start crosses midnight
+}
+
+// WithQuietHours pauses or throttles processing during time windows, so a shared NAS
+// stays responsive while the family uses it. The windows are in local time, each
+// optionally preceded by days: "08:00-18:00", "mon-fri 08:00-18:00", "sat 10:00-14:00"
+// or "22:00-06:00" across midnight. Mode is QuietPause (also for an empty mode) or
+// QuietThrottle. Files already started are finished. No windows disable the schedule.
+func WithQuietHours(windows []string, mode string) Option {
+	return func(p *Processor) error {
+		switch mode {
+		case "":
+			mode = QuietPause
+		case QuietPause, QuietThrottle:
+		default:
+			return fmt.Errorf("unknown quiet hours mode %q (expected %s or %s)", mode, QuietPause, QuietThrottle)
+		}
+		parsed := make([]quietWindow, 0, len(windows))
+		for _, spec := range windows {
+			window, err := parseQuietWindow(strings.TrimSpace(spec))
+			if err != nil {
+				return err
+			}
+			parsed = append(parsed, window)
+		}
+		p.quietWindows, p.quietMode = parsed, mode
+		return nil
+	}
+}
+
+// WithNiceIO lowers the process to the idle IO class and the lowest CPU priority right
+// away, so its disk and CPU use give way to everything else on the machine (Linux
+// only). The exiftool and ffmpeg processes it starts inherit the priorities. A
+// priority that can't be lowered is warned about and the run goes on.
+func WithNiceIO(enabled bool) Option {
+	return func(p *Processor) error {
+		if !enabled {
+			return nil
+		}
+		if err := lowerPriority(); err != nil {
+			fmt.Printf("[WARN] Cannot lower the process priority: %v\n", err)
+		}
+		return nil
+	}
+}
+
+// parseQuietWindow parses one "[days ]HH:MM-HH:MM" window
+func parseQuietWindow(s string) (quietWindow, error) {
+	var window quietWindow
+	days, hours, found := strings.Cut(s, " ")
+	if !found {
+		days, hours = "", s
+	}
+	if days == "" {
+		for i := range window.days {
+			window.days[i] = true
+		}
+	} else {
+		first, last, isRange := strings.Cut(strings.ToLower(days), "-")
+		if !isRange {
+			last = first
+		}
+		from, to := indexOf(weekdayNames, first), indexOf(weekdayNames, last)
+		if from < 0 || to < 0 {
+			return window, fmt.Errorf("invalid days %q in quiet hours (expected e.g. mon-fri or sat)", days)
+		}
+		for i := from; ; i = (i + 1) % 7 {
+			window.days[i] = true
+			if i == to {
+				break
+			}
+		}
+	}
+	start, end, ok := strings.Cut(strings.TrimSpace(hours), "-")
+	if !ok {
+		return window, fmt.Errorf("invalid quiet hours %q (expected e.g. 08:00-18:00)", s)
+	}
+	var err error
+	if window.start, err = parseClock(start); err != nil {
+		return window, err
+	}
+	if window.end, err = parseClock(end); err != nil {
+		return window, err
+	}
+	if window.start == window.end {
+		return window, fmt.Errorf("quiet hours %q are empty", s)
+	}
+	return window, nil
+}
+
+// parseClock parses "HH:MM" as minutes after midnight, "24:00" included
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(s), ":")
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q in quiet hours (expected HH:MM)", s)
+	}
+	return h*60 + m, nil
+}
+
+// windowEnd returns when the window ends if now is inside it
+func (w quietWindow) windowEnd(now time.Time) (time.Time, bool) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	minute := now.Hour()*60 + now.Minute()
+	day := int(now.Weekday())
+	switch {
+	case w.end > w.start && w.days[day] && minute >= w.start && minute < w.end:
+		return midnight.Add(time.Duration(w.end) * time.Minute), true
+	case w.end <= w.start && w.days[day] && minute >= w.start:
+		return midnight.AddDate(0, 0, 1).Add(time.Duration(w.end) * time.Minute), true
+	case w.end <= w.start && w.days[(day+6)%7] && minute < w.end:
+		return midnight.Add(time.Duration(w.end) * time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// quietUntil returns when the quiet hours now falls in end, following windows that
+// begin where another ends
+func (p *Processor) quietUntil(now time.Time) (time.Time, bool) {
+	var until time.Time
+	for at := now; ; {
+		later := until
+		for _, window := range p.quietWindows {
+			if end, ok := window.windowEnd(at); ok && end.After(later) {
+				later = end
+			}
+		}
+		if !later.After(until) || later.Sub(now) > 7*24*time.Hour {
+			return until, !until.IsZero()
+		}
+		until, at = later, later
+	}
+}
+
+// waitQuietHours holds a worker back while processing is paused for quiet hours, and
+// reports whether it should go on with its file
+func (p *Processor) waitQuietHours(ctx context.Context) bool {
+	for {
+		until, quiet := p.quietUntil(time.Now())
+		if !quiet {
+			p.announceQuiet(time.Time{})
+			return true
+		}
+		p.announceQuiet(until)
+		timer := time.NewTimer(min(time.Until(until), quietCheckInterval))
+		select {
+		case <-timer.C:
+		case <-p.abort:
+			timer.Stop()
+			return false
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// announceQuiet prints when the run pauses for quiet hours, until the zero time
+// announces that it resumes
+func (p *Processor) announceQuiet(until time.Time) {
+	p.quietMutex.Lock()
+	defer p.quietMutex.Unlock()
+	switch {
+	case until.Equal(p.quietAnnounced):
+		return
+	case until.IsZero():
+		fmt.Println("[SCHEDULE] Quiet hours over, resuming")
+	case p.quietMode == QuietThrottle:
+		fmt.Printf("[SCHEDULE] Quiet hours: throttling until %s\n", until.Format("Mon 15:04"))
+	default:
+		fmt.Printf("[SCHEDULE] Quiet hours: pausing until %s\n", until.Format("Mon 15:04"))
+	}
+	p.quietAnnounced = until
+}
+
+// scheduled runs one file once the run is not paused, under the quiet hours schedule:
+// after the pause, or in the single throttled slot, which the file holds for
+// throttleDutyCycle times as long as it takes. It reports false when the run stopped
+// while waiting.
+func (p *Processor) scheduled(ctx context.Context, process func()) bool {
+	if !p.waitPaused(ctx) {
+		return false
+	}
+	if len(p.quietWindows) == 0 {
+		process()
+		return true
+	}
+	if p.quietMode == QuietPause {
+		if !p.waitQuietHours(ctx) {
+			return false
+		}
+		process()
+		return true
+	}
+	until, quiet := p.quietUntil(time.Now())
+	if !quiet {
+		p.announceQuiet(time.Time{})
+		process()
+		return true
+	}
+	p.announceQuiet(until)
+	select {
+	case p.throttleSlot <- struct{}{}:
+	case <-p.abort:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+	defer func() { <-p.throttleSlot }()
+	started := time.Now()
+	process()
+	rest := time.Since(started) * (throttleDutyCycle - 1)
+	if rest > 0 {
+		timer := time.NewTimer(min(rest, time.Until(until)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	return true
+}
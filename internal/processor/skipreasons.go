@@ -0,0 +1,39 @@
+package processor
+
+// Skip reasons recorded in FileResult.SkipReason and counted in Statistics.SkipReasons
+const (
+	SkipNoSidecar        = "no-sidecar"        // No JSON sidecar (and no EXIF time with -sync-mtime)
+	SkipUnsupportedType  = "unsupported-type"  // Not a media format the tool can write
+	SkipNotMedia         = "not-media"         // A .ts file that is not an MPEG transport stream, e.g. TypeScript
+	SkipFilteredOut      = "filtered-out"      // Outside the albums selected with -album
+	SkipAlreadyProcessed = "already-processed" // Carries the -marker of a previous run, or done before -resume
+	SkipTrashed          = "trashed"           // In the Google Photos trash according to its sidecar
+	SkipDuplicate        = "duplicate"         // Another copy of the same photo is processed instead
+	SkipOutsideRoot      = "outside-root"      // Resolves outside the Takeout root
+	SkipSuspectedMatch   = "suspected-match"   // The sidecar's title names another photo
+	SkipBadSidecar       = "bad-sidecar"       // The sidecar is a directory or too large to be JSON
+	SkipNotInLibrary     = "not-in-library"    // No single copy in the -relocated library
+	SkipNestedArchive    = "nested-archive"    // A zip inside the export, extracted with -extract-zips
+	SkipSplitPart        = "split-part"        // Part of a split video joined with -merge-split-videos
+	SkipCorrupt          = "corrupt"           // Empty or truncated, see metadata.CheckIntegrity
+	SkipTooLarge         = "too-large"         // A video over the WithMaxVideoSize limit
+)
+
+// SkipReasonNames returns the skip reasons in the order the summary lists them
+func SkipReasonNames() []string {
+	return []string{SkipNoSidecar, SkipUnsupportedType, SkipNotMedia, SkipFilteredOut, SkipAlreadyProcessed, SkipTrashed,
+		SkipDuplicate, SkipOutsideRoot, SkipSuspectedMatch, SkipBadSidecar, SkipNotInLibrary, SkipNestedArchive, SkipSplitPart, SkipCorrupt, SkipTooLarge}
+}
+
+// recordSkip counts a skipped file under its reason and records its result
+func (p *Processor) recordSkip(result FileResult, reason string) {
+	result.Status, result.SkipReason = StatusSkipped, reason
+	p.counters.skippedFiles.Add(1)
+	p.update(func(s *Statistics) {
+		if s.SkipReasons == nil {
+			s.SkipReasons = make(map[string]int)
+		}
+		s.SkipReasons[reason]++
+	})
+	p.recordResult(result)
+}
@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"sort"
+	"time"
+)
+
+// defaultSlowestFiles is how many of the slowest files a run keeps unless
+// WithSlowestFiles says otherwise
+const defaultSlowestFiles = 10
+
+// FileTiming is the time one media file took from being picked up by a worker to
+// its result, including copies, sidecar reads and every tool run for it
+type FileTiming struct {
+	Path     string
+	Size     int64
+	Duration time.Duration
+}
+
+// WithSlowestFiles keeps the n media files that took longest in
+// Statistics.SlowestFiles, slowest first, to find the giant videos and odd files
+// worth excluding or transcoding beforehand (0 = none). Dry runs write nothing and
+// keep none.
+func WithSlowestFiles(n int) Option {
+	return func(p *Processor) error {
+		p.slowestFiles = max(n, 0)
+		return nil
+	}
+}
+
+// recordDuration adds the time a media file took to the slowest files when it is one
+// of them
+func (p *Processor) recordDuration(job fileJob, d time.Duration) {
+	n := p.slowestFiles
+	if n == 0 || p.dryRun {
+		return
+	}
+	timing := FileTiming{Path: job.mediaPath, Size: job.size, Duration: d}
+	p.update(func(s *Statistics) {
+		i := sort.Search(len(s.SlowestFiles), func(i int) bool { return s.SlowestFiles[i].Duration < d })
+		if i >= n {
+			return
+		}
+		// A new slice, so snapshots taken before keep their list
+		slowest := make([]FileTiming, 0, min(len(s.SlowestFiles)+1, n))
+		slowest = append(slowest, s.SlowestFiles[:i]...)
+		slowest = append(slowest, timing)
+		slowest = append(slowest, s.SlowestFiles[i:min(len(s.SlowestFiles), n-1)]...)
+		s.SlowestFiles = slowest
+	})
+}
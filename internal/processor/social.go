@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Where shared album likes and comments are kept
+const (
+	SharedCommentsXMP  = "xmp"  // In the file's XMP (or its -video-xmp sidecar)
+	SharedCommentsText = "text" // In a .comments.txt file next to the media file
+)
+
+// WithSharedComments keeps the likes and comments a photo received in shared albums,
+// which the JSON records but no standard tag holds, in XMP or in a text file next to
+// it. An empty mode leaves them out.
+func WithSharedComments(mode string) Option {
+	return func(p *Processor) error {
+		switch mode {
+		case "", SharedCommentsXMP, SharedCommentsText:
+			p.sharedComments = mode
+			return nil
+		}
+		return fmt.Errorf("unknown shared comments mode %q (expected %s or %s)", mode, SharedCommentsXMP, SharedCommentsText)
+	}
+}
+
+// writeSharedComments writes the .comments.txt file of a processed media file with
+// shared album likes or comments, leaving an identical file untouched
+func (p *Processor) writeSharedComments(target string, meta *metadata.Metadata) {
+	text := meta.SocialText()
+	if p.sharedComments != SharedCommentsText || text == "" {
+		return
+	}
+	path := target + ".comments.txt"
+	if p.dryRun {
+		fmt.Printf("[DRY-RUN] Would write shared album comments to %s\n", path)
+		return
+	}
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, []byte(text)) {
+		return
+	}
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		p.warn(target, "Failed to write shared album comments %s: %v", path, err)
+		return
+	}
+	if p.verbose {
+		fmt.Printf("    Shared album comments: %s\n", path)
+	}
+}
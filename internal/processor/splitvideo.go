@@ -0,0 +1,191 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// MatchSplitParts is the match strategy recorded for a joined split video that uses
+// the sidecar of one of its parts
+const MatchSplitParts = "split-parts"
+
+// splitPartPattern matches the names of the parts of a split video: VID_part1.mp4,
+// VID-part2.mp4, VID.part3.mp4 or VID (part 4).mp4
+var splitPartPattern = regexp.MustCompile(`(?i)^(.+?)(?:[ ._-]+|\s*\()part[ _-]?(\d{1,3})\)?(\.[^.]+)$`)
+
+// splitPart is one part of a split video found by the walk
+type splitPart struct {
+	job    int // Index in p.jobs
+	number int
+}
+
+// WithMergeSplitVideos joins the parts of split videos (VID_part1.mp4, VID_part2.mp4,
+// ...) into one video next to them (VID.mp4) with ffmpeg before applying metadata,
+// instead of only warning about them. The joined video takes its own sidecar or the
+// first part's. The parts are kept; a later run finding the joined video skips them.
+func WithMergeSplitVideos(enabled bool) Option {
+	return func(p *Processor) error {
+		p.mergeSplitVideos = enabled
+		return nil
+	}
+}
+
+// findSplitVideos looks for videos split into numbered parts. Complete sets of parts
+// are replaced by one job for the joined video with -merge-split-videos; otherwise
+// they are processed one by one with a warning.
+func (p *Processor) findSplitVideos() {
+	groups := make(map[string][]splitPart)
+	var joined []string
+	for i, job := range p.jobs {
+		if !isVideoFile(job.mediaPath) {
+			continue
+		}
+		m := splitPartPattern.FindStringSubmatch(filepath.Base(job.mediaPath))
+		if m == nil {
+			continue
+		}
+		number, _ := strconv.Atoi(m[2])
+		target := filepath.Join(filepath.Dir(job.mediaPath), m[1]+m[3])
+		if _, ok := groups[target]; !ok {
+			joined = append(joined, target)
+		}
+		groups[target] = append(groups[target], splitPart{job: i, number: number})
+	}
+
+	drop := make(map[int]bool)
+	var added []fileJob
+	for _, target := range joined {
+		parts := groups[target]
+		sort.Slice(parts, func(i, j int) bool { return parts[i].number < parts[j].number })
+		if len(parts) < 2 {
+			continue // A single "part" is more likely just a name
+		}
+		if missing := missingPart(parts); missing > 0 {
+			p.warn(target, "Split video %s is missing part %d; its %d parts are processed separately", target, missing, len(parts))
+			continue
+		}
+		if !p.mergeSplitVideos {
+			p.warn(target, "%s is split into %d parts; use -merge-split-videos to join them with ffmpeg", target, len(parts))
+			continue
+		}
+
+		for _, part := range parts {
+			drop[part.job] = true
+		}
+		if p.hasJob(target) {
+			// Joined by a previous run; the joined video is processed like any other
+			for _, part := range parts {
+				job := p.jobs[part.job]
+				p.uncountMatch(job.matchRule)
+				p.recordSkip(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath,
+					Message: "part of a split video already joined into " + target}, SkipSplitPart)
+			}
+			continue
+		}
+		added = append(added, p.joinedJob(target, parts))
+	}
+	if len(drop) == 0 {
+		return
+	}
+
+	jobs := p.jobs[:0]
+	for i, job := range p.jobs {
+		if !drop[i] {
+			jobs = append(jobs, job)
+		}
+	}
+	p.jobs = append(jobs, added...)
+}
+
+// missingPart returns the first part number missing from parts sorted by number, 0
+// when they are complete. Numbering starts at 1, or at 0 for some tools.
+func missingPart(parts []splitPart) int {
+	next := 1
+	if parts[0].number == 0 {
+		next = 0
+	}
+	for _, part := range parts {
+		if part.number != next {
+			return next
+		}
+		next++
+	}
+	return 0
+}
+
+// joinedJob returns the job for the video joined from parts, using its own sidecar
+// or, failing that, the first part's
+func (p *Processor) joinedJob(target string, parts []splitPart) fileJob {
+	job := fileJob{mediaPath: target}
+	for _, part := range parts {
+		partJob := p.jobs[part.job]
+		job.size += partJob.size
+		job.splitParts = append(job.splitParts, partJob.mediaPath)
+		p.uncountMatch(partJob.matchRule)
+	}
+	job.jsonInfo, job.jsonPath, job.matchRule, job.jsonErr = p.resolveSidecar(target)
+	if job.jsonErr != nil {
+		for _, part := range parts {
+			if partJob := p.jobs[part.job]; partJob.jsonErr == nil {
+				job.jsonInfo, job.jsonPath, job.jsonErr, job.matchRule = partJob.jsonInfo, partJob.jsonPath, nil, MatchSplitParts
+				break
+			}
+		}
+	}
+	rule := job.matchRule
+	p.update(func(s *Statistics) { s.MatchStrategies[rule]++ })
+	if p.verbose {
+		fmt.Printf("[SPLIT] %d parts will be joined into %s\n", len(parts), target)
+	}
+	return job
+}
+
+// hasJob reports whether a media file is queued
+func (p *Processor) hasJob(path string) bool {
+	for _, job := range p.jobs {
+		if job.mediaPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// uncountMatch removes a job from the match strategy counts
+func (p *Processor) uncountMatch(rule string) {
+	p.update(func(s *Statistics) {
+		if s.MatchStrategies[rule]--; s.MatchStrategies[rule] <= 0 {
+			delete(s.MatchStrategies, rule)
+		}
+	})
+}
+
+// joinSplitVideo joins the parts of a split video before its metadata is applied.
+// It reports false when the parts could not be joined, after recording the error.
+func (p *Processor) joinSplitVideo(ctx context.Context, job fileJob) bool {
+	if p.dryRun {
+		fmt.Printf("[DRY-RUN] Would join %d parts into %s\n", len(job.splitParts), job.mediaPath)
+		for _, part := range job.splitParts {
+			p.recordSkip(FileResult{Path: part, Message: "part of a split video, would be joined into " + job.mediaPath}, SkipSplitPart)
+		}
+		return true
+	}
+	if err := metadata.JoinVideos(ctx, job.splitParts, job.mediaPath); err != nil {
+		p.recordError()
+		fmt.Printf("[ERROR] Failed to join %s: %v\n", job.mediaPath, err)
+		p.recordResult(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath, Status: StatusError,
+			Message: fmt.Sprintf("joining %s: %v", strings.Join(job.splitParts, ", "), err), Err: err})
+		return false
+	}
+	fmt.Printf("[SPLIT] Joined %d parts into %s\n", len(job.splitParts), job.mediaPath)
+	for _, part := range job.splitParts {
+		p.recordSkip(FileResult{Path: part, Message: "part of a split video joined into " + job.mediaPath}, SkipSplitPart)
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"os"
+	"time"
+)
+
+// Run stages timed in Statistics.Stages
+const (
+	StageScan       = "scan"        // Walking the export
+	StageMatch      = "match"       // Finding, pairing and de-duplicating sidecars
+	StageReadJSON   = "read-json"   // Parsing sidecars and adjusting their times
+	StageWriteImage = "write-image" // Writing image metadata, including output copies
+	StageWriteVideo = "write-video" // Writing video metadata, including output copies
+	StageDedupe     = "dedupe"      // Finding processed files with the same content, with WithPipeline
+	StageReorganize = "reorganize"  // Copying processed files into a library by photo time
+	StageVerify     = "verify"      // Checking the written files against their checksums
+)
+
+// StageNames returns the run stages in the order they happen
+func StageNames() []string {
+	return []string{StageScan, StageMatch, StageReadJSON, StageWriteImage, StageWriteVideo, StageDedupe, StageReorganize, StageVerify}
+}
+
+// StageStats is the time and IO volume of one run stage. Scan and match times are wall
+// time; the other stages run in the workers and add up the time spent on every file,
+// which can exceed the run's elapsed time. Byte counts are estimated from file sizes:
+// a written file counts as read once and, when it changed, written once.
+type StageStats struct {
+	Files        int
+	Duration     time.Duration
+	BytesRead    int64
+	BytesWritten int64
+}
+
+// recordStage adds one measurement to a stage
+func (p *Processor) recordStage(name string, files int, d time.Duration, read, written int64) {
+	p.update(func(s *Statistics) {
+		if s.Stages == nil {
+			s.Stages = make(map[string]StageStats)
+		}
+		stage := s.Stages[name]
+		stage.Files += files
+		stage.Duration += d
+		stage.BytesRead += read
+		stage.BytesWritten += written
+		s.Stages[name] = stage
+	})
+}
+
+// recordWrite adds the write of one media file to its stage. path is the file after
+// the write; size is the size of the media file it was written from.
+func (p *Processor) recordWrite(mediaPath, path string, size int64, written bool, d time.Duration) {
+	stage := StageWriteImage
+	if isVideoFile(mediaPath) {
+		stage = StageWriteVideo
+	}
+	var bytesWritten int64
+	if written {
+		if info, err := os.Stat(path); err == nil {
+			bytesWritten = info.Size()
+		}
+	}
+	p.recordStage(stage, 1, d, size, bytesWritten)
+	p.chargeIO(stage, size, bytesWritten)
+}
+
+// copyStages copies a stage map so the snapshot doesn't share it with the collector
+func copyStages(stages map[string]StageStats) map[string]StageStats {
+	if stages == nil {
+		return nil
+	}
+	copied := make(map[string]StageStats, len(stages))
+	for k, v := range stages {
+		copied[k] = v
+	}
+	return copied
+}
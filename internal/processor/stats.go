@@ -0,0 +1,96 @@
+package processor
+
+import "sync/atomic"
+
+// statCounters are the Statistics counters, updated by workers without locking
+type statCounters struct {
+	mediaFiles      atomic.Int64
+	sidecarFiles    atomic.Int64
+	otherFiles      atomic.Int64
+	jsonFiles       atomic.Int64
+	nonMediaFiles   atomic.Int64
+	legacyFiles     atomic.Int64
+	picasaFiles     atomic.Int64
+	processedFiles  atomic.Int64
+	modifiedFiles   atomic.Int64
+	unmodifiedFiles atomic.Int64
+	skippedFiles    atomic.Int64
+	partnerFiles    atomic.Int64
+	creationFiles   atomic.Int64
+	corruptFiles    atomic.Int64
+	transportFiles  atomic.Int64
+	syncedFiles     atomic.Int64
+	clonedFiles     atomic.Int64
+	linkedFiles     atomic.Int64
+	writeMismatches atomic.Int64
+	errorCount      atomic.Int64
+	bytesChanged    atomic.Int64
+}
+
+// scanned returns how many files the scan found: media, sidecars and others
+func (c *statCounters) scanned() int64 {
+	return c.mediaFiles.Load() + c.sidecarFiles.Load() + c.otherFiles.Load()
+}
+
+// statsQueueSize lets workers hand off detail updates without waiting on the collector
+const statsQueueSize = 1024
+
+// update queues a change to the Statistics detail lists. Changes are applied in order
+// by a single collector goroutine, so workers never contend on a lock for them.
+func (p *Processor) update(fn func(*Statistics)) {
+	p.collectorOnce.Do(func() {
+		p.updates = make(chan func(*Statistics), p.queueSize(statsQueueSize))
+		go func() {
+			for fn := range p.updates {
+				fn(&p.stats)
+			}
+		}()
+	})
+	p.updates <- fn
+}
+
+// getStatsCopy returns a snapshot of the statistics, including every update queued so far
+func (p *Processor) getStatsCopy() Statistics {
+	snapshot := make(chan Statistics)
+	p.update(func(s *Statistics) {
+		copied := *s
+		copied.MatchStrategies = copyCounts(s.MatchStrategies)
+		copied.SkipReasons = copyCounts(s.SkipReasons)
+		copied.Stages = copyStages(s.Stages)
+		snapshot <- copied
+	})
+	stats := <-snapshot
+
+	stats.MediaFiles = int(p.counters.mediaFiles.Load())
+	stats.SidecarFiles = int(p.counters.sidecarFiles.Load())
+	stats.OtherFiles = int(p.counters.otherFiles.Load())
+	stats.TotalFiles = stats.MediaFiles + stats.SidecarFiles + stats.OtherFiles
+	stats.JSONFiles = int(p.counters.jsonFiles.Load())
+	stats.NonMediaFiles = int(p.counters.nonMediaFiles.Load())
+	stats.LegacyFiles = int(p.counters.legacyFiles.Load())
+	stats.PicasaFiles = int(p.counters.picasaFiles.Load())
+	stats.ProcessedFiles = int(p.counters.processedFiles.Load())
+	stats.ModifiedFiles = int(p.counters.modifiedFiles.Load())
+	stats.UnmodifiedFiles = int(p.counters.unmodifiedFiles.Load())
+	stats.SkippedFiles = int(p.counters.skippedFiles.Load())
+	stats.PartnerFiles = int(p.counters.partnerFiles.Load())
+	stats.CreationFiles = int(p.counters.creationFiles.Load())
+	stats.CorruptFiles = int(p.counters.corruptFiles.Load())
+	stats.TransportStreams = int(p.counters.transportFiles.Load())
+	stats.ClonedFiles = int(p.counters.clonedFiles.Load())
+	stats.LinkedFiles = int(p.counters.linkedFiles.Load())
+	stats.WriteMismatches = int(p.counters.writeMismatches.Load())
+	stats.SyncedFiles = int(p.counters.syncedFiles.Load())
+	stats.ErrorCount = int(p.counters.errorCount.Load())
+	stats.BytesChanged = p.counters.bytesChanged.Load()
+	return stats
+}
+
+// copyCounts copies a counter map so the snapshot doesn't share it with the collector
+func copyCounts(counts map[string]int) map[string]int {
+	copied := make(map[string]int, len(counts))
+	for k, v := range counts {
+		copied[k] = v
+	}
+	return copied
+}
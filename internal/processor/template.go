@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// templateField matches a {field} placeholder in a name template
+var templateField = regexp.MustCompile(`\{([a-z]*)\}`)
+
+// templateFields render the placeholders of a name template from the photo time and
+// the original file name without its extension
+var templateFields = map[string]func(t time.Time, original string) string{
+	"yyyy":     func(t time.Time, _ string) string { return t.Format("2006") },
+	"yy":       func(t time.Time, _ string) string { return t.Format("06") },
+	"mm":       func(t time.Time, _ string) string { return t.Format("01") },
+	"dd":       func(t time.Time, _ string) string { return t.Format("02") },
+	"hh":       func(t time.Time, _ string) string { return t.Format("15") },
+	"min":      func(t time.Time, _ string) string { return t.Format("04") },
+	"ss":       func(t time.Time, _ string) string { return t.Format("05") },
+	"hhmmss":   func(t time.Time, _ string) string { return t.Format("150405") },
+	"original": func(_ time.Time, original string) string { return original },
+}
+
+// WithNameTemplate names the copies written in output mode after their metadata, e.g.
+// "{yyyy}{mm}{dd}_{hhmmss}_{original}". The extension is kept. A template with "/"
+// also chooses the folders below the output directory ("{yyyy}/{mm}/{original}");
+// otherwise copies stay in their original folder. Files without a usable photo time
+// keep their name. An empty template keeps all names.
+func WithNameTemplate(template string) Option {
+	return func(p *Processor) error {
+		if template == "" {
+			p.nameTemplate = ""
+			return nil
+		}
+		if err := validateNameTemplate(template); err != nil {
+			return err
+		}
+		p.nameTemplate = template
+		return nil
+	}
+}
+
+// validateNameTemplate checks that a template only uses known fields and names no
+// empty or relative path segments
+func validateNameTemplate(template string) error {
+	for _, match := range templateField.FindAllStringSubmatch(template, -1) {
+		if _, ok := templateFields[match[1]]; !ok {
+			return fmt.Errorf("unknown field %s in name template", match[0])
+		}
+	}
+	for _, segment := range strings.Split(template, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid path segment %q in name template", segment)
+		}
+	}
+	return nil
+}
+
+// prepareJob parses the job's sidecar and applies the time adjustments ahead of the
+// run, keeping the result for processMediaFile, and returns the photo time that will
+// be written. It reports false for files without a usable sidecar or photo time;
+// those are left for processMediaFile to report.
+func (p *Processor) prepareJob(ctx context.Context, job *fileJob) (time.Time, bool) {
+	// Manifest jobs come with their metadata
+	if job.meta == nil {
+		if job.jsonErr != nil || job.jsonInfo.IsDir() || job.jsonInfo.Size() > metadata.MaxJSONSize {
+			return time.Time{}, false
+		}
+		started := time.Now()
+		meta, err := p.loadMetadata(ctx, job.mediaPath, job.jsonPath)
+		p.recordStage(StageReadJSON, 1, time.Since(started), job.jsonInfo.Size(), 0)
+		if err != nil {
+			return time.Time{}, false
+		}
+		job.meta = meta
+	}
+	photoTime, err := job.meta.GetPhotoTime()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return photoTime, true
+}
+
+// expandNameTemplate returns the folder and file name of a copy named by the template.
+// name is the copy's current file name, whose stem fills {original}.
+func expandNameTemplate(template string, photoTime time.Time, dir, name string) (string, string) {
+	ext := filepath.Ext(name)
+	original := strings.TrimSuffix(name, ext)
+	expanded := templateField.ReplaceAllStringFunc(template, func(field string) string {
+		return templateFields[field[1:len(field)-1]](photoTime, original)
+	})
+
+	segments := strings.Split(expanded, "/")
+	for i, segment := range segments {
+		segments[i] = sanitizeSegment(segment)
+	}
+	name = segments[len(segments)-1] + ext
+	if len(segments) > 1 {
+		dir = filepath.Join(segments[:len(segments)-1]...)
+	}
+	return dir, name
+}
+
+// sanitizeSegment replaces the characters Windows does not allow in a file or folder
+// name, which an original name filled into a template may contain
+func sanitizeSegment(segment string) string {
+	segment = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(windowsInvalid, r) {
+			return '_'
+		}
+		return r
+	}, segment)
+	segment = strings.TrimRight(strings.TrimSpace(segment), ".")
+	if segment == "" {
+		return "unnamed"
+	}
+	return segment
+}
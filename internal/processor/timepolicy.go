@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Timestamp policies used when photoTakenTime and creationTime disagree
+const (
+	TimePolicyTaken    = "taken"
+	TimePolicyCreation = "creation"
+	TimePolicyEarliest = "earliest"
+)
+
+// ValidateTimePolicy checks that policy is one of the supported timestamp policies
+func ValidateTimePolicy(policy string) error {
+	switch policy {
+	case "", TimePolicyTaken, TimePolicyCreation, TimePolicyEarliest:
+		return nil
+	}
+	return fmt.Errorf("unknown time policy %q (expected %s, %s or %s)", policy, TimePolicyTaken, TimePolicyCreation, TimePolicyEarliest)
+}
+
+// WithTimePolicy configures which timestamp is written when photoTakenTime and
+// creationTime differ by more than threshold (0 disables conflict detection)
+func WithTimePolicy(policy string, threshold time.Duration) Option {
+	return func(p *Processor) error {
+		p.timePolicy = policy
+		p.timeThreshold = threshold
+		return nil
+	}
+}
+
+// applyTimePolicy flags files whose taken and creation times differ wildly and,
+// depending on the policy, overrides the time that will be written
+func (p *Processor) applyTimePolicy(mediaPath string, meta *metadata.Metadata) {
+	if p.timeThreshold <= 0 {
+		return
+	}
+	taken, created, ok := meta.GetTakenAndCreationTimes()
+	if !ok {
+		return
+	}
+	gap := taken.Sub(created)
+	if gap < 0 {
+		gap = -gap
+	}
+	if gap <= p.timeThreshold {
+		return
+	}
+
+	chosen := taken
+	switch p.timePolicy {
+	case TimePolicyCreation:
+		chosen = created
+	case TimePolicyEarliest:
+		if created.Before(taken) {
+			chosen = created
+		}
+	}
+	meta.SetPhotoTime(chosen)
+
+	detail := fmt.Sprintf("  %s\n    Taken: %s, Created: %s, Using: %s",
+		filepath.Base(mediaPath),
+		taken.Format("2006-01-02 15:04:05"),
+		created.Format("2006-01-02 15:04:05"),
+		chosen.Format("2006-01-02 15:04:05"))
+	p.update(func(s *Statistics) { s.TimestampConflicts = append(s.TimestampConflicts, detail) })
+	if p.verbose {
+		fmt.Printf("[WARN] Taken and creation times differ by %s: %s\n", gap.Round(time.Hour), mediaPath)
+	}
+}
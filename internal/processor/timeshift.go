@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// TimeShift is a calendar-aware offset applied to written timestamps
+type TimeShift struct {
+	Years    int
+	Months   int
+	Days     int
+	Duration time.Duration
+}
+
+// calendarShiftRe matches a leading calendar component; months use "mo" so that
+// "m" keeps meaning minutes in the trailing Go duration
+var calendarShiftRe = regexp.MustCompile(`^(\d+)(y|mo|d)`)
+
+// ParseTimeShift parses offsets such as "-5y", "+3mo10d", "+2h37m" or "1y-2h".
+// Years (y), months (mo) and days (d) come first, followed by an optional Go duration.
+func ParseTimeShift(value string) (TimeShift, error) {
+	var shift TimeShift
+	s := strings.TrimSpace(value)
+	if s == "" {
+		return shift, fmt.Errorf("empty time shift")
+	}
+
+	sign := 1
+	switch s[0] {
+	case '-':
+		sign = -1
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	for {
+		m := calendarShiftRe.FindStringSubmatch(s)
+		if m == nil {
+			break
+		}
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "y":
+			shift.Years += sign * n
+		case "mo":
+			shift.Months += sign * n
+		case "d":
+			shift.Days += sign * n
+		}
+		s = s[len(m[0]):]
+	}
+
+	if s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return TimeShift{}, fmt.Errorf("invalid time shift %q: %w", value, err)
+		}
+		shift.Duration = time.Duration(sign) * d
+	}
+	return shift, nil
+}
+
+// IsZero reports whether the shift changes nothing
+func (s TimeShift) IsZero() bool {
+	return s.Years == 0 && s.Months == 0 && s.Days == 0 && s.Duration == 0
+}
+
+// Apply shifts t by the offset
+func (s TimeShift) Apply(t time.Time) time.Time {
+	return t.AddDate(s.Years, s.Months, s.Days).Add(s.Duration)
+}
+
+// WithTimeShift configures a shift applied to every written timestamp, plus per-camera
+// shifts keyed by EXIF camera model (case-insensitive)
+func WithTimeShift(global TimeShift, cameras map[string]string) Option {
+	return func(p *Processor) error {
+		p.timeShift = global
+		p.cameraShifts = make(map[string]TimeShift, len(cameras))
+		for model, value := range cameras {
+			shift, err := ParseTimeShift(value)
+			if err != nil {
+				return fmt.Errorf("camera %q: %w", model, err)
+			}
+			p.cameraShifts[strings.ToLower(strings.TrimSpace(model))] = shift
+		}
+		return nil
+	}
+}
+
+// applyTimeShift applies the camera-specific and global clock-skew corrections
+func (p *Processor) applyTimeShift(ctx context.Context, mediaPath string, meta *metadata.Metadata) {
+	shift := p.timeShift
+	if len(p.cameraShifts) > 0 {
+		model := metadata.ReadCameraModel(ctx, mediaPath)
+		if cameraShift, ok := p.cameraShifts[strings.ToLower(model)]; ok {
+			shift = TimeShift{
+				Years:    shift.Years + cameraShift.Years,
+				Months:   shift.Months + cameraShift.Months,
+				Days:     shift.Days + cameraShift.Days,
+				Duration: shift.Duration + cameraShift.Duration,
+			}
+			if p.verbose {
+				fmt.Printf("    Camera %s: applying time shift\n", model)
+			}
+		}
+	}
+	if shift.IsZero() {
+		return
+	}
+	if photoTime, err := meta.GetPhotoTime(); err == nil {
+		meta.SetPhotoTime(shift.Apply(photoTime))
+	}
+}
+
+// parseFixedDate parses a date override in one of the accepted layouts, as UTC
+func parseFixedDate(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD or YYYY-MM-DDTHH:MM:SS)", value)
+}
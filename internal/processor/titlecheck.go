@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ErrTitleMismatch is recorded in FileResult.Err for files left untouched because
+// their sidecar describes a differently named photo
+var ErrTitleMismatch = errors.New("JSON title does not match the file name")
+
+// minTruncatedKey is the shortest title key accepted as a truncated form of the other,
+// as Google only cuts long names
+const minTruncatedKey = 16
+
+// WithForce applies sidecars whose title does not match the media file name instead of
+// skipping the file as a suspected wrong match
+func WithForce(enabled bool) Option {
+	return func(p *Processor) error {
+		p.force = enabled
+		return nil
+	}
+}
+
+// titleMatches reports whether a sidecar's "title" roughly names the media file. The
+// names are compared without extensions, duplicate numbers, edited markers, case and
+// punctuation, and a long name may be a truncated form of the other. An empty title
+// can't be checked and matches.
+func titleMatches(mediaPath, title string) bool {
+	if title == "" {
+		return true
+	}
+	media, want := titleKey(filepath.Base(mediaPath)), titleKey(title)
+	if media == want || media == "" || want == "" {
+		return true
+	}
+	short, long := media, want
+	if len(short) > len(long) {
+		short, long = long, short
+	}
+	return len(short) >= minTruncatedKey && strings.HasPrefix(long, short)
+}
+
+// titleKey reduces a file name to the lower-cased letters and digits of its stem
+func titleKey(name string) string {
+	name = duplicateNumber.ReplaceAllString(name, "")
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	for _, suffix := range editedSuffixes {
+		if strings.HasSuffix(strings.ToLower(name), suffix) {
+			name = name[:len(name)-len(suffix)]
+			break
+		}
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// skipTitleMismatch records a file whose sidecar seems to belong to another photo.
+// In output mode the file is still copied unchanged, so the output library is complete.
+func (p *Processor) skipTitleMismatch(job fileJob, title string) {
+	p.warn(job.mediaPath, "Suspected wrong match: %s has the JSON of %q (%s); use -force to apply it", job.mediaPath, title, job.jsonPath)
+	var copied string
+	if p.outputDir != "" && !p.dryRun {
+		linked, err := p.linkToOutput(job.mediaPath, job.outputPath)
+		if err != nil {
+			p.recordError()
+			fmt.Printf("[ERROR] %s: %v\n", job.mediaPath, err)
+			p.recordResult(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath, Status: StatusError, Message: err.Error(), Err: err})
+			return
+		}
+		if linked {
+			p.counters.linkedFiles.Add(1)
+		}
+		copied = job.outputPath
+	}
+	detail := fmt.Sprintf("  %s: JSON title %q (%s)", job.mediaPath, title, filepath.Base(job.jsonPath))
+	p.update(func(s *Statistics) { s.SuspectedMatches = append(s.SuspectedMatches, detail) })
+	p.recordSkip(FileResult{Path: job.mediaPath, JSONPath: job.jsonPath, Output: copied,
+		Message: fmt.Sprintf("suspected wrong match: JSON title %q", title), Err: ErrTitleMismatch}, SkipSuspectedMatch)
+}
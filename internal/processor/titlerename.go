@@ -0,0 +1,214 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// generatedNamePattern matches file name stems made up by an app or service instead of
+// a person: UUIDs, long hex hashes and Google Photos media IDs (AF1Qip...)
+var generatedNamePattern = regexp.MustCompile(`(?i)^(?:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|[0-9a-f]{16,}|AF1Qip[0-9a-z_-]{20,})$`)
+
+// RenameEntry is one line of a rename journal
+type RenameEntry struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+// WithRenameToTitle renames media files whose name was generated (a UUID, hash or
+// Google media ID) to the title in their JSON sidecar, keeping their extension. The
+// title is cleaned up like -normalize-names and numbered when the name is taken. In
+// output mode the copy gets the new name; otherwise the file is renamed after its
+// metadata is written and the rename is recorded in the journal, so "undo-renames"
+// can revert it.
+func WithRenameToTitle(enabled bool, journal string) Option {
+	return func(p *Processor) error {
+		if !enabled {
+			p.renameToTitle, p.renameJournal = false, ""
+			return nil
+		}
+		if journal == "" {
+			return errors.New("renaming to titles needs a rename journal")
+		}
+		abs, err := filepath.Abs(journal)
+		if err != nil {
+			return fmt.Errorf("failed to resolve rename journal: %w", err)
+		}
+		p.renameToTitle, p.renameJournal = true, abs
+		return nil
+	}
+}
+
+// isGeneratedName reports whether a media file name was made up by an app rather
+// than chosen by a person, ignoring the duplicate number Google adds
+func isGeneratedName(path string) bool {
+	name := filepath.Base(path)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	stem = strings.TrimSpace(duplicateNumber.ReplaceAllString(stem, ""))
+	return generatedNamePattern.MatchString(stem)
+}
+
+// titleName returns the file name a media file with a generated name gets from its
+// JSON title, or "" when it keeps its name: its name is not generated, or the title is
+// missing, generated too, or already the file's name
+func (p *Processor) titleName(ctx context.Context, job *fileJob) string {
+	if !isGeneratedName(job.mediaPath) {
+		return ""
+	}
+	if job.meta == nil {
+		p.prepareJob(ctx, job)
+	}
+	if job.meta == nil {
+		return ""
+	}
+	title := strings.TrimSpace(job.meta.Title)
+	if isSupportedMediaFile(title) {
+		title = strings.TrimSuffix(title, filepath.Ext(title))
+	}
+	if title == "" || isGeneratedName(title) {
+		return ""
+	}
+	name := normalizeFileName(title + filepath.Ext(job.mediaPath))
+	if strings.EqualFold(name, filepath.Base(job.mediaPath)) {
+		return ""
+	}
+	return name
+}
+
+// planTitleRenames assigns the new names of the files renamed in place to their title.
+// Names already used by a file on disk or by another rename are numbered, in queue
+// order, so the same export always gets the same names. Output mode names the copies
+// in planOutputs instead.
+func (p *Processor) planTitleRenames(ctx context.Context) {
+	if !p.renameToTitle || p.outputDir != "" {
+		return
+	}
+	taken := make(map[string]bool)
+	for i := range p.jobs {
+		job := &p.jobs[i]
+		if job.jsonErr != nil {
+			continue
+		}
+		name := p.titleName(ctx, job)
+		if name == "" {
+			continue
+		}
+		target := job.mediaPath
+		if job.outputPath != "" {
+			target = job.outputPath
+		}
+		if !isGeneratedName(target) {
+			continue // A relocated copy found by hash may have been named already
+		}
+		wanted := filepath.Join(filepath.Dir(target), name)
+		path := uniquePath(wanted, taken)
+		for {
+			if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			path = uniquePath(wanted, taken)
+		}
+		job.renamePath = path
+	}
+}
+
+// renameFileToTitle renames a written file to the name planned from its title, recording
+// the rename in the journal first, and returns the file's path afterwards. A failed
+// rename only warns; the file keeps its name.
+func (p *Processor) renameFileToTitle(path, newPath string) string {
+	if _, err := os.Lstat(newPath); err == nil {
+		p.warn(path, "Not renaming %s: %s already exists", path, newPath)
+		return path
+	}
+	if err := p.journalRename(path, newPath); err != nil {
+		p.warn(path, "Not renaming %s: %v", path, err)
+		return path
+	}
+	if err := os.Rename(path, newPath); err != nil {
+		p.warn(path, "Failed to rename %s to its title: %v", path, err)
+		return path
+	}
+	fmt.Printf("[RENAME] %s -> %s\n", path, filepath.Base(newPath))
+	return newPath
+}
+
+// journalRename appends a rename to the journal and syncs it, so a rename is on disk
+// before the file is renamed and can always be reverted
+func (p *Processor) journalRename(from, to string) error {
+	line, err := json.Marshal(RenameEntry{Time: time.Now().UTC(), From: from, To: to})
+	if err != nil {
+		return fmt.Errorf("failed to encode rename journal entry: %w", err)
+	}
+	p.journalMutex.Lock()
+	defer p.journalMutex.Unlock()
+	f, err := os.OpenFile(p.renameJournal, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open rename journal: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write rename journal: %w", err)
+	}
+	return nil
+}
+
+// LoadRenameJournal reads the renames recorded in a journal, oldest first
+func LoadRenameJournal(path string) ([]RenameEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rename journal: %w", err)
+	}
+	defer f.Close()
+
+	var entries []RenameEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry RenameEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("rename journal line %d: %w", line, err)
+		}
+		if entry.From == "" || entry.To == "" {
+			return nil, fmt.Errorf("rename journal line %d: missing path", line)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rename journal: %w", err)
+	}
+	return entries, nil
+}
+
+// UndoRename reverts one journaled rename. A file that is no longer at its new name,
+// or whose old name is taken again, is left alone with an error.
+func UndoRename(entry RenameEntry) error {
+	if _, err := os.Lstat(entry.To); err != nil {
+		return fmt.Errorf("renamed file is gone: %w", err)
+	}
+	if _, err := os.Lstat(entry.From); err == nil {
+		return fmt.Errorf("original name is taken: %s", entry.From)
+	}
+	if err := os.Rename(entry.To, entry.From); err != nil {
+		return fmt.Errorf("failed to rename back: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Photos with generated names and the title in their sidecar; two share a title
+// that a photo with a chosen name already has
+var titledPhotos = []struct {
+	name, title, renamed string
+}{
+	{"0123456789abcdef0123.jpg", "Beach.jpg", "Beach_2.jpg"},
+	{"3f2504e0-4f89-11d3-9a0c-0305e82c3301.jpg", "Sunset.JPG", "Sunset.jpg"},
+	{"AF1QipMxkR2bQ7vT9wZ3nL5pY8cD4fH6jK1s.jpg", "Beach.jpg", "Beach_3.jpg"},
+	{"Beach.jpg", "Beach.jpg", "Beach.jpg"},
+}
+
+// renameToTitles runs a processor renaming the titled photos in dir, recording the
+// renames in journal, and returns the files left in dir
+func renameToTitles(t *testing.T, dir, journal string) []string {
+	t.Helper()
+	for i, photo := range titledPhotos {
+		writeTakeoutPhoto(t, dir, photo.name, photo.title, int64(1563121200+i*60))
+	}
+	p, err := New(dir,
+		WithApplyOptions(metadata.ApplyOptions{Writer: metadata.WriterNative}),
+		WithOrder(OrderPath, nil),
+		WithRenameToTitle(true, journal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Process(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return dirNames(t, dir)
+}
+
+// undoRenames reverts the renames of a journal newest first, like "undo-renames", and
+// returns the entries that failed
+func undoRenames(t *testing.T, journal string) []RenameEntry {
+	t.Helper()
+	entries, err := LoadRenameJournal(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failed []RenameEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := UndoRename(entries[i]); err != nil {
+			failed = append(failed, entries[i])
+		}
+	}
+	return failed
+}
+
+// dirNames returns the sorted names of the files in dir
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRenameToTitleRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	journal := filepath.Join(t.TempDir(), "takeout-renames.jsonl")
+
+	// Titles taken on disk or by another rename are numbered, and the applied
+	// sidecars are gone
+	var renamed, original []string
+	for _, photo := range titledPhotos {
+		renamed = append(renamed, photo.renamed)
+		original = append(original, photo.name)
+	}
+	sort.Strings(renamed)
+	sort.Strings(original)
+	if got := renameToTitles(t, dir, journal); strings.Join(got, " ") != strings.Join(renamed, " ") {
+		t.Fatalf("files after renaming: %v, want %v", got, renamed)
+	}
+	entries, err := LoadRenameJournal(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(titledPhotos)-1 {
+		t.Errorf("journal records %d renames, want %d", len(entries), len(titledPhotos)-1)
+	}
+
+	if failed := undoRenames(t, journal); len(failed) > 0 {
+		t.Fatalf("undo failed for %v", failed)
+	}
+	if got := dirNames(t, dir); strings.Join(got, " ") != strings.Join(original, " ") {
+		t.Fatalf("files after undo: %v, want %v", got, original)
+	}
+
+	// With the sidecars of the export restored, every photo is paired with its own
+	// sidecar again
+	for _, photo := range titledPhotos {
+		sidecar := fmt.Sprintf(`{"title": %q}`, photo.title)
+		if err := os.WriteFile(filepath.Join(dir, photo.name+".supplemental-metadata.json"), []byte(sidecar), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := New(dir, WithDryRun(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.jobs) != len(titledPhotos) {
+		t.Fatalf("scan found %d photos, want %d", len(p.jobs), len(titledPhotos))
+	}
+	for _, job := range p.jobs {
+		if want := job.mediaPath + ".supplemental-metadata.json"; job.jsonErr != nil || job.jsonPath != want {
+			t.Errorf("%s paired with %q (%v), want %s", job.mediaPath, job.jsonPath, job.jsonErr, want)
+		}
+	}
+}
+
+func TestUndoRenameOriginalNameTaken(t *testing.T) {
+	dir := t.TempDir()
+	journal := filepath.Join(t.TempDir(), "takeout-renames.jsonl")
+	renameToTitles(t, dir, journal)
+
+	// A file created under an original name since the run is not overwritten
+	taken := filepath.Join(dir, titledPhotos[1].name)
+	if err := os.WriteFile(taken, []byte("new file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	failed := undoRenames(t, journal)
+	if len(failed) != 1 || failed[0].From != taken {
+		t.Fatalf("failed undos %v, want only the one to %s", failed, taken)
+	}
+	if data, err := os.ReadFile(taken); err != nil || string(data) != "new file" {
+		t.Errorf("%s overwritten by the undo", taken)
+	}
+	if _, err := os.Stat(filepath.Join(dir, titledPhotos[1].renamed)); err != nil {
+		t.Errorf("renamed file not left alone: %v", err)
+	}
+	for _, i := range []int{0, 2} {
+		if _, err := os.Stat(filepath.Join(dir, titledPhotos[i].name)); err != nil {
+			t.Errorf("other renames not undone: %v", err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package processor
+
+import (
+	"fmt"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// WithExcludeTransportStreams skips every .ts, .mts and .m2ts file as an unsupported
+// type, for folders where they are only ever source code or recordings to leave as
+// they are. Otherwise each one is sniffed and only real transport streams are processed.
+func WithExcludeTransportStreams(exclude bool) Option {
+	return func(p *Processor) error {
+		p.excludeTransport = exclude
+		return nil
+	}
+}
+
+// skipTransportStream checks a .ts, .mts or .m2ts file found by the scan and records
+// it as skipped when it is excluded or not an MPEG transport stream, which would only
+// make ffmpeg fail. It reports whether the file must be left out.
+func (p *Processor) skipTransportStream(path string) bool {
+	if !metadata.IsTransportStreamExt(path) {
+		return false
+	}
+	if p.excludeTransport {
+		p.recordSkip(FileResult{Path: path, Message: "transport streams are excluded by the config"}, SkipUnsupportedType)
+		return true
+	}
+	if !metadata.IsTransportStream(path) {
+		if p.verbose {
+			fmt.Printf("[SKIP] Not an MPEG transport stream: %s\n", path)
+		}
+		p.recordSkip(FileResult{Path: path, Message: "not an MPEG transport stream"}, SkipNotMedia)
+		return true
+	}
+	p.counters.transportFiles.Add(1)
+	return false
+}
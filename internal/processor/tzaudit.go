@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// WithTimezoneAudit enables the UTC-offset audit; with correct, the GPS-derived local
+// time is written instead of the UTC time from the JSON
+func WithTimezoneAudit(audit, correct bool) Option {
+	return func(p *Processor) error {
+		p.tzAudit = audit || correct
+		p.tzCorrect = correct
+		return nil
+	}
+}
+
+// gpsUTCOffset estimates the local UTC offset from the longitude (15° per hour).
+// It ignores political timezone borders and DST, so it is only a hint.
+func gpsUTCOffset(longitude float64) time.Duration {
+	return time.Duration(math.Round(longitude/15)) * time.Hour
+}
+
+// wholeHours returns the number of whole hours in d, and false if d is not within a
+// minute of a whole, non-zero number of hours no larger than 14
+func wholeHours(d time.Duration) (int, bool) {
+	hours := math.Round(d.Hours())
+	if hours == 0 || math.Abs(hours) > 14 {
+		return 0, false
+	}
+	if rest := d - time.Duration(hours)*time.Hour; rest < -time.Minute || rest > time.Minute {
+		return 0, false
+	}
+	return int(hours), true
+}
+
+// auditTimezone compares the time that will be written against the GPS-derived local
+// time and the file's existing EXIF time, flagging whole-hour differences
+func (p *Processor) auditTimezone(ctx context.Context, mediaPath string, meta *metadata.Metadata) {
+	if !p.tzAudit {
+		return
+	}
+	if _, ok := meta.GetLatitude(); !ok {
+		return
+	}
+	lon, ok := meta.GetLongitude()
+	if !ok {
+		return
+	}
+	written, err := meta.GetPhotoTime()
+	if err != nil {
+		return
+	}
+
+	offset := gpsUTCOffset(lon)
+	local := written.Add(offset)
+
+	var reason string
+	if existing, ok := metadata.ReadDateTimeOriginal(ctx, mediaPath); ok {
+		hours, whole := wholeHours(existing.Sub(written))
+		if !whole {
+			return
+		}
+		reason = fmt.Sprintf("existing EXIF time differs by %+dh", hours)
+	} else if offset != 0 {
+		reason = fmt.Sprintf("UTC time differs from GPS local time by %+dh", int(offset.Hours()))
+	} else {
+		return
+	}
+
+	action := ""
+	if p.tzCorrect {
+		meta.SetPhotoTime(local)
+		meta.SetUTCOffset(offset)
+		action = ", corrected to local time"
+	}
+
+	detail := fmt.Sprintf("  %s\n    Written (UTC): %s, GPS local: %s (%s%s)",
+		filepath.Base(mediaPath),
+		written.Format("2006-01-02 15:04:05"),
+		local.Format("2006-01-02 15:04:05"),
+		reason, action)
+	p.update(func(s *Statistics) { s.TimezoneAudit = append(s.TimezoneAudit, detail) })
+}
@@ -0,0 +1,12 @@
+package processor
+
+// WithVerifyWrites reads the tags back right after each file is written and compares
+// them with the values written. A file whose tags don't match (exiftool warned and
+// skipped them, or the format can't hold them) is counted as an error instead of a
+// success, and its sidecar is kept.
+func WithVerifyWrites(enabled bool) Option {
+	return func(p *Processor) error {
+		p.verifyWrites = enabled
+		return nil
+	}
+}
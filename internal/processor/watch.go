@@ -0,0 +1,235 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"google-takeout-exif-applier/internal/metadata"
+)
+
+// Defaults for WatchOptions
+const (
+	defaultWatchInterval = 10 * time.Second
+	defaultWatchSettle   = time.Minute
+)
+
+// WatchOptions controls how Watch follows an export that is still being extracted
+type WatchOptions struct {
+	Interval time.Duration // Time between two looks at the export (0 = 10s)
+	Settle   time.Duration // How long a folder must stay unchanged before its files are processed (0 = 1m)
+	Idle     time.Duration // Stop once no file appeared or changed for this long (0 = until ctx is cancelled)
+}
+
+// watchedFile is what the last look at the export saw of a media file
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchedDir is what the last look at the export saw of a folder
+type watchedDir struct {
+	modTime time.Time              // Modification time of the folder itself
+	changed time.Time              // When a media file in it last appeared or changed
+	files   map[string]watchedFile // Media files directly in the folder
+}
+
+// Watch processes the export while it is still being extracted or synced. Every
+// interval it looks at the folders under the roots; once no file in a folder has
+// appeared or changed for the settle time, the folder's new files are processed like
+// a -files-from list. Waiting for the whole folder gives the sidecars extracted after
+// their media files time to arrive. Only the folders that changed since the last look,
+// or have not settled yet, have their files listed again; the others are only
+// checked for a new modification time. It returns when ctx is cancelled, the error
+// limit is reached or, with an idle time, the export stops changing, with the
+// statistics of every file processed.
+func (p *Processor) Watch(ctx context.Context, opts WatchOptions) (Statistics, error) {
+	defer p.closeEvents()
+	defer p.watchEvents(ctx)()
+	defer metadata.RemoveExiftoolConfig()
+	if opts.Interval <= 0 {
+		opts.Interval = defaultWatchInterval
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = defaultWatchSettle
+	}
+	fmt.Printf("[WATCH] Watching %s every %s; a folder is processed once it was unchanged for %s\n",
+		p.rootDir, opts.Interval, opts.Settle)
+
+	started := time.Now()
+	dirs := make(map[string]*watchedDir)
+	for _, root := range p.roots() {
+		p.addWatchedDir(dirs, root, started)
+	}
+	done := make(map[string]bool)
+	lastChange := started
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for first := true; ; first = false {
+		if err := ctx.Err(); err != nil {
+			p.finishWatch(started)
+			return p.getStatsCopy(), fmt.Errorf("run interrupted: %w", err)
+		}
+		if p.aborted() {
+			p.finishWatch(started)
+			return p.getStatsCopy(), fmt.Errorf("%w: aborted after %d errors", ErrTooManyErrors, p.maxErrors)
+		}
+
+		now := time.Now()
+		if !first && p.pollWatchedDirs(ctx, dirs, now, opts.Settle) {
+			lastChange = now
+		}
+
+		var ready []string
+		waiting := 0
+		for _, dir := range dirs {
+			settled := now.Sub(dir.changed) >= opts.Settle
+			for path := range dir.files {
+				switch {
+				case done[path]:
+				case settled:
+					ready = append(ready, path)
+				default:
+					waiting++
+				}
+			}
+		}
+		if len(ready) > 0 && ctx.Err() == nil {
+			sort.Strings(ready)
+			fmt.Printf("[WATCH] Processing %d new media files\n", len(ready))
+			p.processArrived(ctx, ready)
+			// Writing the metadata changed the files; that is not new activity. Their
+			// folders are listed again on the next look, for files that arrived meanwhile.
+			for _, path := range ready {
+				done[path] = true
+				if dir, ok := dirs[filepath.Dir(path)]; ok {
+					if info, err := os.Stat(path); err == nil {
+						dir.files[path] = watchedFile{size: info.Size(), modTime: info.ModTime()}
+					}
+				}
+			}
+		}
+
+		if opts.Idle > 0 && len(ready) == 0 && waiting == 0 && time.Since(lastChange) >= opts.Idle {
+			fmt.Printf("[WATCH] Nothing changed for %s, stopping\n", opts.Idle)
+			p.finishWatch(started)
+			return p.getStatsCopy(), nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		case <-p.abort:
+		}
+	}
+}
+
+// pollWatchedDirs looks at the watched folders again and reports whether a media file
+// appeared, changed or went away. A folder whose modification time is unchanged had no
+// file added, removed or renamed, so its files are listed again only while it has not
+// settled, when they may still be growing.
+func (p *Processor) pollWatchedDirs(ctx context.Context, dirs map[string]*watchedDir, now time.Time, settle time.Duration) bool {
+	paths := make([]string, 0, len(dirs))
+	for path := range dirs {
+		paths = append(paths, path)
+	}
+	changed := false
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return changed
+		}
+		dir, ok := dirs[path]
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			// Removed or renamed by the extraction; a renamed folder shows up again
+			// through its parent
+			delete(dirs, path)
+			changed = changed || len(dir.files) > 0
+			continue
+		}
+		if info.ModTime().Equal(dir.modTime) && now.Sub(dir.changed) >= settle {
+			continue
+		}
+		dir.modTime = info.ModTime()
+		filesChanged, dirsAdded := p.listWatchedDir(dirs, path, dir, now)
+		if filesChanged {
+			dir.changed = now
+		}
+		changed = changed || filesChanged || dirsAdded
+	}
+	return changed
+}
+
+// addWatchedDir starts watching a folder and every folder below it, leaving out
+// folders of an interrupted extraction, and reports whether it was new
+func (p *Processor) addWatchedDir(dirs map[string]*watchedDir, path string, now time.Time) bool {
+	if _, ok := dirs[path]; ok || isPartialExtraction(path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	dir := &watchedDir{modTime: info.ModTime(), changed: now, files: make(map[string]watchedFile)}
+	dirs[path] = dir
+	p.listWatchedDir(dirs, path, dir, now)
+	return true
+}
+
+// listWatchedDir lists the media files of a folder and starts watching its new
+// subfolders. It reports whether one of the folder's media files appeared, changed or
+// went away, and whether a subfolder was added; a new subfolder settles on its own,
+// without holding up the files of this one.
+func (p *Processor) listWatchedDir(dirs map[string]*watchedDir, path string, dir *watchedDir, now time.Time) (bool, bool) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return false, false // Removed or renamed by the extraction since it was listed
+	}
+	files := make(map[string]watchedFile)
+	changed, added := false, false
+	for _, entry := range entries {
+		entryPath := filepath.Join(path, entry.Name())
+		if entry.IsDir() {
+			added = p.addWatchedDir(dirs, entryPath, now) || added
+			continue
+		}
+		if !isSupportedMediaFile(entryPath) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		file := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		if previous, ok := dir.files[entryPath]; !ok || previous != file {
+			changed = true
+		}
+		files[entryPath] = file
+	}
+	changed = changed || len(files) != len(dir.files)
+	dir.files = files
+	return changed, added
+}
+
+// processArrived scans and processes media files that have settled, as one run over a
+// file list
+func (p *Processor) processArrived(ctx context.Context, paths []string) {
+	p.plan, p.jobs, p.fileList, p.lookupTime = nil, nil, paths, 0
+	if _, err := p.Scan(ctx); err != nil {
+		fmt.Printf("[ERROR] %v\n", err)
+		return
+	}
+	p.runJobs(ctx, p.jobs)
+}
+
+// finishWatch records the wall time of a watch
+func (p *Processor) finishWatch(started time.Time) {
+	elapsed := time.Since(started)
+	p.update(func(s *Statistics) { s.Elapsed = elapsed })
+}
@@ -0,0 +1,52 @@
+package report
+
+import "sort"
+
+// StatusAbsent marks a file that does not appear in one of the compared reports
+const StatusAbsent = "absent"
+
+// Change is a file whose status differs between two reports
+type Change struct {
+	Path   string
+	Before string
+	After  string
+}
+
+// Diff lists the files whose status changed from report a to report b
+func Diff(a, b *Report) []Change {
+	before := make(map[string]string, len(a.Files))
+	for _, f := range a.Files {
+		before[f.Path] = f.Status
+	}
+	after := make(map[string]string, len(b.Files))
+	for _, f := range b.Files {
+		after[f.Path] = f.Status
+	}
+
+	var changes []Change
+	for path, status := range before {
+		next, ok := after[path]
+		if !ok {
+			next = StatusAbsent
+		}
+		if next != status {
+			changes = append(changes, Change{Path: path, Before: status, After: next})
+		}
+	}
+	for path, status := range after {
+		if _, ok := before[path]; !ok {
+			changes = append(changes, Change{Path: path, Before: StatusAbsent, After: status})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Before != changes[j].Before {
+			return changes[i].Before < changes[j].Before
+		}
+		if changes[i].After != changes[j].After {
+			return changes[i].After < changes[j].After
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
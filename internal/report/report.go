@@ -0,0 +1,235 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// Report is the JSON run report written with -report
+type Report struct {
+	GeneratedAt time.Time  `json:"generatedAt"`
+	RootDir     string     `json:"rootDir"`
+	DryRun      bool       `json:"dryRun"`
+	Summary     Summary    `json:"summary"`
+	Files       []File     `json:"files"`
+	Conflicts   []Conflict `json:"conflicts,omitempty"`
+	Index       *Index     `json:"archiveIndex,omitempty"`
+	Stages      []Stage    `json:"stages,omitempty"`
+	Duplicates  []DupFile  `json:"duplicates,omitempty"`     // With -pipeline dedupe
+	Failures    []string   `json:"verifyFailures,omitempty"` // With -pipeline verify
+	Slowest     []Timing   `json:"slowestFiles,omitempty"`   // Files that took longest, slowest first
+	Albums      []Album    `json:"incompleteAlbums,omitempty"`
+}
+
+// Album is an album folder holding fewer items than its album metadata lists
+type Album struct {
+	Folder   string   `json:"folder"`
+	Title    string   `json:"title,omitempty"`
+	Expected int      `json:"expected"`
+	Found    int      `json:"found"`
+	Missing  []string `json:"missing,omitempty"`
+}
+
+// Timing is the time one media file took to process
+type Timing struct {
+	Path    string  `json:"path"`
+	Size    int64   `json:"size"`
+	Seconds float64 `json:"seconds"`
+}
+
+// DupFile is a processed file with the same content as another, left out of the
+// reorganized library
+type DupFile struct {
+	Path     string `json:"path"`
+	Original string `json:"original"`
+}
+
+// Stage is the time and estimated IO volume of one run stage
+type Stage struct {
+	Name         string  `json:"name"`
+	Files        int     `json:"files"`
+	Seconds      float64 `json:"seconds"` // Wall time for scan and match, summed over workers otherwise
+	BytesRead    int64   `json:"bytesRead"`
+	BytesWritten int64   `json:"bytesWritten"`
+}
+
+// Index is the cross-check against the archive_browser.html export index
+type Index struct {
+	Path    string   `json:"path"`
+	Listed  int      `json:"listed"`
+	Found   int      `json:"found"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Summary holds the run's counters
+type Summary struct {
+	TotalFiles      int            `json:"totalFiles"` // mediaFiles + sidecarFiles + otherFiles
+	MediaFiles      int            `json:"mediaFiles"`
+	SidecarFiles    int            `json:"sidecarFiles"`
+	OtherFiles      int            `json:"otherFiles"`
+	JSONFiles       int            `json:"jsonFiles"`
+	NonMediaFiles   int            `json:"nonMediaFiles"` // Takeout's HTML/CSV indexes and other non-media files, ignored
+	ProcessedFiles  int            `json:"processedFiles"`
+	ModifiedFiles   int            `json:"modifiedFiles"`
+	UnmodifiedFiles int            `json:"unmodifiedFiles"`
+	SkippedFiles    int            `json:"skippedFiles"`
+	SkipReasons     map[string]int `json:"skipReasons,omitempty"` // Skipped files per reason
+	ErrorCount      int            `json:"errorCount"`
+	BytesChanged    int64          `json:"bytesChanged"`
+	MatchStrategies map[string]int `json:"matchStrategies,omitempty"` // Media files per sidecar match strategy
+	ElapsedSeconds  float64        `json:"elapsedSeconds"`
+}
+
+// File is the outcome for a single media file; paths are relative to RootDir
+type File struct {
+	Path         string      `json:"path"`
+	JSONPath     string      `json:"json,omitempty"`
+	Output       string      `json:"output,omitempty"` // Absolute path of the copy, with -output
+	Status       string      `json:"status"`
+	SkipReason   string      `json:"skipReason,omitempty"`
+	Message      string      `json:"message,omitempty"`
+	Changes      []TagChange `json:"changes,omitempty"`
+	BytesChanged int64       `json:"bytesChanged,omitempty"`
+	SHA256       string      `json:"sha256,omitempty"`   // Checksum after the run, with -checksums
+	Creation     string      `json:"creation,omitempty"` // Google Photos creation kind: collage, animation, effects, mix, ...
+}
+
+// TagChange is one tag written to a file; Old is omitted when the tag was absent or
+// could not be read, and equals New for files found up to date
+type TagChange struct {
+	Tag string `json:"tag"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new"`
+}
+
+// Conflict is a photo found in several merged exports with disagreeing sidecars
+type Conflict struct {
+	Path   string   `json:"path"`
+	Winner string   `json:"winner"`
+	Others []string `json:"others"`
+	Fields []string `json:"fields"`
+	Reason string   `json:"reason"`
+}
+
+// New builds a report from the processor statistics
+func New(rootDir string, dryRun bool, stats *processor.Statistics) *Report {
+	r := &Report{
+		GeneratedAt: time.Now().UTC(),
+		RootDir:     rootDir,
+		DryRun:      dryRun,
+		Summary: Summary{
+			TotalFiles:      stats.TotalFiles,
+			MediaFiles:      stats.MediaFiles,
+			SidecarFiles:    stats.SidecarFiles,
+			OtherFiles:      stats.OtherFiles,
+			JSONFiles:       stats.JSONFiles,
+			NonMediaFiles:   stats.NonMediaFiles,
+			ProcessedFiles:  stats.ProcessedFiles,
+			ModifiedFiles:   stats.ModifiedFiles,
+			UnmodifiedFiles: stats.UnmodifiedFiles,
+			SkippedFiles:    stats.SkippedFiles,
+			SkipReasons:     stats.SkipReasons,
+			ErrorCount:      stats.ErrorCount,
+			BytesChanged:    stats.BytesChanged,
+			MatchStrategies: stats.MatchStrategies,
+			ElapsedSeconds:  stats.Elapsed.Seconds(),
+		},
+		Files: make([]File, 0, len(stats.Files)),
+	}
+	for _, f := range stats.Files {
+		var changes []TagChange
+		for _, c := range f.Changes {
+			changes = append(changes, TagChange{Tag: c.Tag, Old: c.Old, New: c.New})
+		}
+		r.Files = append(r.Files, File{
+			Path:         relativePath(rootDir, f.Path),
+			JSONPath:     relativePath(rootDir, f.JSONPath),
+			Output:       f.Output,
+			Status:       f.Status,
+			SkipReason:   f.SkipReason,
+			Message:      f.Message,
+			Changes:      changes,
+			BytesChanged: f.BytesChanged,
+			SHA256:       f.SHA256,
+			Creation:     f.Creation,
+		})
+	}
+	for _, c := range stats.MergeConflicts {
+		conflict := Conflict{Path: c.Path, Winner: relativePath(rootDir, c.Winner), Fields: c.Fields, Reason: c.Reason}
+		for _, other := range c.Others {
+			conflict.Others = append(conflict.Others, relativePath(rootDir, other))
+		}
+		r.Conflicts = append(r.Conflicts, conflict)
+	}
+	if c := stats.IndexCheck; c != nil {
+		r.Index = &Index{Path: relativePath(rootDir, c.IndexPath), Listed: c.Listed, Found: c.Found, Missing: c.Missing}
+	}
+	for _, name := range processor.StageNames() {
+		if stage, ok := stats.Stages[name]; ok {
+			r.Stages = append(r.Stages, Stage{Name: name, Files: stage.Files, Seconds: stage.Duration.Seconds(),
+				BytesRead: stage.BytesRead, BytesWritten: stage.BytesWritten})
+		}
+	}
+	for _, d := range stats.Duplicates {
+		r.Duplicates = append(r.Duplicates, DupFile{Path: relativePath(rootDir, d.Path), Original: relativePath(rootDir, d.Original)})
+	}
+	r.Failures = stats.VerifyFailures
+	for _, t := range stats.SlowestFiles {
+		r.Slowest = append(r.Slowest, Timing{Path: relativePath(rootDir, t.Path), Size: t.Size, Seconds: t.Duration.Seconds()})
+	}
+	for _, a := range stats.IncompleteAlbums() {
+		r.Albums = append(r.Albums, Album{Folder: a.Folder, Title: a.Title, Expected: a.Expected, Found: a.Found, Missing: a.Missing})
+	}
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].Path < r.Files[j].Path })
+	return r
+}
+
+// Write saves the report as indented JSON
+func (r *Report) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// Load reads a report written by a previous run
+func Load(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal report %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// AbsPath resolves a path stored in the report against the report's root directory
+func (r *Report) AbsPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(r.RootDir, filepath.FromSlash(path))
+}
+
+func relativePath(rootDir, path string) string {
+	if path == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(rootDir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// WriteSHA256Sums writes a checksum manifest in the format of sha256sum(1) listing
+// every media file of the run that is under root after it: the copy for runs with
+// -output or -relocated, the file itself otherwise. Paths are relative to root, so
+// "sha256sum -c" run there checks the tree. Checksums recorded during the run, right
+// after each file was written or verified, are reused; the others are computed now.
+// It returns the number of files listed.
+func WriteSHA256Sums(path, root string, files []processor.FileResult) (int, error) {
+	sums := make(map[string]string)
+	for _, f := range files {
+		target := f.Path
+		if f.Output != "" {
+			target = f.Output
+		}
+		rel, err := filepath.Rel(root, target)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := sums[rel]; ok {
+			continue
+		}
+		if _, err := os.Stat(target); errors.Is(err, fs.ErrNotExist) {
+			continue // Moved away (partner items) or removed; not part of the tree
+		}
+		sum := f.SHA256
+		if sum == "" {
+			if sum, err = processor.FileChecksum(target); err != nil {
+				return 0, fmt.Errorf("failed to checksum %s: %w", target, err)
+			}
+		}
+		sums[rel] = sum
+	}
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create checksum manifest: %w", err)
+	}
+	w := bufio.NewWriter(out)
+	for _, name := range names {
+		// sha256sum escapes names with backslashes or line breaks and marks the line
+		escaped := name
+		if strings.ContainsAny(name, "\\\n") {
+			escaped = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(name)
+			w.WriteString("\\")
+		}
+		fmt.Fprintf(w, "%s  %s\n", sums[name], escaped)
+	}
+	err = w.Flush()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write checksum manifest: %w", err)
+	}
+	return len(names), nil
+}
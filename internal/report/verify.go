@@ -0,0 +1,51 @@
+package report
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+
+	"google-takeout-exif-applier/internal/processor"
+)
+
+// Verification results for a file whose checksum no longer matches the report
+const (
+	VerifyChanged = "changed" // Content differs from the recorded checksum
+	VerifyMissing = "missing" // File no longer exists
+)
+
+// Mismatch is a file that was modified or removed after the run that wrote the report
+type Mismatch struct {
+	Path   string
+	Result string
+	Err    error // Set when the file could not be read
+}
+
+// Verify checks every file with a recorded checksum against its current content; for
+// runs with -output that is the copy. It returns the mismatches and the number of
+// files checked.
+func Verify(r *Report) ([]Mismatch, int) {
+	var mismatches []Mismatch
+	checked := 0
+	for _, f := range r.Files {
+		if f.SHA256 == "" {
+			continue
+		}
+		checked++
+		path := r.AbsPath(f.Path)
+		if f.Output != "" {
+			path = f.Output
+		}
+		sum, err := processor.FileChecksum(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			mismatches = append(mismatches, Mismatch{Path: f.Path, Result: VerifyMissing})
+		case err != nil:
+			mismatches = append(mismatches, Mismatch{Path: f.Path, Result: VerifyChanged, Err: err})
+		case sum != f.SHA256:
+			mismatches = append(mismatches, Mismatch{Path: f.Path, Result: VerifyChanged})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Path < mismatches[j].Path })
+	return mismatches, checked
+}